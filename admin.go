@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const defaultJWTRoleClaim = "roles"
+
+// AdminConfig protects the debug and admin endpoints. DebugEndpoints turns
+// on /webhook/print, which echoes request bodies back and so is off by
+// default. When Password is set the debug endpoints require basic auth.
+//
+// The /admin API is enabled by a JWT signing key: JWTSecret for HMAC signed
+// tokens or JWTPublicKeyFile, a PEM RSA or ECDSA public key, for tokens
+// signed by an identity provider. Roles are read from the JWTRoleClaim
+// claim of the token. A token can be exchanged for a browser session
+// lasting up to SessionTTL.
+type AdminConfig struct {
+	DebugEndpoints bool   `yaml:"debug_endpoints"`
+	Username       string `yaml:"username"`
+	Password       string `yaml:"password"`
+
+	JWTSecret        string `yaml:"jwt_secret"`
+	JWTPublicKeyFile string `yaml:"jwt_public_key_file"`
+	JWTIssuer        string `yaml:"jwt_issuer"`
+	JWTAudience      string `yaml:"jwt_audience"`
+	JWTRoleClaim     string `yaml:"jwt_role_claim"`
+	SessionTTL       string `yaml:"session_ttl"`
+	sessionTTL       time.Duration
+
+	// jwtKey verifies token signatures: []byte, *rsa.PublicKey or
+	// *ecdsa.PublicKey
+	jwtKey interface{}
+}
+
+// loadJWTKey reads the key admin API tokens are verified with
+func (c *AdminConfig) loadJWTKey() error {
+	if c.JWTRoleClaim == "" {
+		c.JWTRoleClaim = defaultJWTRoleClaim
+	}
+
+	switch {
+	case c.JWTSecret != "" && c.JWTPublicKeyFile != "":
+		return errors.New("only one of ADMIN_JWT_SECRET and ADMIN_JWT_PUBLIC_KEY_FILE may be set")
+	case c.JWTSecret != "":
+		c.jwtKey = []byte(c.JWTSecret)
+	case c.JWTPublicKeyFile != "":
+		pem, err := os.ReadFile(c.JWTPublicKeyFile)
+		if err != nil {
+			return fmt.Errorf("error reading JWT public key: %w", err)
+		}
+		if key, err := jwt.ParseRSAPublicKeyFromPEM(pem); err == nil {
+			c.jwtKey = key
+		} else if key, err := jwt.ParseECPublicKeyFromPEM(pem); err == nil {
+			c.jwtKey = key
+		} else {
+			return fmt.Errorf("JWT public key %s is not a PEM RSA or ECDSA public key", c.JWTPublicKeyFile)
+		}
+	}
+	return nil
+}
+
+// adminAuth checks the basic auth credentials on the debug endpoints
+// against the current config, so a reload can change them
+func (w *WebhookHandler) adminAuth() echo.MiddlewareFunc {
+	return middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Skipper: func(echo.Context) bool {
+			return w.state.Load().admin.Password == ""
+		},
+		Validator: func(username, password string, c echo.Context) (bool, error) {
+			admin := w.state.Load().admin
+			valid := subtle.ConstantTimeCompare([]byte(username), []byte(admin.Username)) &
+				subtle.ConstantTimeCompare([]byte(password), []byte(admin.Password))
+			if valid != 1 {
+				log.Printf("Rejected admin request from %s: invalid credentials", c.Request().RemoteAddr)
+			}
+			return valid == 1, nil
+		},
+		Realm: "jenkins-webhook-discord",
+	})
+}
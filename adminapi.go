@@ -0,0 +1,269 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+// Admin API roles. Each role can do everything the roles before it can.
+const (
+	roleViewer   = "viewer"
+	roleOperator = "operator"
+	roleAdmin    = "admin"
+)
+
+var roleRanks = map[string]int{roleViewer: 1, roleOperator: 2, roleAdmin: 3}
+
+// adminClaimsKey holds the claims of the authenticated admin request
+const adminClaimsKey = "admin.claims"
+
+// registerAdminAPI adds the /admin and /api routes. They answer 404 until a
+// JWT signing key is configured.
+func (w *WebhookHandler) registerAdminAPI(e *echo.Echo, configPath, port string) {
+	admin := e.Group("/admin")
+	admin.POST("/session", w.handleCreateSession, w.requireRole(roleViewer))
+	admin.GET("/session", w.handleGetSession, w.requireRole(roleViewer))
+	admin.DELETE("/session", w.handleDeleteSession, w.requireRole(roleViewer))
+	admin.GET("/mutes", w.handleListMutes, w.requireRole(roleViewer))
+	admin.POST("/mutes", w.handleMute, w.requireRole(roleOperator))
+	admin.DELETE("/mutes/*", w.handleUnmute, w.requireRole(roleOperator))
+	admin.GET("/events", w.handleListEvents, w.requireRole(roleViewer))
+	admin.POST("/events/:id/replay", w.handleReplay, w.requireRole(roleOperator))
+	admin.GET("/audit", w.handleAudit, w.requireRole(roleViewer))
+	admin.GET("/breakers", w.handleListBreakers, w.requireRole(roleViewer))
+	admin.POST("/preview", w.handlePreview, w.requireRole(roleOperator))
+	admin.POST("/reload", func(c echo.Context) error {
+		if !w.reloadConfig(configPath, port) {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to reload config, see the server log"})
+		}
+		return c.JSON(http.StatusOK, map[string]string{"status": "reloaded"})
+	}, w.requireRole(roleAdmin))
+
+	api := e.Group("/api")
+	api.GET("/deliveries", w.handleListDeliveries, w.requireRole(roleViewer))
+}
+
+// requireRole checks the bearer token or session of admin API requests and
+// that it grants role
+func (w *WebhookHandler) requireRole(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			admin := w.state.Load().admin
+			if admin.jwtKey == nil {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "Admin API is not enabled"})
+			}
+
+			var claims jwt.MapClaims
+			var err error
+			if raw, ok := strings.CutPrefix(c.Request().Header.Get("Authorization"), "Bearer "); ok {
+				claims, err = admin.verifyToken(raw)
+			} else {
+				claims, err = w.sessionClaims(c)
+			}
+			if err != nil {
+				log.Printf("Rejected admin request from %s: %v", c.Request().RemoteAddr, err)
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+			}
+			if !hasRole(claims[admin.JWTRoleClaim], role) {
+				log.Printf("Rejected admin request by %v: %s role required", claims["sub"], role)
+				return c.JSON(http.StatusForbidden, map[string]string{"error": "Forbidden"})
+			}
+			c.Set(adminClaimsKey, claims)
+			return next(c)
+		}
+	}
+}
+
+// verifyToken checks the signature, expiry, issuer and audience of a token
+func (c AdminConfig) verifyToken(raw string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		// Only accept the algorithms of the configured key, so a token
+		// can't pick one that verifies with a public key as a secret
+		var ok bool
+		switch c.jwtKey.(type) {
+		case []byte:
+			_, ok = token.Method.(*jwt.SigningMethodHMAC)
+		case *rsa.PublicKey:
+			_, ok = token.Method.(*jwt.SigningMethodRSA)
+			if !ok {
+				_, ok = token.Method.(*jwt.SigningMethodRSAPSS)
+			}
+		case *ecdsa.PublicKey:
+			_, ok = token.Method.(*jwt.SigningMethodECDSA)
+		}
+		if !ok {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Header["alg"])
+		}
+		return c.jwtKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.New("token has no expiry")
+	}
+	if c.JWTIssuer != "" && !claims.VerifyIssuer(c.JWTIssuer, true) {
+		return nil, errors.New("invalid issuer")
+	}
+	if c.JWTAudience != "" && !claims.VerifyAudience(c.JWTAudience, true) {
+		return nil, errors.New("invalid audience")
+	}
+	return claims, nil
+}
+
+// hasRole reports whether the role claim, a list or a space separated
+// string of roles, grants role
+func hasRole(claim interface{}, role string) bool {
+	var roles []string
+	switch claim := claim.(type) {
+	case string:
+		roles = strings.Fields(claim)
+	case []interface{}:
+		for _, r := range claim {
+			if r, ok := r.(string); ok {
+				roles = append(roles, r)
+			}
+		}
+	}
+
+	for _, r := range roles {
+		if roleRanks[r] >= roleRanks[role] {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *WebhookHandler) handleListMutes(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{"mutes": w.mutes.list()})
+}
+
+// handleListBreakers lists the circuit breakers of the destinations that
+// failed since their last delivery
+func (w *WebhookHandler) handleListBreakers(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{"breakers": destinationBreakers.list()})
+}
+
+// handleMute mutes the jobs matching a pattern, for a duration when one is
+// given
+func (w *WebhookHandler) handleMute(c echo.Context) error {
+	var request struct {
+		Job      string `json:"job"`
+		Duration string `json:"duration"`
+		Reason   string `json:"reason"`
+	}
+	if err := c.Bind(&request); err != nil || request.Job == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "job is required"})
+	}
+
+	mute := jobMute{Job: request.Job, Reason: request.Reason}
+	if request.Duration != "" {
+		duration, err := time.ParseDuration(request.Duration)
+		if err != nil || duration <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid duration"})
+		}
+		mute.Until = time.Now().Add(duration)
+	}
+
+	w.mutes.set(mute)
+	log.Printf("Muted notifications for %s", mute.Job)
+	return c.JSON(http.StatusCreated, mute)
+}
+
+func (w *WebhookHandler) handleUnmute(c echo.Context) error {
+	job := c.Param("*")
+	if !w.mutes.remove(job) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Job is not muted"})
+	}
+	log.Printf("Unmuted notifications for %s", job)
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (w *WebhookHandler) handleListEvents(c echo.Context) error {
+	events := w.history.list()
+	// Counting the failure tags shows which kinds of failure are common
+	tags := make(map[string]int)
+	for _, event := range events {
+		for _, tag := range event.Tags {
+			tags[tag]++
+		}
+	}
+	if tag := c.QueryParam("tag"); tag != "" {
+		tagged := []deliveredEvent{}
+		for _, event := range events {
+			if containsString(event.Tags, tag) {
+				tagged = append(tagged, event)
+			}
+		}
+		events = tagged
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"events": events, "tags": tags})
+}
+
+// handleReplay sends a recorded event to the current destinations again,
+// as it was first delivered
+func (w *WebhookHandler) handleReplay(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid event ID"})
+	}
+	event, ok := w.history.get(id)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Unknown event"})
+	}
+
+	log.Printf("Replaying event %d: %s - %s - %s", id, event.Project, event.Build, event.Event)
+	results := notify(w.state.Load().destinations, event.build)
+	for _, r := range results {
+		if r.Error != "" {
+			log.Printf("Error sending to %s: %s", r.Destination, r.Error)
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"destinations": results})
+}
+
+// handleAudit returns the audit log entries matching the query parameters,
+// newest first
+func (w *WebhookHandler) handleAudit(c echo.Context) error {
+	filter := auditFilter{
+		Source:   c.QueryParam("source"),
+		ClientIP: c.QueryParam("client_ip"),
+		Auth:     c.QueryParam("auth"),
+		Outcome:  c.QueryParam("outcome"),
+		Limit:    100,
+	}
+	if since := c.QueryParam("since"); since != "" {
+		// Either a time or how long ago, such as 1h
+		if ago, err := time.ParseDuration(since); err == nil {
+			filter.Since = time.Now().Add(-ago)
+		} else if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid since"})
+		}
+	}
+	if limit := c.QueryParam("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid limit"})
+		}
+		filter.Limit = min(n, auditMemoryEntries)
+	}
+
+	entries, err := w.audit.query(filter)
+	if err != nil {
+		log.Printf("Error reading audit log: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to read audit log"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"entries": entries})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// tamperToken swaps the payload of a token, keeping its signature
+func tamperToken(token string, claims string) string {
+	parts := strings.Split(token, ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(claims))
+	return strings.Join(parts, ".")
+}
+
+func TestVerifyToken(t *testing.T) {
+	secret := []byte("secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	exp := time.Now().Add(time.Hour).Unix()
+	valid := jwt.MapClaims{"sub": "me", "exp": exp}
+	hmacConfig := AdminConfig{jwtKey: secret}
+	rsaConfig := AdminConfig{jwtKey: &rsaKey.PublicKey}
+
+	tests := []struct {
+		name  string
+		cfg   AdminConfig
+		token string
+		ok    bool
+	}{
+		{"HMAC", hmacConfig, signToken(t, jwt.SigningMethodHS256, secret, valid), true},
+		{"RSA", rsaConfig, signToken(t, jwt.SigningMethodRS256, rsaKey, valid), true},
+		{"RSA-PSS", rsaConfig, signToken(t, jwt.SigningMethodPS256, rsaKey, valid), true},
+		{"ECDSA", AdminConfig{jwtKey: &ecKey.PublicKey}, signToken(t, jwt.SigningMethodES256, ecKey, valid), true},
+		{"expired", hmacConfig, signToken(t, jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": "me", "exp": time.Now().Add(-time.Minute).Unix()}), false},
+		{"no expiry", hmacConfig, signToken(t, jwt.SigningMethodHS256, secret, jwt.MapClaims{"sub": "me"}), false},
+		{"wrong secret", hmacConfig, signToken(t, jwt.SigningMethodHS256, []byte("other"), valid), false},
+		{"tampered payload", hmacConfig, tamperToken(signToken(t, jwt.SigningMethodHS256, secret, valid), `{"sub":"me","roles":["admin"],"exp":9999999999}`), false},
+		{"none algorithm", hmacConfig, signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, valid), false},
+		{"HMAC signed with the RSA public key", rsaConfig, signToken(t, jwt.SigningMethodHS256, rsaPEM, valid), false},
+		{"RSA token for an HMAC key", hmacConfig, signToken(t, jwt.SigningMethodRS256, rsaKey, valid), false},
+		{"ECDSA token for an RSA key", rsaConfig, signToken(t, jwt.SigningMethodES256, ecKey, valid), false},
+		{"issuer", AdminConfig{jwtKey: secret, JWTIssuer: "idp"}, signToken(t, jwt.SigningMethodHS256, secret, jwt.MapClaims{"iss": "idp", "exp": exp}), true},
+		{"wrong issuer", AdminConfig{jwtKey: secret, JWTIssuer: "idp"}, signToken(t, jwt.SigningMethodHS256, secret, jwt.MapClaims{"iss": "other", "exp": exp}), false},
+		{"missing issuer", AdminConfig{jwtKey: secret, JWTIssuer: "idp"}, signToken(t, jwt.SigningMethodHS256, secret, valid), false},
+		{"audience", AdminConfig{jwtKey: secret, JWTAudience: "bridge"}, signToken(t, jwt.SigningMethodHS256, secret, jwt.MapClaims{"aud": "bridge", "exp": exp}), true},
+		{"wrong audience", AdminConfig{jwtKey: secret, JWTAudience: "bridge"}, signToken(t, jwt.SigningMethodHS256, secret, jwt.MapClaims{"aud": "other", "exp": exp}), false},
+		{"malformed", hmacConfig, "not.a.token", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.cfg.verifyToken(tt.token)
+			if ok := err == nil; ok != tt.ok {
+				t.Errorf("verifyToken() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		name  string
+		claim interface{}
+		role  string
+		want  bool
+	}{
+		{"list", []interface{}{"viewer"}, roleViewer, true},
+		{"higher role", []interface{}{"admin"}, roleOperator, true},
+		{"lower role", []interface{}{"viewer"}, roleOperator, false},
+		{"space separated", "viewer operator", roleOperator, true},
+		{"unknown role", []interface{}{"root"}, roleViewer, false},
+		{"non-string entries", []interface{}{3, true}, roleViewer, false},
+		{"missing", nil, roleViewer, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasRole(tt.claim, tt.role); got != tt.want {
+				t.Errorf("hasRole(%v, %s) = %v, want %v", tt.claim, tt.role, got, tt.want)
+			}
+		})
+	}
+}
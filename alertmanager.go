@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// AlertmanagerConfig configures the Alertmanager receiver. When Token is set,
+// requests must send it as "Authorization: Bearer <token>".
+type AlertmanagerConfig struct {
+	Token string `yaml:"token"`
+}
+
+// Alertmanager webhook payload structures (version 4)
+type AlertmanagerWebhook struct {
+	Status      string              `json:"status"`
+	Receiver    string              `json:"receiver"`
+	ExternalURL string              `json:"externalURL"`
+	Alerts      []AlertmanagerAlert `json:"alerts"`
+}
+
+type AlertmanagerAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+type alertmanagerSource struct {
+	cfg AlertmanagerConfig
+}
+
+func (s alertmanagerSource) Name() string {
+	return "alertmanager"
+}
+
+func (s alertmanagerSource) Detect(header http.Header, body []byte) bool {
+	return jsonHasKeys(body, "receiver", "alerts")
+}
+
+func (s alertmanagerSource) Verify(req *http.Request, body []byte) error {
+	if !s.cfg.verifyToken(req.Header.Get("Authorization")) {
+		return errInvalidToken
+	}
+	return nil
+}
+
+// Parse notifies each alert in the group on its own so it can be resolved
+// on its own
+func (s alertmanagerSource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	var payload AlertmanagerWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	builds := make([]BuildEvent, 0, len(payload.Alerts))
+	for _, alert := range payload.Alerts {
+		builds = append(builds, alert.toBuildEvent(payload.ExternalURL))
+	}
+	return builds, nil
+}
+
+// verifyToken checks the bearer token in the Authorization header
+func (c AlertmanagerConfig) verifyToken(header string) bool {
+	return verifyBearerToken(header, c.Token)
+}
+
+// toBuildEvent converts one alert into a BuildEvent. Firing alerts are
+// failures, or unstable for warning and info severities; resolved alerts
+// are successes.
+func (a AlertmanagerAlert) toBuildEvent(externalURL string) BuildEvent {
+	build := BuildEvent{
+		Source:      "alertmanager",
+		ProjectName: a.Labels["alertname"],
+		BuildName:   a.Labels["instance"],
+		BuildURL:    a.GeneratorURL,
+		Payload:     a,
+	}
+	if build.BuildName == "" {
+		build.BuildName = a.Labels["job"]
+	}
+	if build.BuildName == "" {
+		build.BuildName = a.Fingerprint
+	}
+	if build.BuildURL == "" {
+		build.BuildURL = externalURL
+	}
+	if !a.StartsAt.IsZero() {
+		// An alert that fires again starts again
+		build.RunID = a.Fingerprint + "@" + a.StartsAt.Format(time.RFC3339Nano)
+	}
+
+	severity := a.Labels["severity"]
+	switch {
+	case a.Status == "resolved":
+		build.Event = "success"
+		if !a.StartsAt.IsZero() && a.EndsAt.After(a.StartsAt) {
+			build.Duration = a.EndsAt.Sub(a.StartsAt)
+		}
+	case severity == "warning" || severity == "info":
+		build.Event = "unstable"
+	default:
+		build.Event = "failure"
+	}
+
+	if summary := a.Annotations["summary"]; summary != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Summary", Value: summary})
+	}
+	if description := a.Annotations["description"]; description != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Description", Value: description})
+	}
+
+	// Remaining labels are sorted so repeated notifications render the same
+	keys := make([]string, 0, len(a.Labels))
+	for key := range a.Labels {
+		if key != "alertname" && key != "instance" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		build.Vars = append(build.Vars, BuildVar{Key: key, Value: a.Labels[key]})
+	}
+
+	return build
+}
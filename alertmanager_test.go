@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const alertmanagerPayload = `{"version": "4", "status": "firing", "receiver": "bridge", "externalURL": "https://alertmanager.example.com",
+  "alerts": [
+    {"status": "firing", "labels": {"alertname": "HighLatency", "instance": "web-1", "severity": "critical", "team": "web"},
+     "annotations": {"summary": "p99 over 2s"}, "startsAt": "2024-05-01T10:00:00Z",
+     "generatorURL": "https://prometheus.example.com/graph", "fingerprint": "a1"},
+    {"status": "firing", "labels": {"alertname": "DiskFilling", "job": "node", "severity": "warning"},
+     "startsAt": "2024-05-01T10:00:00Z", "fingerprint": "b2"},
+    {"status": "resolved", "labels": {"alertname": "Down"}, "startsAt": "2024-05-01T10:00:00Z",
+     "endsAt": "2024-05-01T10:05:00Z", "fingerprint": "c3"}]}`
+
+func TestAlertmanagerParse(t *testing.T) {
+	if name := detectSource(t, http.Header{}, alertmanagerPayload); name != "alertmanager" {
+		t.Errorf("detected as %q, want alertmanager", name)
+	}
+	builds := parseBuilds(t, alertmanagerSource{}, http.Header{}, alertmanagerPayload)
+
+	want := []buildSummary{
+		{"HighLatency", "web-1", "https://prometheus.example.com/graph", "failure"},
+		{"DiskFilling", "node", "https://alertmanager.example.com", "unstable"},
+		{"Down", "c3", "https://alertmanager.example.com", "success"},
+	}
+	if got := summarize(builds); !reflect.DeepEqual(got, want) {
+		t.Fatalf("builds = %+v, want %+v", got, want)
+	}
+
+	wantVars := []BuildVar{
+		{Key: "Summary", Value: "p99 over 2s"},
+		{Key: "severity", Value: "critical"},
+		{Key: "team", Value: "web"},
+	}
+	if !reflect.DeepEqual(builds[0].Vars, wantVars) {
+		t.Errorf("vars = %+v, want %+v", builds[0].Vars, wantVars)
+	}
+	if builds[0].RunID != "a1@2024-05-01T10:00:00Z" {
+		t.Errorf("RunID = %q", builds[0].RunID)
+	}
+	if builds[2].Duration != 5*time.Minute {
+		t.Errorf("resolved alert duration = %v, want 5m", builds[2].Duration)
+	}
+}
+
+func TestAlertmanagerVerify(t *testing.T) {
+	src := alertmanagerSource{cfg: AlertmanagerConfig{Token: "secret"}}
+	for auth, ok := range map[string]bool{"Bearer secret": true, "Bearer other": false, "secret": false, "": false} {
+		req, _ := http.NewRequest(http.MethodPost, "/webhook/alertmanager", nil)
+		req.Header.Set("Authorization", auth)
+		if err := src.Verify(req, nil); (err == nil) != ok {
+			t.Errorf("Verify() with %q = %v, want ok %v", auth, err, ok)
+		}
+	}
+}
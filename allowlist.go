@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AllowlistConfig limits the addresses webhooks are accepted from. CIDRs
+// applies to every endpoint and Sources replaces it for single sources by
+// name. Behind a reverse proxy, list the proxy in TrustedProxies so the
+// client address is taken from X-Forwarded-For; the header is ignored on
+// requests from any other address, as anyone can send it.
+type AllowlistConfig struct {
+	CIDRs          []string            `yaml:"cidrs"`
+	Sources        map[string][]string `yaml:"sources"`
+	TrustedProxies []string            `yaml:"trusted_proxies"`
+
+	networks map[string][]*net.IPNet
+	clientIP echo.IPExtractor
+}
+
+// compile parses the address ranges, keyed by source with "" for CIDRs.
+// Single addresses are accepted as well as ranges.
+func (c *AllowlistConfig) compile() error {
+	c.networks = map[string][]*net.IPNet{}
+	if len(c.CIDRs) > 0 {
+		networks, err := parseCIDRs(c.CIDRs)
+		if err != nil {
+			return err
+		}
+		c.networks[""] = networks
+	}
+	for source, cidrs := range c.Sources {
+		if _, ok := sourceNames[source]; !ok {
+			return fmt.Errorf("unknown webhook source %q", source)
+		}
+		networks, err := parseCIDRs(cidrs)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		c.networks[source] = networks
+	}
+
+	proxies, err := parseCIDRs(c.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("trusted proxies: %w", err)
+	}
+	// Echo trusts private and loopback addresses unless told otherwise,
+	// which would let any host on the network claim to be the controller
+	trust := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range proxies {
+		trust = append(trust, echo.TrustIPRange(proxy))
+	}
+	c.clientIP = echo.ExtractIPFromXFFHeader(trust...)
+	return nil
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", cidr)
+			}
+			bits := 8 * len(ip)
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", cidr)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// allows reports whether the request to the named source comes from an
+// allowed address, returning the client address it checked
+func (c AllowlistConfig) allows(req *http.Request, source string) (string, bool) {
+	networks, ok := c.networks[source]
+	if !ok {
+		networks = c.networks[""]
+	}
+	if len(networks) == 0 {
+		return "", true
+	}
+
+	client := c.client(req)
+	ip := net.ParseIP(client)
+	if ip == nil {
+		return client, false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return client, true
+		}
+	}
+	return client, false
+}
+
+// client returns the address of the client that sent the request, read
+// from X-Forwarded-For when it came through a trusted proxy
+func (c AllowlistConfig) client(req *http.Request) string {
+	if c.clientIP == nil {
+		return echo.ExtractIPDirect()(req)
+	}
+	return c.clientIP(req)
+}
+
+// sourceCIDRsFromEnv reads the per-source WEBHOOK_ALLOWED_CIDRS_<SOURCE>
+// variables over the lists in the config file
+func sourceCIDRsFromEnv(env *environment, file map[string][]string) map[string][]string {
+	sources := make(map[string][]string, len(file))
+	for source, cidrs := range file {
+		sources[source] = cidrs
+	}
+	for source := range sourceNames {
+		if cidrs := env.list("WEBHOOK_ALLOWED_CIDRS_"+strings.ToUpper(source), nil); len(cidrs) > 0 {
+			sources[source] = cidrs
+		}
+	}
+	return sources
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowlistAllows(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        AllowlistConfig
+		source     string
+		remoteAddr string
+		xff        string
+		client     string
+		ok         bool
+	}{
+		{"allowed address", AllowlistConfig{CIDRs: []string{"203.0.113.0/24"}}, "jenkins", "203.0.113.5:1234", "", "203.0.113.5", true},
+		{"other address", AllowlistConfig{CIDRs: []string{"203.0.113.0/24"}}, "jenkins", "198.51.100.7:1234", "", "198.51.100.7", false},
+		{"single address", AllowlistConfig{CIDRs: []string{"203.0.113.5"}}, "jenkins", "203.0.113.5:1234", "", "203.0.113.5", true},
+		{"next to a single address", AllowlistConfig{CIDRs: []string{"203.0.113.5"}}, "jenkins", "203.0.113.6:1234", "", "203.0.113.6", false},
+		{"no allowlist", AllowlistConfig{}, "jenkins", "198.51.100.7:1234", "", "", true},
+		{"spoofed X-Forwarded-For", AllowlistConfig{CIDRs: []string{"203.0.113.0/24"}}, "jenkins", "198.51.100.7:1234", "203.0.113.5", "198.51.100.7", false},
+		{"spoofed X-Forwarded-For from a private address", AllowlistConfig{CIDRs: []string{"203.0.113.0/24"}}, "jenkins", "10.0.0.2:1234", "203.0.113.5", "10.0.0.2", false},
+		{"spoofed X-Forwarded-For from loopback", AllowlistConfig{CIDRs: []string{"203.0.113.0/24"}}, "jenkins", "127.0.0.1:1234", "203.0.113.5", "127.0.0.1", false},
+		{"X-Forwarded-For from a trusted proxy", AllowlistConfig{CIDRs: []string{"203.0.113.0/24"}, TrustedProxies: []string{"10.0.0.0/8"}}, "jenkins", "10.0.0.2:1234", "203.0.113.5", "203.0.113.5", true},
+		{"disallowed client behind a trusted proxy", AllowlistConfig{CIDRs: []string{"203.0.113.0/24"}, TrustedProxies: []string{"10.0.0.0/8"}}, "jenkins", "10.0.0.2:1234", "198.51.100.7", "198.51.100.7", false},
+		{"spoofed entry before a trusted proxy's", AllowlistConfig{CIDRs: []string{"203.0.113.0/24"}, TrustedProxies: []string{"10.0.0.0/8"}}, "jenkins", "10.0.0.2:1234", "203.0.113.5, 198.51.100.7", "198.51.100.7", false},
+		{"source override", AllowlistConfig{CIDRs: []string{"203.0.113.0/24"}, Sources: map[string][]string{"jenkins": {"198.51.100.0/24"}}}, "jenkins", "198.51.100.7:1234", "", "198.51.100.7", true},
+		{"default list with a source override", AllowlistConfig{CIDRs: []string{"203.0.113.0/24"}, Sources: map[string][]string{"jenkins": {"198.51.100.0/24"}}}, "jenkins", "203.0.113.5:1234", "", "203.0.113.5", false},
+		{"other source uses the default list", AllowlistConfig{CIDRs: []string{"203.0.113.0/24"}, Sources: map[string][]string{"jenkins": {"198.51.100.0/24"}}}, "gitlab", "203.0.113.5:1234", "", "203.0.113.5", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.compile(); err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("POST", "/webhook", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			client, ok := tt.cfg.allows(req, tt.source)
+			if ok != tt.ok {
+				t.Errorf("allows() = %v, want %v", ok, tt.ok)
+			}
+			if client != tt.client {
+				t.Errorf("allows() client = %q, want %q", client, tt.client)
+			}
+		})
+	}
+}
+
+func TestAllowlistCompile(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  AllowlistConfig
+		ok   bool
+	}{
+		{"CIDRs and addresses", AllowlistConfig{CIDRs: []string{"203.0.113.0/24", "2001:db8::1"}}, true},
+		{"invalid CIDR", AllowlistConfig{CIDRs: []string{"203.0.113.0/33"}}, false},
+		{"invalid address", AllowlistConfig{CIDRs: []string{"example.com"}}, false},
+		{"unknown source", AllowlistConfig{Sources: map[string][]string{"nope": {"203.0.113.0/24"}}}, false},
+		{"invalid trusted proxy", AllowlistConfig{TrustedProxies: []string{"proxy"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.compile()
+			if ok := err == nil; ok != tt.ok {
+				t.Errorf("compile() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
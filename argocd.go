@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// ArgoCDConfig configures the ArgoCD notification source. When Token is set,
+// requests must send it as "Authorization: Bearer <token>".
+type ArgoCDConfig struct {
+	Token string `yaml:"token"`
+}
+
+// ArgoCDWebhook is the body rendered by the ArgoCD notification template in
+// the README. ArgoCD webhooks have no fixed format, so every field is
+// optional except app.
+type ArgoCDWebhook struct {
+	App          string `json:"app"`
+	Project      string `json:"project"`
+	Revision     string `json:"revision"`
+	SyncStatus   string `json:"syncStatus"`
+	HealthStatus string `json:"healthStatus"`
+	Phase        string `json:"phase"`
+	Message      string `json:"message"`
+	URL          string `json:"url"`
+
+	// Timestamps are strings because the template renders them empty when
+	// the app has no sync operation
+	StartedAt  string `json:"startedAt"`
+	FinishedAt string `json:"finishedAt"`
+}
+
+type argocdSource struct {
+	cfg ArgoCDConfig
+}
+
+func (s argocdSource) Name() string {
+	return "argocd"
+}
+
+// Detect recognises the fields the README template always renders
+func (s argocdSource) Detect(header http.Header, body []byte) bool {
+	return jsonHasKeys(body, "app", "healthStatus")
+}
+
+func (s argocdSource) Verify(req *http.Request, body []byte) error {
+	if !s.cfg.verifyToken(req.Header.Get("Authorization")) {
+		return errInvalidToken
+	}
+	return nil
+}
+
+// Parse ignores progressing, missing and unknown states, which don't say
+// how the deployment went
+func (s argocdSource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	var payload ArgoCDWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return singleBuild(payload.toBuildEvent()), nil
+}
+
+// verifyToken checks the bearer token in the Authorization header
+func (c ArgoCDConfig) verifyToken(header string) bool {
+	return verifyBearerToken(header, c.Token)
+}
+
+// toBuildEvent converts an ArgoCD notification into a BuildEvent. The sync
+// operation phase decides the event when present, otherwise the app health.
+func (p ArgoCDWebhook) toBuildEvent() (BuildEvent, bool) {
+	if p.App == "" {
+		return BuildEvent{}, false
+	}
+
+	build := BuildEvent{
+		Source:      "argocd",
+		ProjectName: p.App,
+		BuildName:   "sync",
+		BuildURL:    p.URL,
+		Payload:     p,
+	}
+	if len(p.Revision) >= 8 {
+		build.BuildName = p.Revision[:8]
+	} else if p.Revision != "" {
+		build.BuildName = p.Revision
+	}
+	if p.StartedAt != "" {
+		// A sync operation is told apart by when it started
+		build.RunID = p.Revision + "@" + p.StartedAt
+	}
+
+	switch p.Phase {
+	case "Running":
+		build.Event = "started"
+	case "Succeeded":
+		build.Event = "success"
+		// A sync that applied cleanly can still leave the app unhealthy
+		if p.HealthStatus == "Degraded" {
+			build.Event = "unstable"
+		}
+	case "Failed", "Error":
+		build.Event = "failure"
+	case "Terminating":
+		build.Event = "aborted"
+	case "":
+		switch p.HealthStatus {
+		case "Healthy":
+			build.Event = "success"
+		case "Degraded":
+			build.Event = "failure"
+		case "Suspended":
+			build.Event = "aborted"
+		default:
+			return BuildEvent{}, false
+		}
+	default:
+		return BuildEvent{}, false
+	}
+	if build.Event != "started" {
+		started, err1 := time.Parse(time.RFC3339, p.StartedAt)
+		finished, err2 := time.Parse(time.RFC3339, p.FinishedAt)
+		if err1 == nil && err2 == nil && finished.After(started) {
+			build.Duration = finished.Sub(started)
+		}
+	}
+
+	if p.Project != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Project", Value: p.Project})
+	}
+	if p.SyncStatus != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Sync", Value: p.SyncStatus})
+	}
+	if p.HealthStatus != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Health", Value: p.HealthStatus})
+	}
+	if p.Message != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Message", Value: p.Message})
+	}
+
+	return build, true
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestArgoCDParse(t *testing.T) {
+	url := "https://argocd.example.com/applications/app"
+	tests := []struct {
+		name string
+		body string
+		want []buildSummary
+	}{
+		{
+			"sync running",
+			`{"app": "app", "revision": "0123456789abcdef", "phase": "Running", "healthStatus": "Progressing", "url": "` + url + `", "startedAt": "2026-10-14T12:00:00Z"}`,
+			[]buildSummary{{"app", "01234567", url, "started"}},
+		},
+		{
+			"synced but degraded",
+			`{"app": "app", "revision": "0123456789abcdef", "phase": "Succeeded", "healthStatus": "Degraded", "url": "` + url + `"}`,
+			[]buildSummary{{"app", "01234567", url, "unstable"}},
+		},
+		{
+			"health without a sync",
+			`{"app": "app", "phase": "", "healthStatus": "Healthy", "url": "` + url + `"}`,
+			[]buildSummary{{"app", "sync", url, "success"}},
+		},
+		{"progressing", `{"app": "app", "phase": "", "healthStatus": "Progressing"}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name := detectSource(t, http.Header{}, tt.body); name != "argocd" {
+				t.Errorf("detected as %q, want argocd", name)
+			}
+			builds := parseBuilds(t, argocdSource{}, http.Header{}, tt.body)
+			if got := summarize(builds); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("builds = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArgoCDSyncRun(t *testing.T) {
+	body := `{"app": "app", "revision": "abc", "phase": "Failed", "healthStatus": "Degraded", "startedAt": "2026-10-14T12:00:00Z", "finishedAt": "2026-10-14T12:00:45Z"}`
+	builds := parseBuilds(t, argocdSource{}, http.Header{}, body)
+	if build := builds[0]; build.RunID != "abc@2026-10-14T12:00:00Z" || build.Duration != 45*time.Second {
+		t.Errorf("run %q taking %v, want the sync told apart by its start and timed", build.RunID, build.Duration)
+	}
+}
+
+func TestArgoCDVerify(t *testing.T) {
+	src := argocdSource{cfg: ArgoCDConfig{Token: "secret"}}
+	for header, ok := range map[string]bool{"Bearer secret": true, "Bearer wrong": false, "secret": false, "": false} {
+		req, _ := http.NewRequest(http.MethodPost, "/webhook/argocd", nil)
+		req.Header.Set("Authorization", header)
+		if err := src.Verify(req, nil); (err == nil) != ok {
+			t.Errorf("Verify() with %q = %v, want ok %v", header, err, ok)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ArtifactoryConfig configures the JFrog Artifactory webhook source. When
+// Secret is set, X-JFrog-Event-Auth must carry either the secret itself or,
+// with payload signing enabled, its hex HMAC-SHA256 of the body.
+type ArtifactoryConfig struct {
+	Secret string `yaml:"secret"`
+}
+
+// Artifactory webhook payload structures
+type ArtifactoryWebhook struct {
+	Domain    string           `json:"domain"`
+	EventType string           `json:"event_type"`
+	Data      *ArtifactoryData `json:"data,omitempty"`
+	JPDOrigin string           `json:"jpd_origin"`
+	Source    string           `json:"source"`
+}
+
+type ArtifactoryData struct {
+	RepoKey   string `json:"repo_key"`
+	Path      string `json:"path"`
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	ImageName string `json:"image_name"`
+	Tag       string `json:"tag"`
+}
+
+type artifactorySource struct {
+	cfg ArtifactoryConfig
+}
+
+func (s artifactorySource) Name() string {
+	return "artifactory"
+}
+
+func (s artifactorySource) Detect(header http.Header, body []byte) bool {
+	return jsonHasKeys(body, "domain", "event_type")
+}
+
+func (s artifactorySource) Verify(req *http.Request, body []byte) error {
+	if !s.cfg.verifySignature(req.Header.Get("X-JFrog-Event-Auth"), body) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// signedAt reports requests as signed when a secret is configured. The
+// signature doesn't cover a send time.
+func (s artifactorySource) signedAt(header http.Header) (time.Time, bool) {
+	return time.Time{}, s.cfg.Secret != ""
+}
+
+// Parse ignores deletions, moves, property changes and build events
+func (s artifactorySource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	var payload ArtifactoryWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return singleBuild(payload.toBuildEvent()), nil
+}
+
+// verifySignature accepts the plain secret or the hex HMAC-SHA256 of the body
+func (c ArtifactoryConfig) verifySignature(header string, body []byte) bool {
+	if c.Secret == "" {
+		return true
+	}
+	if subtle.ConstantTimeCompare([]byte(header), []byte(c.Secret)) == 1 {
+		return true
+	}
+
+	decoded, err := hex.DecodeString(header)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.Secret))
+	mac.Write(body)
+	return hmac.Equal(decoded, mac.Sum(nil))
+}
+
+// toBuildEvent converts deployed artifacts and pushed Docker tags into a
+// successful BuildEvent, returning false for every other event
+func (p ArtifactoryWebhook) toBuildEvent() (BuildEvent, bool) {
+	data := p.Data
+	if data == nil {
+		return BuildEvent{}, false
+	}
+
+	build := BuildEvent{
+		Source:      "artifactory",
+		ProjectName: data.RepoKey,
+		Event:       "success",
+		Payload:     p,
+	}
+
+	switch {
+	case p.Domain == "artifact" && p.EventType == "deployed":
+		build.BuildName = data.Path
+	case p.Domain == "docker" && p.EventType == "pushed":
+		build.BuildName = data.ImageName + ":" + data.Tag
+	default:
+		return BuildEvent{}, false
+	}
+	if p.JPDOrigin != "" {
+		build.BuildURL = strings.TrimSuffix(p.JPDOrigin, "/") + "/artifactory/" + data.RepoKey + "/" + data.Path
+	}
+
+	if data.Size > 0 {
+		build.Vars = append(build.Vars, BuildVar{Key: "Size", Value: formatByteSize(data.Size)})
+	}
+	if len(data.SHA256) >= 12 {
+		build.Vars = append(build.Vars, BuildVar{Key: "SHA-256", Value: data.SHA256[:12]})
+	}
+	if p.Source != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Deployed by", Value: strings.TrimPrefix(p.Source, "jfrog/")})
+	}
+
+	return build, true
+}
+
+// formatByteSize renders a size in bytes with a binary unit, e.g. "1.5 MiB"
+func formatByteSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
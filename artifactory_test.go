@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestArtifactoryParse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []buildSummary
+	}{
+		{
+			"artifact deployed",
+			`{"domain": "artifact", "event_type": "deployed", "jpd_origin": "https://acme.jfrog.io/", "source": "jfrog/ana",
+			  "data": {"repo_key": "libs-release", "path": "com/acme/app/1.2.0/app-1.2.0.jar", "name": "app-1.2.0.jar",
+			  "size": 1572864, "sha256": "0123456789abcdef0123"}}`,
+			[]buildSummary{{"libs-release", "com/acme/app/1.2.0/app-1.2.0.jar", "https://acme.jfrog.io/artifactory/libs-release/com/acme/app/1.2.0/app-1.2.0.jar", "success"}},
+		},
+		{
+			"docker tag pushed",
+			`{"domain": "docker", "event_type": "pushed", "data": {"repo_key": "docker-local", "path": "app/1.2.0/manifest.json", "image_name": "app", "tag": "1.2.0"}}`,
+			[]buildSummary{{"docker-local", "app:1.2.0", "", "success"}},
+		},
+		{
+			"artifact deleted",
+			`{"domain": "artifact", "event_type": "deleted", "data": {"repo_key": "libs-release", "path": "app.jar"}}`,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name := detectSource(t, http.Header{}, tt.body); name != "artifactory" {
+				t.Errorf("detected as %q, want artifactory", name)
+			}
+			builds := parseBuilds(t, artifactorySource{}, http.Header{}, tt.body)
+			if got := summarize(builds); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("builds = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	builds := parseBuilds(t, artifactorySource{}, http.Header{}, tests[0].body)
+	want := []BuildVar{
+		{Key: "Size", Value: "1.5 MiB"},
+		{Key: "SHA-256", Value: "0123456789ab"},
+		{Key: "Deployed by", Value: "ana"},
+	}
+	if !reflect.DeepEqual(builds[0].Vars, want) {
+		t.Errorf("vars = %+v, want %+v", builds[0].Vars, want)
+	}
+}
+
+func TestArtifactoryVerify(t *testing.T) {
+	body := []byte(`{"domain": "artifact"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	src := artifactorySource{cfg: ArtifactoryConfig{Secret: "secret"}}
+
+	for auth, ok := range map[string]bool{"secret": true, hex.EncodeToString(mac.Sum(nil)): true, "other": false, "": false} {
+		req, _ := http.NewRequest(http.MethodPost, "/webhook/artifactory", nil)
+		req.Header.Set("X-JFrog-Event-Auth", auth)
+		if err := src.Verify(req, body); (err == nil) != ok {
+			t.Errorf("Verify() with %q = %v, want ok %v", auth, err, ok)
+		}
+	}
+}
+
+func TestFormatByteSize(t *testing.T) {
+	tests := map[int64]string{512: "512 B", 2048: "2.0 KiB", 1572864: "1.5 MiB", 3 << 30: "3.0 GiB"}
+	for size, want := range tests {
+		if got := formatByteSize(size); got != want {
+			t.Errorf("formatByteSize(%d) = %q, want %q", size, got, want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// maxArtifacts is the most artifacts a notification may list
+const maxArtifacts = 25
+
+// Artifact is a file a build archived
+type Artifact struct {
+	Name string
+	URL  string
+}
+
+// fetchArtifacts reads the artifacts of the build at buildURL from the
+// Jenkins API, returning up to limit of them and how many there are
+func (s jenkinsSource) fetchArtifacts(buildURL string, limit int) ([]Artifact, int, error) {
+	resp, err := s.apiGet(buildURL, "api/json?tree=artifacts[fileName,relativePath]")
+	if err != nil || resp == nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	var details struct {
+		Artifacts []struct {
+			FileName     string `json:"fileName"`
+			RelativePath string `json:"relativePath"`
+		} `json:"artifacts"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
+		return nil, 0, fmt.Errorf("error decoding artifacts: %w", err)
+	}
+
+	var artifacts []Artifact
+	for _, a := range details.Artifacts {
+		if len(artifacts) == limit {
+			break
+		}
+		artifacts = append(artifacts, Artifact{
+			Name: a.FileName,
+			URL:  strings.TrimSuffix(buildURL, "/") + "/artifact/" + escapePath(a.RelativePath),
+		})
+	}
+	return artifacts, len(details.Artifacts), nil
+}
+
+// escapePath escapes each segment of a slash separated path
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// addArtifacts adds the artifacts of a finished build. Errors are logged,
+// as the build is notified either way.
+func (s jenkinsSource) addArtifacts(build *BuildEvent, buildURL string) {
+	if s.artifacts <= 0 || build.Event == "started" {
+		return
+	}
+	artifacts, total, err := s.fetchArtifacts(buildURL, s.artifacts)
+	if err != nil {
+		log.Printf("Error fetching artifacts for %s %s: %v", build.ProjectName, build.BuildName, err)
+		return
+	}
+	build.Artifacts = artifacts
+	build.ArtifactCount = total
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultAuditRetention = 30 * 24 * time.Hour
+
+	// auditMemoryEntries caps the entries kept without an audit log file
+	auditMemoryEntries = 1000
+
+	auditContextKey = "audit"
+)
+
+// AuditConfig configures the audit log of webhook requests. Entries are
+// appended to File as JSON lines, or kept in memory when it isn't set, and
+// dropped once they are older than Retention.
+type AuditConfig struct {
+	File      string `yaml:"file"`
+	Retention string `yaml:"retention"`
+	retention time.Duration
+}
+
+func (c *AuditConfig) compile() error {
+	c.retention = defaultAuditRetention
+	if c.Retention == "" {
+		return nil
+	}
+	retention, err := time.ParseDuration(c.Retention)
+	if err != nil || retention <= 0 {
+		return fmt.Errorf("invalid AUDIT_LOG_RETENTION value: %s", c.Retention)
+	}
+	c.retention = retention
+	return nil
+}
+
+// auditEntry records one webhook request and what became of it
+type auditEntry struct {
+	Time     time.Time `json:"time"`
+	ClientIP string    `json:"client_ip"`
+	Endpoint string    `json:"endpoint"`
+	Source   string    `json:"source,omitempty"`
+	// Auth is "passed" or why the request was rejected, empty when it
+	// didn't get that far
+	Auth        string `json:"auth,omitempty"`
+	PayloadHash string `json:"payload_sha256,omitempty"`
+	Status      int    `json:"status"`
+	Outcome     string `json:"outcome"`
+}
+
+// auditRequest returns the audit entry of the request being handled, or a
+// throwaway one for requests that aren't audited
+func auditRequest(c echo.Context) *auditEntry {
+	if entry, ok := c.Get(auditContextKey).(*auditEntry); ok {
+		return entry
+	}
+	return &auditEntry{}
+}
+
+// setPayload records the hash of the request body
+func (e *auditEntry) setPayload(body []byte) {
+	sum := sha256.Sum256(body)
+	e.PayloadHash = hex.EncodeToString(sum[:])
+}
+
+// auditWebhooks records every request to the webhook endpoints once it
+// has been answered
+func (w *WebhookHandler) auditWebhooks(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !strings.HasPrefix(c.Path(), "/webhook") {
+			return next(c)
+		}
+
+		entry := &auditEntry{
+			Time:     time.Now().UTC(),
+			ClientIP: w.state.Load().allowlist.client(c.Request()),
+			Endpoint: c.Request().URL.Path,
+		}
+		c.Set(auditContextKey, entry)
+
+		err := next(c)
+		if err != nil {
+			// Let Echo write the error response so its status is recorded
+			c.Error(err)
+		}
+		entry.Status = c.Response().Status
+		if entry.Outcome == "" {
+			entry.Outcome = "accepted"
+			if entry.Status >= 400 {
+				entry.Outcome = "rejected"
+			}
+		}
+		w.audit.record(*entry)
+		return nil
+	}
+}
+
+// auditLog stores the audit entries
+type auditLog struct {
+	mu        sync.Mutex
+	path      string
+	file      *os.File
+	retention time.Duration
+	pruned    time.Time
+
+	// entries holds the log when there is no file
+	entries []auditEntry
+}
+
+func newAuditLog() *auditLog {
+	return &auditLog{retention: defaultAuditRetention}
+}
+
+// configure switches to the audit settings of a newly loaded config
+func (a *auditLog) configure(cfg AuditConfig) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.retention = cfg.retention
+	if cfg.File == a.path {
+		return nil
+	}
+	if a.file != nil {
+		a.file.Close()
+		a.file = nil
+	}
+	a.path = cfg.File
+	a.pruned = time.Time{}
+	if a.path == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(a.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		a.path = ""
+		return fmt.Errorf("error opening audit log: %w", err)
+	}
+	a.file = file
+	return nil
+}
+
+// record appends an entry, dropping expired ones now and then
+func (a *auditLog) record(entry auditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		a.entries = append(a.entries, entry)
+		if len(a.entries) > auditMemoryEntries {
+			a.entries = a.entries[len(a.entries)-auditMemoryEntries:]
+		}
+		cutoff := time.Now().Add(-a.retention)
+		expired := 0
+		for expired < len(a.entries) && a.entries[expired].Time.Before(cutoff) {
+			expired++
+		}
+		a.entries = a.entries[expired:]
+		return
+	}
+
+	line, err := json.Marshal(entry)
+	if err == nil {
+		_, err = a.file.Write(append(line, '\n'))
+	}
+	if err != nil {
+		log.Printf("Error writing audit log: %v", err)
+	}
+	if time.Since(a.pruned) > time.Hour {
+		a.pruned = time.Now()
+		if err := a.prune(); err != nil {
+			log.Printf("Error pruning audit log: %v", err)
+		}
+	}
+}
+
+// prune rewrites the audit log file without the expired entries
+func (a *auditLog) prune() error {
+	cutoff := time.Now().Add(-a.retention)
+	var kept []auditEntry
+	expired := false
+	if err := a.scan(func(entry auditEntry) {
+		if entry.Time.Before(cutoff) {
+			expired = true
+			return
+		}
+		kept = append(kept, entry)
+	}); err != nil {
+		return err
+	}
+	if !expired {
+		return nil
+	}
+
+	tmp := a.path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(out)
+	for _, entry := range kept {
+		if err := encoder.Encode(entry); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, a.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(a.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	a.file.Close()
+	a.file = file
+	return nil
+}
+
+// scan calls fn with every entry in the audit log file
+func (a *auditLog) scan(fn func(auditEntry)) error {
+	file, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry auditEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			fn(entry)
+		}
+	}
+	return scanner.Err()
+}
+
+// auditFilter selects audit entries; empty fields match everything
+type auditFilter struct {
+	Since    time.Time
+	Source   string
+	ClientIP string
+	Auth     string
+	Outcome  string
+	Limit    int
+}
+
+func (f auditFilter) matches(entry auditEntry) bool {
+	return !entry.Time.Before(f.Since) &&
+		(f.Source == "" || entry.Source == f.Source) &&
+		(f.ClientIP == "" || entry.ClientIP == f.ClientIP) &&
+		(f.Auth == "" || entry.Auth == f.Auth) &&
+		(f.Outcome == "" || entry.Outcome == f.Outcome)
+}
+
+// query returns the entries matching the filter, newest first
+func (a *auditLog) query(filter auditFilter) ([]auditEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var matched []auditEntry
+	collect := func(entry auditEntry) {
+		if filter.matches(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	if a.file == nil {
+		for _, entry := range a.entries {
+			collect(entry)
+		}
+	} else if err := a.scan(collect); err != nil {
+		return nil, err
+	}
+
+	entries := []auditEntry{}
+	for i := len(matched) - 1; i >= 0 && len(entries) < filter.Limit; i-- {
+		entries = append(entries, matched[i])
+	}
+	return entries, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultTokenHeader     = "X-Webhook-Token"
+	defaultTokenQueryParam = "token"
+)
+
+// AuthConfig requires a shared token on the webhook endpoints, on top of
+// any signature the source itself sends. Tokens sets the token of single
+// sources by name and Token applies to the others. The token is read from
+// Header, or from QueryParam for senders such as the Jenkins Notification
+// plugin that can only be given a URL.
+type AuthConfig struct {
+	Token      string            `yaml:"token"`
+	Tokens     map[string]string `yaml:"tokens"`
+	Header     string            `yaml:"header"`
+	QueryParam string            `yaml:"query_param"`
+}
+
+// token returns the token the named source's requests must carry, or ""
+func (c AuthConfig) token(source string) string {
+	if token, ok := c.Tokens[source]; ok {
+		return token
+	}
+	return c.Token
+}
+
+// verify checks the webhook token of a request to the named source
+func (c AuthConfig) verify(req *http.Request, source string) bool {
+	token := c.token(source)
+	if token == "" {
+		return true
+	}
+
+	got := req.Header.Get(c.Header)
+	if got == "" {
+		got = req.URL.Query().Get(c.QueryParam)
+	}
+	return got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// sourceTokensFromEnv reads the per-source WEBHOOK_TOKEN_<SOURCE> variables
+// over the tokens in the config file
+func sourceTokensFromEnv(env *environment, file map[string]string) map[string]string {
+	tokens := make(map[string]string, len(file))
+	for source, token := range file {
+		tokens[source] = token
+	}
+	for source := range sourceNames {
+		if token := env.lookup("WEBHOOK_TOKEN_" + strings.ToUpper(source)); token != "" {
+			tokens[source] = token
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AzureDevOpsConfig configures the Azure DevOps service hook source. When
+// Username is set, requests must use basic authentication with these
+// credentials, as configured on the service hook subscription.
+type AzureDevOpsConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Azure DevOps service hook payload structures. Build and release events
+// share the envelope and differ in the shape of resource.
+type AzureDevOpsWebhook struct {
+	EventType string               `json:"eventType"`
+	Resource  *AzureDevOpsResource `json:"resource,omitempty"`
+}
+
+type AzureDevOpsResource struct {
+	// build.complete
+	BuildNumber   string              `json:"buildNumber,omitempty"`
+	Result        string              `json:"result,omitempty"`
+	StartTime     time.Time           `json:"startTime"`
+	FinishTime    time.Time           `json:"finishTime"`
+	SourceBranch  string              `json:"sourceBranch,omitempty"`
+	SourceVersion string              `json:"sourceVersion,omitempty"`
+	Definition    *AzureDevOpsNamed   `json:"definition,omitempty"`
+	RequestedFor  *AzureDevOpsUser    `json:"requestedFor,omitempty"`
+	Links         *AzureDevOpsLinks   `json:"_links,omitempty"`
+	Project       *AzureDevOpsNamed   `json:"project,omitempty"`
+	Environment   *AzureDevOpsEnv     `json:"environment,omitempty"`
+	Release       *AzureDevOpsRelease `json:"release,omitempty"`
+}
+
+type AzureDevOpsNamed struct {
+	Name string `json:"name"`
+}
+
+type AzureDevOpsUser struct {
+	DisplayName string `json:"displayName"`
+}
+
+type AzureDevOpsLinks struct {
+	Web struct {
+		Href string `json:"href"`
+	} `json:"web"`
+}
+
+type AzureDevOpsEnv struct {
+	Name              string            `json:"name"`
+	Status            string            `json:"status"`
+	ReleaseDefinition *AzureDevOpsNamed `json:"releaseDefinition,omitempty"`
+}
+
+type AzureDevOpsRelease struct {
+	Name              string            `json:"name"`
+	ReleaseDefinition *AzureDevOpsNamed `json:"releaseDefinition,omitempty"`
+	Links             *AzureDevOpsLinks `json:"_links,omitempty"`
+}
+
+type azureDevOpsSource struct {
+	cfg AzureDevOpsConfig
+}
+
+func (s azureDevOpsSource) Name() string {
+	return "azuredevops"
+}
+
+func (s azureDevOpsSource) Detect(header http.Header, body []byte) bool {
+	return jsonHasKeys(body, "eventType", "publisherId")
+}
+
+func (s azureDevOpsSource) Verify(req *http.Request, body []byte) error {
+	username, password, _ := req.BasicAuth()
+	if !s.cfg.verifyCredentials(username, password) {
+		return errors.New("invalid credentials")
+	}
+	return nil
+}
+
+func (s azureDevOpsSource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	var payload AzureDevOpsWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return singleBuild(payload.toBuildEvent()), nil
+}
+
+// verifyCredentials compares the basic auth credentials in constant time
+func (c AzureDevOpsConfig) verifyCredentials(username, password string) bool {
+	if c.Username == "" {
+		return true
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(c.Username)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(password), []byte(c.Password)) == 1
+	return userOK && passOK
+}
+
+// azureDevOpsEvent maps a build result or deployment status to an event
+func azureDevOpsEvent(result string) string {
+	switch result {
+	case "succeeded":
+		return "success"
+	case "partiallySucceeded":
+		return "unstable"
+	case "failed", "rejected":
+		return "failure"
+	case "canceled":
+		return "aborted"
+	default:
+		return ""
+	}
+}
+
+// toBuildEvent converts build.complete and deployment-completed hooks into a
+// BuildEvent, returning false for any other event type
+func (p AzureDevOpsWebhook) toBuildEvent() (BuildEvent, bool) {
+	r := p.Resource
+	if r == nil {
+		return BuildEvent{}, false
+	}
+
+	build := BuildEvent{
+		Source:  "azuredevops",
+		Payload: p,
+	}
+
+	switch p.EventType {
+	case "build.complete":
+		if r.Definition == nil {
+			return BuildEvent{}, false
+		}
+		build.ProjectName = r.Definition.Name
+		build.BuildName = r.BuildNumber
+		build.Event = azureDevOpsEvent(r.Result)
+		if r.Links != nil {
+			build.BuildURL = r.Links.Web.Href
+		}
+		if !r.StartTime.IsZero() && r.FinishTime.After(r.StartTime) {
+			build.Duration = r.FinishTime.Sub(r.StartTime)
+		}
+
+		if r.Project != nil {
+			build.Vars = append(build.Vars, BuildVar{Key: "Project", Value: r.Project.Name})
+		}
+		if r.SourceBranch != "" {
+			build.Vars = append(build.Vars, BuildVar{Key: "Branch", Value: strings.TrimPrefix(r.SourceBranch, "refs/heads/")})
+		}
+		if len(r.SourceVersion) >= 8 {
+			build.Vars = append(build.Vars, BuildVar{Key: "Commit", Value: r.SourceVersion[:8]})
+		}
+		if r.RequestedFor != nil && r.RequestedFor.DisplayName != "" {
+			build.Vars = append(build.Vars, BuildVar{Key: "Requested by", Value: r.RequestedFor.DisplayName})
+		}
+	case "ms.vss-release.deployment-completed-event":
+		if r.Environment == nil || r.Release == nil {
+			return BuildEvent{}, false
+		}
+		definition := r.Release.ReleaseDefinition
+		if definition == nil {
+			definition = r.Environment.ReleaseDefinition
+		}
+		if definition != nil {
+			build.ProjectName = definition.Name
+		}
+		build.BuildName = r.Release.Name
+		build.Event = azureDevOpsEvent(r.Environment.Status)
+		if r.Release.Links != nil {
+			build.BuildURL = r.Release.Links.Web.Href
+		}
+
+		build.Vars = append(build.Vars, BuildVar{Key: "Environment", Value: r.Environment.Name})
+		if r.Project != nil {
+			build.Vars = append(build.Vars, BuildVar{Key: "Project", Value: r.Project.Name})
+		}
+	default:
+		return BuildEvent{}, false
+	}
+
+	if build.Event == "" {
+		return BuildEvent{}, false
+	}
+	return build, true
+}
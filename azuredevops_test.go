@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestAzureDevOpsParse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []buildSummary
+	}{
+		{
+			"partially succeeded build",
+			`{"eventType": "build.complete", "publisherId": "tfs", "resource": {"buildNumber": "20261014.1", "result": "partiallySucceeded",
+			  "definition": {"name": "app-ci"}, "sourceBranch": "refs/heads/main", "_links": {"web": {"href": "https://dev.azure.com/org/p/_build/results?buildId=1"}}}}`,
+			[]buildSummary{{"app-ci", "20261014.1", "https://dev.azure.com/org/p/_build/results?buildId=1", "unstable"}},
+		},
+		{
+			"rejected deployment",
+			`{"eventType": "ms.vss-release.deployment-completed-event", "publisherId": "rm", "resource": {"environment": {"name": "prod", "status": "rejected"},
+			  "release": {"name": "Release-3", "releaseDefinition": {"name": "app-cd"}, "_links": {"web": {"href": "https://dev.azure.com/org/p/_release?releaseId=3"}}}}}`,
+			[]buildSummary{{"app-cd", "Release-3", "https://dev.azure.com/org/p/_release?releaseId=3", "failure"}},
+		},
+		{
+			"build still running",
+			`{"eventType": "build.complete", "publisherId": "tfs", "resource": {"buildNumber": "1", "result": "inProgress", "definition": {"name": "app-ci"}}}`,
+			nil,
+		},
+		{"work item", `{"eventType": "workitem.updated", "publisherId": "tfs", "resource": {}}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name := detectSource(t, http.Header{}, tt.body); name != "azuredevops" {
+				t.Errorf("detected as %q, want azuredevops", name)
+			}
+			builds := parseBuilds(t, azureDevOpsSource{}, http.Header{}, tt.body)
+			if got := summarize(builds); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("builds = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAzureDevOpsVerify(t *testing.T) {
+	src := azureDevOpsSource{cfg: AzureDevOpsConfig{Username: "hook", Password: "secret"}}
+	tests := []struct {
+		name, username, password string
+		ok                       bool
+	}{
+		{"valid", "hook", "secret", true},
+		{"wrong password", "hook", "guess", false},
+		{"wrong user", "other", "secret", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/webhook/azuredevops", nil)
+			req.SetBasicAuth(tt.username, tt.password)
+			if err := src.Verify(req, nil); (err == nil) != tt.ok {
+				t.Errorf("Verify() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
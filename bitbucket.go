@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// BitbucketConfig configures the Bitbucket webhook source. When Secret is
+// set, requests must carry a matching HMAC-SHA256 in X-Hub-Signature.
+type BitbucketConfig struct {
+	Secret string `yaml:"secret"`
+}
+
+// Bitbucket commit status webhook payload structures. Pipelines report
+// progress through repo:commit_status_created and repo:commit_status_updated.
+type BitbucketWebhook struct {
+	CommitStatus *BitbucketCommitStatus `json:"commit_status,omitempty"`
+	Repository   *BitbucketRepository   `json:"repository,omitempty"`
+}
+
+type BitbucketCommitStatus struct {
+	Name      string           `json:"name"`
+	State     string           `json:"state"`
+	URL       string           `json:"url"`
+	Type      string           `json:"type"`
+	RefName   string           `json:"refname"`
+	CreatedOn time.Time        `json:"created_on"`
+	UpdatedOn time.Time        `json:"updated_on"`
+	Commit    *BitbucketCommit `json:"commit,omitempty"`
+}
+
+type BitbucketCommit struct {
+	Hash    string `json:"hash"`
+	Message string `json:"message"`
+	Author  *struct {
+		Raw  string         `json:"raw"`
+		User *BitbucketUser `json:"user,omitempty"`
+	} `json:"author,omitempty"`
+}
+
+type BitbucketRepository struct {
+	FullName string `json:"full_name"`
+}
+
+type BitbucketUser struct {
+	DisplayName string `json:"display_name"`
+}
+
+type bitbucketSource struct {
+	cfg BitbucketConfig
+}
+
+func (s bitbucketSource) Name() string {
+	return "bitbucket"
+}
+
+func (s bitbucketSource) Detect(header http.Header, body []byte) bool {
+	return strings.HasPrefix(header.Get("X-Event-Key"), "repo:")
+}
+
+func (s bitbucketSource) Verify(req *http.Request, body []byte) error {
+	if !s.cfg.verifySignature(req.Header.Get("X-Hub-Signature"), body) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// signedAt reports requests as signed when a secret is configured. The
+// signature doesn't cover a send time.
+func (s bitbucketSource) signedAt(header http.Header) (time.Time, bool) {
+	return time.Time{}, s.cfg.Secret != ""
+}
+
+// Parse ignores pushes, pull requests and the other repository events that
+// share the webhook
+func (s bitbucketSource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	var payload BitbucketWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return singleBuild(payload.toBuildEvent()), nil
+}
+
+// verifySignature checks the X-Hub-Signature header, "sha256=<hex hmac>"
+func (c BitbucketConfig) verifySignature(header string, body []byte) bool {
+	if c.Secret == "" {
+		return true
+	}
+
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	decoded, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.Secret))
+	mac.Write(body)
+	return hmac.Equal(decoded, mac.Sum(nil))
+}
+
+// toBuildEvent converts a commit status webhook into a BuildEvent, returning
+// false for other webhook events and unknown states
+func (p BitbucketWebhook) toBuildEvent() (BuildEvent, bool) {
+	status := p.CommitStatus
+	if status == nil || p.Repository == nil || status.Type != "build" {
+		return BuildEvent{}, false
+	}
+
+	build := BuildEvent{
+		Source:      "bitbucket",
+		ProjectName: p.Repository.FullName,
+		BuildName:   status.Name,
+		BuildURL:    status.URL,
+		Payload:     p,
+	}
+
+	switch status.State {
+	case "INPROGRESS":
+		build.Event = "started"
+	case "SUCCESSFUL":
+		build.Event = "success"
+	case "FAILED":
+		build.Event = "failure"
+	case "STOPPED":
+		build.Event = "aborted"
+	default:
+		return BuildEvent{}, false
+	}
+	if build.Event != "started" && status.UpdatedOn.After(status.CreatedOn) && !status.CreatedOn.IsZero() {
+		build.Duration = status.UpdatedOn.Sub(status.CreatedOn)
+	}
+
+	if status.RefName != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Branch", Value: status.RefName})
+	}
+	if commit := status.Commit; commit != nil {
+		if len(commit.Hash) >= 8 {
+			build.Vars = append(build.Vars, BuildVar{Key: "Commit", Value: commit.Hash[:8]})
+		}
+		if message, _, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n"); message != "" {
+			build.Vars = append(build.Vars, BuildVar{Key: "Message", Value: message})
+		}
+		if author := commit.Author; author != nil {
+			name := author.Raw
+			if author.User != nil && author.User.DisplayName != "" {
+				name = author.User.DisplayName
+			}
+			if name != "" {
+				build.Vars = append(build.Vars, BuildVar{Key: "Author", Value: name})
+			}
+		}
+	}
+
+	return build, true
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBitbucketParse(t *testing.T) {
+	header := http.Header{"X-Event-Key": {"repo:commit_status_updated"}}
+	status := func(state, kind string) string {
+		return `{"repository": {"full_name": "team/app"}, "commit_status": {"name": "Pipeline #5", "state": "` + state + `", "type": "` + kind + `",
+		  "url": "https://bitbucket.org/team/app/pipelines/results/5", "created_on": "2026-10-14T12:00:00Z", "updated_on": "2026-10-14T12:02:00Z",
+		  "commit": {"hash": "0123456789abcdef", "author": {"raw": "Dev <dev@example.com>", "user": {"display_name": "Dev"}}}}}`
+	}
+	tests := []struct {
+		name string
+		body string
+		want []buildSummary
+	}{
+		{"in progress", status("INPROGRESS", "build"), []buildSummary{{"team/app", "Pipeline #5", "https://bitbucket.org/team/app/pipelines/results/5", "started"}}},
+		{"failed", status("FAILED", "build"), []buildSummary{{"team/app", "Pipeline #5", "https://bitbucket.org/team/app/pipelines/results/5", "failure"}}},
+		{"not a build", status("FAILED", "deployment"), nil},
+		{"push", `{"repository": {"full_name": "team/app"}, "push": {}}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name := detectSource(t, header, tt.body); name != "bitbucket" {
+				t.Errorf("detected as %q, want bitbucket", name)
+			}
+			builds := parseBuilds(t, bitbucketSource{}, header, tt.body)
+			if got := summarize(builds); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("builds = %+v, want %+v", got, tt.want)
+			}
+			if tt.name == "failed" {
+				if builds[0].Duration != 2*time.Minute {
+					t.Errorf("duration = %v, want 2m", builds[0].Duration)
+				}
+				if author, _ := builds[0].variable("Author"); author != "Dev" {
+					t.Errorf("author = %q, want the display name", author)
+				}
+			}
+		})
+	}
+}
+
+func TestBitbucketVerify(t *testing.T) {
+	body := []byte(`{"repository": {}}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	valid := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name, header string
+		ok           bool
+	}{
+		{"valid", valid, true},
+		{"no prefix", valid[len("sha256="):], false},
+		{"wrong", "sha256=" + hex.EncodeToString(make([]byte, 32)), false},
+		{"missing", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/webhook/bitbucket", nil)
+			req.Header.Set("X-Hub-Signature", tt.header)
+			err := bitbucketSource{cfg: BitbucketConfig{Secret: "secret"}}.Verify(req, body)
+			if (err == nil) != tt.ok {
+				t.Errorf("Verify() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
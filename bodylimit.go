@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// defaultMaxBodySize matches the default client_max_body_size of nginx, so
+// payloads that made it through a proxy in front of the server fit
+const defaultMaxBodySize = "1M"
+
+// parseByteSize parses a size such as 512K, 1M or 1048576, with an
+// optional B suffix
+func parseByteSize(value string) (int64, error) {
+	size := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	multiplier := int64(1)
+	if n := len(size); n > 0 {
+		switch size[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			size = size[:n-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n <= 0 || n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n * multiplier, nil
+}
+
+// limitBody caps the size of request bodies at the configured maximum, so
+// oversized payloads are rejected while they are read instead of being
+// buffered whole
+func (w *WebhookHandler) limitBody(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		limit := w.state.Load().maxBodySize
+		req := c.Request()
+		if req.ContentLength > limit {
+			return bodyTooLarge(c, limit)
+		}
+		req.Body = http.MaxBytesReader(c.Response(), req.Body, limit)
+		return next(c)
+	}
+}
+
+// readError answers a request whose body couldn't be read, with 413 when
+// it is over the size limit
+func readError(c echo.Context, err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return bodyTooLarge(c, tooLarge.Limit)
+	}
+	log.Printf("Error reading request body: %v", err)
+	return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to read request body"})
+}
+
+func bodyTooLarge(c echo.Context, limit int64) error {
+	log.Printf("Rejected request from %s: body over %d bytes", c.Request().RemoteAddr, limit)
+	auditRequest(c).Outcome = "too_large"
+	return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "Request body too large"})
+}
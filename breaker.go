@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Defaults of the destination circuit breakers
+const (
+	defaultBreakerFailures = 5
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+// BreakerConfig opens the circuit of a destination after Failures failed
+// deliveries in a row: events skip it, failing right away, until Cooldown
+// has passed. Then one event is let through as a probe, which closes the
+// circuit when it is delivered and opens it again otherwise. Failures of
+// -1 disables the breakers.
+type BreakerConfig struct {
+	Failures int    `yaml:"failures"`
+	Cooldown string `yaml:"cooldown"`
+	cooldown time.Duration
+}
+
+func (c *BreakerConfig) compile() error {
+	if c.Failures < -1 {
+		return fmt.Errorf("invalid BREAKER_FAILURES value: %d", c.Failures)
+	}
+	if c.Failures == 0 {
+		c.Failures = defaultBreakerFailures
+	}
+	c.cooldown = defaultBreakerCooldown
+	if c.Cooldown != "" {
+		cooldown, err := time.ParseDuration(c.Cooldown)
+		if err != nil || cooldown <= 0 {
+			return fmt.Errorf("invalid BREAKER_COOLDOWN value: %s", c.Cooldown)
+		}
+		c.cooldown = cooldown
+	}
+	return nil
+}
+
+// errCircuitOpen is returned for events that skipped a destination whose
+// circuit is open
+var errCircuitOpen = errors.New("circuit open, destination skipped")
+
+// circuit is the breaker state of one destination
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+	lastError string
+}
+
+// destinationBreakers holds the circuits of the destinations by
+// circuitName. They outlive config reloads, which create new destinations.
+var destinationBreakers = newBreakers()
+
+type breakers struct {
+	mu       sync.Mutex
+	cfg      BreakerConfig
+	circuits map[string]*circuit
+}
+
+func newBreakers() *breakers {
+	return &breakers{
+		cfg:      BreakerConfig{Failures: defaultBreakerFailures, cooldown: defaultBreakerCooldown},
+		circuits: make(map[string]*circuit),
+	}
+}
+
+// configure switches to the breaker settings of a newly loaded config
+func (b *breakers) configure(cfg BreakerConfig) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cfg = cfg
+}
+
+// targeted is implemented by destinations that post each build to one of
+// several targets, each with a circuit of its own
+type targeted interface {
+	// circuitTarget names the target of the build
+	circuitTarget(build BuildEvent) string
+}
+
+// circuitName names the circuit the build's delivery to d goes through:
+// the destination's ID, followed by the build's target for destinations
+// with several, so one that is down doesn't stop the others
+func circuitName(d Destination, build BuildEvent) string {
+	if t, ok := d.(targeted); ok {
+		if target := t.circuitTarget(build); target != "" {
+			return d.ID() + "/" + target
+		}
+	}
+	return d.ID()
+}
+
+// call runs send unless the destination's circuit is open, recording how
+// it went
+func (b *breakers) call(destination string, send func() error) error {
+	if !b.allow(destination) {
+		return errCircuitOpen
+	}
+	err := send()
+	b.record(destination, err)
+	return err
+}
+
+// allow reports whether an event may be sent to the destination: when its
+// circuit is closed, or it is the probe of an open circuit that cooled down
+func (b *breakers) allow(destination string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[destination]
+	if !ok || b.cfg.Failures < 0 || c.failures < b.cfg.Failures {
+		return true
+	}
+	if c.probing || time.Now().Before(c.openUntil) {
+		return false
+	}
+	c.probing = true
+	return true
+}
+
+// record counts a failed delivery towards opening the circuit, or closes it
+// after a successful one. Destinations that rejected the event work, so
+// those failures don't count.
+func (b *breakers) record(destination string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[destination]
+	if err == nil || permanent(err) {
+		if ok && c.failures >= b.cfg.Failures && b.cfg.Failures > 0 {
+			log.Printf("Circuit of %s closed", destination)
+		}
+		delete(b.circuits, destination)
+		return
+	}
+	if !ok {
+		c = &circuit{}
+		b.circuits[destination] = c
+	}
+	c.failures++
+	c.lastError = err.Error()
+	c.probing = false
+	if b.cfg.Failures > 0 && c.failures >= b.cfg.Failures {
+		c.openUntil = time.Now().Add(b.cfg.cooldown)
+		log.Printf("Circuit of %s open for %v after %d failed deliveries: %v", destination, b.cfg.cooldown, c.failures, err)
+	}
+}
+
+// probeAt is when the open circuit of the destination lets the next event
+// through as a probe, or a second from now when that time has passed, as
+// another event is probing it
+func (b *breakers) probeAt(destination string) time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	next := time.Now().Add(time.Second)
+	if c, ok := b.circuits[destination]; ok && c.openUntil.After(next) {
+		return c.openUntil
+	}
+	return next
+}
+
+// breakerStatus is the state of a circuit in GET /admin/breakers
+type breakerStatus struct {
+	Destination string     `json:"destination"`
+	State       string     `json:"state"`
+	Failures    int        `json:"failures"`
+	OpenUntil   *time.Time `json:"open_until,omitempty"`
+	LastError   string     `json:"last_error"`
+}
+
+// list reports the circuits of the destinations with failed deliveries;
+// the others are closed
+func (b *breakers) list() []breakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	statuses := []breakerStatus{}
+	for name, c := range b.circuits {
+		status := breakerStatus{Destination: name, State: "closed", Failures: c.failures, LastError: c.lastError}
+		if b.cfg.Failures > 0 && c.failures >= b.cfg.Failures {
+			status.State = "open"
+			if c.probing || !time.Now().Before(c.openUntil) {
+				status.State = "half_open"
+			}
+			until := c.openUntil
+			status.OpenUntil = &until
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Destination < statuses[j].Destination })
+	return statuses
+}
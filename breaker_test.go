@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// setBreakers configures the breakers for the test, with every circuit
+// closed, restoring the defaults after it
+func setBreakers(t *testing.T, failures int, cooldown time.Duration) {
+	t.Helper()
+	reset := func(cfg BreakerConfig) {
+		destinationBreakers.mu.Lock()
+		defer destinationBreakers.mu.Unlock()
+		destinationBreakers.cfg = cfg
+		destinationBreakers.circuits = make(map[string]*circuit)
+	}
+	reset(BreakerConfig{Failures: failures, cooldown: cooldown})
+	t.Cleanup(func() {
+		reset(BreakerConfig{Failures: defaultBreakerFailures, cooldown: defaultBreakerCooldown})
+	})
+}
+
+func TestBreakerOpensAndProbes(t *testing.T) {
+	setBreakers(t, 2, 50*time.Millisecond)
+	d := newTestDestination("breaker-probe")
+	down, attempts := true, 0
+	d.fail = func(BuildEvent) error {
+		attempts++
+		if down {
+			return statusError{status: http.StatusBadGateway}
+		}
+		return nil
+	}
+	build := BuildEvent{Source: "jenkins", ProjectName: "app", BuildName: "#1", Event: "failure"}
+
+	for i := 0; i < 2; i++ {
+		if err := send(d, build, nil); err == nil || errors.Is(err, errCircuitOpen) {
+			t.Fatalf("attempt %d: error = %v, want the destination's", i+1, err)
+		}
+	}
+	if err := send(d, build, nil); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("error after %d failures = %v, want %v", 2, err, errCircuitOpen)
+	}
+	if attempts != 2 {
+		t.Errorf("destination got %d events, want 2 before the circuit opened", attempts)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	down = false
+	if err := send(d, build, nil); err != nil {
+		t.Fatalf("probe error = %v", err)
+	}
+	if err := send(d, build, nil); err != nil {
+		t.Errorf("error after the probe closed the circuit = %v", err)
+	}
+}
+
+func TestBreakerIgnoresRejectedEvents(t *testing.T) {
+	setBreakers(t, 1, time.Minute)
+	d := newTestDestination("breaker-rejected")
+	d.fail = func(BuildEvent) error { return statusError{status: http.StatusBadRequest} }
+	build := BuildEvent{Source: "jenkins", ProjectName: "app", BuildName: "#1", Event: "failure"}
+
+	for i := 0; i < 3; i++ {
+		if err := send(d, build, nil); errors.Is(err, errCircuitOpen) {
+			t.Fatalf("attempt %d skipped the destination: a 4xx opened the circuit", i+1)
+		}
+	}
+}
+
+func TestBreakerKeepsDiscordTargetsApart(t *testing.T) {
+	setBreakers(t, 2, time.Minute)
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	var upPosts atomic.Int32
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upPosts.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer up.Close()
+
+	config := Config{Discord: DiscordConfig{Routes: []DiscordRoute{
+		{JobMatch: JobMatch{Exact: "down"}, WebhookURL: down.URL},
+		{JobMatch: JobMatch{Exact: "up"}, WebhookURL: up.URL},
+	}}}
+	destinations, err := buildDestinations(&config, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := destinations[0].(*discordDestination)
+	d.setID("breaker-discord")
+
+	downBuild := BuildEvent{Source: "jenkins", ProjectName: "down", BuildName: "#1", Event: "failure"}
+	upBuild := BuildEvent{Source: "jenkins", ProjectName: "up", BuildName: "#1", Event: "failure"}
+	if circuitName(d, downBuild) == circuitName(d, upBuild) {
+		t.Fatalf("both routes go through circuit %s", circuitName(d, upBuild))
+	}
+	if name := circuitName(d, upBuild); strings.Contains(name, up.URL) {
+		t.Errorf("circuit name %s holds the webhook URL", name)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := send(d, downBuild, nil); err == nil || errors.Is(err, errCircuitOpen) {
+			t.Fatalf("attempt %d to the failing route: error = %v, want the webhook's", i+1, err)
+		}
+	}
+	if err := send(d, downBuild, nil); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("failing route error = %v, want %v", err, errCircuitOpen)
+	}
+	if err := send(d, upBuild, nil); err != nil {
+		t.Fatalf("working route error = %v, want it delivered while the other route's circuit is open", err)
+	}
+	if upPosts.Load() != 1 {
+		t.Errorf("working route got %d posts, want 1", upPosts.Load())
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BuildkiteConfig configures the Buildkite webhook source. When Token is set,
+// requests must either carry it in X-Buildkite-Token or sign the body with it
+// in X-Buildkite-Signature, depending on the webhook's token setting.
+type BuildkiteConfig struct {
+	Token string `yaml:"token"`
+}
+
+// buildkiteTimeLayout is the timestamp format used in Buildkite webhooks
+const buildkiteTimeLayout = "2006-01-02 15:04:05 MST"
+
+// Buildkite webhook payload structures
+type BuildkiteWebhook struct {
+	Event    string             `json:"event"`
+	Build    *BuildkiteBuild    `json:"build,omitempty"`
+	Job      *BuildkiteJob      `json:"job,omitempty"`
+	Pipeline *BuildkitePipeline `json:"pipeline,omitempty"`
+}
+
+type BuildkiteBuild struct {
+	Number     int64  `json:"number"`
+	State      string `json:"state"`
+	WebURL     string `json:"web_url"`
+	Message    string `json:"message"`
+	Commit     string `json:"commit"`
+	Branch     string `json:"branch"`
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at"`
+	Creator    *struct {
+		Name string `json:"name"`
+	} `json:"creator,omitempty"`
+}
+
+type BuildkiteJob struct {
+	Name       string `json:"name"`
+	State      string `json:"state"`
+	WebURL     string `json:"web_url"`
+	ExitStatus *int   `json:"exit_status,omitempty"`
+	SoftFailed bool   `json:"soft_failed"`
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at"`
+}
+
+type BuildkitePipeline struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type buildkiteSource struct {
+	cfg BuildkiteConfig
+}
+
+func (s buildkiteSource) Name() string {
+	return "buildkite"
+}
+
+func (s buildkiteSource) Detect(header http.Header, body []byte) bool {
+	return header.Get("X-Buildkite-Event") != ""
+}
+
+func (s buildkiteSource) Verify(req *http.Request, body []byte) error {
+	if !s.cfg.verify(req.Header, body) {
+		return errInvalidToken
+	}
+	return nil
+}
+
+// signedAt returns the timestamp of X-Buildkite-Signature, which the
+// signature covers. Requests authenticated with the plain X-Buildkite-Token
+// header aren't signed.
+func (s buildkiteSource) signedAt(header http.Header) (time.Time, bool) {
+	if s.cfg.Token == "" || header.Get("X-Buildkite-Token") != "" {
+		return time.Time{}, false
+	}
+	timestamp, _ := parseBuildkiteSignature(header.Get("X-Buildkite-Signature"))
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0), true
+}
+
+// Parse ignores pings and the build or job events that aren't notified
+func (s buildkiteSource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	var payload BuildkiteWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return singleBuild(payload.toBuildEvent()), nil
+}
+
+// verify checks either the plain X-Buildkite-Token header or the
+// "timestamp=<unix>,signature=<hex hmac>" X-Buildkite-Signature header,
+// where the HMAC covers "<timestamp>.<body>"
+func (c BuildkiteConfig) verify(header http.Header, body []byte) bool {
+	if c.Token == "" {
+		return true
+	}
+
+	if token := header.Get("X-Buildkite-Token"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(c.Token)) == 1
+	}
+
+	timestamp, signature := parseBuildkiteSignature(header.Get("X-Buildkite-Signature"))
+	decoded, err := hex.DecodeString(signature)
+	if timestamp == "" || err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.Token))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hmac.Equal(decoded, mac.Sum(nil))
+}
+
+// parseBuildkiteSignature splits an X-Buildkite-Signature header into its
+// timestamp and signature
+func parseBuildkiteSignature(header string) (timestamp, signature string) {
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "timestamp":
+			timestamp = value
+		case "signature":
+			signature = value
+		}
+	}
+	return timestamp, signature
+}
+
+// buildkiteDuration returns the time between two Buildkite timestamps, or
+// zero when either is missing
+func buildkiteDuration(startedAt, finishedAt string) time.Duration {
+	started, err1 := time.Parse(buildkiteTimeLayout, startedAt)
+	finished, err2 := time.Parse(buildkiteTimeLayout, finishedAt)
+	if err1 != nil || err2 != nil || !finished.After(started) {
+		return 0
+	}
+	return finished.Sub(started)
+}
+
+// buildkiteEvent maps a build or job state to an event
+func buildkiteEvent(state string) string {
+	switch state {
+	case "passed":
+		return "success"
+	case "failed", "broken", "timed_out":
+		return "failure"
+	case "canceled", "canceling":
+		return "aborted"
+	default:
+		return ""
+	}
+}
+
+// toBuildEvent converts build.finished and job.finished webhooks into a
+// BuildEvent, returning false for every other event
+func (p BuildkiteWebhook) toBuildEvent() (BuildEvent, bool) {
+	if p.Build == nil || p.Pipeline == nil {
+		return BuildEvent{}, false
+	}
+	b := p.Build
+
+	build := BuildEvent{
+		Source:      "buildkite",
+		ProjectName: p.Pipeline.Name,
+		BuildName:   "#" + strconv.FormatInt(b.Number, 10),
+		Payload:     p,
+	}
+
+	switch p.Event {
+	case "build.finished":
+		build.BuildURL = b.WebURL
+		build.Event = buildkiteEvent(b.State)
+		build.Duration = buildkiteDuration(b.StartedAt, b.FinishedAt)
+	case "job.finished":
+		if p.Job == nil {
+			return BuildEvent{}, false
+		}
+		build.BuildName += " " + p.Job.Name
+		build.BuildURL = p.Job.WebURL
+		build.Event = buildkiteEvent(p.Job.State)
+		build.Duration = buildkiteDuration(p.Job.StartedAt, p.Job.FinishedAt)
+		if build.Event == "failure" && p.Job.SoftFailed {
+			build.Event = "unstable"
+		}
+	default:
+		return BuildEvent{}, false
+	}
+	if build.Event == "" {
+		return BuildEvent{}, false
+	}
+
+	if b.Branch != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Branch", Value: b.Branch})
+	}
+	if len(b.Commit) >= 8 {
+		build.Vars = append(build.Vars, BuildVar{Key: "Commit", Value: b.Commit[:8]})
+	}
+	if message, _, _ := strings.Cut(strings.TrimSpace(b.Message), "\n"); message != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Message", Value: message})
+	}
+	if b.Creator != nil && b.Creator.Name != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Creator", Value: b.Creator.Name})
+	}
+	if p.Job != nil && p.Job.ExitStatus != nil && *p.Job.ExitStatus != 0 {
+		build.Vars = append(build.Vars, BuildVar{Key: "Exit status", Value: strconv.Itoa(*p.Job.ExitStatus)})
+	}
+
+	return build, true
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildkiteParse(t *testing.T) {
+	build := func(state string) string {
+		return `"build": {"number": 12, "state": "` + state + `", "web_url": "https://buildkite.com/acme/app/builds/12",
+		  "message": "Fix the login\n\nLonger description", "commit": "0123456789abcdef", "branch": "main",
+		  "started_at": "2026-10-14 12:00:00 UTC", "finished_at": "2026-10-14 12:02:30 UTC", "creator": {"name": "Ana"}},
+		  "pipeline": {"name": "App", "slug": "app"}`
+	}
+	job := func(state string, softFailed bool) string {
+		soft := "false"
+		if softFailed {
+			soft = "true"
+		}
+		return `"job": {"name": "lint", "state": "` + state + `", "web_url": "https://buildkite.com/acme/app/builds/12#lint",
+		  "exit_status": 1, "soft_failed": ` + soft + `, "started_at": "2026-10-14 12:00:00 UTC", "finished_at": "2026-10-14 12:01:00 UTC"}`
+	}
+	tests := []struct {
+		name         string
+		event        string
+		body         string
+		want         []buildSummary
+		wantDuration time.Duration
+	}{
+		{
+			"build passed", "build.finished",
+			`{"event": "build.finished", ` + build("passed") + `}`,
+			[]buildSummary{{"App", "#12", "https://buildkite.com/acme/app/builds/12", "success"}},
+			150 * time.Second,
+		},
+		{
+			"build canceled", "build.finished",
+			`{"event": "build.finished", ` + build("canceled") + `}`,
+			[]buildSummary{{"App", "#12", "https://buildkite.com/acme/app/builds/12", "aborted"}},
+			150 * time.Second,
+		},
+		{
+			"job failed", "job.finished",
+			`{"event": "job.finished", ` + job("failed", false) + `, ` + build("running") + `}`,
+			[]buildSummary{{"App", "#12 lint", "https://buildkite.com/acme/app/builds/12#lint", "failure"}},
+			time.Minute,
+		},
+		{
+			"job soft failed", "job.finished",
+			`{"event": "job.finished", ` + job("failed", true) + `, ` + build("running") + `}`,
+			[]buildSummary{{"App", "#12 lint", "https://buildkite.com/acme/app/builds/12#lint", "unstable"}},
+			time.Minute,
+		},
+		{"build running", "build.running", `{"event": "build.running", ` + build("running") + `}`, nil, 0},
+		{"ping", "ping", `{"event": "ping"}`, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{"X-Buildkite-Event": {tt.event}}
+			if name := detectSource(t, header, tt.body); name != "buildkite" {
+				t.Errorf("detected as %q, want buildkite", name)
+			}
+			builds := parseBuilds(t, buildkiteSource{}, header, tt.body)
+			if got := summarize(builds); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("builds = %+v, want %+v", got, tt.want)
+			}
+			if len(builds) > 0 && builds[0].Duration != tt.wantDuration {
+				t.Errorf("duration = %v, want %v", builds[0].Duration, tt.wantDuration)
+			}
+		})
+	}
+}
+
+func TestBuildkiteVars(t *testing.T) {
+	body := `{"event": "job.finished", "job": {"name": "lint", "state": "failed", "exit_status": 2},
+	  "build": {"number": 12, "message": "Fix the login\n\nLonger description", "commit": "0123456789abcdef", "branch": "main", "creator": {"name": "Ana"}},
+	  "pipeline": {"name": "App"}}`
+	builds := parseBuilds(t, buildkiteSource{}, http.Header{}, body)
+	want := []BuildVar{
+		{Key: "Branch", Value: "main"},
+		{Key: "Commit", Value: "01234567"},
+		{Key: "Message", Value: "Fix the login"},
+		{Key: "Creator", Value: "Ana"},
+		{Key: "Exit status", Value: "2"},
+	}
+	if !reflect.DeepEqual(builds[0].Vars, want) {
+		t.Errorf("vars = %+v, want %+v", builds[0].Vars, want)
+	}
+}
+
+func TestBuildkiteVerify(t *testing.T) {
+	body := []byte(`{"event": "ping"}`)
+	sign := func(timestamp, token string) string {
+		mac := hmac.New(sha256.New, []byte(token))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		return "timestamp=" + timestamp + ",signature=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	tests := []struct {
+		name   string
+		header http.Header
+		ok     bool
+	}{
+		{"token", http.Header{"X-Buildkite-Token": {"secret"}}, true},
+		{"wrong token", http.Header{"X-Buildkite-Token": {"other"}}, false},
+		{"signature", http.Header{"X-Buildkite-Signature": {sign("1700000000", "secret")}}, true},
+		{"signature with another token", http.Header{"X-Buildkite-Signature": {sign("1700000000", "other")}}, false},
+		{"signature without timestamp", http.Header{"X-Buildkite-Signature": {"signature=00"}}, false},
+		{"unauthenticated", http.Header{}, false},
+	}
+	src := buildkiteSource{cfg: BuildkiteConfig{Token: "secret"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/webhook/buildkite", nil)
+			req.Header = tt.header
+			if err := src.Verify(req, body); (err == nil) != tt.ok {
+				t.Errorf("Verify() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+
+	signed := http.Header{"X-Buildkite-Signature": {sign("1700000000", "secret")}}
+	if at, ok := src.signedAt(signed); !ok || at.Unix() != 1700000000 {
+		t.Errorf("signedAt() = %v, %v, want the signature's timestamp", at, ok)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CircleCIConfig configures the CircleCI webhook source. When Secret is set,
+// requests must carry a matching HMAC-SHA256 signature in circleci-signature.
+type CircleCIConfig struct {
+	Secret string `yaml:"secret"`
+}
+
+// CircleCI webhook payload structures
+type CircleCIWebhook struct {
+	Type     string            `json:"type"`
+	ID       string            `json:"id"`
+	Workflow *CircleCIWorkflow `json:"workflow,omitempty"`
+	Pipeline *CircleCIPipeline `json:"pipeline,omitempty"`
+	Project  *CircleCIProject  `json:"project,omitempty"`
+}
+
+type CircleCIWorkflow struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+	StoppedAt time.Time `json:"stopped_at"`
+}
+
+type CircleCIPipeline struct {
+	ID     string       `json:"id"`
+	Number int64        `json:"number"`
+	VCS    *CircleCIVCS `json:"vcs,omitempty"`
+}
+
+type CircleCIVCS struct {
+	Branch   string `json:"branch"`
+	Tag      string `json:"tag"`
+	Revision string `json:"revision"`
+	Commit   *struct {
+		Subject string `json:"subject"`
+	} `json:"commit,omitempty"`
+}
+
+type CircleCIProject struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type circleciSource struct {
+	cfg CircleCIConfig
+}
+
+func (s circleciSource) Name() string {
+	return "circleci"
+}
+
+func (s circleciSource) Detect(header http.Header, body []byte) bool {
+	return header.Get("Circleci-Event-Type") != ""
+}
+
+func (s circleciSource) Verify(req *http.Request, body []byte) error {
+	if !s.cfg.verifySignature(req.Header.Get("circleci-signature"), body) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// signedAt reports requests as signed when a secret is configured. The
+// signature doesn't cover a send time.
+func (s circleciSource) signedAt(header http.Header) (time.Time, bool) {
+	return time.Time{}, s.cfg.Secret != ""
+}
+
+func (s circleciSource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	var payload CircleCIWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return singleBuild(payload.toBuildEvent()), nil
+}
+
+// verifySignature checks the circleci-signature header, which holds one or
+// more comma-separated "v1=<hex hmac-sha256 of the body>" entries
+func (c CircleCIConfig) verifySignature(header string, body []byte) bool {
+	if c.Secret == "" {
+		return true
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.Secret))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+
+	for _, part := range strings.Split(header, ",") {
+		version, sig, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || version != "v1" {
+			continue
+		}
+		decoded, err := hex.DecodeString(sig)
+		if err == nil && hmac.Equal(decoded, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// toBuildEvent converts a workflow-completed event into a BuildEvent,
+// returning false for other event types and non-final statuses
+func (p CircleCIWebhook) toBuildEvent() (BuildEvent, bool) {
+	if p.Type != "workflow-completed" || p.Workflow == nil || p.Project == nil {
+		return BuildEvent{}, false
+	}
+
+	build := BuildEvent{
+		Source:      "circleci",
+		ProjectName: p.Project.Name,
+		BuildName:   p.Workflow.Name,
+		BuildURL:    p.Workflow.URL,
+		Payload:     p,
+	}
+	if p.Pipeline != nil {
+		build.BuildName += " #" + strconv.FormatInt(p.Pipeline.Number, 10)
+	}
+	if !p.Workflow.CreatedAt.IsZero() && p.Workflow.StoppedAt.After(p.Workflow.CreatedAt) {
+		build.Duration = p.Workflow.StoppedAt.Sub(p.Workflow.CreatedAt)
+	}
+
+	switch p.Workflow.Status {
+	case "success":
+		build.Event = "success"
+	case "failed", "error", "unauthorized":
+		build.Event = "failure"
+	case "canceled":
+		build.Event = "aborted"
+	default:
+		return BuildEvent{}, false
+	}
+
+	if p.Pipeline != nil && p.Pipeline.VCS != nil {
+		vcs := p.Pipeline.VCS
+		if vcs.Branch != "" {
+			build.Vars = append(build.Vars, BuildVar{Key: "Branch", Value: vcs.Branch})
+		}
+		if vcs.Tag != "" {
+			build.Vars = append(build.Vars, BuildVar{Key: "Tag", Value: vcs.Tag})
+		}
+		if len(vcs.Revision) >= 8 {
+			build.Vars = append(build.Vars, BuildVar{Key: "Commit", Value: vcs.Revision[:8]})
+		}
+		if vcs.Commit != nil && vcs.Commit.Subject != "" {
+			build.Vars = append(build.Vars, BuildVar{Key: "Message", Value: vcs.Commit.Subject})
+		}
+	}
+
+	return build, true
+}
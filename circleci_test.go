@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func circleCISignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestCircleCIVerifySignature(t *testing.T) {
+	body := []byte(`{"type":"workflow-completed"}`)
+	cfg := CircleCIConfig{Secret: "secret"}
+
+	tests := []struct {
+		name   string
+		cfg    CircleCIConfig
+		header string
+		body   []byte
+		want   bool
+	}{
+		{"valid", cfg, circleCISignature("secret", body), body, true},
+		{"one of several versions", cfg, "v2=abc, " + circleCISignature("secret", body), body, true},
+		{"wrong secret", cfg, circleCISignature("other", body), body, false},
+		{"tampered body", cfg, circleCISignature("secret", body), []byte(`{"type":"job-completed"}`), false},
+		{"wrong version", cfg, "v2=" + circleCISignature("secret", body)[3:], body, false},
+		{"not hex", cfg, "v1=zz", body, false},
+		{"missing", cfg, "", body, false},
+		{"no secret configured", CircleCIConfig{}, "", body, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.verifySignature(tt.header, tt.body); got != tt.want {
+				t.Errorf("verifySignature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+)
+
+// Where a failure classifier looks for its pattern
+const (
+	classifyConsole     = "console"
+	classifyDescription = "description"
+)
+
+// FailureClassifier tags the failed and unstable builds whose console log
+// tail or description matches Pattern with Tag, such as "infra flake". In
+// is console or description; both are searched when it is empty.
+type FailureClassifier struct {
+	Tag     string `yaml:"tag"`
+	Pattern string `yaml:"pattern"`
+	In      string `yaml:"in"`
+
+	re *regexp.Regexp
+}
+
+func (c *FailureClassifier) compile() error {
+	if c.Tag == "" || c.Pattern == "" {
+		return fmt.Errorf("needs a tag and a pattern")
+	}
+	if c.In != "" && c.In != classifyConsole && c.In != classifyDescription {
+		return fmt.Errorf("invalid in %q, expected console or description", c.In)
+	}
+	re, err := regexp.Compile(c.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	c.re = re
+	return nil
+}
+
+func (c FailureClassifier) matches(build BuildEvent) bool {
+	return (c.In != classifyDescription && c.re.MatchString(build.ConsoleLog)) ||
+		(c.In != classifyConsole && c.re.MatchString(build.Description))
+}
+
+// searchesDescriptions reports whether a classifier searches the build
+// description, which is only fetched for them
+func searchesDescriptions(classifiers []FailureClassifier) bool {
+	for _, c := range classifiers {
+		if c.In != classifyConsole {
+			return true
+		}
+	}
+	return false
+}
+
+// classifiable reports whether the build's failure is classified
+func classifiable(build BuildEvent) bool {
+	return isFailureEvent(build.Event) || build.Event == "unstable"
+}
+
+// classify tags the build with every classifier that matches, each tag once
+func classify(classifiers []FailureClassifier, build *BuildEvent) {
+	if !classifiable(*build) {
+		return
+	}
+	for _, c := range classifiers {
+		if c.matches(*build) && !containsString(build.Tags, c.Tag) {
+			build.Tags = append(build.Tags, c.Tag)
+		}
+	}
+}
+
+// addDescription adds the description of a failed or unstable build, which
+// the failure classifiers search along with the console log. Errors are
+// logged, as the build is notified either way.
+func (s jenkinsSource) addDescription(build *BuildEvent, buildURL string) {
+	if !classifiable(*build) {
+		return
+	}
+	resp, err := s.apiGet(buildURL, "api/json?tree=description")
+	if err != nil || resp == nil {
+		if err != nil {
+			log.Printf("Error fetching description for %s %s: %v", build.ProjectName, build.BuildName, err)
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	var details struct {
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
+		log.Printf("Error decoding description for %s %s: %v", build.ProjectName, build.BuildName, err)
+		return
+	}
+	build.Description = details.Description
+}
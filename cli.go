@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+// command is a subcommand of the binary, run with the arguments after its name
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"serve", "run the webhook server (the default)", serve},
+	{"validate", "check the configuration, templates and destinations and exit", validate},
+	{"validate-config", "same as validate", validate},
+	{"config", "print the effective configuration with secrets redacted (config dump)", configCommand},
+	{"send-test", "send a test notification to every destination", sendTest},
+	{"encrypt", "encrypt a secret read from stdin into an enc: setting", encryptCommand},
+	{"version", "print the version", printVersion},
+}
+
+func main() {
+	args := os.Args[1:]
+	log.SetOutput(redactingWriter{os.Stderr})
+
+	// Without a subcommand the binary serves, so existing deployments that
+	// only pass flags keep working
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(args); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	printUsage()
+	os.Exit(2)
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+}
+
+// configFlag registers the --config flag shared by every command that reads
+// the configuration
+func configFlag(flags *flag.FlagSet) *string {
+	return flags.String("config", os.Getenv("CONFIG_FILE"), "path, or http(s)://, s3://, configmap:// or secret:// URL, of a YAML config file")
+}
+
+// sendTest delivers a made-up build event to every destination and reports
+// how each one did
+func sendTest(args []string) error {
+	flags := flag.NewFlagSet("send-test", flag.ExitOnError)
+	configPath := configFlag(flags)
+	event := flags.String("event", "success", "event to send: started, success, failure, unstable or aborted")
+	project := flags.String("project", "test-project", "project name of the test build")
+	flags.Parse(args)
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	handler, err := NewWebhookHandler(config)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	build := testBuild(*project, *event)
+	state := handler.state.Load()
+	state.notifySettings(build).apply(&build)
+
+	failed := 0
+	for _, r := range notify(state.destinations, build) {
+		if r.Error != "" {
+			fmt.Printf("%s: %s\n", r.Destination, r.Error)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: sent\n", r.Destination)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d destinations failed", failed, len(state.destinations))
+	}
+	return nil
+}
+
+// testBuild is the made-up build event send-test delivers and validate
+// renders templates with
+func testBuild(project, event string) BuildEvent {
+	return BuildEvent{
+		Source:      "jenkins",
+		ProjectName: project,
+		BuildName:   "#0",
+		Event:       event,
+		Duration:    90 * time.Second,
+		Time:        time.Now(),
+		Vars:        []BuildVar{{Key: "Test", Value: "sent with " + os.Args[0] + " send-test"}},
+	}
+}
+
+func printVersion(args []string) error {
+	fmt.Println(version)
+	return nil
+}
@@ -0,0 +1,907 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the runtime settings, read from the optional YAML config
+// file and the environment
+type Config struct {
+	Port       string `yaml:"port"`
+	JenkinsURL string `yaml:"jenkins_url"`
+	// JenkinsUser and JenkinsAPIToken read test reports from the Jenkins API
+	JenkinsUser     string `yaml:"jenkins_user"`
+	JenkinsAPIToken string `yaml:"jenkins_api_token"`
+	// JenkinsConsoleLines is how many console log lines failed builds show
+	JenkinsConsoleLines int `yaml:"jenkins_console_lines"`
+	// JenkinsArtifacts is how many artifacts finished builds link to
+	JenkinsArtifacts int `yaml:"jenkins_artifacts"`
+
+	// MaxBodySize caps the size of request bodies, e.g. 512K or 2M
+	MaxBodySize  string `yaml:"max_body_size"`
+	maxBodyBytes int64
+	// ShutdownTimeout is how long finishing requests and deliveries may
+	// take on SIGTERM or SIGINT
+	ShutdownTimeout string `yaml:"shutdown_timeout"`
+	shutdownTimeout time.Duration
+
+	// TLS serves HTTPS with the given certificate instead of plain HTTP
+	TLS TLSConfig `yaml:"tls"`
+
+	// Destinations names the destinations to deliver to; when empty every
+	// configured destination is used
+	Destinations []string `yaml:"destinations"`
+
+	// DestinationURLs declares extra destinations as URLs such as
+	// discord://id/token, see parseDestinationURL
+	DestinationURLs []string `yaml:"destination_urls"`
+
+	// Notifications are the default notification settings, and Jobs
+	// override them for matching jobs
+	Notifications NotifySettings `yaml:"notifications"`
+	Jobs          []JobOverride  `yaml:"jobs"`
+
+	// Classifiers tag failed builds by their console log or description
+	Classifiers []FailureClassifier `yaml:"classifiers"`
+
+	GitLab       GitLabConfig       `yaml:"gitlab"`
+	CircleCI     CircleCIConfig     `yaml:"circleci"`
+	Drone        DroneConfig        `yaml:"drone"`
+	Bitbucket    BitbucketConfig    `yaml:"bitbucket"`
+	AzureDevOps  AzureDevOpsConfig  `yaml:"azure_devops"`
+	ArgoCD       ArgoCDConfig       `yaml:"argocd"`
+	Tekton       TektonConfig       `yaml:"tekton"`
+	SonarQube    SonarQubeConfig    `yaml:"sonarqube"`
+	Harbor       HarborConfig       `yaml:"harbor"`
+	Alertmanager AlertmanagerConfig `yaml:"alertmanager"`
+	Buildkite    BuildkiteConfig    `yaml:"buildkite"`
+	Travis       TravisConfig       `yaml:"travis"`
+	Woodpecker   WoodpeckerConfig   `yaml:"woodpecker"`
+	Gitea        GiteaConfig        `yaml:"gitea"`
+	Spinnaker    SpinnakerConfig    `yaml:"spinnaker"`
+	Artifactory  ArtifactoryConfig  `yaml:"artifactory"`
+	Nexus        NexusConfig        `yaml:"nexus"`
+
+	Discord       DiscordConfig       `yaml:"discord"`
+	Slack         SlackConfig         `yaml:"slack"`
+	Telegram      TelegramConfig      `yaml:"telegram"`
+	Mattermost    MattermostConfig    `yaml:"mattermost"`
+	RocketChat    RocketChatConfig    `yaml:"rocketchat"`
+	GoogleChat    GoogleChatConfig    `yaml:"google_chat"`
+	SMTP          SMTPConfig          `yaml:"smtp"`
+	Twilio        TwilioConfig        `yaml:"twilio"`
+	PagerDuty     PagerDutyConfig     `yaml:"pagerduty"`
+	Opsgenie      OpsgenieConfig      `yaml:"opsgenie"`
+	Generic       GenericConfig       `yaml:"generic"`
+	Ntfy          NtfyConfig          `yaml:"ntfy"`
+	SNS           SNSConfig           `yaml:"sns"`
+	Zulip         ZulipConfig         `yaml:"zulip"`
+	Webex         WebexConfig         `yaml:"webex"`
+	IRC           IRCConfig           `yaml:"irc"`
+	XMPP          XMPPConfig          `yaml:"xmpp"`
+	Gotify        GotifyConfig        `yaml:"gotify"`
+	GrafanaOnCall GrafanaOnCallConfig `yaml:"grafana_oncall"`
+
+	// Vault is where settings written as vault:path#key are read from
+	Vault VaultConfig `yaml:"vault"`
+	// Encryption holds the key settings written as enc:<base64> are
+	// decrypted with
+	Encryption EncryptionConfig `yaml:"encryption"`
+
+	// Auth protects the webhook endpoints with shared tokens
+	Auth AuthConfig `yaml:"auth"`
+	// Allowlist limits the addresses the webhook endpoints accept
+	Allowlist AllowlistConfig `yaml:"allowlist"`
+	// RateLimit limits how often webhooks are accepted per client and job
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	// Admin protects the debug endpoints
+	Admin AdminConfig `yaml:"admin"`
+	// Replay rejects replayed deliveries of signed webhooks
+	Replay ReplayConfig `yaml:"replay"`
+	// Dedup drops repeated events of a build
+	Dedup DedupConfig `yaml:"dedup"`
+	// Log configures what the logs leave out
+	Log LogConfig `yaml:"log"`
+	// Audit records every webhook request
+	Audit AuditConfig `yaml:"audit"`
+	// Queue keeps outbound notifications on disk until they are delivered
+	Queue QueueConfig `yaml:"queue"`
+	// Delivery hands events to background workers
+	Delivery DeliveryConfig `yaml:"delivery"`
+	// Breaker skips destinations that keep failing
+	Breaker BreakerConfig `yaml:"breaker"`
+}
+
+// loadConfig reads the YAML config file at path, when set, and overrides its
+// values with any environment variables that are set
+func loadConfig(path string) (*Config, error) {
+	file := &Config{}
+	if path != "" {
+		var err error
+		if file, err = readConfigFile(path, os.Getenv("APP_ENV")); err != nil {
+			return nil, err
+		}
+	}
+
+	env := readEnvironment()
+	envOr, envList := env.or, env.list
+
+	cfg := &Config{
+		Port:            envOr("PORT", file.Port),
+		JenkinsURL:      envOr("JENKINS_URL", file.JenkinsURL),
+		JenkinsUser:     envOr("JENKINS_USER", file.JenkinsUser),
+		JenkinsAPIToken: envOr("JENKINS_API_TOKEN", file.JenkinsAPIToken),
+		Destinations:    envList("DESTINATIONS", file.Destinations),
+		MaxBodySize:     envOr("MAX_BODY_SIZE", file.MaxBodySize),
+		ShutdownTimeout: envOr("SHUTDOWN_TIMEOUT", file.ShutdownTimeout),
+
+		TLS: TLSConfig{
+			CertFile:     envOr("TLS_CERT_FILE", file.TLS.CertFile),
+			KeyFile:      envOr("TLS_KEY_FILE", file.TLS.KeyFile),
+			RedirectPort: envOr("TLS_REDIRECT_PORT", file.TLS.RedirectPort),
+			ClientCAFile: envOr("TLS_CLIENT_CA_FILE", file.TLS.ClientCAFile),
+
+			ACMEHosts:        envList("TLS_ACME_HOSTS", file.TLS.ACMEHosts),
+			ACMEEmail:        envOr("TLS_ACME_EMAIL", file.TLS.ACMEEmail),
+			ACMECacheDir:     envOr("TLS_ACME_CACHE_DIR", file.TLS.ACMECacheDir),
+			ACMEDirectoryURL: envOr("TLS_ACME_DIRECTORY_URL", file.TLS.ACMEDirectoryURL),
+		},
+
+		Notifications: file.Notifications,
+		Jobs:          file.Jobs,
+		Classifiers:   file.Classifiers,
+
+		GitLab: GitLabConfig{
+			Token: envOr("GITLAB_WEBHOOK_TOKEN", file.GitLab.Token),
+		},
+		CircleCI: CircleCIConfig{
+			Secret: envOr("CIRCLECI_WEBHOOK_SECRET", file.CircleCI.Secret),
+		},
+		Drone: DroneConfig{
+			Secret: envOr("DRONE_WEBHOOK_SECRET", file.Drone.Secret),
+		},
+		Bitbucket: BitbucketConfig{
+			Secret: envOr("BITBUCKET_WEBHOOK_SECRET", file.Bitbucket.Secret),
+		},
+		AzureDevOps: AzureDevOpsConfig{
+			Username: envOr("AZURE_DEVOPS_WEBHOOK_USERNAME", file.AzureDevOps.Username),
+			Password: envOr("AZURE_DEVOPS_WEBHOOK_PASSWORD", file.AzureDevOps.Password),
+		},
+		ArgoCD: ArgoCDConfig{
+			Token: envOr("ARGOCD_WEBHOOK_TOKEN", file.ArgoCD.Token),
+		},
+		Tekton: TektonConfig{
+			DashboardURL: envOr("TEKTON_DASHBOARD_URL", file.Tekton.DashboardURL),
+		},
+		SonarQube: SonarQubeConfig{
+			Secret: envOr("SONARQUBE_WEBHOOK_SECRET", file.SonarQube.Secret),
+		},
+		Harbor: HarborConfig{
+			AuthHeader:        envOr("HARBOR_WEBHOOK_AUTH", file.Harbor.AuthHeader),
+			SeverityThreshold: envOr("HARBOR_SEVERITY_THRESHOLD", file.Harbor.SeverityThreshold),
+		},
+		Alertmanager: AlertmanagerConfig{
+			Token: envOr("ALERTMANAGER_WEBHOOK_TOKEN", file.Alertmanager.Token),
+		},
+		Buildkite: BuildkiteConfig{
+			Token: envOr("BUILDKITE_WEBHOOK_TOKEN", file.Buildkite.Token),
+		},
+		Travis: TravisConfig{
+			PublicKey: envOr("TRAVIS_PUBLIC_KEY", file.Travis.PublicKey),
+			APIURL:    envOr("TRAVIS_API_URL", file.Travis.APIURL),
+		},
+		Woodpecker: WoodpeckerConfig{
+			Token: envOr("WOODPECKER_WEBHOOK_TOKEN", file.Woodpecker.Token),
+		},
+		Gitea: GiteaConfig{
+			Secret: envOr("GITEA_WEBHOOK_SECRET", file.Gitea.Secret),
+		},
+		Spinnaker: SpinnakerConfig{
+			Token:   envOr("SPINNAKER_WEBHOOK_TOKEN", file.Spinnaker.Token),
+			DeckURL: envOr("SPINNAKER_DECK_URL", file.Spinnaker.DeckURL),
+		},
+		Artifactory: ArtifactoryConfig{
+			Secret: envOr("ARTIFACTORY_WEBHOOK_SECRET", file.Artifactory.Secret),
+		},
+		Nexus: NexusConfig{
+			Secret: envOr("NEXUS_WEBHOOK_SECRET", file.Nexus.Secret),
+			URL:    envOr("NEXUS_URL", file.Nexus.URL),
+		},
+
+		Discord: DiscordConfig{
+			WebhookURL:       envOr("DISCORD_WEBHOOK_URL", file.Discord.WebhookURL),
+			BotToken:         envOr("DISCORD_BOT_TOKEN", file.Discord.BotToken),
+			ChannelID:        envOr("DISCORD_CHANNEL_ID", file.Discord.ChannelID),
+			Format:           envOr("DISCORD_FORMAT", file.Discord.Format),
+			Username:         envOr("DISCORD_USERNAME", file.Discord.Username),
+			AvatarURL:        envOr("DISCORD_AVATAR_URL", file.Discord.AvatarURL),
+			Threads:          envOr("DISCORD_THREADS", file.Discord.Threads),
+			EditMessages:     file.Discord.EditMessages,
+			PublicKey:        envOr("DISCORD_PUBLIC_KEY", file.Discord.PublicKey),
+			InteractionRoles: envList("DISCORD_INTERACTION_ROLES", file.Discord.InteractionRoles),
+			Digest:           envOr("DISCORD_DIGEST", file.Discord.Digest),
+			Retries:          file.Discord.Retries,
+			RetryBackoff:     envOr("DISCORD_RETRY_BACKOFF", file.Discord.RetryBackoff),
+			Routes:           file.Discord.Routes,
+		},
+		Slack: SlackConfig{
+			WebhookURL: envOr("SLACK_WEBHOOK_URL", file.Slack.WebhookURL),
+		},
+		Telegram: TelegramConfig{
+			BotToken: envOr("TELEGRAM_BOT_TOKEN", file.Telegram.BotToken),
+			ChatID:   envOr("TELEGRAM_CHAT_ID", file.Telegram.ChatID),
+		},
+		Mattermost: MattermostConfig{
+			WebhookURL: envOr("MATTERMOST_WEBHOOK_URL", file.Mattermost.WebhookURL),
+		},
+		RocketChat: RocketChatConfig{
+			WebhookURL: envOr("ROCKETCHAT_WEBHOOK_URL", file.RocketChat.WebhookURL),
+			Channel:    envOr("ROCKETCHAT_CHANNEL", file.RocketChat.Channel),
+		},
+		GoogleChat: GoogleChatConfig{
+			WebhookURL: envOr("GOOGLE_CHAT_WEBHOOK_URL", file.GoogleChat.WebhookURL),
+		},
+		SMTP: SMTPConfig{
+			Host:     envOr("SMTP_HOST", file.SMTP.Host),
+			Port:     envOr("SMTP_PORT", file.SMTP.Port),
+			Username: envOr("SMTP_USERNAME", file.SMTP.Username),
+			Password: envOr("SMTP_PASSWORD", file.SMTP.Password),
+			From:     envOr("SMTP_FROM", file.SMTP.From),
+			To:       envList("SMTP_TO", file.SMTP.To),
+			TLS:      strings.ToLower(envOr("SMTP_TLS", file.SMTP.TLS)),
+		},
+		Twilio: TwilioConfig{
+			AccountSID: envOr("TWILIO_ACCOUNT_SID", file.Twilio.AccountSID),
+			AuthToken:  envOr("TWILIO_AUTH_TOKEN", file.Twilio.AuthToken),
+			FromNumber: envOr("TWILIO_FROM_NUMBER", file.Twilio.FromNumber),
+			ToNumbers:  envList("TWILIO_TO_NUMBERS", file.Twilio.ToNumbers),
+		},
+		PagerDuty: PagerDutyConfig{
+			RoutingKey: envOr("PAGERDUTY_ROUTING_KEY", file.PagerDuty.RoutingKey),
+		},
+		Opsgenie: OpsgenieConfig{
+			APIKey: envOr("OPSGENIE_API_KEY", file.Opsgenie.APIKey),
+			APIURL: envOr("OPSGENIE_API_URL", file.Opsgenie.APIURL),
+		},
+		Generic: GenericConfig{
+			URL:          envOr("GENERIC_WEBHOOK_URL", file.Generic.URL),
+			Method:       strings.ToUpper(envOr("GENERIC_WEBHOOK_METHOD", file.Generic.Method)),
+			ContentType:  envOr("GENERIC_WEBHOOK_CONTENT_TYPE", file.Generic.ContentType),
+			Template:     envOr("GENERIC_WEBHOOK_TEMPLATE", file.Generic.Template),
+			TemplateFile: envOr("GENERIC_WEBHOOK_TEMPLATE_FILE", file.Generic.TemplateFile),
+		},
+		Ntfy: NtfyConfig{
+			URL:   envOr("NTFY_URL", file.Ntfy.URL),
+			Topic: envOr("NTFY_TOPIC", file.Ntfy.Topic),
+			Token: envOr("NTFY_TOKEN", file.Ntfy.Token),
+		},
+		SNS: SNSConfig{
+			TopicARN: envOr("SNS_TOPIC_ARN", file.SNS.TopicARN),
+			Region:   envOr("AWS_REGION", file.SNS.Region),
+			Credentials: awsCredentials{
+				AccessKeyID:     envOr("AWS_ACCESS_KEY_ID", file.SNS.Credentials.AccessKeyID),
+				SecretAccessKey: envOr("AWS_SECRET_ACCESS_KEY", file.SNS.Credentials.SecretAccessKey),
+				SessionToken:    envOr("AWS_SESSION_TOKEN", file.SNS.Credentials.SessionToken),
+			},
+		},
+		Zulip: ZulipConfig{
+			Site:     envOr("ZULIP_SITE", file.Zulip.Site),
+			BotEmail: envOr("ZULIP_BOT_EMAIL", file.Zulip.BotEmail),
+			APIKey:   envOr("ZULIP_API_KEY", file.Zulip.APIKey),
+			Stream:   envOr("ZULIP_STREAM", file.Zulip.Stream),
+			Topic:    envOr("ZULIP_TOPIC", file.Zulip.Topic),
+		},
+		Webex: WebexConfig{
+			BotToken: envOr("WEBEX_BOT_TOKEN", file.Webex.BotToken),
+			RoomID:   envOr("WEBEX_ROOM_ID", file.Webex.RoomID),
+		},
+		IRC: IRCConfig{
+			Server:       envOr("IRC_SERVER", file.IRC.Server),
+			Channel:      envOr("IRC_CHANNEL", file.IRC.Channel),
+			Nick:         envOr("IRC_NICK", file.IRC.Nick),
+			SASLUsername: envOr("IRC_SASL_USERNAME", file.IRC.SASLUsername),
+			SASLPassword: envOr("IRC_SASL_PASSWORD", file.IRC.SASLPassword),
+		},
+		XMPP: XMPPConfig{
+			JID:      envOr("XMPP_JID", file.XMPP.JID),
+			Password: envOr("XMPP_PASSWORD", file.XMPP.Password),
+			Server:   envOr("XMPP_SERVER", file.XMPP.Server),
+			Room:     envOr("XMPP_ROOM", file.XMPP.Room),
+			Nick:     envOr("XMPP_NICK", file.XMPP.Nick),
+			To:       envList("XMPP_TO", file.XMPP.To),
+		},
+		Gotify: GotifyConfig{
+			URL:      envOr("GOTIFY_URL", file.Gotify.URL),
+			AppToken: envOr("GOTIFY_APP_TOKEN", file.Gotify.AppToken),
+		},
+		GrafanaOnCall: GrafanaOnCallConfig{
+			URL: envOr("GRAFANA_ONCALL_URL", file.GrafanaOnCall.URL),
+		},
+
+		Auth: AuthConfig{
+			Token:      envOr("WEBHOOK_TOKEN", file.Auth.Token),
+			Tokens:     sourceTokensFromEnv(env, file.Auth.Tokens),
+			Header:     envOr("WEBHOOK_TOKEN_HEADER", file.Auth.Header),
+			QueryParam: envOr("WEBHOOK_TOKEN_QUERY_PARAM", file.Auth.QueryParam),
+		},
+		Log: LogConfig{
+			RedactPatterns: envList("LOG_REDACT_PATTERNS", file.Log.RedactPatterns),
+		},
+		Audit: AuditConfig{
+			File:      envOr("AUDIT_LOG_FILE", file.Audit.File),
+			Retention: envOr("AUDIT_LOG_RETENTION", file.Audit.Retention),
+		},
+		Queue: QueueConfig{
+			Path:        envOr("QUEUE_PATH", file.Queue.Path),
+			Workers:     file.Queue.Workers,
+			MaxAttempts: file.Queue.MaxAttempts,
+		},
+		Delivery: file.Delivery,
+		Breaker: BreakerConfig{
+			Failures: file.Breaker.Failures,
+			Cooldown: envOr("BREAKER_COOLDOWN", file.Breaker.Cooldown),
+		},
+		Admin: AdminConfig{
+			Username: envOr("ADMIN_USERNAME", file.Admin.Username),
+			Password: envOr("ADMIN_PASSWORD", file.Admin.Password),
+
+			JWTSecret:        envOr("ADMIN_JWT_SECRET", file.Admin.JWTSecret),
+			JWTPublicKeyFile: envOr("ADMIN_JWT_PUBLIC_KEY_FILE", file.Admin.JWTPublicKeyFile),
+			JWTIssuer:        envOr("ADMIN_JWT_ISSUER", file.Admin.JWTIssuer),
+			JWTAudience:      envOr("ADMIN_JWT_AUDIENCE", file.Admin.JWTAudience),
+			JWTRoleClaim:     envOr("ADMIN_JWT_ROLE_CLAIM", file.Admin.JWTRoleClaim),
+			SessionTTL:       envOr("ADMIN_SESSION_TTL", file.Admin.SessionTTL),
+		},
+		Allowlist: AllowlistConfig{
+			CIDRs:          envList("WEBHOOK_ALLOWED_CIDRS", file.Allowlist.CIDRs),
+			Sources:        sourceCIDRsFromEnv(env, file.Allowlist.Sources),
+			TrustedProxies: envList("TRUSTED_PROXIES", file.Allowlist.TrustedProxies),
+		},
+
+		Encryption: EncryptionConfig{
+			Key:    envOr("CONFIG_ENCRYPTION_KEY", file.Encryption.Key),
+			KMSKey: envOr("CONFIG_ENCRYPTION_KMS_KEY", file.Encryption.KMSKey),
+		},
+		Vault: VaultConfig{
+			Address:   envOr("VAULT_ADDR", file.Vault.Address),
+			Token:     envOr("VAULT_TOKEN", file.Vault.Token),
+			Namespace: envOr("VAULT_NAMESPACE", file.Vault.Namespace),
+		},
+	}
+
+	for i, name := range cfg.Destinations {
+		cfg.Destinations[i] = strings.ToLower(name)
+	}
+
+	if cfg.Port == "" {
+		cfg.Port = "8080"
+	}
+
+	// Validate port
+	if _, err := strconv.Atoi(cfg.Port); err != nil {
+		return nil, fmt.Errorf("invalid PORT value: %s", cfg.Port)
+	}
+	if cfg.MaxBodySize == "" {
+		cfg.MaxBodySize = defaultMaxBodySize
+	}
+	maxBodyBytes, err := parseByteSize(cfg.MaxBodySize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAX_BODY_SIZE value: %s", cfg.MaxBodySize)
+	}
+	cfg.maxBodyBytes = maxBodyBytes
+	cfg.shutdownTimeout = defaultShutdownTimeout
+	if cfg.ShutdownTimeout != "" {
+		timeout, err := time.ParseDuration(cfg.ShutdownTimeout)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid SHUTDOWN_TIMEOUT value: %s", cfg.ShutdownTimeout)
+		}
+		cfg.shutdownTimeout = timeout
+	}
+	if err := cfg.TLS.validate(cfg.Port); err != nil {
+		return nil, err
+	}
+
+	cfg.Generic.Headers = file.Generic.Headers
+	if value := env.lookup("GENERIC_WEBHOOK_HEADERS"); value != "" {
+		headers, err := parseHeaders(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GENERIC_WEBHOOK_HEADERS: %w", err)
+		}
+		cfg.Generic.Headers = headers
+	}
+
+	if value := env.lookup("DISCORD_EDIT_MESSAGES"); value != "" {
+		edit, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DISCORD_EDIT_MESSAGES value: %s", value)
+		}
+		cfg.Discord.EditMessages = edit
+	}
+
+	if value := env.lookup("DISCORD_RETRIES"); value != "" {
+		retries, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DISCORD_RETRIES value: %s", value)
+		}
+		cfg.Discord.Retries = retries
+	}
+
+	cfg.Discord.Users = file.Discord.Users
+	if value := env.lookup("DISCORD_USERS"); value != "" {
+		users, err := parsePairs(value, "user_id")
+		if err != nil {
+			return nil, fmt.Errorf("invalid DISCORD_USERS: %w", err)
+		}
+		cfg.Discord.Users = users
+	}
+
+	cfg.IRC.TLS = file.IRC.TLS
+	if value := env.lookup("IRC_TLS"); value != "" {
+		useTLS, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IRC_TLS value: %s", value)
+		}
+		cfg.IRC.TLS = useTLS
+	}
+
+	cfg.Admin.DebugEndpoints = file.Admin.DebugEndpoints
+	if value := env.lookup("DEBUG_ENDPOINTS"); value != "" {
+		debug, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DEBUG_ENDPOINTS value: %s", value)
+		}
+		cfg.Admin.DebugEndpoints = debug
+	}
+	if cfg.Admin.Password != "" && cfg.Admin.Username == "" {
+		cfg.Admin.Username = "admin"
+	}
+
+	cfg.Replay = ReplayConfig{Disabled: file.Replay.Disabled, Tolerance: envOr("REPLAY_TOLERANCE", file.Replay.Tolerance)}
+	if value := env.lookup("REPLAY_PROTECTION"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REPLAY_PROTECTION value: %s", value)
+		}
+		cfg.Replay.Disabled = !enabled
+	}
+	if err := cfg.Replay.compile(); err != nil {
+		return nil, err
+	}
+
+	cfg.Dedup = DedupConfig{Disabled: file.Dedup.Disabled, Window: envOr("DEDUP_WINDOW", file.Dedup.Window)}
+	if value := env.lookup("DUPLICATE_SUPPRESSION"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DUPLICATE_SUPPRESSION value: %s", value)
+		}
+		cfg.Dedup.Disabled = !enabled
+	}
+	if err := cfg.Dedup.compile(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Audit.compile(); err != nil {
+		return nil, err
+	}
+
+	cfg.DestinationURLs = file.DestinationURLs
+	if value := env.lookup("DESTINATION_URLS"); value != "" {
+		cfg.DestinationURLs = strings.Fields(value)
+	}
+
+	cfg.RateLimit = file.RateLimit
+	for key, limit := range map[string]*int{
+		"RATE_LIMIT_PER_IP":  &cfg.RateLimit.PerIP,
+		"RATE_LIMIT_PER_JOB": &cfg.RateLimit.PerJob,
+		"RATE_LIMIT_BURST":   &cfg.RateLimit.Burst,
+	} {
+		if value := env.lookup(key); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value: %s", key, value)
+			}
+			*limit = n
+		}
+	}
+	if err := cfg.RateLimit.validate(); err != nil {
+		return nil, err
+	}
+
+	for key, n := range map[string]*int{
+		"QUEUE_WORKERS":       &cfg.Queue.Workers,
+		"QUEUE_MAX_ATTEMPTS":  &cfg.Queue.MaxAttempts,
+		"DELIVERY_WORKERS":    &cfg.Delivery.Workers,
+		"DELIVERY_QUEUE_SIZE": &cfg.Delivery.QueueSize,
+		"BREAKER_FAILURES":    &cfg.Breaker.Failures,
+	} {
+		if value := env.lookup(key); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value: %s", key, value)
+			}
+			*n = parsed
+		}
+	}
+	if err := cfg.Queue.compile(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Delivery.compile(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Breaker.compile(); err != nil {
+		return nil, err
+	}
+
+	cfg.Notifications.Timezone = envOr("TIMEZONE", file.Notifications.Timezone)
+	cfg.Notifications.DateFormat = envOr("DATE_FORMAT", file.Notifications.DateFormat)
+	cfg.Notifications.Mentions = envList("DISCORD_MENTIONS", file.Notifications.Mentions)
+	cfg.Notifications.MentionEvents = envList("DISCORD_MENTION_EVENTS", file.Notifications.MentionEvents)
+	if value := env.lookup("STATUS_COLORS"); value != "" {
+		colors, err := parsePairs(value, "color")
+		if err != nil {
+			return nil, fmt.Errorf("invalid STATUS_COLORS: %w", err)
+		}
+		cfg.Notifications.Colors = colors
+	}
+	cfg.Notifications.ParameterFields = envList("PARAMETER_FIELDS", file.Notifications.ParameterFields)
+	cfg.Notifications.RedactParameters = envList("REDACT_PARAMETERS", file.Notifications.RedactParameters)
+	cfg.Notifications.InstanceName = envOr("INSTANCE_NAME", file.Notifications.InstanceName)
+	// The environment sets the default footer, keeping the file's others
+	for name, footer := range map[string]*map[string]string{
+		"FOOTER_TEXT":     &cfg.Notifications.FooterTexts,
+		"FOOTER_ICON_URL": &cfg.Notifications.FooterIcons,
+	} {
+		if value := env.lookup(name); value != "" {
+			*footer = mergeStrings(*footer, map[string]string{"default": value})
+		}
+	}
+	if value := env.lookup("STATUS_TEXTS"); value != "" {
+		texts, err := parsePairs(value, "text")
+		if err != nil {
+			return nil, fmt.Errorf("invalid STATUS_TEXTS: %w", err)
+		}
+		cfg.Notifications.StatusTexts = texts
+	}
+
+	if env.err != nil {
+		return nil, env.err
+	}
+	if err := resolveEncryptedSecrets(cfg); err != nil {
+		return nil, err
+	}
+	if err := resolveVaultSecrets(cfg); err != nil {
+		return nil, err
+	}
+
+	if cfg.Auth.Header == "" {
+		cfg.Auth.Header = defaultTokenHeader
+	}
+	if cfg.Auth.QueryParam == "" {
+		cfg.Auth.QueryParam = defaultTokenQueryParam
+	}
+	for source := range cfg.Auth.Tokens {
+		if _, ok := sourceNames[source]; !ok {
+			return nil, fmt.Errorf("invalid auth tokens: unknown webhook source %q", source)
+		}
+	}
+	if err := cfg.Admin.loadJWTKey(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Admin.parseSessionTTL(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Allowlist.compile(); err != nil {
+		return nil, fmt.Errorf("invalid allowlist: %w", err)
+	}
+
+	if cfg.Travis.APIURL == "" {
+		cfg.Travis.APIURL = defaultTravisAPIURL
+	}
+
+	if cfg.Harbor.SeverityThreshold == "" {
+		cfg.Harbor.SeverityThreshold = "High"
+	}
+	if harborSeverityRank(cfg.Harbor.SeverityThreshold) < 0 {
+		return nil, fmt.Errorf("invalid HARBOR_SEVERITY_THRESHOLD value: %s", cfg.Harbor.SeverityThreshold)
+	}
+
+	cfg.JenkinsConsoleLines = file.JenkinsConsoleLines
+	if value := env.lookup("JENKINS_CONSOLE_LINES"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JENKINS_CONSOLE_LINES value: %s", value)
+		}
+		cfg.JenkinsConsoleLines = n
+	}
+	if cfg.JenkinsConsoleLines < 0 || cfg.JenkinsConsoleLines > maxConsoleLines {
+		return nil, fmt.Errorf("invalid JENKINS_CONSOLE_LINES value: %d", cfg.JenkinsConsoleLines)
+	}
+	cfg.JenkinsArtifacts = file.JenkinsArtifacts
+	if value := env.lookup("JENKINS_ARTIFACTS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JENKINS_ARTIFACTS value: %s", value)
+		}
+		cfg.JenkinsArtifacts = n
+	}
+	if cfg.JenkinsArtifacts < 0 || cfg.JenkinsArtifacts > maxArtifacts {
+		return nil, fmt.Errorf("invalid JENKINS_ARTIFACTS value: %d", cfg.JenkinsArtifacts)
+	}
+	if (cfg.JenkinsUser == "") != (cfg.JenkinsAPIToken == "") {
+		return nil, fmt.Errorf("JENKINS_USER and JENKINS_API_TOKEN must be set together")
+	}
+	if cfg.JenkinsUser != "" && cfg.JenkinsURL == "" {
+		return nil, fmt.Errorf("JENKINS_URL is required with JENKINS_API_TOKEN")
+	}
+
+	if err := cfg.validateDestinations(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Notifications.compile(); err != nil {
+		return nil, fmt.Errorf("invalid notifications: %w", err)
+	}
+	for i := range cfg.Jobs {
+		job := &cfg.Jobs[i]
+		if err := job.JobMatch.compile(); err != nil {
+			return nil, fmt.Errorf("invalid job override %d: %w", i+1, err)
+		}
+		if err := job.NotifySettings.compile(); err != nil {
+			return nil, fmt.Errorf("invalid job override %d: %w", i+1, err)
+		}
+	}
+	for i := range cfg.Classifiers {
+		if err := cfg.Classifiers[i].compile(); err != nil {
+			return nil, fmt.Errorf("invalid classifier %d: %w", i+1, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// readConfigFile parses the YAML config file with the named profile applied,
+// rejecting unknown keys so typos don't silently leave settings unset
+func readConfigFile(path, profile string) (*Config, error) {
+	content, _, _, err := fetchConfig(path, "")
+	if err != nil {
+		return nil, err
+	}
+	path = configDisplayName(path)
+
+	// Profiles and secret file keys are resolved on the node tree, which is
+	// then encoded again because only a Decoder can reject unknown keys.
+	// Files without either are decoded as written so error line numbers
+	// stay right.
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	profiled, err := applyProfile(&doc, profile)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	resolved, err := resolveSecretFiles(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	if profiled || resolved {
+		if content, err = yaml.Marshal(&doc); err != nil {
+			return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+		}
+	}
+
+	cfg := &Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// validateDestinations checks the destination settings and fills in defaults
+func (c *Config) validateDestinations() error {
+	// A bot token without a default channel is fine when routes pick the channel
+	if (c.Discord.BotToken == "") != (c.Discord.ChannelID == "") &&
+		(c.Discord.ChannelID != "" || len(c.Discord.Routes) == 0) {
+		return fmt.Errorf("DISCORD_BOT_TOKEN and DISCORD_CHANNEL_ID must be set together")
+	}
+	if c.Discord.Format != "" && !containsString(discordFormats, c.Discord.Format) {
+		return fmt.Errorf("invalid DISCORD_FORMAT value: %s", c.Discord.Format)
+	}
+	if c.Discord.PublicKey != "" {
+		if key, err := hex.DecodeString(c.Discord.PublicKey); err != nil || len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("invalid DISCORD_PUBLIC_KEY: expected %d hex encoded bytes", ed25519.PublicKeySize)
+		}
+		if c.Discord.BotToken == "" {
+			return fmt.Errorf("DISCORD_PUBLIC_KEY requires DISCORD_BOT_TOKEN")
+		}
+	}
+	if c.Discord.Digest != "" {
+		digest, err := time.ParseDuration(c.Discord.Digest)
+		if err != nil || digest <= 0 {
+			return fmt.Errorf("invalid DISCORD_DIGEST value: %s", c.Discord.Digest)
+		}
+		c.Discord.digest = digest
+	}
+	if c.Discord.Retries < 0 {
+		return fmt.Errorf("invalid DISCORD_RETRIES value: %d", c.Discord.Retries)
+	}
+	c.Discord.retryBackoff = defaultRetryBackoff
+	if c.Discord.RetryBackoff != "" {
+		backoff, err := time.ParseDuration(c.Discord.RetryBackoff)
+		if err != nil || backoff <= 0 {
+			return fmt.Errorf("invalid DISCORD_RETRY_BACKOFF value: %s", c.Discord.RetryBackoff)
+		}
+		c.Discord.retryBackoff = backoff
+	}
+	if c.Discord.Threads != "" {
+		if !containsString(threadModes, c.Discord.Threads) {
+			return fmt.Errorf("invalid DISCORD_THREADS value: %s", c.Discord.Threads)
+		}
+		if c.Discord.BotToken == "" {
+			return fmt.Errorf("DISCORD_THREADS requires DISCORD_BOT_TOKEN")
+		}
+	}
+	for i := range c.Discord.Routes {
+		route := &c.Discord.Routes[i]
+		if err := route.compile(); err != nil {
+			return fmt.Errorf("invalid discord route %d: %w", i+1, err)
+		}
+		if route.Format != "" && !containsString(discordFormats, route.Format) {
+			return fmt.Errorf("invalid discord route %d: format must be one of %s", i+1, strings.Join(discordFormats, ", "))
+		}
+		if (route.WebhookURL == "") == (route.ChannelID == "") {
+			return fmt.Errorf("invalid discord route %d: exactly one of webhook_url or channel_id is required", i+1)
+		}
+		if route.ChannelID != "" && c.Discord.BotToken == "" {
+			return fmt.Errorf("invalid discord route %d: channel_id requires DISCORD_BOT_TOKEN", i+1)
+		}
+	}
+	for name, id := range c.Discord.Users {
+		if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+			return fmt.Errorf("invalid Discord user ID %q for %s", id, name)
+		}
+	}
+
+	if (c.Telegram.BotToken == "") != (c.Telegram.ChatID == "") {
+		return fmt.Errorf("TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID must be set together")
+	}
+
+	if c.SMTP.Host != "" {
+		if c.SMTP.Port == "" {
+			c.SMTP.Port = "587"
+		}
+		if _, err := strconv.Atoi(c.SMTP.Port); err != nil {
+			return fmt.Errorf("invalid SMTP_PORT value: %s", c.SMTP.Port)
+		}
+		if c.SMTP.From == "" || len(c.SMTP.To) == 0 {
+			return fmt.Errorf("SMTP_FROM and SMTP_TO are required when SMTP_HOST is set")
+		}
+		switch c.SMTP.TLS {
+		case "":
+			c.SMTP.TLS = "starttls"
+		case "starttls", "tls", "none":
+		default:
+			return fmt.Errorf("invalid SMTP_TLS value: %s (expected starttls, tls or none)", c.SMTP.TLS)
+		}
+	}
+
+	if c.Twilio.AccountSID != "" {
+		if c.Twilio.AuthToken == "" || c.Twilio.FromNumber == "" || len(c.Twilio.ToNumbers) == 0 {
+			return fmt.Errorf("TWILIO_AUTH_TOKEN, TWILIO_FROM_NUMBER and TWILIO_TO_NUMBERS are required when TWILIO_ACCOUNT_SID is set")
+		}
+	}
+
+	if c.Opsgenie.APIURL == "" {
+		c.Opsgenie.APIURL = "https://api.opsgenie.com"
+	}
+
+	if c.Generic.Method == "" {
+		c.Generic.Method = "POST"
+	}
+	if c.Generic.ContentType == "" {
+		c.Generic.ContentType = "application/json"
+	}
+
+	if c.Ntfy.URL == "" {
+		c.Ntfy.URL = "https://ntfy.sh"
+	}
+
+	if c.SNS.TopicARN != "" {
+		if !strings.HasPrefix(c.SNS.TopicARN, "arn:") {
+			return fmt.Errorf("invalid SNS_TOPIC_ARN value: %s", c.SNS.TopicARN)
+		}
+		if c.SNS.Credentials.AccessKeyID == "" || c.SNS.Credentials.SecretAccessKey == "" {
+			return fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required when SNS_TOPIC_ARN is set")
+		}
+	}
+
+	if c.Zulip.Site != "" {
+		if c.Zulip.BotEmail == "" || c.Zulip.APIKey == "" || c.Zulip.Stream == "" {
+			return fmt.Errorf("ZULIP_BOT_EMAIL, ZULIP_API_KEY and ZULIP_STREAM are required when ZULIP_SITE is set")
+		}
+	}
+
+	if (c.Webex.BotToken == "") != (c.Webex.RoomID == "") {
+		return fmt.Errorf("WEBEX_BOT_TOKEN and WEBEX_ROOM_ID must be set together")
+	}
+
+	if c.IRC.Server != "" {
+		if _, _, err := net.SplitHostPort(c.IRC.Server); err != nil {
+			return fmt.Errorf("invalid IRC_SERVER value (expected host:port): %s", c.IRC.Server)
+		}
+		if c.IRC.Channel == "" {
+			return fmt.Errorf("IRC_CHANNEL is required when IRC_SERVER is set")
+		}
+		if c.IRC.Nick == "" {
+			c.IRC.Nick = "jenkins"
+		}
+	}
+
+	if c.XMPP.JID != "" {
+		if !strings.Contains(c.XMPP.JID, "@") || c.XMPP.Password == "" {
+			return fmt.Errorf("XMPP_JID must be user@domain and XMPP_PASSWORD is required")
+		}
+		if c.XMPP.Room == "" && len(c.XMPP.To) == 0 {
+			return fmt.Errorf("XMPP_ROOM or XMPP_TO is required when XMPP_JID is set")
+		}
+		if c.XMPP.Nick == "" {
+			c.XMPP.Nick = "jenkins"
+		}
+	}
+
+	if (c.Gotify.URL == "") != (c.Gotify.AppToken == "") {
+		return fmt.Errorf("GOTIFY_URL and GOTIFY_APP_TOKEN must be set together")
+	}
+
+	return nil
+}
+
+// splitList parses a comma-separated environment value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseHeaders parses a comma-separated list of "Name: value" pairs
+func parseHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, item := range splitList(value) {
+		name, val, ok := strings.Cut(item, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("expected \"Name: value\", got %q", item)
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(val)
+	}
+	return headers, nil
+}
+
+// parsePairs parses a comma-separated list of "name=value" pairs, naming
+// the value in errors
+func parsePairs(value, what string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, item := range splitList(value) {
+		name, v, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("expected \"name=%s\", got %q", what, item)
+		}
+		pairs[strings.TrimSpace(name)] = strings.TrimSpace(v)
+	}
+	return pairs, nil
+}
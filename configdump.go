@@ -0,0 +1,208 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "<redacted>"
+
+// configCommand runs the config subcommands
+func configCommand(args []string) error {
+	if len(args) == 0 || args[0] != "dump" {
+		return fmt.Errorf("usage: %s config dump [flags]", os.Args[0])
+	}
+	return dumpConfig(args[1:])
+}
+
+// dumpConfig prints the effective configuration, after the config file
+// profile, environment variables and secrets are applied, with secrets
+// redacted. With --job it also explains how a build of that job is notified.
+func dumpConfig(args []string) error {
+	flags := flag.NewFlagSet("config dump", flag.ExitOnError)
+	configPath := configFlag(flags)
+	job := flags.String("job", "", "explain which settings and routes apply to builds of this job")
+	branch := flags.String("branch", "", "branch of the --job build")
+	event := flags.String("event", "failure", "event of the --job build")
+	flags.Parse(args)
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := doc.Encode(config); err != nil {
+		return err
+	}
+	redactNode(&doc, "")
+	pruneNode(&doc)
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+
+	if *job != "" {
+		handler, err := NewWebhookHandler(config)
+		if err != nil {
+			return fmt.Errorf("invalid configuration: %w", err)
+		}
+		if err := encoder.Encode(explainBuild(handler.state.Load(), config, *job, *branch, *event)); err != nil {
+			return err
+		}
+	}
+	return encoder.Close()
+}
+
+// buildExplanation shows how one build would be notified
+type buildExplanation struct {
+	Job      string    `yaml:"job"`
+	Branch   string    `yaml:"branch,omitempty"`
+	Event    string    `yaml:"event"`
+	Notified bool      `yaml:"notified"`
+	Matched  []int     `yaml:"matched_job_overrides,omitempty"`
+	Settings yaml.Node `yaml:"settings"`
+	Discord  string    `yaml:"discord,omitempty"`
+}
+
+func explainBuild(state *handlerState, config *Config, job, branch, event string) buildExplanation {
+	build := testBuild(job, event)
+	if branch != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Branch", Value: branch})
+	}
+
+	explanation := buildExplanation{Job: job, Branch: branch, Event: event}
+	for i, override := range state.jobs {
+		if override.matches(build) {
+			explanation.Matched = append(explanation.Matched, i+1)
+		}
+	}
+
+	settings := state.notifySettings(build)
+	explanation.Notified = settings.apply(&build)
+	explanation.Settings.Encode(settings)
+	pruneNode(&explanation.Settings)
+
+	if config.Discord.WebhookURL != "" || config.Discord.botMode() || len(config.Discord.Routes) > 0 {
+		target := config.Discord.target(build)
+		switch {
+		case target.channelID != "":
+			explanation.Discord = "channel " + target.channelID
+		case target.webhookURL != "":
+			explanation.Discord = redactURLPath(target.webhookURL)
+		default:
+			explanation.Discord = "skipped, no route matches"
+		}
+	}
+	return explanation
+}
+
+// secretSettings are config keys, matched by suffix, whose values are secrets
+var secretSettings = []string{"token", "secret", "password", "api_key", "routing_key", "secret_access_key", "auth_header"}
+
+// redactNode masks the secrets in an encoded config under the dotted key path
+func redactNode(node *yaml.Node, path string) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			redactNode(child, path)
+		}
+	case yaml.SequenceNode:
+		for _, child := range node.Content {
+			if path == "destination_urls" {
+				// Destination URLs carry their credentials in every part
+				scheme, _, _ := strings.Cut(child.Value, "://")
+				child.SetString(scheme + "://" + redacted)
+				continue
+			}
+			redactNode(child, path)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			child := key
+			if path != "" {
+				child = path + "." + key
+			}
+			if (path == "generic.headers" || path == "auth.tokens") && value.Value != "" {
+				value.SetString(redacted)
+				continue
+			}
+			redactValue(key, child, value)
+			redactNode(value, child)
+		}
+	}
+}
+
+// redactValue masks a single setting: secrets entirely, webhook URLs past
+// their host, and passwords in any other URL
+func redactValue(key, path string, value *yaml.Node) {
+	if value.Kind != yaml.ScalarNode || value.Value == "" {
+		return
+	}
+	for _, suffix := range secretSettings {
+		if strings.HasSuffix(key, suffix) {
+			value.SetString(redacted)
+			return
+		}
+	}
+	if path == "encryption.key" {
+		value.SetString(redacted)
+		return
+	}
+	if key == "webhook_url" || path == "grafana_oncall.url" {
+		value.SetString(redactURLPath(value.Value))
+		return
+	}
+	if u, err := url.Parse(value.Value); err == nil && u.User != nil {
+		value.SetString(u.Redacted())
+	}
+}
+
+// redactURLPath keeps the scheme and host of a URL whose path holds a token
+func redactURLPath(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+	return u.Scheme + "://" + u.Host + "/" + redacted
+}
+
+// pruneNode drops unset settings so the dump shows what is configured
+func pruneNode(node *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			pruneNode(child)
+		}
+		return false
+	case yaml.SequenceNode:
+		content := node.Content[:0]
+		for _, child := range node.Content {
+			if !pruneNode(child) {
+				content = append(content, child)
+			}
+		}
+		node.Content = content
+		return len(content) == 0
+	case yaml.MappingNode:
+		content := node.Content[:0]
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if !pruneNode(node.Content[i+1]) {
+				content = append(content, node.Content[i], node.Content[i+1])
+			}
+		}
+		node.Content = content
+		return len(content) == 0
+	case yaml.ScalarNode:
+		return node.Value == "" || node.Tag == "!!null" || (node.Tag == "!!bool" && node.Value == "false")
+	}
+	return false
+}
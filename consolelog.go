@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// maxConsoleLines is the most console log lines a notification may show
+const maxConsoleLines = 100
+
+// consoleLineLimit is where long console log lines are cut off
+const consoleLineLimit = 200
+
+// ansiEscape matches the color codes of the AnsiColor plugin in console logs
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// fetchConsoleTail reads the last lines of the console log of the build at
+// buildURL from the Jenkins API
+func (s jenkinsSource) fetchConsoleTail(buildURL string, lines int) (string, error) {
+	resp, err := s.apiGet(buildURL, "consoleText")
+	if err != nil || resp == nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	tail, err := tailLines(resp.Body, lines)
+	if err != nil {
+		return "", fmt.Errorf("error reading console log: %w", err)
+	}
+	return ansiEscape.ReplaceAllString(strings.Join(tail, "\n"), ""), nil
+}
+
+// tailLines returns the last n lines of r, each cut at consoleLineLimit
+// bytes. The log is streamed, so only those lines are kept in memory.
+func tailLines(r io.Reader, n int) ([]string, error) {
+	reader := bufio.NewReader(r)
+	ring := make([]string, 0, n)
+	next := 0
+	for {
+		line, isPrefix, err := reader.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		text := string(line)
+		if len(text) > consoleLineLimit {
+			text = strings.ToValidUTF8(text[:consoleLineLimit], "") + "…"
+		}
+		// Skip the rest of a line longer than the reader's buffer
+		for isPrefix {
+			if _, isPrefix, err = reader.ReadLine(); err != nil {
+				break
+			}
+		}
+
+		if len(ring) < n {
+			ring = append(ring, text)
+		} else {
+			ring[next] = text
+		}
+		next = (next + 1) % n
+	}
+	if len(ring) < n {
+		return ring, nil
+	}
+	return append(ring[next:], ring[:next]...), nil
+}
+
+// addConsoleLog adds the tail of the console log of a failed build. Errors
+// are logged, as the build is notified either way.
+func (s jenkinsSource) addConsoleLog(build *BuildEvent, buildURL string) {
+	if s.consoleLines <= 0 || build.Event != "failure" {
+		return
+	}
+	tail, err := s.fetchConsoleTail(buildURL, s.consoleLines)
+	if err != nil {
+		log.Printf("Error fetching console log for %s %s: %v", build.ProjectName, build.BuildName, err)
+		return
+	}
+	build.ConsoleLog = tail
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultDedupWindow is how long an event is remembered to drop its
+// duplicates
+const defaultDedupWindow = 5 * time.Minute
+
+// DedupConfig drops events that repeat one of the same job, build and phase
+// seen within Window, as sent by Jenkins plugins retrying a delivery or by
+// two notifiers configured for the same job
+type DedupConfig struct {
+	Disabled bool   `yaml:"disabled"`
+	Window   string `yaml:"window"`
+	window   time.Duration
+}
+
+func (c *DedupConfig) compile() error {
+	if c.Window == "" {
+		c.window = defaultDedupWindow
+		return nil
+	}
+	window, err := time.ParseDuration(c.Window)
+	if err != nil || window <= 0 {
+		return fmt.Errorf("invalid DEDUP_WINDOW value: %s", c.Window)
+	}
+	c.window = window
+	return nil
+}
+
+// runIDSources are the sources whose BuildName is shared by several runs,
+// such as the name of a Spinnaker pipeline or of a SonarQube branch, so only
+// their RunID tells the events of two runs apart
+var runIDSources = map[string]bool{
+	"alertmanager": true,
+	"argocd":       true,
+	"harbor":       true,
+	"sonarqube":    true,
+	"spinnaker":    true,
+}
+
+// key identifies the event among its duplicates, reporting false for events
+// that can't be told apart from other runs
+func (c DedupConfig) key(build BuildEvent) (string, bool) {
+	run := build.BuildName
+	if build.RunID != "" {
+		run = build.RunID
+	} else if runIDSources[build.Source] {
+		return "", false
+	}
+	if c.Disabled || build.ProjectName == "" || run == "" {
+		return "", false
+	}
+	return build.Source + "\x00" + build.ProjectName + "\x00" + run + "\x00" + build.Event, true
+}
+
+// allFailed reports whether no destination took the event
+func allFailed(results []deliveryResult) bool {
+	for _, r := range results {
+		if r.Status != "error" {
+			return false
+		}
+	}
+	return len(results) > 0
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDedupKey(t *testing.T) {
+	cfg := DedupConfig{window: defaultDedupWindow}
+	build := BuildEvent{Source: "jenkins", ProjectName: "app", BuildName: "#1", Event: "failure"}
+	key, ok := cfg.key(build)
+	if !ok {
+		t.Fatal("key() = false for a named build")
+	}
+
+	tests := []struct {
+		name   string
+		build  BuildEvent
+		cfg    DedupConfig
+		ok     bool
+		sameAs bool
+	}{
+		{"same event", build, cfg, true, true},
+		{"other phase", BuildEvent{Source: "jenkins", ProjectName: "app", BuildName: "#1", Event: "started"}, cfg, true, false},
+		{"other build", BuildEvent{Source: "jenkins", ProjectName: "app", BuildName: "#2", Event: "failure"}, cfg, true, false},
+		{"other source", BuildEvent{Source: "gitlab", ProjectName: "app", BuildName: "#1", Event: "failure"}, cfg, true, false},
+		{"no build name", BuildEvent{Source: "jenkins", ProjectName: "app", Event: "failure"}, cfg, false, false},
+		{"disabled", build, DedupConfig{Disabled: true}, false, false},
+		{"run of a shared name", BuildEvent{Source: "spinnaker", ProjectName: "shop", BuildName: "Deploy", RunID: "01HX", Event: "success"}, cfg, true, false},
+		{"shared name without a run", BuildEvent{Source: "spinnaker", ProjectName: "shop", BuildName: "Deploy", Event: "success"}, cfg, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.cfg.key(tt.build)
+			if ok != tt.ok {
+				t.Fatalf("key() ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && (got == key) != tt.sameAs {
+				t.Errorf("key() = %q, same as the first event's: %v, want %v", got, got == key, tt.sameAs)
+			}
+		})
+	}
+}
+
+func TestDedupDropsRepeatedEvents(t *testing.T) {
+	setBreakers(t, -1, defaultBreakerCooldown)
+	slack := newRecordingServer(t, http.StatusOK, "ok")
+	mattermost := newRecordingServer(t, http.StatusInternalServerError, "down")
+	status := func(rec *httptest.ResponseRecorder) string {
+		var response struct {
+			Status string `json:"status"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		return response.Status
+	}
+
+	t.Run("delivered", func(t *testing.T) {
+		w := newTestHandler(t, "slack:\n  webhook_url: "+slack.server.URL+"\ndelivery:\n  workers: -1\n")
+		body := `{"projectName": "app", "buildName": "#1", "event": "failure"}`
+		for _, want := range []string{"success", "duplicate"} {
+			rec := postWebhook(t, w, "/webhook", nil, body)
+			if got := status(rec); rec.Code != http.StatusOK || got != want {
+				t.Errorf("answered %d %q, want 200 %q", rec.Code, got, want)
+			}
+		}
+		if n := len(slack.requests()); n != 1 {
+			t.Errorf("Slack got %d posts, want 1", n)
+		}
+		rec := postWebhook(t, w, "/webhook", nil, `{"projectName": "app", "buildName": "#1", "event": "success"}`)
+		if got := status(rec); got != "success" {
+			t.Errorf("next phase answered %q, want it delivered", got)
+		}
+	})
+
+	t.Run("failed everywhere", func(t *testing.T) {
+		w := newTestHandler(t, "mattermost:\n  webhook_url: "+mattermost.server.URL+"\ndelivery:\n  workers: -1\n")
+		body := `{"projectName": "app", "buildName": "#1", "event": "failure"}`
+		for i := 0; i < 2; i++ {
+			if rec := postWebhook(t, w, "/webhook", nil, body); rec.Code != http.StatusInternalServerError {
+				t.Errorf("attempt %d answered %d, want the failure so the sender retries", i+1, rec.Code)
+			}
+		}
+		if n := len(mattermost.requests()); n != 2 {
+			t.Errorf("Mattermost got %d posts, want the retry delivered too", n)
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// deliveryLogSize is how many deliveries are kept for GET /api/deliveries
+const deliveryLogSize = 1000
+
+// deliveryAttempt is one attempt at sending an event to a destination.
+// StatusCode is the HTTP status of a rejected request.
+type deliveryAttempt struct {
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"status_code,omitempty"`
+	LatencyMS  int64     `json:"latency_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// deliveryRecord tracks the delivery of one event to one destination,
+// across the retries of the destination and of the outbound queue. Its
+// status is "delivered", "failed", "retrying", "queued" or "skipped" when
+// the destination's circuit was open.
+type deliveryRecord struct {
+	ID          int               `json:"id"`
+	Time        time.Time         `json:"time"`
+	Source      string            `json:"source"`
+	Job         string            `json:"job"`
+	Build       string            `json:"build"`
+	Event       string            `json:"event"`
+	Destination string            `json:"destination"`
+	Status      string            `json:"status"`
+	Retries     int               `json:"retries"`
+	Attempts    []deliveryAttempt `json:"attempts"`
+}
+
+// deliveries records the deliveries of this process
+var deliveries = newDeliveryLog()
+
+// deliveryLog keeps the most recent deliveries
+type deliveryLog struct {
+	mu      sync.Mutex
+	records []*deliveryRecord
+	nextID  int
+}
+
+func newDeliveryLog() *deliveryLog {
+	return &deliveryLog{nextID: 1}
+}
+
+// start records a delivery of the event to destination, dropping the
+// oldest one when the log is full
+func (l *deliveryLog) start(build BuildEvent, destination, status string) *deliveryRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	record := &deliveryRecord{
+		ID:          l.nextID,
+		Time:        time.Now(),
+		Source:      build.Source,
+		Job:         build.ProjectName,
+		Build:       build.BuildName,
+		Event:       build.Event,
+		Destination: destination,
+		Status:      status,
+		Attempts:    []deliveryAttempt{},
+	}
+	l.nextID++
+	l.records = append(l.records, record)
+	if len(l.records) > deliveryLogSize {
+		l.records = l.records[len(l.records)-deliveryLogSize:]
+	}
+	return record
+}
+
+// attempt records an attempt that started at started and ended with err
+func (l *deliveryLog) attempt(record *deliveryRecord, started time.Time, err error) {
+	if record == nil {
+		return
+	}
+	attempt := deliveryAttempt{Time: started, LatencyMS: time.Since(started).Milliseconds()}
+	if err != nil {
+		attempt.Error = err.Error()
+		var statusErr statusError
+		if errors.As(err, &statusErr) {
+			attempt.StatusCode = statusErr.status
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(record.Attempts) > 0 {
+		record.Retries++
+	}
+	record.Attempts = append(record.Attempts, attempt)
+	switch {
+	case err == nil:
+		record.Status = "delivered"
+	case errors.Is(err, errCircuitOpen):
+		record.Status = "skipped"
+	case errors.As(err, &retryingError{}):
+		record.Status = "retrying"
+	default:
+		record.Status = "failed"
+	}
+}
+
+// setStatus updates the status of a delivery whose failed attempt is retried
+func (l *deliveryLog) setStatus(record *deliveryRecord, status string) {
+	if record == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	record.Status = status
+}
+
+// query returns copies of the deliveries matching the filter, newest first
+func (l *deliveryLog) query(job, build, destination string, limit int) []deliveryRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records := []deliveryRecord{}
+	for i := len(l.records) - 1; i >= 0 && len(records) < limit; i-- {
+		record := l.records[i]
+		if job != "" && !globMatch(job, record.Job) {
+			continue
+		}
+		if build != "" && strings.TrimPrefix(record.Build, "#") != strings.TrimPrefix(build, "#") {
+			continue
+		}
+		if destination != "" && record.Destination != destination {
+			continue
+		}
+		copied := *record
+		copied.Attempts = append([]deliveryAttempt(nil), record.Attempts...)
+		records = append(records, copied)
+	}
+	return records
+}
+
+// send delivers the event to d through its circuit breaker, recording the
+// attempt in record
+func send(d Destination, build BuildEvent, record *deliveryRecord) error {
+	build.delivery = record
+	started := time.Now()
+	err := destinationBreakers.call(circuitName(d, build), func() error { return d.Send(build) })
+	deliveries.attempt(record, started, err)
+	return err
+}
+
+// handleListDeliveries returns the recorded deliveries, newest first,
+// filtered by the job (a name or glob pattern), build and destination query
+// parameters
+func (w *WebhookHandler) handleListDeliveries(c echo.Context) error {
+	limit := 100
+	if value := c.QueryParam("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid limit"})
+		}
+		if n > deliveryLogSize {
+			n = deliveryLogSize
+		}
+		limit = n
+	}
+	records := deliveries.query(c.QueryParam("job"), c.QueryParam("build"), c.QueryParam("destination"), limit)
+	return c.JSON(http.StatusOK, map[string]interface{}{"deliveries": records})
+}
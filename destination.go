@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Destination delivers build events to one external system
+type Destination interface {
+	// Name names the kind of destination in DESTINATIONS
+	Name() string
+	// ID identifies the destination in logs, responses, queued deliveries
+	// and circuit breakers, telling destinations of the same kind apart
+	ID() string
+	// Send delivers the event, returning nil when the destination
+	// deliberately ignores it (e.g. SMS for successful builds)
+	Send(build BuildEvent) error
+}
+
+// destinationID is embedded by every destination to hold its ID
+type destinationID struct {
+	id string
+}
+
+func (d *destinationID) ID() string {
+	return d.id
+}
+
+func (d *destinationID) setID(id string) {
+	d.id = id
+}
+
+// httpSender is embedded by destinations that talk HTTP
+type httpSender struct {
+	client *http.Client
+}
+
+// buildDestinations creates every configured destination, limited to the
+// ones named in config.Destinations when that list is set, followed by the
+// ones declared in config.DestinationURLs. Configured destinations are
+// identified by their name, and URL-declared ones by their name and a
+// digest of the URL, so the deliveries queued for them find them again
+// after a restart.
+func buildDestinations(config *Config, client *http.Client) ([]Destination, error) {
+	configured, err := configuredDestinations(config, client)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range configured {
+		d.(interface{ setID(string) }).setID(d.Name())
+	}
+
+	selected := configured
+	if len(config.Destinations) > 0 {
+		byName := make(map[string]Destination, len(configured))
+		for _, d := range configured {
+			byName[d.Name()] = d
+		}
+
+		selected = nil
+		for _, name := range config.Destinations {
+			d, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("destination %q is listed in DESTINATIONS but not configured", name)
+			}
+			selected = append(selected, d)
+		}
+	}
+
+	for _, raw := range config.DestinationURLs {
+		urlConfig, err := parseDestinationURL(raw)
+		if err == nil {
+			urlConfig.JenkinsURL = config.JenkinsURL
+			err = urlConfig.validateDestinations()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s:// destination URL: %w", destinationURLScheme(raw), err)
+		}
+
+		declared, err := configuredDestinations(urlConfig, client)
+		if err != nil {
+			return nil, err
+		}
+		digest := sha256.Sum256([]byte(raw))
+		for _, d := range declared {
+			d.(interface{ setID(string) }).setID(d.Name() + "-" + hex.EncodeToString(digest[:4]))
+		}
+		selected = append(selected, declared...)
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("at least one destination must be configured (e.g. DISCORD_WEBHOOK_URL or DESTINATION_URLS)")
+	}
+	ids := make(map[string]bool, len(selected))
+	for _, d := range selected {
+		if ids[d.ID()] {
+			return nil, fmt.Errorf("destination %s is declared more than once", d.ID())
+		}
+		ids[d.ID()] = true
+	}
+	return selected, nil
+}
+
+// configuredDestinations creates a destination for every service that has
+// settings in config
+func configuredDestinations(config *Config, client *http.Client) ([]Destination, error) {
+	sender := httpSender{client: client}
+	source := alertSource(config)
+
+	var configured []Destination
+	if config.Discord.WebhookURL != "" || config.Discord.botMode() || len(config.Discord.Routes) > 0 {
+		configured = append(configured, &discordDestination{httpSender: sender, cfg: config.Discord, jenkins: newJenkinsSource(config, client)})
+	}
+	if config.Slack.WebhookURL != "" {
+		configured = append(configured, &slackDestination{httpSender: sender, cfg: config.Slack})
+	}
+	if config.Telegram.BotToken != "" {
+		configured = append(configured, &telegramDestination{httpSender: sender, cfg: config.Telegram})
+	}
+	if config.Mattermost.WebhookURL != "" {
+		configured = append(configured, &mattermostDestination{httpSender: sender, cfg: config.Mattermost})
+	}
+	if config.RocketChat.WebhookURL != "" {
+		configured = append(configured, &rocketChatDestination{httpSender: sender, cfg: config.RocketChat})
+	}
+	if config.GoogleChat.WebhookURL != "" {
+		configured = append(configured, &googleChatDestination{httpSender: sender, cfg: config.GoogleChat})
+	}
+	if config.SMTP.Host != "" {
+		configured = append(configured, &emailDestination{cfg: config.SMTP})
+	}
+	if config.Twilio.AccountSID != "" {
+		configured = append(configured, &twilioDestination{httpSender: sender, cfg: config.Twilio})
+	}
+	if config.PagerDuty.RoutingKey != "" {
+		configured = append(configured, &pagerDutyDestination{
+			httpSender: sender,
+			cfg:        config.PagerDuty,
+			source:     source,
+			incidents:  newPagerDutyIncidents(),
+		})
+	}
+	if config.Opsgenie.APIKey != "" {
+		configured = append(configured, &opsgenieDestination{httpSender: sender, cfg: config.Opsgenie, source: source})
+	}
+	if config.Generic.URL != "" {
+		tmpl, err := parseGenericTemplate(config.Generic)
+		if err != nil {
+			return nil, err
+		}
+		configured = append(configured, &genericDestination{httpSender: sender, cfg: config.Generic, template: tmpl})
+	}
+	if config.Ntfy.Topic != "" {
+		configured = append(configured, &ntfyDestination{httpSender: sender, cfg: config.Ntfy})
+	}
+	if config.SNS.TopicARN != "" {
+		configured = append(configured, &snsDestination{httpSender: sender, cfg: config.SNS})
+	}
+	if config.Zulip.Site != "" {
+		configured = append(configured, &zulipDestination{httpSender: sender, cfg: config.Zulip})
+	}
+	if config.Webex.BotToken != "" {
+		configured = append(configured, &webexDestination{httpSender: sender, cfg: config.Webex})
+	}
+	if config.IRC.Server != "" {
+		configured = append(configured, &ircDestination{cfg: config.IRC})
+	}
+	if config.XMPP.JID != "" {
+		configured = append(configured, &xmppDestination{cfg: config.XMPP})
+	}
+	if config.Gotify.URL != "" {
+		configured = append(configured, &gotifyDestination{httpSender: sender, cfg: config.Gotify})
+	}
+	if config.GrafanaOnCall.URL != "" {
+		configured = append(configured, &grafanaOnCallDestination{httpSender: sender, cfg: config.GrafanaOnCall})
+	}
+
+	return configured, nil
+}
+
+// alertSource names the system alerts originate from
+func alertSource(config *Config) string {
+	if config.JenkinsURL != "" {
+		return config.JenkinsURL
+	}
+	return "jenkins"
+}
+
+// postJSON marshals payload and POSTs it to url with any extra headers,
+// treating non-2xx responses as errors
+func (h httpSender) postJSON(url string, payload interface{}, headers map[string]string) error {
+	return h.requestJSON("POST", url, payload, nil, headers)
+}
+
+// requestJSON sends payload as JSON with the given method and decodes the
+// response into out, unless out is nil
+func (h httpSender) requestJSON(method, url string, payload, out interface{}, headers map[string]string) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling payload: %w", err)
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	return h.doRequest(req, out)
+}
+
+// statusError is returned for non-2xx responses. retryAfter is how long a
+// rate limited response asked to wait.
+type statusError struct {
+	status     int
+	retryAfter time.Duration
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("API returned status: %d", e.status)
+}
+
+// hasStatus reports whether err is a response with the given status
+func hasStatus(err error, status int) bool {
+	var statusErr statusError
+	return errors.As(err, &statusErr) && statusErr.status == status
+}
+
+// sendRequest performs req and treats non-2xx responses as errors
+func (h httpSender) sendRequest(req *http.Request) error {
+	return h.doRequest(req, nil)
+}
+
+// doRequest performs req, treating non-2xx responses as errors, and decodes
+// the response into out, unless out is nil
+func (h httpSender) doRequest(req *http.Request, out interface{}) error {
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, out)
+}
+
+// decodeResponse treats non-2xx responses as errors and decodes the
+// response into out, unless out is nil
+func decodeResponse(resp *http.Response, out interface{}) error {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return statusError{status: resp.StatusCode, retryAfter: retryAfter(resp.Header)}
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("error decoding response: %w", err)
+		}
+	}
+	return nil
+}
+
+// retryAfter reads the Retry-After header, in seconds or as a date
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBuildDestinationIDs(t *testing.T) {
+	first := "discord://1/first"
+	second := "discord://2/second"
+
+	tests := []struct {
+		name      string
+		config    Config
+		want      []string
+		duplicate bool
+	}{
+		{"configured", Config{Discord: DiscordConfig{WebhookURL: "https://discord.com/api/webhooks/1/first"}}, []string{"discord"}, false},
+		{"URLs of the same kind", Config{DestinationURLs: []string{first, second}}, []string{"discord-", "discord-"}, false},
+		{"configured and declared", Config{Discord: DiscordConfig{WebhookURL: "https://discord.com/api/webhooks/1/first"}, DestinationURLs: []string{first}}, []string{"discord", "discord-"}, false},
+		{"same URL twice", Config{DestinationURLs: []string{first, first}}, nil, true},
+		{"name listed twice", Config{Discord: DiscordConfig{WebhookURL: "https://discord.com/api/webhooks/1/first"}, Destinations: []string{"discord", "discord"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destinations, err := buildDestinations(&tt.config, http.DefaultClient)
+			if tt.duplicate {
+				if err == nil || !strings.Contains(err.Error(), "more than once") {
+					t.Fatalf("buildDestinations() error = %v, want a duplicate error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(destinations) != len(tt.want) {
+				t.Fatalf("got %d destinations, want %d", len(destinations), len(tt.want))
+			}
+			ids := map[string]bool{}
+			for i, d := range destinations {
+				if !strings.HasPrefix(d.ID(), tt.want[i]) || (strings.HasSuffix(tt.want[i], "-") && len(d.ID()) != len(tt.want[i])+8) {
+					t.Errorf("destination %d ID = %q, want %q", i, d.ID(), tt.want[i])
+				}
+				if ids[d.ID()] {
+					t.Errorf("ID %q is used twice", d.ID())
+				}
+				ids[d.ID()] = true
+			}
+		})
+	}
+}
+
+func TestBuildDestinationIDsAreStable(t *testing.T) {
+	ids := func(urls ...string) map[string]bool {
+		destinations, err := buildDestinations(&Config{DestinationURLs: urls}, http.DefaultClient)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := map[string]bool{}
+		for _, d := range destinations {
+			found[d.ID()] = true
+		}
+		return found
+	}
+	before := ids("discord://1/first", "discord://2/second")
+	after := ids("discord://2/second", "discord://1/first")
+	for id := range before {
+		if !after[id] {
+			t.Errorf("ID %q changed when the URLs were reordered", id)
+		}
+	}
+}
+
+// testDestination records the builds sent to it, failing with the errors
+// of fail while it returns any
+type testDestination struct {
+	destinationID
+	name string
+	fail func(build BuildEvent) error
+
+	mu   sync.Mutex
+	sent []BuildEvent
+}
+
+func newTestDestination(id string) *testDestination {
+	d := &testDestination{name: "test"}
+	d.setID(id)
+	return d
+}
+
+func (d *testDestination) Name() string {
+	return d.name
+}
+
+func (d *testDestination) Send(build BuildEvent) error {
+	if d.fail != nil {
+		if err := d.fail(build); err != nil {
+			return err
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sent = append(d.sent, build)
+	return nil
+}
+
+// builds returns the builds sent so far
+func (d *testDestination) builds() []BuildEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]BuildEvent(nil), d.sent...)
+}
+
+// waitFor waits up to a few seconds for n builds to be sent
+func (d *testDestination) waitFor(t *testing.T, n int) []BuildEvent {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if builds := d.builds(); len(builds) >= n {
+			return builds
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s got %d builds, want %d", d.ID(), len(d.builds()), n)
+	return nil
+}
+
+// recordedRequest is a request received by a recordingServer
+type recordedRequest struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// decode unmarshals the JSON body of the request into v
+func (r recordedRequest) decode(t *testing.T, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		t.Fatalf("request body %q: %v", r.Body, err)
+	}
+}
+
+// recordingServer stands in for the services destinations post to,
+// recording the requests and answering them with status and body
+type recordingServer struct {
+	server *httptest.Server
+	status int
+	body   string
+
+	mu       sync.Mutex
+	received []recordedRequest
+}
+
+func newRecordingServer(t *testing.T, status int, body string) *recordingServer {
+	s := &recordingServer{status: status, body: body}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.received = append(s.received, recordedRequest{r.Method, r.URL.EscapedPath(), r.URL.Query(), r.Header.Clone(), body})
+		s.mu.Unlock()
+		w.WriteHeader(s.status)
+		io.WriteString(w, s.body)
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// requests returns the requests received so far
+func (s *recordingServer) requests() []recordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]recordedRequest(nil), s.received...)
+}
+
+// only returns the one request received, failing the test otherwise
+func (s *recordingServer) only(t *testing.T) recordedRequest {
+	t.Helper()
+	requests := s.requests()
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+	return requests[0]
+}
+
+// sender returns an httpSender whose requests all go to the server,
+// whatever their URL, so destinations with fixed API URLs can be tested
+func (s *recordingServer) sender() httpSender {
+	target, _ := url.Parse(s.server.URL)
+	return httpSender{client: &http.Client{Transport: redirectTransport{target}}}
+}
+
+// redirectTransport sends every request to the host of target
+type redirectTransport struct{ target *url.URL }
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = t.target.Scheme, t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
@@ -0,0 +1,648 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const discordAPIURL = "https://discord.com/api/v10"
+
+// discordFieldLimit is the most characters Discord takes in an embed field value
+const discordFieldLimit = 1024
+
+// commitMessageLimit is where the first line of a commit message is cut off
+const commitMessageLimit = 72
+
+// DiscordConfig configures the Discord destination. Setting BotToken and
+// ChannelID posts through the bot REST API instead of the webhook URL.
+// Routes send matching jobs to their own webhook or channel instead. Users
+// maps CI user names and emails to Discord user IDs, so the culprits of a
+// build are mentioned along with the configured mentions. Format is the
+// default message format, one of discordFormats, and Username and AvatarURL
+// replace the name and icon webhook messages are posted with. Threads, job
+// or build, posts the messages of each job or build into its own thread
+// when posting as a bot. EditMessages edits the started message of a build
+// when it finishes rather than posting another. PublicKey, the application's
+// public key, adds buttons to the bot's failure messages, which
+// InteractionRoles may limit to members with those roles. Digest, a
+// duration, gathers the embeds posted in that window into messages of up to
+// 10 embeds. Failed messages are retried in the background up to Retries
+// times, after RetryBackoff doubling each time.
+type DiscordConfig struct {
+	WebhookURL       string            `yaml:"webhook_url"`
+	BotToken         string            `yaml:"bot_token"`
+	ChannelID        string            `yaml:"channel_id"`
+	Format           string            `yaml:"format"`
+	Username         string            `yaml:"username"`
+	AvatarURL        string            `yaml:"avatar_url"`
+	Threads          string            `yaml:"threads"`
+	EditMessages     bool              `yaml:"edit_messages"`
+	PublicKey        string            `yaml:"public_key"`
+	InteractionRoles []string          `yaml:"interaction_roles"`
+	Digest           string            `yaml:"digest"`
+	Retries          int               `yaml:"retries"`
+	RetryBackoff     string            `yaml:"retry_backoff"`
+	Routes           []DiscordRoute    `yaml:"routes"`
+	Users            map[string]string `yaml:"users"`
+	digest           time.Duration
+	retryBackoff     time.Duration
+}
+
+// DiscordRoute posts the matching builds to WebhookURL, or to ChannelID
+// through the bot. When Events is set the route only takes those events.
+// Format, Username and AvatarURL replace the defaults when set.
+type DiscordRoute struct {
+	JobMatch   `yaml:",inline"`
+	Events     []string `yaml:"events"`
+	WebhookURL string   `yaml:"webhook_url"`
+	ChannelID  string   `yaml:"channel_id"`
+	Format     string   `yaml:"format"`
+	Username   string   `yaml:"username"`
+	AvatarURL  string   `yaml:"avatar_url"`
+}
+
+// discordTarget is where and how a build is posted
+type discordTarget struct {
+	webhookURL, channelID string
+	format                string
+	username, avatarURL   string
+}
+
+// Discord message formats: compact is a single line of content, detailed
+// the full embed, and auto compact for started builds and detailed for
+// finished ones
+const (
+	discordCompact  = "compact"
+	discordDetailed = "detailed"
+	discordAuto     = "auto"
+)
+
+var discordFormats = []string{discordCompact, discordDetailed, discordAuto}
+
+// botMode reports whether messages are posted as a bot rather than a webhook
+func (c DiscordConfig) botMode() bool {
+	return c.BotToken != ""
+}
+
+// target returns where the build is posted: the first matching route,
+// otherwise the default webhook or bot channel. The webhook URL and channel
+// are both empty when only routes are configured and none matches.
+func (c DiscordConfig) target(build BuildEvent) discordTarget {
+	target := discordTarget{format: c.Format, username: c.Username, avatarURL: c.AvatarURL}
+	for _, route := range c.Routes {
+		if route.matches(build) && (len(route.Events) == 0 || containsString(route.Events, build.Event)) {
+			target.webhookURL, target.channelID = route.WebhookURL, route.ChannelID
+			if route.Format != "" {
+				target.format = route.Format
+			}
+			if route.Username != "" {
+				target.username = route.Username
+			}
+			if route.AvatarURL != "" {
+				target.avatarURL = route.AvatarURL
+			}
+			return target
+		}
+	}
+	if c.botMode() {
+		target.channelID = c.ChannelID
+	} else {
+		target.webhookURL = c.WebhookURL
+	}
+	return target
+}
+
+// compactMessage reports whether the build is sent as a single line in the
+// given format
+func compactMessage(format string, build BuildEvent) bool {
+	switch format {
+	case discordCompact:
+		return true
+	case discordAuto:
+		return build.Event == "started"
+	default:
+		return false
+	}
+}
+
+// mentions returns the configured mentions of the build followed by its
+// culprits that have a Discord user, each once
+func (c DiscordConfig) mentions(build BuildEvent) []string {
+	mentions := append([]string(nil), build.Mentions...)
+	if !build.MentionCulprits {
+		return mentions
+	}
+	for _, culprit := range build.Culprits {
+		for name, id := range c.Users {
+			if strings.EqualFold(name, culprit) {
+				if mention := "<@" + id + ">"; !containsString(mentions, mention) {
+					mentions = append(mentions, mention)
+				}
+				break
+			}
+		}
+	}
+	return mentions
+}
+
+type discordDestination struct {
+	destinationID
+	httpSender
+	cfg DiscordConfig
+	// jenkins finds the builds the Rebuild button can start
+	jenkins jenkinsSource
+}
+
+func (d *discordDestination) Name() string {
+	return "discord"
+}
+
+// circuitTarget keeps the circuits of the webhooks and channels that
+// builds are routed to apart. Webhooks are named by a digest of their URL,
+// which holds their token.
+func (d *discordDestination) circuitTarget(build BuildEvent) string {
+	target := d.cfg.target(build)
+	if target.channelID != "" {
+		return "channel/" + target.channelID
+	}
+	if target.webhookURL == "" {
+		return ""
+	}
+	digest := sha256.Sum256([]byte(target.webhookURL))
+	return "webhook/" + hex.EncodeToString(digest[:4])
+}
+
+func (d *discordDestination) pingAddress() string {
+	if d.cfg.WebhookURL != "" {
+		return d.cfg.WebhookURL
+	}
+	return discordAPIURL
+}
+
+func (d *discordDestination) Send(build BuildEvent) error {
+	target := d.cfg.target(build)
+	if target.webhookURL == "" && target.channelID == "" {
+		return nil
+	}
+	payload := d.message(build, target)
+	if d.digests(target, payload) {
+		return d.sendDigest(target, payload)
+	}
+
+	key := messageKey(target, build)
+	var started discordMessage
+	edit := false
+	if d.editsMessage(build) {
+		started, edit = discordMessages.take(key)
+	}
+
+	send := func() error {
+		if edit {
+			err := d.editMessage(started, payload)
+			if !hasStatus(err, http.StatusNotFound) {
+				return err
+			}
+			// The started message was deleted, post a new one
+			edit = false
+		}
+
+		var message discordMessage
+		var err error
+		if target.channelID != "" && d.cfg.Threads != "" {
+			message, err = d.sendToThread(payload, target.channelID, build)
+		} else {
+			message, err = d.sendToDiscord(payload, target.webhookURL, target.channelID)
+		}
+		if err == nil && d.cfg.EditMessages && build.Event == "started" && message.id != "" {
+			discordMessages.set(key, message)
+		}
+		return err
+	}
+	if err := send(); err != nil {
+		return retryInBackground(circuitName(d, build), build, d.cfg.Retries, d.cfg.retryBackoff, err, send)
+	}
+	return nil
+}
+
+// message renders the build in the target's format, cut down to Discord's
+// limits
+func (d *discordDestination) message(build BuildEvent, target discordTarget) DiscordWebhook {
+	payload := d.convertToDiscordPayload(build)
+	if compactMessage(target.format, build) {
+		payload = d.compactPayload(build)
+	}
+	// Bots always post as themselves, and only their messages can have
+	// buttons
+	if target.channelID == "" {
+		payload.Username, payload.AvatarURL = target.username, target.avatarURL
+	} else {
+		payload.Components = d.buttons(build)
+	}
+	return sanitizeMessage(payload)
+}
+
+// Discord webhook payload structures
+type DiscordWebhook struct {
+	Content    string             `json:"content,omitempty"`
+	Username   string             `json:"username,omitempty"`
+	AvatarURL  string             `json:"avatar_url,omitempty"`
+	Embeds     []DiscordEmbed     `json:"embeds,omitempty"`
+	Components []DiscordComponent `json:"components,omitempty"`
+}
+
+type DiscordEmbed struct {
+	Title       string              `json:"title,omitempty"`
+	Description string              `json:"description,omitempty"`
+	URL         string              `json:"url,omitempty"`
+	Color       int                 `json:"color,omitempty"`
+	Fields      []DiscordEmbedField `json:"fields,omitempty"`
+	Timestamp   string              `json:"timestamp,omitempty"`
+	Footer      *DiscordEmbedFooter `json:"footer,omitempty"`
+}
+
+type DiscordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+type DiscordEmbedFooter struct {
+	Text    string `json:"text"`
+	IconURL string `json:"icon_url,omitempty"`
+}
+
+func (d *discordDestination) convertToDiscordPayload(build BuildEvent) DiscordWebhook {
+	// Determine color based on event status
+	color := build.EventColor()
+
+	// Parse build variables, leaving out the ones shown as their own fields
+	scmFields := formatSCM(build.SCM)
+	vars := build.Vars
+	if len(build.ParameterFields) > 0 || len(scmFields) > 0 {
+		vars = nil
+		for _, v := range build.Vars {
+			if !hasField(build.ParameterFields, v.Key) && !hasEmbedField(scmFields, v.Key) {
+				vars = append(vars, v)
+			}
+		}
+	}
+	buildVarsFormatted := formatBuildVars(vars)
+
+	// Create embed fields
+	fields := []DiscordEmbedField{
+		{
+			Name:   "Build",
+			Value:  build.BuildName,
+			Inline: true,
+		},
+		{
+			Name:   "Status",
+			Value:  build.StatusText(),
+			Inline: true,
+		},
+		{
+			Name:   "Project",
+			Value:  build.ProjectName,
+			Inline: true,
+		},
+	}
+
+	if len(build.Tags) > 0 {
+		fields = append(fields, DiscordEmbedField{Name: "Failure Type", Value: "🏷️ " + strings.Join(build.Tags, ", "), Inline: true})
+	}
+	fields = append(fields, scmFields...)
+	for _, field := range build.ParameterFields {
+		fields = append(fields, DiscordEmbedField{Name: field.Name, Value: field.Value, Inline: field.Inline})
+	}
+	if build.Event == "started" && build.EstimatedDuration > 0 {
+		fields = append(fields, DiscordEmbedField{Name: "ETA", Value: formatETA(build), Inline: true})
+	}
+	if build.Duration > 0 && build.Event != "started" {
+		duration := formatDuration(build.Duration)
+		if comparison := compareDuration(build.Duration, build.AverageDuration); comparison != "" {
+			duration += " (" + comparison + ")"
+		}
+		fields = append(fields, DiscordEmbedField{Name: "Duration", Value: duration, Inline: true})
+	}
+	if tests := build.Tests; tests != nil {
+		fields = append(fields, DiscordEmbedField{
+			Name:  "Tests",
+			Value: formatTests(*tests),
+		})
+	}
+	if len(build.Stages) > 0 {
+		fields = append(fields, DiscordEmbedField{
+			Name:  "Stages",
+			Value: formatStages(build.Stages, discordFieldLimit),
+		})
+	}
+	if build.ConsoleLog != "" {
+		fields = append(fields, DiscordEmbedField{
+			Name:  "Console Output",
+			Value: formatConsoleLog(build.ConsoleLog, discordFieldLimit),
+		})
+	}
+	if len(build.Artifacts) > 0 {
+		fields = append(fields, DiscordEmbedField{
+			Name:  "Artifacts",
+			Value: formatArtifacts(build.Artifacts, build.ArtifactCount, discordFieldLimit),
+		})
+	}
+	// The release notes list the build's own commits too
+	if len(build.Commits) > 0 && build.ReleaseNotes == "" {
+		fields = append(fields, DiscordEmbedField{
+			Name:  "Changes",
+			Value: formatCommits(build.Commits, discordFieldLimit),
+		})
+	}
+
+	// Add build variables if available
+	if buildVarsFormatted != "" {
+		fields = append(fields, DiscordEmbedField{
+			Name:   "Build Variables",
+			Value:  buildVarsFormatted,
+			Inline: false,
+		})
+	}
+
+	if build.Fields != nil {
+		fields = make([]DiscordEmbedField, 0, len(build.Fields))
+		for _, field := range build.Fields {
+			fields = append(fields, DiscordEmbedField{Name: field.Name, Value: field.Value, Inline: field.Inline})
+		}
+	}
+
+	description := build.Message
+	if description == "" {
+		description = fmt.Sprintf("Build %s", build.Event)
+	}
+	if build.ReleaseNotes != "" {
+		description += "\n\n" + build.ReleaseNotes
+	}
+	title := build.Title
+	if title == "" {
+		title = fmt.Sprintf("%s - %s", build.ProjectName, build.BuildName)
+	}
+
+	embed := DiscordEmbed{
+		Title:       title,
+		Description: description,
+		URL:         build.BuildURL,
+		Color:       color,
+		Fields:      fields,
+		Timestamp:   build.Time.Format(time.RFC3339),
+		Footer: &DiscordEmbedFooter{
+			Text:    build.Footer() + " • " + build.Timestamp,
+			IconURL: build.FooterIcon,
+		},
+	}
+
+	return DiscordWebhook{
+		Content: strings.Join(d.cfg.mentions(build), " "),
+		Embeds:  []DiscordEmbed{embed},
+	}
+}
+
+// compactPayload sends the build as a single line of content, e.g.
+// "🔄 Started **app - #12** <https://ci/job/app/12/>". The link is in angle
+// brackets so Discord doesn't add a preview embed after all.
+func (d *discordDestination) compactPayload(build BuildEvent) DiscordWebhook {
+	title := build.Title
+	if title == "" {
+		title = fmt.Sprintf("%s - %s", build.ProjectName, build.BuildName)
+	}
+	parts := []string{build.StatusText(), "**" + title + "**"}
+	if build.BuildURL != "" {
+		parts = append(parts, "<"+build.BuildURL+">")
+	}
+	parts = append(parts, d.cfg.mentions(build)...)
+	return DiscordWebhook{Content: strings.Join(parts, " ")}
+}
+
+// sendToDiscord posts the message, returning where it was posted. Webhook
+// messages only have an ID when messages are edited, as Discord only
+// returns it with ?wait=true.
+func (d *discordDestination) sendToDiscord(payload DiscordWebhook, webhookURL, channelID string) (discordMessage, error) {
+	if channelID != "" {
+		return d.sendAsBot(payload, channelID)
+	}
+
+	message := discordMessage{webhookURL: webhookURL}
+	var err error
+	if d.cfg.EditMessages {
+		var created struct {
+			ID string `json:"id"`
+		}
+		err = d.requestJSON("POST", withQuery(webhookURL, "wait", "true"), payload, &created, nil)
+		message.id = created.ID
+	} else {
+		err = d.postJSON(webhookURL, payload, nil)
+	}
+	if err != nil {
+		return discordMessage{}, err
+	}
+
+	log.Printf("Successfully sent webhook to Discord")
+	return message, nil
+}
+
+// sendAsBot posts the message to the channel via POST /channels/{id}/messages
+func (d *discordDestination) sendAsBot(payload DiscordWebhook, channelID string) (discordMessage, error) {
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := d.postBotMessage(payload, channelID, &created); err != nil {
+		return discordMessage{}, err
+	}
+
+	log.Printf("Successfully sent message to Discord channel %s", channelID)
+	return discordMessage{channelID: channelID, id: created.ID}, nil
+}
+
+// postBotMessage posts the message to a channel or thread, decoding the
+// created message into out unless it is nil
+func (d *discordDestination) postBotMessage(payload DiscordWebhook, channelID string, out interface{}) error {
+	endpoint := fmt.Sprintf("%s/channels/%s/messages", discordAPIURL, url.PathEscape(channelID))
+	return d.requestJSON("POST", endpoint, payload, out, d.botHeaders())
+}
+
+func (d *discordDestination) botHeaders() map[string]string {
+	return map[string]string{"Authorization": "Bot " + d.cfg.BotToken}
+}
+
+func hasField(fields []MessageField, name string) bool {
+	for _, field := range fields {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasEmbedField(fields []DiscordEmbedField, name string) bool {
+	for _, field := range fields {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// formatSCM shows the branch, commit and pull request as inline fields,
+// linked to the repository when its URL is known
+func formatSCM(scm *SCMContext) []DiscordEmbedField {
+	if scm == nil {
+		return nil
+	}
+	link := func(text, url string) string {
+		if url == "" {
+			return text
+		}
+		return fmt.Sprintf("[%s](%s)", text, url)
+	}
+
+	var fields []DiscordEmbedField
+	if scm.Branch != "" {
+		fields = append(fields, DiscordEmbedField{Name: "Branch", Value: link(scm.Branch, scm.BranchURL()), Inline: true})
+	}
+	if scm.Commit != "" {
+		fields = append(fields, DiscordEmbedField{Name: "Commit", Value: link(scm.ShortCommit(), scm.CommitURL()), Inline: true})
+	}
+	if scm.PullRequest != "" {
+		fields = append(fields, DiscordEmbedField{Name: "Pull Request", Value: link("#"+scm.PullRequest, scm.PullRequestLink()), Inline: true})
+	}
+	return fields
+}
+
+// formatTests shows the test counts followed by the failing tests
+func formatTests(tests TestSummary) string {
+	lines := []string{tests.String()}
+	for _, name := range tests.Failures {
+		lines = append(lines, "• "+name)
+	}
+	if more := tests.Failed - len(tests.Failures); more > 0 && len(tests.Failures) > 0 {
+		lines = append(lines, fmt.Sprintf("…and %d more", more))
+	}
+	value := strings.Join(lines, "\n")
+	if runes := []rune(value); len(runes) > discordFieldLimit {
+		value = string(runes[:discordFieldLimit-1]) + "…"
+	}
+	return value
+}
+
+// formatConsoleLog shows the end of the console log in a code block, dropping
+// the lines at the start that don't fit in limit characters
+func formatConsoleLog(consoleLog string, limit int) string {
+	// A fence in the log would end the code block early
+	consoleLog = strings.ReplaceAll(consoleLog, "```", "`\u200b``")
+	const fence = "```\n"
+	room := limit - utf8.RuneCountInString(fence+"\n```")
+	for utf8.RuneCountInString(consoleLog) > room {
+		i := strings.IndexByte(consoleLog, '\n')
+		if i < 0 {
+			runes := []rune(consoleLog)
+			consoleLog = string(runes[len(runes)-room:])
+			break
+		}
+		consoleLog = consoleLog[i+1:]
+	}
+	return fence + consoleLog + "\n```"
+}
+
+// formatArtifacts links the artifacts one per line, counting the ones that
+// aren't listed or don't fit in limit characters
+func formatArtifacts(artifacts []Artifact, total, limit int) string {
+	// Room for the line counting the rest
+	const moreRoom = 20
+	var lines []string
+	length := 0
+	for _, artifact := range artifacts {
+		// Brackets in the name would end the link text early
+		name := strings.NewReplacer("[", "(", "]", ")").Replace(artifact.Name)
+		line := fmt.Sprintf("[%s](%s)", name, artifact.URL)
+		if length+utf8.RuneCountInString(line)+1 > limit-moreRoom {
+			break
+		}
+		lines = append(lines, line)
+		length += utf8.RuneCountInString(line) + 1
+	}
+	if more := total - len(lines); more > 0 {
+		lines = append(lines, fmt.Sprintf("…and %d more", more))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatCommits lists commits one per line with their short SHA, first
+// message line and author, counting the commits that don't fit in limit
+// characters instead of listing them
+func formatCommits(commits []Commit, limit int) string {
+	// Room kept for the line counting the rest
+	moreRoom := utf8.RuneCountInString("\n…and 9999 more")
+
+	var lines []string
+	length := 0
+	for i, commit := range commits {
+		line := formatCommit(commit)
+		room := limit
+		if i < len(commits)-1 {
+			room -= moreRoom
+		}
+		if length+utf8.RuneCountInString(line) > room {
+			lines = append(lines, fmt.Sprintf("…and %d more", len(commits)-i))
+			break
+		}
+		lines = append(lines, line)
+		length += utf8.RuneCountInString(line) + 1
+	}
+	return strings.Join(lines, "\n")
+}
+
+// releaseNotesLimit is how long the list of a What's new section may get,
+// leaving the rest of the embed description to the message
+const releaseNotesLimit = 3000
+
+// formatReleaseNotes lists the commits of a deployment as a What's new
+// section, leaving out merge commits
+func formatReleaseNotes(commits []Commit) string {
+	var changes []Commit
+	for _, commit := range commits {
+		if !strings.HasPrefix(commit.Message, "Merge ") {
+			changes = append(changes, commit)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+	lines := strings.Split(formatCommits(changes, releaseNotesLimit), "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "…") {
+			lines[i] = "• " + line
+		}
+	}
+	return "**What's new**\n" + strings.Join(lines, "\n")
+}
+
+func formatCommit(commit Commit) string {
+	message, _, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n")
+	if runes := []rune(message); len(runes) > commitMessageLimit {
+		message = string(runes[:commitMessageLimit-1]) + "…"
+	}
+	line := message
+	if id := commit.ID; id != "" {
+		if len(id) > 8 {
+			id = id[:8]
+		}
+		line = "`" + id + "` " + line
+	}
+	if commit.Author != "" {
+		line += " – " + commit.Author
+	}
+	return line
+}
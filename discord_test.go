@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDiscordBotMode(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    DiscordConfig
+		path   string
+		header string
+	}{
+		{"webhook", DiscordConfig{WebhookURL: "https://discord.com/api/webhooks/1/token"}, "/api/webhooks/1/token", ""},
+		{"bot", DiscordConfig{BotToken: "bot-token", ChannelID: "42"}, "/api/v10/channels/42/messages", "Bot bot-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRecordingServer(t, http.StatusOK, `{"id":"1001"}`)
+			tt.cfg.Format = discordDetailed
+			d := &discordDestination{httpSender: server.sender(), cfg: tt.cfg}
+			d.setID("discord-" + tt.name)
+
+			if err := d.Send(testBuild("app", "failure")); err != nil {
+				t.Fatal(err)
+			}
+			request := server.only(t)
+			if request.Path != tt.path || request.Header.Get("Authorization") != tt.header {
+				t.Errorf("request to %s with %q, want %s with %q", request.Path, request.Header.Get("Authorization"), tt.path, tt.header)
+			}
+			var payload DiscordWebhook
+			request.decode(t, &payload)
+			if len(payload.Embeds) != 1 || payload.Embeds[0].Title != "app - #0" {
+				t.Errorf("payload = %+v, want the build's embed", payload)
+			}
+		})
+	}
+}
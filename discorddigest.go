@@ -0,0 +1,184 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// discordDigests gathers the embeds posted to each target across config
+// reloads, which create new destinations, so the batches of replaced
+// destinations are still posted on shutdown
+var discordDigests = newDiscordDigest()
+
+// discordDigest gathers the embeds posted to each target during the digest
+// window, so a burst of builds is posted as a few messages of up to
+// discordEmbedLimit embeds rather than one message each
+type discordDigest struct {
+	mu      sync.Mutex
+	pending map[discordTarget]*digestBatch
+}
+
+// digestBatch is the embeds waiting for a target, the destination that
+// queued the first of them, which posts them, and the timer of the window
+type digestBatch struct {
+	destination *discordDestination
+	embeds      []DiscordEmbed
+	timer       *time.Timer
+}
+
+func newDiscordDigest() *discordDigest {
+	return &discordDigest{pending: make(map[discordTarget]*digestBatch)}
+}
+
+// add queues the embeds for target, posting them once the digest window of
+// d has passed since the first of them. When the message is full its embeds
+// are returned instead, to be posted right away.
+func (g *discordDigest) add(target discordTarget, embeds []DiscordEmbed, d *discordDestination) []DiscordEmbed {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	batch, started := g.pending[target]
+	if !started {
+		batch = &digestBatch{destination: d}
+	}
+	batch.embeds = append(batch.embeds, embeds...)
+	if len(batch.embeds) >= discordEmbedLimit {
+		// Stopped so it doesn't post the next batch early
+		if batch.timer != nil {
+			batch.timer.Stop()
+		}
+		delete(g.pending, target)
+		return batch.embeds
+	}
+	g.pending[target] = batch
+	if !started {
+		batch.timer = time.AfterFunc(d.cfg.digest, func() { g.flushBatch(target, batch) })
+	}
+	return nil
+}
+
+// restore puts the embeds of a full message that failed to post back in
+// front of those queued for target, so the next flush posts them
+func (g *discordDigest) restore(target discordTarget, embeds []DiscordEmbed, d *discordDestination) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	batch, started := g.pending[target]
+	if !started {
+		batch = &digestBatch{destination: d}
+		g.pending[target] = batch
+		batch.timer = time.AfterFunc(d.cfg.digest, func() { g.flushBatch(target, batch) })
+	}
+	batch.embeds = append(append([]DiscordEmbed(nil), embeds...), batch.embeds...)
+}
+
+// targets lists the targets with queued embeds
+func (g *discordDigest) targets() []discordTarget {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var targets []discordTarget
+	for target := range g.pending {
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// take returns and forgets the batch queued for target, when it is batch
+// or batch is nil
+func (g *discordDigest) take(target discordTarget, batch *digestBatch) *digestBatch {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	pending := g.pending[target]
+	if pending == nil || batch != nil && pending != batch {
+		return nil
+	}
+	pending.timer.Stop()
+	delete(g.pending, target)
+	return pending
+}
+
+// flushBatch posts the batch once its window has passed, unless it was
+// already posted. The builds were already reported delivered, so errors are
+// logged.
+func (g *discordDigest) flushBatch(target discordTarget, batch *digestBatch) {
+	batch = g.take(target, batch)
+	if batch == nil {
+		return
+	}
+	if unsent, err := batch.destination.postEmbeds(target, batch.embeds); err != nil {
+		log.Printf("Error sending Discord digest of %d builds: %v", len(unsent), err)
+	}
+}
+
+// flushAll posts every digest without waiting for its window, on shutdown
+func (g *discordDigest) flushAll() {
+	for _, target := range g.targets() {
+		g.flushBatch(target, nil)
+	}
+}
+
+// digests reports whether the payload waits for the digest. Only plain
+// embeds do: mentions and buttons belong to a single build, and threads and
+// edited messages need messages of their own.
+func (d *discordDestination) digests(target discordTarget, payload DiscordWebhook) bool {
+	return d.cfg.digest > 0 && len(payload.Embeds) > 0 && payload.Content == "" &&
+		len(payload.Components) == 0 && !d.cfg.EditMessages &&
+		(target.channelID == "" || d.cfg.Threads == "")
+}
+
+// sendDigest queues the payload's embeds, posting them when the message is
+// full. The other builds of a full message were already reported delivered,
+// so when it fails its embeds wait for the next flush rather than being
+// lost with this build's error.
+func (d *discordDestination) sendDigest(target discordTarget, payload DiscordWebhook) error {
+	embeds := discordDigests.add(target, payload.Embeds, d)
+	if embeds == nil {
+		return nil
+	}
+	if unsent, err := d.postEmbeds(target, embeds); err != nil {
+		log.Printf("Error sending Discord digest of %d builds, trying again with the next one: %v", len(unsent), err)
+		discordDigests.restore(target, unsent, d)
+	}
+	return nil
+}
+
+// postEmbeds posts the embeds as few messages as Discord's limits allow,
+// returning those that weren't posted when a message fails
+func (d *discordDestination) postEmbeds(target discordTarget, embeds []DiscordEmbed) ([]DiscordEmbed, error) {
+	posted := 0
+	for _, chunk := range embedChunks(embeds) {
+		payload := DiscordWebhook{Embeds: chunk}
+		if target.channelID == "" {
+			payload.Username, payload.AvatarURL = target.username, target.avatarURL
+		}
+		if _, err := d.sendToDiscord(payload, target.webhookURL, target.channelID); err != nil {
+			return embeds[posted:], err
+		}
+		posted += len(chunk)
+	}
+	return nil, nil
+}
+
+// embedChunks splits the embeds into messages of at most discordEmbedLimit
+// embeds and discordEmbedChars characters
+func embedChunks(embeds []DiscordEmbed) [][]DiscordEmbed {
+	var chunks [][]DiscordEmbed
+	var chunk []DiscordEmbed
+	chars := 0
+	for _, embed := range embeds {
+		size := embedChars(embed)
+		if len(chunk) > 0 && (len(chunk) == discordEmbedLimit || chars+size > discordEmbedChars) {
+			chunks = append(chunks, chunk)
+			chunk, chars = nil, 0
+		}
+		chunk = append(chunk, embed)
+		chars += size
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
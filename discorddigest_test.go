@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// digestServer is a Discord webhook that records the embeds of each message
+// it accepts, failing the first failures messages
+type digestServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	failures int
+	messages []int
+}
+
+func newDigestServer(t *testing.T, failures int) *digestServer {
+	s := &digestServer{failures: failures}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload DiscordWebhook
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.failures > 0 {
+			s.failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		s.messages = append(s.messages, len(payload.Embeds))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// posted returns the number of embeds of each message accepted so far
+func (s *digestServer) posted() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int(nil), s.messages...)
+}
+
+// newDigestDestination creates a Discord destination posting to url with
+// a digest window too long to pass during the test
+func newDigestDestination(t *testing.T, url string) *discordDestination {
+	config := Config{Discord: DiscordConfig{WebhookURL: url, Format: discordDetailed, digest: time.Hour}}
+	destinations, err := buildDestinations(&config, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return destinations[0].(*discordDestination)
+}
+
+func digestBuild(i int) BuildEvent {
+	return BuildEvent{Source: "jenkins", ProjectName: "app", BuildName: fmt.Sprintf("#%d", i), Event: "success"}
+}
+
+func TestDigestPostsFullMessages(t *testing.T) {
+	server := newDigestServer(t, 0)
+	d := newDigestDestination(t, server.URL)
+
+	for i := 1; i <= discordEmbedLimit+2; i++ {
+		if err := d.Send(digestBuild(i)); err != nil {
+			t.Fatalf("build %d: %v", i, err)
+		}
+	}
+	if posted := server.posted(); len(posted) != 1 || posted[0] != discordEmbedLimit {
+		t.Fatalf("posted messages of %v embeds, want one full message", posted)
+	}
+
+	discordDigests.flushAll()
+	if posted := server.posted(); len(posted) != 2 || posted[1] != 2 {
+		t.Errorf("posted messages of %v embeds, want the other 2 posted on flush", posted)
+	}
+}
+
+func TestDigestKeepsFailedMessages(t *testing.T) {
+	server := newDigestServer(t, 1)
+	d := newDigestDestination(t, server.URL)
+
+	for i := 1; i <= discordEmbedLimit; i++ {
+		if err := d.Send(digestBuild(i)); err != nil {
+			t.Fatalf("build %d: %v", i, err)
+		}
+	}
+	if posted := server.posted(); len(posted) != 0 {
+		t.Fatalf("posted messages of %v embeds, want the full message to fail", posted)
+	}
+
+	// The next build posts the failed message along with its own embed
+	if err := d.Send(digestBuild(discordEmbedLimit + 1)); err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, embeds := range server.posted() {
+		total += embeds
+	}
+	if total != discordEmbedLimit+1 {
+		t.Errorf("posted %d embeds (%v), want all %d builds'", total, server.posted(), discordEmbedLimit+1)
+	}
+	if targets := discordDigests.targets(); len(targets) != 0 {
+		t.Errorf("%d digests still wait, want none", len(targets))
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Custom IDs of the buttons on failure messages, followed by the relative
+// build path or the job name
+const (
+	rebuildButton = "rebuild:"
+	muteButton    = "mute:"
+)
+
+// customIDLimit is the longest custom ID Discord accepts
+const customIDLimit = 100
+
+// buttonMuteDuration is how long the Mute job button mutes a job
+const buttonMuteDuration = 24 * time.Hour
+
+// interactionMaxAge is how old an interaction's signed timestamp may be
+const interactionMaxAge = 5 * time.Minute
+
+// Discord interaction and component types
+const (
+	interactionPing      = 1
+	interactionComponent = 3
+
+	responsePong            = 1
+	responseMessage         = 4
+	responseDeferredMessage = 5
+
+	componentActionRow = 1
+	componentButton    = 2
+
+	buttonSecondary = 2
+	buttonDanger    = 4
+	buttonLink      = 5
+
+	// ephemeralFlag shows a response only to whoever clicked
+	ephemeralFlag = 64
+)
+
+// DiscordComponent is an action row or a button of a message
+type DiscordComponent struct {
+	Type       int                `json:"type"`
+	Style      int                `json:"style,omitempty"`
+	Label      string             `json:"label,omitempty"`
+	URL        string             `json:"url,omitempty"`
+	CustomID   string             `json:"custom_id,omitempty"`
+	Components []DiscordComponent `json:"components,omitempty"`
+}
+
+// interactive reports whether bot messages carry buttons, which needs the
+// public key that verifies their callbacks
+func (c DiscordConfig) interactive() bool {
+	return c.botMode() && c.PublicKey != ""
+}
+
+// buttons returns the action row of a failed build's message: a link to
+// its console, and Rebuild and Mute job buttons handled by the interactions
+// endpoint. Rebuild needs Jenkins credentials.
+func (d *discordDestination) buttons(build BuildEvent) []DiscordComponent {
+	if !d.cfg.interactive() || !isFailureEvent(build.Event) {
+		return nil
+	}
+
+	var buttons []DiscordComponent
+	if path := d.jenkins.relativeBuildPath(build); path != "" && d.jenkins.apiEnabled() && len(rebuildButton+path) <= customIDLimit {
+		buttons = append(buttons, DiscordComponent{Type: componentButton, Style: buttonDanger, Label: "Rebuild", CustomID: rebuildButton + path})
+	}
+	if build.BuildURL != "" {
+		// Link buttons need an absolute URL
+		if u, err := url.Parse(build.BuildURL); err == nil && u.IsAbs() {
+			link := DiscordComponent{Type: componentButton, Style: buttonLink, Label: "View Build", URL: build.BuildURL}
+			if build.Source == "jenkins" {
+				link.Label, link.URL = "View Console", strings.TrimSuffix(build.BuildURL, "/")+"/console"
+			}
+			buttons = append(buttons, link)
+		}
+	}
+	if build.ProjectName != "" && len(muteButton+build.ProjectName) <= customIDLimit {
+		buttons = append(buttons, DiscordComponent{Type: componentButton, Style: buttonSecondary, Label: "Mute job", CustomID: muteButton + build.ProjectName})
+	}
+	if len(buttons) == 0 {
+		return nil
+	}
+	return []DiscordComponent{{Type: componentActionRow, Components: buttons}}
+}
+
+// discordInteraction is the part of an interaction callback that buttons use
+type discordInteraction struct {
+	Type          int    `json:"type"`
+	ApplicationID string `json:"application_id"`
+	Token         string `json:"token"`
+	Data          struct {
+		CustomID string `json:"custom_id"`
+	} `json:"data"`
+	Member *struct {
+		Roles []string `json:"roles"`
+		User  struct {
+			Username string `json:"username"`
+		} `json:"user"`
+	} `json:"member"`
+}
+
+func (i discordInteraction) username() string {
+	if i.Member != nil {
+		return i.Member.User.Username
+	}
+	return "unknown user"
+}
+
+// verifyInteraction checks the Ed25519 signature Discord sends with every
+// interaction over its timestamp and the body
+func verifyInteraction(publicKey string, header http.Header, body []byte) error {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key")
+	}
+	signature, err := hex.DecodeString(header.Get("X-Signature-Ed25519"))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return errInvalidSignature
+	}
+	timestamp := header.Get("X-Signature-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errInvalidSignature
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > interactionMaxAge || age < -interactionMaxAge {
+		return fmt.Errorf("stale timestamp")
+	}
+	if !ed25519.Verify(key, append([]byte(timestamp), body...), signature) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// handleDiscordInteraction handles the clicks on the buttons of failure
+// messages, which Discord sends to the application's interactions endpoint
+func (w *WebhookHandler) handleDiscordInteraction(c echo.Context) error {
+	state := w.state.Load()
+	if !state.discord.interactive() {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Discord interactions are not configured"})
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	if err := verifyInteraction(state.discord.PublicKey, c.Request().Header, body); err != nil {
+		log.Printf("Rejected Discord interaction from %s: %v", c.RealIP(), err)
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+
+	var interaction discordInteraction
+	if err := json.Unmarshal(body, &interaction); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid JSON payload"})
+	}
+
+	switch interaction.Type {
+	case interactionPing:
+		return c.JSON(http.StatusOK, map[string]int{"type": responsePong})
+	case interactionComponent:
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unsupported interaction"})
+	}
+
+	if !w.interactionAllowed(state.discord, interaction) {
+		return c.JSON(http.StatusOK, ephemeralResponse("You don't have a role that may use these buttons."))
+	}
+
+	customID := interaction.Data.CustomID
+	switch {
+	case strings.HasPrefix(customID, muteButton):
+		job := strings.TrimPrefix(customID, muteButton)
+		w.mutes.set(jobMute{
+			Job:    job,
+			Until:  time.Now().Add(buttonMuteDuration),
+			Reason: "muted from Discord by " + interaction.username(),
+		})
+		log.Printf("Muted notifications for %s from Discord by %s", job, interaction.username())
+		return c.JSON(http.StatusOK, ephemeralResponse(fmt.Sprintf("🔇 Muted %s for %d hours.", job, int(buttonMuteDuration.Hours()))))
+
+	case strings.HasPrefix(customID, rebuildButton):
+		if !state.jenkins.apiEnabled() {
+			return c.JSON(http.StatusOK, ephemeralResponse("Rebuilding needs JENKINS_USER and JENKINS_API_TOKEN."))
+		}
+		path := strings.TrimPrefix(customID, rebuildButton)
+		// Jenkins may take longer than the 3 seconds Discord waits for a
+		// response, so the result follows as an edit of a deferred response
+		go w.rebuildFromDiscord(state.jenkins, interaction, path)
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"type": responseDeferredMessage,
+			"data": map[string]int{"flags": ephemeralFlag},
+		})
+
+	default:
+		return c.JSON(http.StatusOK, ephemeralResponse("Unknown button."))
+	}
+}
+
+// interactionAllowed reports whether whoever clicked has one of the
+// interaction roles, when those are configured
+func (w *WebhookHandler) interactionAllowed(cfg DiscordConfig, interaction discordInteraction) bool {
+	if len(cfg.InteractionRoles) == 0 {
+		return true
+	}
+	if interaction.Member == nil {
+		return false
+	}
+	for _, role := range interaction.Member.Roles {
+		if containsString(cfg.InteractionRoles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// rebuildFromDiscord starts the build again and reports the result in the
+// deferred response
+func (w *WebhookHandler) rebuildFromDiscord(jenkins jenkinsSource, interaction discordInteraction, path string) {
+	content := "🔁 Rebuild of " + path + " queued."
+	if err := jenkins.rebuild(path); err != nil {
+		log.Printf("Error rebuilding %s from Discord: %v", path, err)
+		content = "Rebuild of " + path + " failed: " + err.Error()
+	} else {
+		log.Printf("Rebuilt %s from Discord by %s", path, interaction.username())
+	}
+
+	endpoint := fmt.Sprintf("%s/webhooks/%s/%s/messages/@original", discordAPIURL, url.PathEscape(interaction.ApplicationID), url.PathEscape(interaction.Token))
+	sender := httpSender{client: w.client}
+	if err := sender.requestJSON("PATCH", endpoint, map[string]string{"content": content}, nil, nil); err != nil {
+		log.Printf("Error answering Discord interaction: %v", err)
+	}
+}
+
+func ephemeralResponse(content string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": responseMessage,
+		"data": map[string]interface{}{"content": content, "flags": ephemeralFlag},
+	}
+}
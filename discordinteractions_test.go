@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyInteraction(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := hex.EncodeToString(public)
+	body := []byte(`{"type":3}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-2*interactionMaxAge).Unix(), 10)
+	sign := func(timestamp string, body []byte) http.Header {
+		header := http.Header{}
+		header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(private, append([]byte(timestamp), body...))))
+		header.Set("X-Signature-Timestamp", timestamp)
+		return header
+	}
+	withTimestamp := func(header http.Header, timestamp string) http.Header {
+		header.Set("X-Signature-Timestamp", timestamp)
+		return header
+	}
+
+	tests := []struct {
+		name      string
+		publicKey string
+		header    http.Header
+		body      []byte
+		ok        bool
+	}{
+		{"valid", publicKey, sign(now, body), body, true},
+		{"tampered body", publicKey, sign(now, body), []byte(`{"type":1}`), false},
+		{"timestamp changed after signing", publicKey, withTimestamp(sign(now, body), strconv.FormatInt(time.Now().Unix()+1, 10)), body, false},
+		{"stale timestamp", publicKey, sign(stale, body), body, false},
+		{"signature not hex", publicKey, http.Header{"X-Signature-Ed25519": {"zz"}, "X-Signature-Timestamp": {now}}, body, false},
+		{"missing signature", publicKey, http.Header{"X-Signature-Timestamp": {now}}, body, false},
+		{"missing timestamp", publicKey, withTimestamp(sign(now, body), ""), body, false},
+		{"invalid public key", "abcd", sign(now, body), body, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyInteraction(tt.publicKey, tt.header, tt.body)
+			if ok := err == nil; ok != tt.ok {
+				t.Errorf("verifyInteraction() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Discord's limits on messages, in characters unless noted. Messages that
+// exceed them are rejected with a 400.
+const (
+	discordContentLimit     = 2000
+	discordTitleLimit       = 256
+	discordDescriptionLimit = 4096
+	discordFieldNameLimit   = 256
+	discordFooterLimit      = 2048
+	// discordFieldCount is how many fields an embed may have
+	discordFieldCount = 25
+	// discordEmbedLimit is how many embeds a message may have, and
+	// discordEmbedChars how many characters they may have together
+	discordEmbedLimit = 10
+	discordEmbedChars = 6000
+)
+
+// truncatedMarker ends descriptions and field values that were cut short
+const truncatedMarker = "…(truncated)"
+
+// sanitizeMessage cuts the payload down to Discord's limits, so a long job
+// name or a huge change log shortens the message rather than losing it
+func sanitizeMessage(payload DiscordWebhook) DiscordWebhook {
+	payload.Content = truncateText(payload.Content, discordContentLimit, truncatedMarker)
+	if len(payload.Embeds) > discordEmbedLimit {
+		payload.Embeds = payload.Embeds[:discordEmbedLimit]
+	}
+	embeds := make([]DiscordEmbed, len(payload.Embeds))
+	for i, embed := range payload.Embeds {
+		embeds[i] = sanitizeEmbed(embed, discordEmbedChars/len(payload.Embeds))
+	}
+	if payload.Embeds != nil {
+		payload.Embeds = embeds
+	}
+	return payload
+}
+
+// sanitizeEmbed cuts each part of the embed to its limit, then shortens the
+// description and the longest field values until the embed has at most
+// total characters
+func sanitizeEmbed(embed DiscordEmbed, total int) DiscordEmbed {
+	embed.Title = truncateText(embed.Title, discordTitleLimit, "…")
+	embed.Description = truncateText(embed.Description, discordDescriptionLimit, truncatedMarker)
+	if embed.Footer != nil {
+		footer := *embed.Footer
+		footer.Text = truncateText(footer.Text, discordFooterLimit, "…")
+		embed.Footer = &footer
+	}
+
+	fields := embed.Fields
+	if len(fields) > discordFieldCount {
+		fields = fields[:discordFieldCount]
+	}
+	embed.Fields = make([]DiscordEmbedField, len(fields))
+	for i, field := range fields {
+		// Discord rejects empty field names and values
+		if strings.TrimSpace(field.Name) == "" {
+			field.Name = "\u200b"
+		}
+		if strings.TrimSpace(field.Value) == "" {
+			field.Value = "-"
+		}
+		field.Name = truncateText(field.Name, discordFieldNameLimit, "…")
+		field.Value = truncateText(field.Value, discordFieldLimit, truncatedMarker)
+		embed.Fields[i] = field
+	}
+	if fields == nil {
+		embed.Fields = nil
+	}
+
+	// Past the total, the longest text loses what's over, down to a short
+	// remainder; then fields are dropped from the end, and the footer last
+	const remainder = 100
+	for excess := embedChars(embed) - total; excess > 0; excess = embedChars(embed) - total {
+		longest, length := -1, utf8.RuneCountInString(embed.Description)
+		for i, field := range embed.Fields {
+			if n := utf8.RuneCountInString(field.Value); n > length {
+				longest, length = i, n
+			}
+		}
+		switch {
+		case length > remainder:
+			limit := length - excess
+			if limit < remainder {
+				limit = remainder
+			}
+			if longest < 0 {
+				embed.Description = truncateText(embed.Description, limit, truncatedMarker)
+			} else {
+				embed.Fields[longest].Value = truncateText(embed.Fields[longest].Value, limit, truncatedMarker)
+			}
+		case len(embed.Fields) > 0:
+			embed.Fields = embed.Fields[:len(embed.Fields)-1]
+		default:
+			// Only the title and footer are left, and the footer gives way
+			embed.Description = ""
+			if embed.Footer != nil {
+				footer := *embed.Footer
+				footer.Text = truncateText(footer.Text, max(total-utf8.RuneCountInString(embed.Title), 0), "…")
+				embed.Footer = &footer
+			}
+			return embed
+		}
+	}
+	return embed
+}
+
+// truncateText cuts text to limit characters, ending it with marker when
+// it was cut. A code block that is cut is closed again.
+func truncateText(text string, limit int, marker string) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	suffix := marker
+	if strings.HasPrefix(text, "```") {
+		suffix = "\n```" + marker
+	}
+	keep := limit - utf8.RuneCountInString(suffix)
+	if keep < 0 {
+		return string([]rune(text)[:limit])
+	}
+	return string([]rune(text)[:keep]) + suffix
+}
+
+// embedChars counts the characters of the embed that count towards
+// discordEmbedChars
+func embedChars(embed DiscordEmbed) int {
+	n := utf8.RuneCountInString(embed.Title) + utf8.RuneCountInString(embed.Description)
+	for _, field := range embed.Fields {
+		n += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+	}
+	if embed.Footer != nil {
+		n += utf8.RuneCountInString(embed.Footer.Text)
+	}
+	return n
+}
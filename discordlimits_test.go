@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  string
+	}{
+		{"short", "short", 10, "short"},
+		{"long", "abcdefghijklmnopqrstuvwxyz", 15, "abc" + truncatedMarker},
+		{"multibyte", strings.Repeat("é", 20), 15, "ééé" + truncatedMarker},
+		{"code block", "```\nline one\nline two\nline three\n```", 25, "```\nline " + "\n```" + truncatedMarker},
+		{"limit under the marker", "abcdefghijklmnopqrstuvwxyz", 5, "abcde"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateText(tt.text, tt.limit, truncatedMarker)
+			if got != tt.want {
+				t.Errorf("truncateText() = %q, want %q", got, tt.want)
+			}
+			if n := utf8.RuneCountInString(got); n > tt.limit {
+				t.Errorf("truncateText() has %d characters, over the limit of %d", n, tt.limit)
+			}
+		})
+	}
+}
+
+func TestSanitizeMessage(t *testing.T) {
+	long := strings.Repeat("x", 5000)
+	fields := make([]DiscordEmbedField, 30)
+	for i := range fields {
+		fields[i] = DiscordEmbedField{Name: "Field", Value: long}
+	}
+	fields[0] = DiscordEmbedField{Name: " ", Value: ""}
+	embeds := make([]DiscordEmbed, 12)
+	for i := range embeds {
+		embeds[i] = DiscordEmbed{
+			Title:       strings.Repeat("t", 300),
+			Description: long,
+			Fields:      fields,
+			Footer:      &DiscordEmbedFooter{Text: "jenkins"},
+		}
+	}
+	embeds[0].Footer = &DiscordEmbedFooter{Text: long}
+
+	payload := sanitizeMessage(DiscordWebhook{Content: long, Embeds: embeds})
+
+	if n := utf8.RuneCountInString(payload.Content); n > discordContentLimit {
+		t.Errorf("content has %d characters, want at most %d", n, discordContentLimit)
+	}
+	if len(payload.Embeds) != discordEmbedLimit {
+		t.Fatalf("message has %d embeds, want %d", len(payload.Embeds), discordEmbedLimit)
+	}
+	total := 0
+	for _, embed := range payload.Embeds {
+		total += embedChars(embed)
+		if n := utf8.RuneCountInString(embed.Title); n > discordTitleLimit {
+			t.Errorf("title has %d characters, want at most %d", n, discordTitleLimit)
+		}
+		if n := utf8.RuneCountInString(embed.Footer.Text); n > discordFooterLimit {
+			t.Errorf("footer has %d characters, want at most %d", n, discordFooterLimit)
+		}
+		if len(embed.Fields) > discordFieldCount {
+			t.Errorf("embed has %d fields, want at most %d", len(embed.Fields), discordFieldCount)
+		}
+		for _, field := range embed.Fields {
+			if strings.TrimSpace(field.Name) == "" || strings.TrimSpace(field.Value) == "" {
+				t.Errorf("field %+v is empty, which Discord rejects", field)
+			}
+		}
+	}
+	if total > discordEmbedChars {
+		t.Errorf("embeds have %d characters together, want at most %d", total, discordEmbedChars)
+	}
+	if embeds[0].Description != long {
+		t.Error("sanitizeMessage() changed the embeds it was given")
+	}
+}
+
+func TestSanitizeEmbedKeepsShortMessages(t *testing.T) {
+	embed := DiscordEmbed{
+		Title:       "app #1 failed",
+		Description: "Build failed",
+		Fields:      []DiscordEmbedField{{Name: "Branch", Value: "main"}},
+	}
+	got := sanitizeEmbed(embed, discordEmbedChars)
+	if got.Title != embed.Title || got.Description != embed.Description || len(got.Fields) != 1 || got.Fields[0] != embed.Fields[0] {
+		t.Errorf("sanitizeEmbed() = %+v, want the embed unchanged", got)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// messageTTL is how long a started message is kept for its build to finish
+const messageTTL = 24 * time.Hour
+
+// discordMessage is where a message was posted: through a webhook, or to a
+// channel or thread by the bot
+type discordMessage struct {
+	webhookURL, channelID string
+	id                    string
+	posted                time.Time
+}
+
+// discordMessages remembers the started message of each build across config
+// reloads, so its completion can edit it
+var discordMessages = newMessageStore()
+
+// messageStore maps target and build keys to their started message
+type messageStore struct {
+	mu       sync.Mutex
+	messages map[string]discordMessage
+}
+
+func newMessageStore() *messageStore {
+	return &messageStore{messages: make(map[string]discordMessage)}
+}
+
+// set remembers a message, forgetting the ones older than messageTTL
+func (s *messageStore) set(key string, message discordMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, existing := range s.messages {
+		if now.Sub(existing.posted) > messageTTL {
+			delete(s.messages, k)
+		}
+	}
+	message.posted = now
+	s.messages[key] = message
+}
+
+// take returns and forgets the message
+func (s *messageStore) take(key string) (discordMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message, ok := s.messages[key]
+	delete(s.messages, key)
+	return message, ok
+}
+
+// messageKey identifies the build at the target it is posted to
+func messageKey(target discordTarget, build BuildEvent) string {
+	return target.webhookURL + target.channelID + "/" + build.Source + "/" + build.ProjectName + "#" + build.BuildName
+}
+
+// editsMessage reports whether the build replaces its started message
+// rather than posting a new one. Builds that mention someone are posted
+// anew, as Discord doesn't notify mentions added by an edit.
+func (d *discordDestination) editsMessage(build BuildEvent) bool {
+	return d.cfg.EditMessages && build.Event != "started" && len(d.cfg.mentions(build)) == 0
+}
+
+// messageEdit replaces the content, embeds and buttons of a message, so a
+// compact message can become an embed and the other way around. The name
+// and avatar of webhook messages can't be edited.
+type messageEdit struct {
+	Content    string             `json:"content"`
+	Embeds     []DiscordEmbed     `json:"embeds"`
+	Components []DiscordComponent `json:"components"`
+}
+
+// editMessage replaces a posted message with payload
+func (d *discordDestination) editMessage(message discordMessage, payload DiscordWebhook) error {
+	edit := messageEdit{Content: payload.Content, Embeds: payload.Embeds, Components: payload.Components}
+	if edit.Embeds == nil {
+		edit.Embeds = []DiscordEmbed{}
+	}
+	if edit.Components == nil {
+		edit.Components = []DiscordComponent{}
+	}
+
+	if message.channelID != "" {
+		endpoint := fmt.Sprintf("%s/channels/%s/messages/%s", discordAPIURL, url.PathEscape(message.channelID), url.PathEscape(message.id))
+		if err := d.requestJSON("PATCH", endpoint, edit, nil, d.botHeaders()); err != nil {
+			return err
+		}
+		log.Printf("Successfully edited message %s in Discord channel %s", message.id, message.channelID)
+		return nil
+	}
+
+	if err := d.requestJSON("PATCH", webhookMessageURL(message.webhookURL, message.id), edit, nil, nil); err != nil {
+		return err
+	}
+	log.Printf("Successfully edited webhook message %s in Discord", message.id)
+	return nil
+}
+
+// webhookMessageURL is the URL of a message posted through the webhook,
+// keeping the webhook's query, e.g. its thread_id
+func webhookMessageURL(webhookURL, id string) string {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return webhookURL
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/messages/" + url.PathEscape(id)
+	return u.String()
+}
+
+// withQuery adds a query parameter to rawURL
+func withQuery(rawURL, key, value string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	query.Set(key, value)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// discordRateLimitRetries is how often a request Discord rate limited is
+// sent again once the limit resets
+const discordRateLimitRetries = 3
+
+// discordRateLimitWait is the longest a request waits for a rate limit to
+// reset. Longer limits fail the request with a 429, which is retried in the
+// background when retries are configured.
+const discordRateLimitWait = 30 * time.Second
+
+// discordRateLimits tracks Discord's rate limits across config reloads,
+// which create new destinations
+var discordRateLimits = newDiscordLimiter()
+
+// discordBucket is a rate limit bucket as Discord reports it in the
+// X-RateLimit headers: the requests remaining until it resets to limit
+type discordBucket struct {
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// discordLimiter holds the rate limit buckets of the Discord routes. Routes
+// are the webhook or channel a request goes to, with its method and path,
+// and are mapped to Discord's buckets once a response names them, as
+// several routes may share one.
+type discordLimiter struct {
+	mu      sync.Mutex
+	routes  map[string]string
+	buckets map[string]*discordBucket
+	global  time.Time
+	swept   time.Time
+}
+
+func newDiscordLimiter() *discordLimiter {
+	return &discordLimiter{routes: make(map[string]string), buckets: make(map[string]*discordBucket)}
+}
+
+// discordRoute identifies the route of a request to Discord
+func discordRoute(method, endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return method + " " + endpoint
+	}
+	return method + " " + u.Host + u.Path
+}
+
+// majorParameter is the webhook or channel of a route, which Discord's
+// buckets are per
+func majorParameter(route string) string {
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "webhooks" && i+2 < len(segments):
+			return strings.Join(segments[i+1:i+3], "/")
+		case segment == "channels" && i+1 < len(segments):
+			return segments[i+1]
+		}
+	}
+	return route
+}
+
+// bucket returns the bucket of route, creating it when Discord hasn't
+// named it yet. The caller holds the lock.
+func (l *discordLimiter) bucket(route string) *discordBucket {
+	key, ok := l.routes[route]
+	if !ok {
+		key = route
+	}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &discordBucket{}
+		l.buckets[key] = bucket
+	}
+	return bucket
+}
+
+// wait blocks until route may be requested, taking one of its remaining
+// requests. It returns how long the limit would still take to reset instead
+// when that is longer than discordRateLimitWait.
+func (l *discordLimiter) wait(route string) time.Duration {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.sweep(now)
+		bucket := l.bucket(route)
+		until := l.global
+		if bucket.remaining <= 0 && bucket.reset.After(until) {
+			until = bucket.reset
+		}
+		delay := until.Sub(now)
+		if delay <= 0 {
+			if !bucket.reset.IsZero() && !bucket.reset.After(now) {
+				// The next response tells when it resets again
+				bucket.remaining, bucket.reset = bucket.limit, time.Time{}
+			}
+			bucket.remaining--
+			l.mu.Unlock()
+			return 0
+		}
+		l.mu.Unlock()
+
+		if delay > discordRateLimitWait {
+			return delay
+		}
+		time.Sleep(delay)
+	}
+}
+
+// update records the rate limit headers of a response to route. A 429
+// empties its bucket, or all of them for the global limit, until the
+// response's Retry-After has passed.
+func (l *discordLimiter) update(route string, resp *http.Response) {
+	header := resp.Header
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if name := header.Get("X-RateLimit-Bucket"); name != "" {
+		key := name + " " + majorParameter(route)
+		if old, ok := l.routes[route]; !ok || old != key {
+			if _, ok := l.buckets[key]; !ok {
+				l.buckets[key] = l.bucket(route)
+			}
+			delete(l.buckets, route)
+			l.routes[route] = key
+		}
+	}
+	bucket := l.bucket(route)
+	if limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit")); err == nil {
+		bucket.limit = limit
+	}
+	if remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining")); err == nil {
+		bucket.remaining = remaining
+	}
+	if seconds, err := strconv.ParseFloat(header.Get("X-RateLimit-Reset-After"), 64); err == nil {
+		bucket.reset = now.Add(time.Duration(seconds * float64(time.Second)))
+	}
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+	wait := retryAfter(header)
+	if wait <= 0 {
+		wait = time.Second
+	}
+	reset := now.Add(wait)
+	if header.Get("X-RateLimit-Global") == "true" || header.Get("X-RateLimit-Scope") == "global" {
+		l.global = reset
+		return
+	}
+	bucket.remaining = 0
+	if reset.After(bucket.reset) {
+		bucket.reset = reset
+	}
+}
+
+// sweep drops the buckets that have reset and the routes mapped to them,
+// so routes of edited messages don't use memory forever. The caller holds
+// the lock.
+func (l *discordLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	for key, bucket := range l.buckets {
+		if !bucket.reset.After(now) {
+			delete(l.buckets, key)
+		}
+	}
+	for route, key := range l.routes {
+		if _, ok := l.buckets[key]; !ok {
+			delete(l.routes, route)
+		}
+	}
+}
+
+// requestJSON sends payload as JSON like httpSender.requestJSON, keeping to
+// Discord's rate limits: it waits for the route's bucket to reset when it
+// is empty and, when Discord answers 429 all the same, sends the request
+// again once the limit resets
+func (d *discordDestination) requestJSON(method, endpoint string, payload, out interface{}, headers map[string]string) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling payload: %w", err)
+	}
+
+	route := discordRoute(method, endpoint)
+	for attempt := 0; ; attempt++ {
+		if delay := discordRateLimits.wait(route); delay > 0 {
+			return statusError{status: http.StatusTooManyRequests, retryAfter: delay}
+		}
+
+		req, err := http.NewRequest(method, endpoint, bytes.NewReader(jsonData))
+		if err != nil {
+			return fmt.Errorf("error creating request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		resp, err := d.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("error sending request: %w", err)
+		}
+		discordRateLimits.update(route, resp)
+		err = decodeResponse(resp, out)
+		resp.Body.Close()
+		if !hasStatus(err, http.StatusTooManyRequests) || attempt == discordRateLimitRetries {
+			return err
+		}
+		log.Printf("Rate limited by Discord, retrying after %v", retryAfter(resp.Header))
+	}
+}
+
+func (d *discordDestination) postJSON(endpoint string, payload interface{}, headers map[string]string) error {
+	return d.requestJSON("POST", endpoint, payload, nil, headers)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Discord thread modes: a thread per job, or per build
+const (
+	threadsPerJob   = "job"
+	threadsPerBuild = "build"
+)
+
+var threadModes = []string{threadsPerJob, threadsPerBuild}
+
+// threadTTL is how long a thread is remembered after its last message
+const threadTTL = 7 * 24 * time.Hour
+
+// threadNameLimit is the longest thread name Discord accepts
+const threadNameLimit = 100
+
+// discordThreads remembers the thread of each job or build across config
+// reloads, which create new destinations
+var discordThreads = newThreadStore()
+
+type threadEntry struct {
+	id       string
+	lastUsed time.Time
+}
+
+// threadStore maps channel and job or build keys to Discord thread IDs
+type threadStore struct {
+	mu      sync.Mutex
+	threads map[string]threadEntry
+}
+
+func newThreadStore() *threadStore {
+	return &threadStore{threads: make(map[string]threadEntry)}
+}
+
+func (s *threadStore) get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.threads[key]
+	if !ok {
+		return "", false
+	}
+	entry.lastUsed = time.Now()
+	s.threads[key] = entry
+	return entry.id, true
+}
+
+// set remembers a thread, forgetting the ones unused for threadTTL
+func (s *threadStore) set(key, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, entry := range s.threads {
+		if now.Sub(entry.lastUsed) > threadTTL {
+			delete(s.threads, k)
+		}
+	}
+	s.threads[key] = threadEntry{id: id, lastUsed: now}
+}
+
+func (s *threadStore) remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.threads, key)
+}
+
+// threadName names the thread of the build's job, or of the build itself
+func threadName(mode string, build BuildEvent) string {
+	name := build.ProjectName
+	if mode == threadsPerBuild {
+		name += " " + build.BuildName
+	}
+	if runes := []rune(name); len(runes) > threadNameLimit {
+		name = string(runes[:threadNameLimit])
+	}
+	return name
+}
+
+// sendToThread posts the message into the thread of the build's job or
+// build in the channel. The first message goes to the channel and starts
+// the thread; the ones after it go into the thread, keeping the channel to
+// one message per job or build.
+func (d *discordDestination) sendToThread(payload DiscordWebhook, channelID string, build BuildEvent) (discordMessage, error) {
+	key := channelID + "/" + threadName(d.cfg.Threads, build)
+	if threadID, ok := discordThreads.get(key); ok {
+		var created struct {
+			ID string `json:"id"`
+		}
+		err := d.postBotMessage(payload, threadID, &created)
+		if err == nil {
+			log.Printf("Successfully sent message to Discord thread %s", threadID)
+			return discordMessage{channelID: threadID, id: created.ID}, nil
+		}
+		if !hasStatus(err, http.StatusNotFound) {
+			return discordMessage{}, err
+		}
+		// The thread was deleted, start a new one
+		discordThreads.remove(key)
+	}
+
+	message, err := d.sendAsBot(payload, channelID)
+	if err != nil {
+		return discordMessage{}, err
+	}
+
+	endpoint := fmt.Sprintf("%s/channels/%s/messages/%s/threads", discordAPIURL, url.PathEscape(channelID), url.PathEscape(message.id))
+	request := map[string]string{"name": threadName(d.cfg.Threads, build)}
+	var thread struct {
+		ID string `json:"id"`
+	}
+	if err := d.requestJSON("POST", endpoint, request, &thread, d.botHeaders()); err != nil {
+		// The message is delivered; the next one tries again
+		log.Printf("Error starting Discord thread in channel %s: %v", channelID, err)
+		return message, nil
+	}
+	discordThreads.set(key, thread.ID)
+	return message, nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DroneConfig configures the Drone webhook source. When Secret is set,
+// requests must carry a valid hmac-sha256 HTTP signature made with it,
+// which is what Drone sends when DRONE_WEBHOOK_SECRET is configured.
+type DroneConfig struct {
+	Secret string `yaml:"secret"`
+}
+
+// Drone webhook payload structures
+type DroneWebhook struct {
+	Event  string       `json:"event"`
+	Action string       `json:"action"`
+	Repo   *DroneRepo   `json:"repo,omitempty"`
+	Build  *DroneBuild  `json:"build,omitempty"`
+	System *DroneSystem `json:"system,omitempty"`
+}
+
+type DroneRepo struct {
+	Slug string `json:"slug"`
+	Link string `json:"link"`
+}
+
+type DroneBuild struct {
+	Number     int64        `json:"number"`
+	Status     string       `json:"status"`
+	Event      string       `json:"event"`
+	Link       string       `json:"link"`
+	Message    string       `json:"message"`
+	Target     string       `json:"target"`
+	After      string       `json:"after"`
+	AuthorName string       `json:"author_name"`
+	Started    int64        `json:"started"`
+	Finished   int64        `json:"finished"`
+	Stages     []DroneStage `json:"stages,omitempty"`
+}
+
+type DroneStage struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+type DroneSystem struct {
+	Link string `json:"link"`
+}
+
+type droneSource struct {
+	cfg DroneConfig
+}
+
+func (s droneSource) Name() string {
+	return "drone"
+}
+
+func (s droneSource) Detect(header http.Header, body []byte) bool {
+	return header.Get("X-Drone-Event") != ""
+}
+
+func (s droneSource) Verify(req *http.Request, body []byte) error {
+	if !s.cfg.verifySignature(req, body) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// signedAt returns the Date header when the HTTP signature covers it, as
+// it does by default
+func (s droneSource) signedAt(header http.Header) (time.Time, bool) {
+	if s.cfg.Secret == "" {
+		return time.Time{}, false
+	}
+	for _, part := range strings.Split(header.Get("Signature"), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if key != "headers" {
+			continue
+		}
+		for _, signed := range strings.Fields(strings.Trim(value, `"`)) {
+			if signed == "date" {
+				if date, err := http.ParseTime(header.Get("Date")); err == nil {
+					return date, true
+				}
+			}
+		}
+		return time.Time{}, true
+	}
+	// Without a headers parameter the signature covers the date alone
+	if date, err := http.ParseTime(header.Get("Date")); err == nil {
+		return date, true
+	}
+	return time.Time{}, true
+}
+
+func (s droneSource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	var payload DroneWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return singleBuild(payload.toBuildEvent()), nil
+}
+
+// verifySignature checks the draft-cavage HTTP signature Drone attaches to
+// webhooks, along with the body digest it covers
+func (c DroneConfig) verifySignature(req *http.Request, body []byte) bool {
+	if c.Secret == "" {
+		return true
+	}
+
+	params := make(map[string]string)
+	for _, part := range strings.Split(req.Header.Get("Signature"), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			params[key] = strings.Trim(value, `"`)
+		}
+	}
+	if params["algorithm"] != "hmac-sha256" || params["signature"] == "" {
+		return false
+	}
+
+	sum := sha256.Sum256(body)
+	if req.Header.Get("Digest") != "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]) {
+		return false
+	}
+
+	headers := strings.Fields(params["headers"])
+	if len(headers) == 0 {
+		headers = []string{"date"}
+	}
+	var lines []string
+	for _, h := range headers {
+		if h == "(request-target)" {
+			lines = append(lines, h+": "+strings.ToLower(req.Method)+" "+req.URL.RequestURI())
+			continue
+		}
+		lines = append(lines, h+": "+req.Header.Get(h))
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.Secret))
+	mac.Write([]byte(strings.Join(lines, "\n")))
+
+	signature, err := base64.StdEncoding.DecodeString(params["signature"])
+	return err == nil && hmac.Equal(signature, mac.Sum(nil))
+}
+
+// toBuildEvent converts a build webhook into a BuildEvent. Running builds
+// are reported once, when the first stage starts; other intermediate
+// updates return false.
+func (p DroneWebhook) toBuildEvent() (BuildEvent, bool) {
+	if p.Event != "build" || p.Build == nil || p.Repo == nil {
+		return BuildEvent{}, false
+	}
+	b := p.Build
+
+	build := BuildEvent{
+		Source:      "drone",
+		ProjectName: p.Repo.Slug,
+		BuildName:   "#" + strconv.FormatInt(b.Number, 10),
+		BuildURL:    b.Link,
+		Payload:     p,
+	}
+	if build.BuildURL == "" && p.System != nil {
+		build.BuildURL = p.System.Link + "/" + p.Repo.Slug + "/" + strconv.FormatInt(b.Number, 10)
+	}
+	if b.Started > 0 && b.Finished > b.Started {
+		build.Duration = time.Duration(b.Finished-b.Started) * time.Second
+	}
+
+	switch b.Status {
+	case "running":
+		if !b.firstStageRunning() {
+			return BuildEvent{}, false
+		}
+		build.Event = "started"
+	case "success":
+		build.Event = "success"
+	case "failure", "error":
+		build.Event = "failure"
+	case "killed":
+		build.Event = "aborted"
+	default:
+		return BuildEvent{}, false
+	}
+
+	if b.Target != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Branch", Value: b.Target})
+	}
+	if len(b.After) >= 8 {
+		build.Vars = append(build.Vars, BuildVar{Key: "Commit", Value: b.After[:8]})
+	}
+	if b.AuthorName != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Author", Value: b.AuthorName})
+	}
+	if b.Event != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Trigger", Value: b.Event})
+	}
+	if message, _, _ := strings.Cut(strings.TrimSpace(b.Message), "\n"); message != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Message", Value: message})
+	}
+	if failed := b.failedStages(); len(failed) > 0 {
+		build.Vars = append(build.Vars, BuildVar{Key: "Failed stages", Value: strings.Join(failed, ", ")})
+	}
+
+	return build, true
+}
+
+// firstStageRunning reports whether exactly one stage has started and none
+// have finished, i.e. the build has only just begun
+func (b DroneBuild) firstStageRunning() bool {
+	running := 0
+	for _, s := range b.Stages {
+		switch s.Status {
+		case "running":
+			running++
+		case "pending", "waiting_on_dependencies":
+		default:
+			return false
+		}
+	}
+	return running == 1
+}
+
+// failedStages returns the names of stages that failed or errored
+func (b DroneBuild) failedStages() []string {
+	var failed []string
+	for _, s := range b.Stages {
+		if s.Status == "failure" || s.Status == "error" {
+			failed = append(failed, s.Name)
+		}
+	}
+	return failed
+}
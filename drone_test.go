@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDroneParse(t *testing.T) {
+	header := http.Header{"X-Drone-Event": {"build"}}
+	repo := `"repo": {"slug": "team/app"}, "system": {"link": "https://drone.example.com"}`
+	tests := []struct {
+		name string
+		body string
+		want []buildSummary
+	}{
+		{
+			"first stage running",
+			`{"event": "build", ` + repo + `, "build": {"number": 3, "status": "running", "stages": [{"name": "test", "status": "running"}, {"name": "deploy", "status": "pending"}]}}`,
+			[]buildSummary{{"team/app", "#3", "https://drone.example.com/team/app/3", "started"}},
+		},
+		{
+			"later stage running",
+			`{"event": "build", ` + repo + `, "build": {"number": 3, "status": "running", "stages": [{"name": "test", "status": "success"}, {"name": "deploy", "status": "running"}]}}`,
+			nil,
+		},
+		{
+			"failed",
+			`{"event": "build", ` + repo + `, "build": {"number": 3, "status": "failure", "link": "https://drone.example.com/team/app/3", "stages": [{"name": "test", "status": "failure"}]}}`,
+			[]buildSummary{{"team/app", "#3", "https://drone.example.com/team/app/3", "failure"}},
+		},
+		{"repo event", `{"event": "repo", ` + repo + `}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name := detectSource(t, header, tt.body); name != "drone" {
+				t.Errorf("detected as %q, want drone", name)
+			}
+			builds := parseBuilds(t, droneSource{}, header, tt.body)
+			if got := summarize(builds); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("builds = %+v, want %+v", got, tt.want)
+			}
+			if tt.name == "failed" {
+				if value, _ := builds[0].variable("Failed stages"); value != "test" {
+					t.Errorf("failed stages = %q, want test", value)
+				}
+			}
+		})
+	}
+}
+
+func TestDroneVerify(t *testing.T) {
+	body := []byte(`{"event": "build"}`)
+	sum := sha256.Sum256(body)
+	digest := "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+	date := "Wed, 14 Oct 2026 12:00:00 GMT"
+	sign := func(secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("date: " + date + "\ndigest: " + digest))
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name   string
+		digest string
+		secret string
+		ok     bool
+	}{
+		{"valid", digest, "secret", true},
+		{"wrong secret", digest, "other", false},
+		{"body changed", "SHA-256=" + base64.StdEncoding.EncodeToString(make([]byte, 32)), "secret", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/webhook/drone", nil)
+			req.Header.Set("Date", date)
+			req.Header.Set("Digest", tt.digest)
+			req.Header.Set("Signature", strings.Join([]string{
+				`keyId="hmac-key"`, `algorithm="hmac-sha256"`, `signature="` + sign(tt.secret) + `"`, `headers="date digest"`,
+			}, ","))
+			err := droneSource{cfg: DroneConfig{Secret: "secret"}}.Verify(req, body)
+			if (err == nil) != tt.ok {
+				t.Errorf("Verify() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// SMTPConfig configures the SMTP email destination
+type SMTPConfig struct {
+	Host     string   `yaml:"host"`
+	Port     string   `yaml:"port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	TLS      string   `yaml:"tls"` // "starttls", "tls" or "none"
+}
+
+type emailDestination struct {
+	destinationID
+	cfg SMTPConfig
+}
+
+func (d *emailDestination) Name() string {
+	return "email"
+}
+
+func (d *emailDestination) pingAddress() string {
+	scheme := "tcp"
+	if d.cfg.TLS == "tls" {
+		scheme = "tls"
+	}
+	return scheme + "://" + net.JoinHostPort(d.cfg.Host, d.cfg.Port)
+}
+
+func (d *emailDestination) Send(build BuildEvent) error {
+	message, err := d.convertToEmailMessage(build)
+	if err != nil {
+		return err
+	}
+	return d.sendEmail(message)
+}
+
+// EmailMessage is a rendered notification ready to be sent over SMTP
+type EmailMessage struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// emailData is the view passed to the email templates
+type emailData struct {
+	Source    string
+	Title     string
+	Status    string
+	Color     string
+	URL       string
+	Duration  string
+	Time      string
+	Variables []BuildVar
+}
+
+var emailTextTemplate = template.Must(template.New("text").Parse(`{{.Title}}
+Status: {{.Status}}
+{{- if .Duration}}
+Duration: {{.Duration}}
+{{- end}}
+Time: {{.Time}}
+{{- range .Variables}}
+{{.Key}}: {{.Value}}
+{{- end}}
+{{- if .URL}}
+
+View build: {{.URL}}
+{{- end}}
+
+-- 
+{{.Source}} CI/CD
+`))
+
+var emailHTMLTemplate = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+<table style="border-left: 6px solid {{.Color}}; padding: 8px 16px;">
+<tr><td colspan="2"><h2 style="margin: 0 0 8px 0;">{{.Title}}</h2></td></tr>
+<tr><td><strong>Status</strong></td><td>{{.Status}}</td></tr>
+{{- if .Duration}}
+<tr><td><strong>Duration</strong></td><td>{{.Duration}}</td></tr>
+{{- end}}
+<tr><td><strong>Time</strong></td><td>{{.Time}}</td></tr>
+{{- range .Variables}}
+<tr><td><strong>{{.Key}}</strong></td><td>{{.Value}}</td></tr>
+{{- end}}
+{{- if .URL}}
+<tr><td colspan="2" style="padding-top: 8px;"><a href="{{.URL}}">View build</a></td></tr>
+{{- end}}
+</table>
+<p style="color: #808080; font-size: small;">{{.Source}} CI/CD</p>
+</body>
+</html>
+`))
+
+func (d *emailDestination) convertToEmailMessage(build BuildEvent) (EmailMessage, error) {
+	data := emailData{
+		Source:    build.SourceName(),
+		Title:     fmt.Sprintf("%s - %s", build.ProjectName, build.BuildName),
+		Status:    build.StatusText(),
+		Color:     fmt.Sprintf("#%06X", build.EventColor()),
+		URL:       build.BuildURL,
+		Time:      build.Timestamp,
+		Variables: build.Vars,
+	}
+	if build.Duration > 0 {
+		data.Duration = formatDuration(build.Duration)
+	}
+
+	var text, html bytes.Buffer
+	if err := emailTextTemplate.Execute(&text, data); err != nil {
+		return EmailMessage{}, fmt.Errorf("error rendering text body: %w", err)
+	}
+	if err := emailHTMLTemplate.Execute(&html, data); err != nil {
+		return EmailMessage{}, fmt.Errorf("error rendering HTML body: %w", err)
+	}
+
+	return EmailMessage{
+		Subject: fmt.Sprintf("[%s] %s: %s", data.Source, data.Title, data.Status),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// buildMIME assembles a multipart/alternative message with the plain-text
+// part first so clients that cannot render HTML fall back to it
+func (d *emailDestination) buildMIME(message EmailMessage) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	}
+	for _, p := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := pw.Write([]byte(p.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", d.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(d.cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+func (d *emailDestination) sendEmail(message EmailMessage) error {
+	raw, err := d.buildMIME(message)
+	if err != nil {
+		return fmt.Errorf("error building message: %w", err)
+	}
+
+	host := d.cfg.Host
+	addr := net.JoinHostPort(host, d.cfg.Port)
+	tlsConfig := &tls.Config{ServerName: host}
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	var conn net.Conn
+	if d.cfg.TLS == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %w", addr, err)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error starting SMTP session: %w", err)
+	}
+	defer c.Close()
+
+	if d.cfg.TLS == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("server %s does not support STARTTLS", addr)
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("error starting TLS: %w", err)
+		}
+	}
+
+	if d.cfg.Username != "" {
+		auth := smtp.PlainAuth("", d.cfg.Username, d.cfg.Password, host)
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("error authenticating: %w", err)
+		}
+	}
+
+	if err := c.Mail(d.cfg.From); err != nil {
+		return fmt.Errorf("error setting sender: %w", err)
+	}
+	for _, to := range d.cfg.To {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("error adding recipient %s: %w", to, err)
+		}
+	}
+
+	wc, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("error starting message data: %w", err)
+	}
+	if _, err := wc.Write(raw); err != nil {
+		wc.Close()
+		return fmt.Errorf("error writing message: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("error sending message: %w", err)
+	}
+
+	if err := c.Quit(); err != nil {
+		return fmt.Errorf("error closing SMTP session: %w", err)
+	}
+
+	log.Printf("Successfully sent email to %s", strings.Join(d.cfg.To, ", "))
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// smtpServer is a minimal SMTP server that accepts every message, recording
+// the commands and message data it receives
+type smtpServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	commands []string
+	data     string
+	done     chan struct{}
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{listener: listener, done: make(chan struct{})}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) serve() {
+	defer close(s.done)
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.TrimRight(line, "\r\n")
+		s.mu.Lock()
+		s.commands = append(s.commands, command)
+		s.mu.Unlock()
+		switch verb := strings.ToUpper(strings.SplitN(command, " ", 2)[0]); verb {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestEmailSend(t *testing.T) {
+	server := newSMTPServer(t)
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+	d := &emailDestination{cfg: SMTPConfig{
+		Host: host, Port: port, TLS: "none",
+		From: "ci@example.com", To: []string{"dev@example.com", "ops@example.com"},
+	}}
+	build := testBuild("<app>", "failure")
+	build.BuildURL = "https://ci.example.com/job/app/1/"
+
+	if err := d.Send(build); err != nil {
+		t.Fatal(err)
+	}
+	<-server.done
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	commands := strings.Join(server.commands, "\n")
+	for _, want := range []string{"MAIL FROM:<ci@example.com>", "RCPT TO:<dev@example.com>", "RCPT TO:<ops@example.com>"} {
+		if !strings.Contains(commands, want) {
+			t.Errorf("commands %q don't contain %q", commands, want)
+		}
+	}
+	tests := []struct {
+		name, want string
+	}{
+		{"recipients", "To: dev@example.com, ops@example.com"},
+		{"alternative parts", "Content-Type: multipart/alternative"},
+		{"text part", "<app> - #0\r\nStatus: " + build.StatusText()},
+		{"escaped HTML part", "<h2 style=\"margin: 0 0 8px 0;\">&lt;app&gt; - #0</h2>"},
+		{"link", `<a href="https://ci.example.com/job/app/1/">View build</a>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(server.data, tt.want) {
+				t.Errorf("message doesn't contain %q:\n%s", tt.want, server.data)
+			}
+		})
+	}
+}
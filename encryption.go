@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// encryptedPrefix marks a setting encrypted with the config encryption key,
+// as in enc:<base64>
+const encryptedPrefix = "enc:"
+
+// encryptionKeySize is the size of the AES-256 key secrets are encrypted with
+const encryptionKeySize = 32
+
+// EncryptionConfig holds the key that enc: settings are encrypted with:
+// either Key, a base64 encoded 32 byte key, or KMSKey, such a key encrypted
+// with AWS KMS, which is decrypted with the AWS credentials of the environment
+type EncryptionConfig struct {
+	Key    string `yaml:"key"`
+	KMSKey string `yaml:"kms_key"`
+}
+
+func (c EncryptionConfig) enabled() bool {
+	return c.Key != "" || c.KMSKey != ""
+}
+
+// box returns the secretBox of the configured key
+func (c EncryptionConfig) box() (*secretBox, error) {
+	if c.Key != "" && c.KMSKey != "" {
+		return nil, fmt.Errorf("only one of CONFIG_ENCRYPTION_KEY and CONFIG_ENCRYPTION_KMS_KEY may be set")
+	}
+
+	var key []byte
+	if c.KMSKey != "" {
+		plaintext, err := kmsDecrypt(c.KMSKey)
+		if err != nil {
+			return nil, fmt.Errorf("error decrypting CONFIG_ENCRYPTION_KMS_KEY: %w", err)
+		}
+		key = plaintext
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(c.Key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid CONFIG_ENCRYPTION_KEY: %w", err)
+		}
+		key = decoded
+	}
+	return newSecretBox(key)
+}
+
+// secretBox encrypts secrets with AES-256-GCM. Encrypted values are the
+// random nonce followed by the sealed secret, base64 encoded after the enc:
+// prefix.
+type secretBox struct {
+	aead cipher.AEAD
+}
+
+func newSecretBox(key []byte) (*secretBox, error) {
+	if len(key) != encryptionKeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", encryptionKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &secretBox{aead: aead}, nil
+}
+
+// seal encrypts secret into an enc: value
+func (b *secretBox) seal(secret string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(secret), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts an enc: value
+func (b *secretBox) open(value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil || len(sealed) < b.aead.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	secret, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errors.New("value wasn't encrypted with this key")
+	}
+	return string(secret), nil
+}
+
+// resolveEncryptedSecrets decrypts every enc: setting in cfg
+func resolveEncryptedSecrets(cfg *Config) error {
+	var refs []settingRef
+	collectRefs(reflect.ValueOf(cfg).Elem(), encryptedPrefix, &refs)
+	if len(refs) == 0 {
+		return nil
+	}
+	if !cfg.Encryption.enabled() {
+		return fmt.Errorf("%s settings require CONFIG_ENCRYPTION_KEY or CONFIG_ENCRYPTION_KMS_KEY", encryptedPrefix)
+	}
+
+	box, err := cfg.Encryption.box()
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		secret, err := box.open(ref.value)
+		if err != nil {
+			return fmt.Errorf("error decrypting setting: %w", err)
+		}
+		ref.set(secret)
+	}
+	return nil
+}
+
+// kmsDecrypt decrypts a base64 encoded AWS KMS ciphertext
+func kmsDecrypt(ciphertext string) ([]byte, error) {
+	blob, err := base64.StdEncoding.DecodeString(strings.TrimSpace(ciphertext))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext: %w", err)
+	}
+	body, err := json.Marshal(map[string][]byte{"CiphertextBlob": blob})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	region := awsRegion()
+	req, err := http.NewRequest("POST", fmt.Sprintf("https://kms.%s.amazonaws.com/", region), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService.Decrypt")
+	signAWSRequest(req, body, envAWSCredentials(), region, "kms", time.Now())
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("KMS returned status: %d", resp.StatusCode)
+	}
+	var result struct {
+		Plaintext []byte `json:"Plaintext"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	return result.Plaintext, nil
+}
+
+// encryptCommand encrypts a secret read from stdin into an enc: value for
+// the config, or generates a new key
+func encryptCommand(args []string) error {
+	flags := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	generate := flags.Bool("generate-key", false, "print a new random key for CONFIG_ENCRYPTION_KEY")
+	flags.Parse(args)
+
+	if *generate {
+		key := make([]byte, encryptionKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		fmt.Println(base64.StdEncoding.EncodeToString(key))
+		return nil
+	}
+
+	env := readEnvironment()
+	cfg := EncryptionConfig{
+		Key:    env.lookup("CONFIG_ENCRYPTION_KEY"),
+		KMSKey: env.lookup("CONFIG_ENCRYPTION_KMS_KEY"),
+	}
+	if env.err != nil {
+		return env.err
+	}
+	if !cfg.enabled() {
+		return fmt.Errorf("CONFIG_ENCRYPTION_KEY or CONFIG_ENCRYPTION_KMS_KEY is required")
+	}
+	box, err := cfg.box()
+	if err != nil {
+		return err
+	}
+
+	// Read the secret from stdin so it doesn't end up in the shell history
+	input, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	secret := strings.TrimRight(string(input), "\r\n")
+	if secret == "" {
+		return fmt.Errorf("no secret given on stdin")
+	}
+
+	value, err := box.seal(secret)
+	if err != nil {
+		return err
+	}
+	fmt.Println(value)
+	return nil
+}
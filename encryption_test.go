@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestSecretBox(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, encryptionKeySize)
+	box, err := newSecretBox(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := newSecretBox(bytes.Repeat([]byte{2}, encryptionKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := box.seal("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, encryptedPrefix))
+	raw[len(raw)-1] ^= 1
+	tampered := encryptedPrefix + base64.StdEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name  string
+		box   *secretBox
+		value string
+		want  string
+		ok    bool
+	}{
+		{"round trip", box, sealed, "hunter2", true},
+		{"wrong key", other, sealed, "", false},
+		{"tampered", box, tampered, "", false},
+		{"not base64", box, encryptedPrefix + "not base64!", "", false},
+		{"too short", box, encryptedPrefix + base64.StdEncoding.EncodeToString([]byte("short")), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.box.open(tt.value)
+			if ok := err == nil; ok != tt.ok {
+				t.Fatalf("open() error = %v, want ok %v", err, tt.ok)
+			}
+			if got != tt.want {
+				t.Errorf("open() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	again, err := box.seal("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == sealed {
+		t.Error("seal() returned the same value twice, want a random nonce")
+	}
+}
+
+func TestNewSecretBoxKeySize(t *testing.T) {
+	for _, size := range []int{0, 16, 31, 33} {
+		if _, err := newSecretBox(make([]byte, size)); err == nil {
+			t.Errorf("newSecretBox() with a %d byte key error = nil, want an error", size)
+		}
+	}
+}
+
+func TestResolveEncryptedSecrets(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, encryptionKeySize)
+	box, err := newSecretBox(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := box.seal("https://discord.com/api/webhooks/1/token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedKey := base64.StdEncoding.EncodeToString(key)
+
+	tests := []struct {
+		name       string
+		key        string
+		webhookURL string
+		want       string
+		ok         bool
+	}{
+		{"decrypted", encodedKey, sealed, "https://discord.com/api/webhooks/1/token", true},
+		{"plain values are kept", encodedKey, "https://example.com", "https://example.com", true},
+		{"no key", "", sealed, sealed, false},
+		{"wrong key", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, encryptionKeySize)), sealed, sealed, false},
+		{"key not base64", "not base64!", sealed, sealed, false},
+		{"short key", base64.StdEncoding.EncodeToString(key[:16]), sealed, sealed, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{}
+			cfg.Encryption.Key = tt.key
+			cfg.Discord.WebhookURL = tt.webhookURL
+			err := resolveEncryptedSecrets(cfg)
+			if ok := err == nil; ok != tt.ok {
+				t.Fatalf("resolveEncryptedSecrets() error = %v, want ok %v", err, tt.ok)
+			}
+			if cfg.Discord.WebhookURL != tt.want {
+				t.Errorf("webhook URL = %q, want %q", cfg.Discord.WebhookURL, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// BuildEvent is the CI-agnostic build notification every destination renders.
+// Each webhook source converts its own payload into one of these.
+type BuildEvent struct {
+	Source      string
+	ProjectName string
+	BuildName   string
+	BuildURL    string
+	Event       string
+	// RunID identifies the run in CI systems whose BuildName, such as a
+	// pipeline or branch name, is shared by their runs
+	RunID string
+	// Result is the CI system's own result when events group several,
+	// e.g. Jenkins' NOT_BUILT for an aborted build
+	Result   string
+	Vars     []BuildVar
+	Duration time.Duration
+	// EstimatedDuration is how long a started build is expected to take, and
+	// AverageDuration how long the job's recent builds took, for finished ones
+	EstimatedDuration time.Duration
+	AverageDuration   time.Duration
+	// Culprits are the user names or emails of who made the changes built,
+	// and Commits those changes
+	Culprits []string
+	Commits  []Commit
+	// ReleaseCommits are the commits of a successful build and of the job's
+	// builds since its last successful one, and ReleaseNotes lists them in
+	// Markdown for the builds of deployment jobs
+	ReleaseCommits []Commit
+	ReleaseNotes   string
+	// SCM is the branch, commit and pull request built, when known
+	SCM *SCMContext
+	// Tests are the test results of the build, when known
+	Tests *TestSummary
+	// Stages are the stages of a completed pipeline build, and FailedStage
+	// the name of the first one that failed
+	Stages      []Stage
+	FailedStage string
+	// ConsoleLog is the tail of the console log of a failed build, and
+	// Description the CI system's description of the build
+	ConsoleLog  string
+	Description string
+	// Tags classify why a build failed, see FailureClassifier
+	Tags []string
+	// Artifacts are the first archived files of a finished build, of
+	// ArtifactCount in all
+	Artifacts     []Artifact
+	ArtifactCount int
+
+	// Time is when the event was received, in the configured timezone, and
+	// Timestamp is Time in the configured date format
+	Time      time.Time
+	Timestamp string
+
+	// Color, Text, Mentions, Message, Title and Fields come from the job's
+	// notification settings; Color and Text replace the event's default
+	// color and status text when set, and Message, Title and Fields, when
+	// not nil, the default layout. MentionCulprits is set along with
+	// Mentions, for the events that mention.
+	Color           int
+	Text            string
+	Mentions        []string
+	MentionCulprits bool
+	Message         string
+	Title           string
+	Fields          []MessageField
+	// ParameterFields are the build variables shown as fields of their own
+	ParameterFields []MessageField
+	// FooterText and FooterIcon replace the default footer, and Instance
+	// names the CI server in it
+	FooterText string
+	FooterIcon string
+	Instance   string
+
+	// Payload is the original webhook body, exposed to generic webhook templates
+	Payload interface{} `json:"-"`
+
+	// details fetches what the source's API knows about the build. It runs
+	// on delivery, which may happen after the webhook was answered, and
+	// fetches the build description when describe is set.
+	details func(build *BuildEvent, describe bool)
+	// delivery records the attempts of sending the event to a destination,
+	// and queued is set when the outbound queue sends it, which retries
+	// failed deliveries itself
+	delivery *deliveryRecord
+	queued   bool
+}
+
+// addDetails runs the source's details fetch, once. The build description
+// is only fetched for the failure classifiers that search it.
+func (b *BuildEvent) addDetails(classifiers []FailureClassifier) {
+	if b.details == nil {
+		return
+	}
+	details := b.details
+	b.details = nil
+	details(b, searchesDescriptions(classifiers))
+}
+
+// Commit is a change included in a build
+type Commit struct {
+	ID      string
+	Message string
+	Author  string
+}
+
+// MessageField is a field of the message rendered from the field templates
+type MessageField struct {
+	Name   string
+	Value  string
+	Inline bool
+}
+
+// sourceNames maps source identifiers to their display names
+var sourceNames = map[string]string{
+	"jenkins":      "Jenkins",
+	"gitlab":       "GitLab",
+	"circleci":     "CircleCI",
+	"drone":        "Drone",
+	"teamcity":     "TeamCity",
+	"bitbucket":    "Bitbucket",
+	"azuredevops":  "Azure DevOps",
+	"argocd":       "Argo CD",
+	"tekton":       "Tekton",
+	"sonarqube":    "SonarQube",
+	"harbor":       "Harbor",
+	"alertmanager": "Alertmanager",
+	"buildkite":    "Buildkite",
+	"travis":       "Travis CI",
+	"woodpecker":   "Woodpecker CI",
+	"gitea":        "Gitea Actions",
+	"spinnaker":    "Spinnaker",
+	"artifactory":  "Artifactory",
+	"nexus":        "Nexus Repository",
+}
+
+// SourceName returns the display name of the CI system that sent the event
+func (b BuildEvent) SourceName() string {
+	return sourceName(b.Source)
+}
+
+// EventColor returns the color configured for the build, falling back to
+// the default color of its event
+func (b BuildEvent) EventColor() int {
+	if b.Color != 0 {
+		return b.Color
+	}
+	if color, ok := statusColor(defaultColors, b); ok {
+		return color
+	}
+	return defaultColors["aborted"]
+}
+
+// StatusText returns the status text configured for the build, falling
+// back to the default text of its result or event
+func (b BuildEvent) StatusText() string {
+	if b.Text != "" {
+		return b.Text
+	}
+	if text, ok := statusText(defaultStatusTexts, b); ok {
+		return text
+	}
+	return b.Event
+}
+
+// Footer returns the footer of the build's messages, such as
+// "jenkins-prod.eu • Jenkins CI/CD"
+func (b BuildEvent) Footer() string {
+	text := b.FooterText
+	if text == "" {
+		text = b.SourceName() + " CI/CD"
+	}
+	if b.Instance != "" {
+		text = b.Instance + " • " + text
+	}
+	return text
+}
+
+// sourceName returns the display name of a source identifier
+func sourceName(source string) string {
+	if name, ok := sourceNames[source]; ok {
+		return name
+	}
+	return source
+}
+
+// CloudEvent holds the attributes of a CloudEvent that sources care about
+type CloudEvent struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// isCloudEvent reports whether the request carries a binary or structured
+// mode CloudEvent
+func isCloudEvent(header http.Header) bool {
+	return header.Get("Ce-Type") != "" ||
+		strings.HasPrefix(header.Get("Content-Type"), "application/cloudevents+json")
+}
+
+// parseCloudEvent reads a CloudEvent delivered over HTTP. Binary mode carries
+// the attributes in Ce-* headers with the data as the body; structured mode
+// sends the whole event as JSON.
+func parseCloudEvent(header http.Header, body []byte) (CloudEvent, error) {
+	if !strings.HasPrefix(header.Get("Content-Type"), "application/cloudevents+json") {
+		return CloudEvent{Type: header.Get("Ce-Type"), Data: body}, nil
+	}
+
+	var event CloudEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		return CloudEvent{}, err
+	}
+	return event, nil
+}
+
+// verifyBearerToken checks an "Authorization: Bearer <token>" header in
+// constant time; an empty token accepts every request
+func verifyBearerToken(header, token string) bool {
+	if token == "" {
+		return true
+	}
+	got, ok := strings.CutPrefix(header, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// variable returns the value of the build variable with the given key
+func (b BuildEvent) variable(key string) (string, bool) {
+	for _, v := range b.Vars {
+		if v.Key == key {
+			return v.Value, true
+		}
+	}
+	return "", false
+}
+
+// branch returns the SCM branch of the build: the Branch variable most
+// sources set, or the branch parameters Jenkins pipelines commonly use
+func (b BuildEvent) branch() string {
+	for _, key := range []string{"Branch", "BRANCH_NAME", "GIT_BRANCH"} {
+		if value, ok := b.variable(key); ok && value != "" {
+			return strings.TrimPrefix(value, "origin/")
+		}
+	}
+	return ""
+}
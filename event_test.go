@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestStatusText(t *testing.T) {
+	tests := []struct {
+		name  string
+		build BuildEvent
+		want  string
+	}{
+		{"event", BuildEvent{Event: "success"}, "✅ Success"},
+		{"queued", BuildEvent{Event: "queued"}, "⏳ Queued"},
+		{"finalized", BuildEvent{Event: "finalized"}, "🏁 Finalized"},
+		{"result wins over event", BuildEvent{Event: "aborted", Result: "NOT_BUILT"}, "⏭️ Not Built"},
+		{"configured text", BuildEvent{Event: "failure", Text: "🔥 Broken"}, "🔥 Broken"},
+		{"unknown event", BuildEvent{Event: "paused"}, "paused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.build.StatusText(); got != tt.want {
+				t.Errorf("StatusText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+// GenericConfig configures the generic HTTP destination
+type GenericConfig struct {
+	URL          string            `yaml:"url"`
+	Method       string            `yaml:"method"`
+	ContentType  string            `yaml:"content_type"`
+	Headers      map[string]string `yaml:"headers"`
+	Template     string            `yaml:"template"`
+	TemplateFile string            `yaml:"template_file"`
+}
+
+type genericDestination struct {
+	destinationID
+	httpSender
+	cfg      GenericConfig
+	template *template.Template
+}
+
+func (d *genericDestination) Name() string {
+	return "generic"
+}
+
+func (d *genericDestination) pingAddress() string {
+	return d.cfg.URL
+}
+
+func (d *genericDestination) Send(build BuildEvent) error {
+	body, err := d.renderGenericBody(build)
+	if err != nil {
+		return err
+	}
+	return d.sendToGenericWebhook(body)
+}
+
+// defaultGenericTemplate forwards the original webhook payload as JSON
+const defaultGenericTemplate = `{{json .Payload}}`
+
+// genericTemplateData is the view passed to the generic webhook template
+type genericTemplateData struct {
+	Payload     interface{}
+	ProjectName string
+	BuildName   string
+	BuildURL    string
+	Event       string
+	Status      string
+	Color       string
+	Duration    string
+	Time        string
+	Vars        map[string]string
+	Commits     []Commit
+	// ReleaseNotes is the What's new section of deployment jobs
+	ReleaseNotes string
+	SCM          *SCMContext
+	Tests        *TestSummary
+	Stages       []Stage
+	FailedStage  string
+	ConsoleLog   string
+	Tags         []string
+	Instance     string
+	Artifacts    []Artifact
+	// ETA is when a started build should finish and VsAverage how a finished
+	// build's duration compares with the job's average, when known
+	ETA       string
+	VsAverage string
+}
+
+// templateFuncs are the functions of every template: the sprig library
+// plus json. Sprig's env, expandenv and getHostByName are left out, as
+// templates sent to the preview endpoint could read the server's secrets
+// from the environment or make it resolve any host.
+var templateFuncs = func() template.FuncMap {
+	funcs := sprig.TxtFuncMap()
+	for _, name := range []string{"env", "expandenv", "getHostByName"} {
+		delete(funcs, name)
+	}
+	funcs["json"] = func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+	return funcs
+}()
+
+// parseGenericTemplate compiles the template from GENERIC_WEBHOOK_TEMPLATE_FILE,
+// GENERIC_WEBHOOK_TEMPLATE or the built-in default, in that order
+func parseGenericTemplate(cfg GenericConfig) (*template.Template, error) {
+	text := cfg.Template
+	if cfg.TemplateFile != "" {
+		content, err := os.ReadFile(cfg.TemplateFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading generic webhook template: %w", err)
+		}
+		text = string(content)
+	}
+	if text == "" {
+		text = defaultGenericTemplate
+	}
+
+	tmpl, err := template.New("generic").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing generic webhook template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// newTemplateData builds the template view of a build event
+func newTemplateData(build BuildEvent) genericTemplateData {
+	data := genericTemplateData{
+		Payload:      build.Payload,
+		ProjectName:  build.ProjectName,
+		BuildName:    build.BuildName,
+		BuildURL:     build.BuildURL,
+		Event:        build.Event,
+		Status:       build.StatusText(),
+		Color:        fmt.Sprintf("#%06X", build.EventColor()),
+		Time:         build.Timestamp,
+		Vars:         make(map[string]string),
+		Commits:      build.Commits,
+		ReleaseNotes: build.ReleaseNotes,
+		SCM:          build.SCM,
+		Tests:        build.Tests,
+		Stages:       build.Stages,
+		FailedStage:  build.FailedStage,
+		ConsoleLog:   build.ConsoleLog,
+		Tags:         build.Tags,
+		Instance:     build.Instance,
+		Artifacts:    build.Artifacts,
+	}
+	if build.EstimatedDuration > 0 {
+		data.ETA = formatETA(build)
+	}
+	data.VsAverage = compareDuration(build.Duration, build.AverageDuration)
+	if build.Duration > 0 {
+		data.Duration = formatDuration(build.Duration)
+	}
+	for _, v := range build.Vars {
+		data.Vars[v.Key] = v.Value
+	}
+	return data
+}
+
+func (d *genericDestination) renderGenericBody(build BuildEvent) ([]byte, error) {
+	var body bytes.Buffer
+	if err := d.template.Execute(&body, newTemplateData(build)); err != nil {
+		return nil, fmt.Errorf("error rendering template: %w", err)
+	}
+	return body.Bytes(), nil
+}
+
+func (d *genericDestination) sendToGenericWebhook(body []byte) error {
+	req, err := http.NewRequest(d.cfg.Method, d.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", d.cfg.ContentType)
+	for k, v := range d.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if err := d.sendRequest(req); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully sent generic webhook to %s", req.URL.Host)
+	return nil
+}
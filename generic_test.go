@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGenericSend(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         GenericConfig
+		contentType string
+		body        string
+	}{
+		{
+			name: "default template forwards the payload",
+			cfg:  GenericConfig{Method: "POST", ContentType: "application/json"},
+			body: `{"build":{"phase":"COMPLETED"},"name":"app"}`,
+		},
+		{
+			name: "custom template, method and headers",
+			cfg: GenericConfig{
+				Method:      "PUT",
+				ContentType: "text/plain",
+				Headers:     map[string]string{"X-Token": "secret"},
+				Template:    `{{.ProjectName}} {{.BuildName}} {{.Event}} {{.Vars.Test | upper}}`,
+			},
+			body: "app #0 failure SENT WITH ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRecordingServer(t, http.StatusNoContent, "")
+			tmpl, err := parseGenericTemplate(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.cfg.URL = "https://hooks.example.com/ci"
+			d := &genericDestination{httpSender: server.sender(), cfg: tt.cfg, template: tmpl}
+			build := testBuild("app", "failure")
+			build.Payload = map[string]interface{}{"name": "app", "build": map[string]string{"phase": "COMPLETED"}}
+
+			if err := d.Send(build); err != nil {
+				t.Fatal(err)
+			}
+			request := server.only(t)
+			if request.Method != tt.cfg.Method || request.Path != "/ci" {
+				t.Errorf("request = %s %s, want %s /ci", request.Method, request.Path, tt.cfg.Method)
+			}
+			if got := request.Header.Get("Content-Type"); got != tt.cfg.ContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.cfg.ContentType)
+			}
+			for k, v := range tt.cfg.Headers {
+				if request.Header.Get(k) != v {
+					t.Errorf("header %s = %q, want %q", k, request.Header.Get(k), v)
+				}
+			}
+			if got := string(request.Body); !strings.HasPrefix(got, tt.body) {
+				t.Errorf("body = %q, want it to start with %q", got, tt.body)
+			}
+		})
+	}
+}
+
+func TestGenericTemplateErrors(t *testing.T) {
+	if _, err := parseGenericTemplate(GenericConfig{Template: "{{.ProjectName"}); err == nil {
+		t.Error("unterminated template parsed")
+	}
+
+	tmpl, err := parseGenericTemplate(GenericConfig{Template: "{{.Missing}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &genericDestination{template: tmpl}
+	if err := d.Send(testBuild("app", "success")); err == nil {
+		t.Error("template of an unknown field rendered")
+	}
+}
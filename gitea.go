@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// GiteaConfig configures the Gitea Actions webhook source. When Secret is
+// set, requests must carry a matching HMAC-SHA256 in X-Gitea-Signature.
+type GiteaConfig struct {
+	Secret string `yaml:"secret"`
+}
+
+// Gitea workflow_run webhook payload structures, which follow GitHub's
+type GiteaWebhook struct {
+	Action      string            `json:"action"`
+	WorkflowRun *GiteaWorkflowRun `json:"workflow_run,omitempty"`
+	Repository  *struct {
+		FullName string `json:"full_name"`
+	} `json:"repository,omitempty"`
+}
+
+type GiteaWorkflowRun struct {
+	Name         string    `json:"name"`
+	DisplayTitle string    `json:"display_title"`
+	RunNumber    int64     `json:"run_number"`
+	Event        string    `json:"event"`
+	Conclusion   string    `json:"conclusion"`
+	HTMLURL      string    `json:"html_url"`
+	HeadBranch   string    `json:"head_branch"`
+	HeadSHA      string    `json:"head_sha"`
+	RunStartedAt time.Time `json:"run_started_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	Actor        *struct {
+		Login string `json:"login"`
+	} `json:"actor,omitempty"`
+}
+
+type giteaSource struct {
+	cfg GiteaConfig
+}
+
+func (s giteaSource) Name() string {
+	return "gitea"
+}
+
+func (s giteaSource) Detect(header http.Header, body []byte) bool {
+	return header.Get("X-Gitea-Event") != ""
+}
+
+func (s giteaSource) Verify(req *http.Request, body []byte) error {
+	if !s.cfg.verifySignature(req.Header.Get("X-Gitea-Signature"), body) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// signedAt reports requests as signed when a secret is configured. The
+// signature doesn't cover a send time.
+func (s giteaSource) signedAt(header http.Header) (time.Time, bool) {
+	return time.Time{}, s.cfg.Secret != ""
+}
+
+func (s giteaSource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	if header.Get("X-Gitea-Event") != "workflow_run" {
+		// Pushes, issues and other repository events share the webhook
+		return nil, nil
+	}
+
+	var payload GiteaWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return singleBuild(payload.toBuildEvent()), nil
+}
+
+// verifySignature checks the hex HMAC-SHA256 of the body Gitea sends
+func (c GiteaConfig) verifySignature(header string, body []byte) bool {
+	if c.Secret == "" {
+		return true
+	}
+
+	decoded, err := hex.DecodeString(header)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.Secret))
+	mac.Write(body)
+	return hmac.Equal(decoded, mac.Sum(nil))
+}
+
+// toBuildEvent converts a workflow_run webhook into a BuildEvent, returning
+// false for requested runs and skipped or other inconclusive results
+func (p GiteaWebhook) toBuildEvent() (BuildEvent, bool) {
+	run := p.WorkflowRun
+	if run == nil || p.Repository == nil {
+		return BuildEvent{}, false
+	}
+
+	build := BuildEvent{
+		Source:      "gitea",
+		ProjectName: p.Repository.FullName,
+		BuildName:   run.Name + " #" + strconv.FormatInt(run.RunNumber, 10),
+		BuildURL:    run.HTMLURL,
+		Payload:     p,
+	}
+
+	switch p.Action {
+	case "in_progress":
+		build.Event = "started"
+	case "completed":
+		switch run.Conclusion {
+		case "success":
+			build.Event = "success"
+		case "failure":
+			build.Event = "failure"
+		case "cancelled":
+			build.Event = "aborted"
+		default:
+			return BuildEvent{}, false
+		}
+		if !run.RunStartedAt.IsZero() && run.UpdatedAt.After(run.RunStartedAt) {
+			build.Duration = run.UpdatedAt.Sub(run.RunStartedAt)
+		}
+	default:
+		return BuildEvent{}, false
+	}
+
+	if run.HeadBranch != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Branch", Value: run.HeadBranch})
+	}
+	if len(run.HeadSHA) >= 8 {
+		build.Vars = append(build.Vars, BuildVar{Key: "Commit", Value: run.HeadSHA[:8]})
+	}
+	if run.Actor != nil && run.Actor.Login != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Actor", Value: run.Actor.Login})
+	}
+	if run.Event != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Trigger", Value: run.Event})
+	}
+	if run.DisplayTitle != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Title", Value: run.DisplayTitle})
+	}
+
+	return build, true
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGiteaParse(t *testing.T) {
+	payload := func(action, conclusion string) string {
+		return `{"action": "` + action + `", "repository": {"full_name": "team/app"},
+		  "workflow_run": {"name": "CI", "display_title": "Fix the login", "run_number": 8, "event": "push", "conclusion": "` + conclusion + `",
+		  "html_url": "https://git.example.com/team/app/actions/runs/8", "head_branch": "main", "head_sha": "0123456789abcdef",
+		  "run_started_at": "2026-10-14T12:00:00Z", "updated_at": "2026-10-14T12:04:00Z", "actor": {"login": "ana"}}}`
+	}
+	runURL := "https://git.example.com/team/app/actions/runs/8"
+	tests := []struct {
+		name  string
+		event string
+		body  string
+		want  []buildSummary
+	}{
+		{"in progress", "workflow_run", payload("in_progress", ""), []buildSummary{{"team/app", "CI #8", runURL, "started"}}},
+		{"succeeded", "workflow_run", payload("completed", "success"), []buildSummary{{"team/app", "CI #8", runURL, "success"}}},
+		{"failed", "workflow_run", payload("completed", "failure"), []buildSummary{{"team/app", "CI #8", runURL, "failure"}}},
+		{"cancelled", "workflow_run", payload("completed", "cancelled"), []buildSummary{{"team/app", "CI #8", runURL, "aborted"}}},
+		{"skipped", "workflow_run", payload("completed", "skipped"), nil},
+		{"requested", "workflow_run", payload("requested", ""), nil},
+		{"push", "push", `{"ref": "refs/heads/main"}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{"X-Gitea-Event": {tt.event}}
+			if name := detectSource(t, header, tt.body); name != "gitea" {
+				t.Errorf("detected as %q, want gitea", name)
+			}
+			builds := parseBuilds(t, giteaSource{}, header, tt.body)
+			if got := summarize(builds); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("builds = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	header := http.Header{"X-Gitea-Event": {"workflow_run"}}
+	build := parseBuilds(t, giteaSource{}, header, payload("completed", "failure"))[0]
+	if build.Duration != 4*time.Minute {
+		t.Errorf("duration = %v, want 4m", build.Duration)
+	}
+	want := []BuildVar{
+		{Key: "Branch", Value: "main"},
+		{Key: "Commit", Value: "01234567"},
+		{Key: "Actor", Value: "ana"},
+		{Key: "Trigger", Value: "push"},
+		{Key: "Title", Value: "Fix the login"},
+	}
+	if !reflect.DeepEqual(build.Vars, want) {
+		t.Errorf("vars = %+v, want %+v", build.Vars, want)
+	}
+}
+
+func TestGiteaVerify(t *testing.T) {
+	body := []byte(`{"action": "completed"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	src := giteaSource{cfg: GiteaConfig{Secret: "secret"}}
+
+	for signature, ok := range map[string]bool{hex.EncodeToString(mac.Sum(nil)): true, hex.EncodeToString(make([]byte, 32)): false, "not hex": false} {
+		req, _ := http.NewRequest(http.MethodPost, "/webhook/gitea", nil)
+		req.Header.Set("X-Gitea-Signature", signature)
+		if err := src.Verify(req, body); (err == nil) != ok {
+			t.Errorf("Verify() with %q = %v, want ok %v", signature, err, ok)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// GitLabConfig configures the GitLab webhook source. When Token is set,
+// requests must carry it in the X-Gitlab-Token header.
+type GitLabConfig struct {
+	Token string `yaml:"token"`
+}
+
+// GitLab webhook payload structures. Pipeline hooks and job hooks share the
+// endpoint and are told apart by object_kind.
+type GitLabWebhook struct {
+	ObjectKind string `json:"object_kind"`
+
+	// Pipeline hook fields
+	ObjectAttributes *GitLabPipelineAttributes `json:"object_attributes,omitempty"`
+	Project          *GitLabProject            `json:"project,omitempty"`
+	User             *GitLabUser               `json:"user,omitempty"`
+
+	// Job hook fields
+	Ref               string            `json:"ref,omitempty"`
+	SHA               string            `json:"sha,omitempty"`
+	BuildID           int64             `json:"build_id,omitempty"`
+	BuildName         string            `json:"build_name,omitempty"`
+	BuildStage        string            `json:"build_stage,omitempty"`
+	BuildStatus       string            `json:"build_status,omitempty"`
+	BuildDuration     float64           `json:"build_duration,omitempty"`
+	BuildAllowFailure bool              `json:"build_allow_failure,omitempty"`
+	ProjectName       string            `json:"project_name,omitempty"`
+	Repository        *GitLabRepository `json:"repository,omitempty"`
+}
+
+type GitLabPipelineAttributes struct {
+	ID       int64   `json:"id"`
+	Ref      string  `json:"ref"`
+	SHA      string  `json:"sha"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"duration"`
+	URL      string  `json:"url"`
+}
+
+type GitLabProject struct {
+	Name              string `json:"name"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	WebURL            string `json:"web_url"`
+}
+
+type GitLabUser struct {
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
+
+type GitLabRepository struct {
+	Name     string `json:"name"`
+	Homepage string `json:"homepage"`
+}
+
+type gitlabSource struct {
+	cfg GitLabConfig
+}
+
+func (s gitlabSource) Name() string {
+	return "gitlab"
+}
+
+func (s gitlabSource) Detect(header http.Header, body []byte) bool {
+	return header.Get("X-Gitlab-Event") != ""
+}
+
+func (s gitlabSource) Verify(req *http.Request, body []byte) error {
+	if !s.cfg.verifyToken(req.Header.Get("X-Gitlab-Token")) {
+		return errInvalidToken
+	}
+	return nil
+}
+
+// Parse ignores pending, created and similar intermediate states, which are
+// not worth a notification
+func (s gitlabSource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	var payload GitLabWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return singleBuild(payload.toBuildEvent()), nil
+}
+
+// verifyToken reports whether the X-Gitlab-Token header matches the secret
+func (c GitLabConfig) verifyToken(token string) bool {
+	if c.Token == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(c.Token)) == 1
+}
+
+// toBuildEvent converts a pipeline or job hook into a BuildEvent, returning
+// false for hook kinds and statuses that don't map to a build event
+func (g GitLabWebhook) toBuildEvent() (BuildEvent, bool) {
+	build := BuildEvent{
+		Source:  "gitlab",
+		Payload: g,
+	}
+
+	var status, ref, sha string
+	switch g.ObjectKind {
+	case "pipeline":
+		if g.ObjectAttributes == nil || g.Project == nil {
+			return BuildEvent{}, false
+		}
+		attrs := g.ObjectAttributes
+		status, ref, sha = attrs.Status, attrs.Ref, attrs.SHA
+		build.ProjectName = g.Project.PathWithNamespace
+		build.BuildName = "#" + strconv.FormatInt(attrs.ID, 10)
+		build.BuildURL = attrs.URL
+		if build.BuildURL == "" {
+			build.BuildURL = g.Project.WebURL + "/-/pipelines/" + strconv.FormatInt(attrs.ID, 10)
+		}
+		build.Duration = time.Duration(attrs.Duration * float64(time.Second))
+	case "build":
+		status, ref, sha = g.BuildStatus, g.Ref, g.SHA
+		build.ProjectName = g.ProjectName
+		build.BuildName = g.BuildName + " #" + strconv.FormatInt(g.BuildID, 10)
+		if g.Repository != nil {
+			build.BuildURL = g.Repository.Homepage + "/-/jobs/" + strconv.FormatInt(g.BuildID, 10)
+		}
+		build.Duration = time.Duration(g.BuildDuration * float64(time.Second))
+	default:
+		return BuildEvent{}, false
+	}
+
+	switch status {
+	case "running":
+		build.Event = "started"
+	case "success":
+		build.Event = "success"
+	case "failed":
+		build.Event = "failure"
+		if g.ObjectKind == "build" && g.BuildAllowFailure {
+			build.Event = "unstable"
+		}
+	case "canceled":
+		build.Event = "aborted"
+	default:
+		return BuildEvent{}, false
+	}
+
+	if ref != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Ref", Value: ref})
+	}
+	if len(sha) >= 8 {
+		build.Vars = append(build.Vars, BuildVar{Key: "Commit", Value: sha[:8]})
+	}
+	if g.BuildStage != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Stage", Value: g.BuildStage})
+	}
+	if g.User != nil && g.User.Name != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "User", Value: g.User.Name})
+	}
+
+	return build, true
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestGitLabParse(t *testing.T) {
+	header := http.Header{"X-Gitlab-Event": {"Pipeline Hook"}}
+	tests := []struct {
+		name string
+		body string
+		want []buildSummary
+	}{
+		{
+			"failed pipeline",
+			`{"object_kind": "pipeline", "object_attributes": {"id": 7, "ref": "main", "sha": "0123456789abcdef", "status": "failed", "duration": 65},
+			  "project": {"name": "app", "path_with_namespace": "team/app", "web_url": "https://gitlab.example.com/team/app"}}`,
+			[]buildSummary{{"team/app", "#7", "https://gitlab.example.com/team/app/-/pipelines/7", "failure"}},
+		},
+		{
+			"job allowed to fail",
+			`{"object_kind": "build", "build_id": 9, "build_name": "lint", "build_status": "failed", "build_allow_failure": true,
+			  "project_name": "team / app", "repository": {"homepage": "https://gitlab.example.com/team/app"}}`,
+			[]buildSummary{{"team / app", "lint #9", "https://gitlab.example.com/team/app/-/jobs/9", "unstable"}},
+		},
+		{
+			"pending pipeline",
+			`{"object_kind": "pipeline", "object_attributes": {"id": 7, "status": "pending"}, "project": {"path_with_namespace": "team/app"}}`,
+			nil,
+		},
+		{"push hook", `{"object_kind": "push"}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name := detectSource(t, header, tt.body); name != "gitlab" {
+				t.Errorf("detected as %q, want gitlab", name)
+			}
+			builds := parseBuilds(t, gitlabSource{}, header, tt.body)
+			if got := summarize(builds); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("builds = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitLabVerify(t *testing.T) {
+	src := gitlabSource{cfg: GitLabConfig{Token: "secret"}}
+	tests := []struct {
+		token string
+		ok    bool
+	}{
+		{"secret", true},
+		{"wrong", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodPost, "/webhook/gitlab", nil)
+		req.Header.Set("X-Gitlab-Token", tt.token)
+		if err := src.Verify(req, nil); (err == nil) != tt.ok {
+			t.Errorf("Verify() with token %q = %v, want ok %v", tt.token, err, tt.ok)
+		}
+	}
+}
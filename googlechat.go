@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// GoogleChatConfig configures the Google Chat destination
+type GoogleChatConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
+}
+
+type googleChatDestination struct {
+	destinationID
+	httpSender
+	cfg GoogleChatConfig
+}
+
+func (d *googleChatDestination) Name() string {
+	return "googlechat"
+}
+
+func (d *googleChatDestination) pingAddress() string {
+	return d.cfg.WebhookURL
+}
+
+func (d *googleChatDestination) Send(build BuildEvent) error {
+	return d.sendToGoogleChat(d.convertToGoogleChatMessage(build))
+}
+
+// Google Chat webhook payload structures (cardsV2)
+type GoogleChatMessage struct {
+	Text    string               `json:"text,omitempty"`
+	CardsV2 []GoogleChatCardItem `json:"cardsV2,omitempty"`
+}
+
+type GoogleChatCardItem struct {
+	CardID string         `json:"cardId"`
+	Card   GoogleChatCard `json:"card"`
+}
+
+type GoogleChatCard struct {
+	Header   *GoogleChatCardHeader `json:"header,omitempty"`
+	Sections []GoogleChatSection   `json:"sections"`
+}
+
+type GoogleChatCardHeader struct {
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle,omitempty"`
+}
+
+type GoogleChatSection struct {
+	Header  string             `json:"header,omitempty"`
+	Widgets []GoogleChatWidget `json:"widgets"`
+}
+
+// GoogleChatWidget holds exactly one of the supported widget kinds
+type GoogleChatWidget struct {
+	DecoratedText *GoogleChatDecoratedText `json:"decoratedText,omitempty"`
+	ButtonList    *GoogleChatButtonList    `json:"buttonList,omitempty"`
+}
+
+type GoogleChatDecoratedText struct {
+	TopLabel string `json:"topLabel,omitempty"`
+	Text     string `json:"text"`
+}
+
+type GoogleChatButtonList struct {
+	Buttons []GoogleChatButton `json:"buttons"`
+}
+
+type GoogleChatButton struct {
+	Text    string            `json:"text"`
+	OnClick GoogleChatOnClick `json:"onClick"`
+}
+
+type GoogleChatOnClick struct {
+	OpenLink GoogleChatOpenLink `json:"openLink"`
+}
+
+type GoogleChatOpenLink struct {
+	URL string `json:"url"`
+}
+
+func (d *googleChatDestination) convertToGoogleChatMessage(build BuildEvent) GoogleChatMessage {
+	decorated := func(label, text string) GoogleChatWidget {
+		return GoogleChatWidget{DecoratedText: &GoogleChatDecoratedText{TopLabel: label, Text: text}}
+	}
+
+	widgets := []GoogleChatWidget{
+		decorated("Build", build.BuildName),
+		decorated("Status", build.StatusText()),
+	}
+	if build.Duration > 0 {
+		widgets = append(widgets, decorated("Duration", formatDuration(build.Duration)))
+	}
+
+	sections := []GoogleChatSection{{Widgets: widgets}}
+
+	// Add build variables if available
+	if vars := build.Vars; len(vars) > 0 {
+		var varWidgets []GoogleChatWidget
+		for _, v := range vars {
+			varWidgets = append(varWidgets, decorated(v.Key, v.Value))
+		}
+		sections = append(sections, GoogleChatSection{Header: "Build Variables", Widgets: varWidgets})
+	}
+
+	if build.BuildURL != "" {
+		sections = append(sections, GoogleChatSection{
+			Widgets: []GoogleChatWidget{
+				{
+					ButtonList: &GoogleChatButtonList{
+						Buttons: []GoogleChatButton{
+							{
+								Text:    "View Build",
+								OnClick: GoogleChatOnClick{OpenLink: GoogleChatOpenLink{URL: build.BuildURL}},
+							},
+						},
+					},
+				},
+			},
+		})
+	}
+
+	return GoogleChatMessage{
+		CardsV2: []GoogleChatCardItem{
+			{
+				CardID: "jenkins-build",
+				Card: GoogleChatCard{
+					Header: &GoogleChatCardHeader{
+						Title:    fmt.Sprintf("%s - %s", build.ProjectName, build.BuildName),
+						Subtitle: fmt.Sprintf("Build %s", build.Event),
+					},
+					Sections: sections,
+				},
+			},
+		},
+	}
+}
+
+func (d *googleChatDestination) sendToGoogleChat(message GoogleChatMessage) error {
+	if err := d.postJSON(d.cfg.WebhookURL, message, nil); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully sent webhook to Google Chat")
+	return nil
+}
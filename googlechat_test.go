@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGoogleChatSend(t *testing.T) {
+	tests := []struct {
+		name     string
+		buildURL string
+		sections int
+	}{
+		{"with a build link", "https://ci.example.com/job/app/1/", 3},
+		{"without a build link", "", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRecordingServer(t, http.StatusOK, "{}")
+			d := &googleChatDestination{httpSender: server.sender(), cfg: GoogleChatConfig{WebhookURL: "https://chat.googleapis.com/v1/spaces/AAA/messages?key=k&token=t"}}
+			build := testBuild("app", "success")
+			build.BuildURL = tt.buildURL
+
+			if err := d.Send(build); err != nil {
+				t.Fatal(err)
+			}
+			request := server.only(t)
+			if request.Query.Get("token") != "t" {
+				t.Errorf("query = %v, want the webhook's key and token kept", request.Query)
+			}
+			var message GoogleChatMessage
+			request.decode(t, &message)
+			if len(message.CardsV2) != 1 {
+				t.Fatalf("cards = %+v, want one", message.CardsV2)
+			}
+			card := message.CardsV2[0].Card
+			if card.Header.Title != "app - #0" || card.Header.Subtitle != "Build success" {
+				t.Errorf("header = %+v, want the build and event", card.Header)
+			}
+			if len(card.Sections) != tt.sections {
+				t.Fatalf("got %d sections, want %d", len(card.Sections), tt.sections)
+			}
+			if card.Sections[1].Header != "Build Variables" {
+				t.Errorf("second section = %+v, want the build variables", card.Sections[1])
+			}
+			if tt.buildURL != "" {
+				button := card.Sections[2].Widgets[0].ButtonList.Buttons[0]
+				if button.OnClick.OpenLink.URL != tt.buildURL {
+					t.Errorf("button opens %q, want %q", button.OnClick.OpenLink.URL, tt.buildURL)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// GotifyConfig configures the Gotify destination
+type GotifyConfig struct {
+	URL      string `yaml:"url"`
+	AppToken string `yaml:"app_token"`
+}
+
+type gotifyDestination struct {
+	destinationID
+	httpSender
+	cfg GotifyConfig
+}
+
+func (d *gotifyDestination) Name() string {
+	return "gotify"
+}
+
+func (d *gotifyDestination) pingAddress() string {
+	return d.cfg.URL
+}
+
+func (d *gotifyDestination) Send(build BuildEvent) error {
+	return d.sendToGotify(d.convertToGotifyMessage(build))
+}
+
+// Gotify message payload
+type GotifyMessage struct {
+	Title    string                 `json:"title"`
+	Message  string                 `json:"message"`
+	Priority int                    `json:"priority"`
+	Extras   map[string]interface{} `json:"extras,omitempty"`
+}
+
+// getGotifyPriority maps the event to a Gotify priority; clients treat 8+
+// as high priority and below 4 as silent
+func (d *gotifyDestination) getGotifyPriority(event string) int {
+	switch event {
+	case "failure", "failed":
+		return 8
+	case "unstable":
+		return 6
+	case "started":
+		return 2
+	default:
+		return 4
+	}
+}
+
+func (d *gotifyDestination) convertToGotifyMessage(build BuildEvent) GotifyMessage {
+	lines := []string{"**Status**: " + build.StatusText()}
+	if build.Duration > 0 {
+		lines = append(lines, "**Duration**: "+formatDuration(build.Duration))
+	}
+	// Gotify renders the same markdown as Discord
+	if buildVarsFormatted := formatBuildVars(build.Vars); buildVarsFormatted != "" {
+		lines = append(lines, buildVarsFormatted)
+	}
+
+	extras := map[string]interface{}{
+		"client::display": map[string]string{"contentType": "text/markdown"},
+	}
+	if build.BuildURL != "" {
+		extras["client::notification"] = map[string]interface{}{
+			"click": map[string]string{"url": build.BuildURL},
+		}
+	}
+
+	return GotifyMessage{
+		Title: fmt.Sprintf("%s - %s", build.ProjectName, build.BuildName),
+		// Trailing double spaces force markdown line breaks
+		Message:  strings.Join(lines, "  \n"),
+		Priority: d.getGotifyPriority(build.Event),
+		Extras:   extras,
+	}
+}
+
+func (d *gotifyDestination) sendToGotify(message GotifyMessage) error {
+	endpoint := strings.TrimRight(d.cfg.URL, "/") + "/message"
+	headers := map[string]string{"X-Gotify-Key": d.cfg.AppToken}
+	if err := d.postJSON(endpoint, message, headers); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully sent message to Gotify")
+	return nil
+}
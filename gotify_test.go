@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGotifySend(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    string
+		buildURL string
+		priority int
+	}{
+		{"failure with a link", "failure", "https://ci.example.com/job/app/1/", 8},
+		{"started", "started", "", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRecordingServer(t, http.StatusOK, `{"id":1}`)
+			d := &gotifyDestination{httpSender: server.sender(), cfg: GotifyConfig{URL: "https://gotify.example.com/", AppToken: "app-token"}}
+			build := testBuild("app", tt.event)
+			build.BuildURL = tt.buildURL
+
+			if err := d.Send(build); err != nil {
+				t.Fatal(err)
+			}
+			request := server.only(t)
+			if request.Path != "/message" || request.Header.Get("X-Gotify-Key") != "app-token" {
+				t.Errorf("request to %s with key %q, want the app's message to /message", request.Path, request.Header.Get("X-Gotify-Key"))
+			}
+			var message struct {
+				GotifyMessage
+				Extras map[string]map[string]interface{} `json:"extras"`
+			}
+			request.decode(t, &message)
+			if message.Title != "app - #0" || message.Priority != tt.priority {
+				t.Errorf("title %q with priority %d, want app - #0 with %d", message.Title, message.Priority, tt.priority)
+			}
+			if message.Extras["client::display"]["contentType"] != "text/markdown" {
+				t.Errorf("extras = %v, want the message shown as markdown", message.Extras)
+			}
+			if _, click := message.Extras["client::notification"]; click != (tt.buildURL != "") {
+				t.Errorf("extras = %v, want a click URL only for builds with a link", message.Extras)
+			}
+		})
+	}
+}
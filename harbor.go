@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HarborConfig configures the Harbor webhook source. AuthHeader, when set,
+// must match the Authorization header configured on the webhook policy.
+// Completed scans are reported when their severity reaches SeverityThreshold.
+type HarborConfig struct {
+	AuthHeader        string `yaml:"auth_header"`
+	SeverityThreshold string `yaml:"severity_threshold"`
+}
+
+// harborSeverities orders Harbor vulnerability severities from least severe
+var harborSeverities = []string{"None", "Unknown", "Negligible", "Low", "Medium", "High", "Critical"}
+
+// harborSeverityRank returns the position of the severity in harborSeverities,
+// or -1 when it is not recognised
+func harborSeverityRank(severity string) int {
+	for i, s := range harborSeverities {
+		if strings.EqualFold(s, severity) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Harbor webhook payload structures
+type HarborWebhook struct {
+	Type      string           `json:"type"`
+	OccurAt   int64            `json:"occur_at"`
+	Operator  string           `json:"operator"`
+	EventData *HarborEventData `json:"event_data,omitempty"`
+}
+
+type HarborEventData struct {
+	Resources  []HarborResource `json:"resources"`
+	Repository struct {
+		RepoFullName string `json:"repo_full_name"`
+	} `json:"repository"`
+}
+
+type HarborResource struct {
+	Digest       string                      `json:"digest"`
+	Tag          string                      `json:"tag"`
+	ResourceURL  string                      `json:"resource_url"`
+	ScanOverview map[string]HarborScanReport `json:"scan_overview,omitempty"`
+}
+
+type HarborScanReport struct {
+	ScanStatus string `json:"scan_status"`
+	Severity   string `json:"severity"`
+	Summary    *struct {
+		Total   int            `json:"total"`
+		Fixable int            `json:"fixable"`
+		Summary map[string]int `json:"summary"`
+	} `json:"summary,omitempty"`
+}
+
+type harborSource struct {
+	cfg HarborConfig
+}
+
+func (s harborSource) Name() string {
+	return "harbor"
+}
+
+func (s harborSource) Detect(header http.Header, body []byte) bool {
+	return jsonHasKeys(body, "type", "event_data")
+}
+
+func (s harborSource) Verify(req *http.Request, body []byte) error {
+	if !s.cfg.verifyAuth(req.Header.Get("Authorization")) {
+		return errors.New("invalid authorization")
+	}
+	return nil
+}
+
+// Parse ignores pulls, deletions, quota events and clean scans
+func (s harborSource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	var payload HarborWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return singleBuild(payload.toBuildEvent(s.cfg)), nil
+}
+
+// verifyAuth compares the Authorization header in constant time
+func (c HarborConfig) verifyAuth(header string) bool {
+	if c.AuthHeader == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(header), []byte(c.AuthHeader)) == 1
+}
+
+// toBuildEvent converts artifact pushes and failed or severe scans into a
+// BuildEvent, returning false for every other Harbor event
+func (p HarborWebhook) toBuildEvent(cfg HarborConfig) (BuildEvent, bool) {
+	if p.EventData == nil || len(p.EventData.Resources) == 0 {
+		return BuildEvent{}, false
+	}
+	resource := p.EventData.Resources[0]
+
+	build := BuildEvent{
+		Source:      "harbor",
+		ProjectName: p.EventData.Repository.RepoFullName,
+		BuildName:   resource.Tag,
+		Payload:     p,
+	}
+	if build.BuildName == "" && len(resource.Digest) > 19 {
+		// "sha256:" plus the first 12 hex digits, as Harbor shows it
+		build.BuildName = resource.Digest[:19]
+	}
+	if p.OccurAt > 0 {
+		build.RunID = resource.Digest + "@" + strconv.FormatInt(p.OccurAt, 10)
+	}
+	build.Vars = append(build.Vars, BuildVar{Key: "Image", Value: resource.ResourceURL})
+
+	switch p.Type {
+	case "PUSH_ARTIFACT":
+		build.Event = "success"
+		if p.Operator != "" {
+			build.Vars = append(build.Vars, BuildVar{Key: "Pushed by", Value: p.Operator})
+		}
+		return build, true
+	case "SCANNING_FAILED":
+		build.Event = "failure"
+		build.Vars = append(build.Vars, BuildVar{Key: "Scan", Value: "Scan could not be completed"})
+		return build, true
+	case "SCANNING_COMPLETED":
+		// Reported below when the findings reach the severity threshold
+	default:
+		return BuildEvent{}, false
+	}
+
+	threshold := harborSeverityRank(cfg.SeverityThreshold)
+	for _, report := range resource.ScanOverview {
+		if harborSeverityRank(report.Severity) < threshold {
+			continue
+		}
+
+		build.Event = "failure"
+		build.Vars = append(build.Vars, BuildVar{Key: "Severity", Value: report.Severity})
+		if s := report.Summary; s != nil {
+			build.Vars = append(build.Vars, BuildVar{
+				Key:   "Vulnerabilities",
+				Value: fmt.Sprintf("%d total, %d fixable", s.Total, s.Fixable),
+			})
+			for i := len(harborSeverities) - 1; i >= 0; i-- {
+				if count := s.Summary[harborSeverities[i]]; count > 0 {
+					build.Vars = append(build.Vars, BuildVar{Key: harborSeverities[i], Value: fmt.Sprint(count)})
+				}
+			}
+		}
+		return build, true
+	}
+
+	return BuildEvent{}, false
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func harborPayload(eventType, severity string) string {
+	scan := ""
+	if severity != "" {
+		scan = `, "scan_overview": {"application/vnd.security.vulnerability.report; version=1.1": {"scan_status": "Success", "severity": "` + severity + `",
+		  "summary": {"total": 5, "fixable": 3, "summary": {"Critical": 1, "High": 2, "Low": 2}}}}`
+	}
+	return `{"type": "` + eventType + `", "occur_at": 1700000000, "operator": "robot", "event_data": {
+	  "resources": [{"digest": "sha256:0123456789abcdef0123", "tag": "1.2.0", "resource_url": "harbor.example.com/team/app:1.2.0"` + scan + `}],
+	  "repository": {"repo_full_name": "team/app"}}}`
+}
+
+func TestHarborParse(t *testing.T) {
+	src := harborSource{cfg: HarborConfig{SeverityThreshold: "High"}}
+	tests := []struct {
+		name      string
+		body      string
+		wantEvent string
+		wantVars  []BuildVar
+	}{
+		{
+			"push", harborPayload("PUSH_ARTIFACT", ""), "success",
+			[]BuildVar{{Key: "Image", Value: "harbor.example.com/team/app:1.2.0"}, {Key: "Pushed by", Value: "robot"}},
+		},
+		{
+			"scan failed", harborPayload("SCANNING_FAILED", ""), "failure",
+			[]BuildVar{{Key: "Image", Value: "harbor.example.com/team/app:1.2.0"}, {Key: "Scan", Value: "Scan could not be completed"}},
+		},
+		{
+			"critical scan", harborPayload("SCANNING_COMPLETED", "Critical"), "failure",
+			[]BuildVar{
+				{Key: "Image", Value: "harbor.example.com/team/app:1.2.0"},
+				{Key: "Severity", Value: "Critical"},
+				{Key: "Vulnerabilities", Value: "5 total, 3 fixable"},
+				{Key: "Critical", Value: "1"},
+				{Key: "High", Value: "2"},
+				{Key: "Low", Value: "2"},
+			},
+		},
+		{"scan under the threshold", harborPayload("SCANNING_COMPLETED", "Medium"), "", nil},
+		{"pull", harborPayload("PULL_ARTIFACT", ""), "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name := detectSource(t, http.Header{}, tt.body); name != "harbor" {
+				t.Errorf("detected as %q, want harbor", name)
+			}
+			builds := parseBuilds(t, src, http.Header{}, tt.body)
+			if tt.wantEvent == "" {
+				if len(builds) != 0 {
+					t.Errorf("builds = %+v, want none", summarize(builds))
+				}
+				return
+			}
+			want := []buildSummary{{"team/app", "1.2.0", "", tt.wantEvent}}
+			if got := summarize(builds); !reflect.DeepEqual(got, want) {
+				t.Fatalf("builds = %+v, want %+v", got, want)
+			}
+			if !reflect.DeepEqual(builds[0].Vars, tt.wantVars) {
+				t.Errorf("vars = %+v, want %+v", builds[0].Vars, tt.wantVars)
+			}
+			if builds[0].RunID != "sha256:0123456789abcdef0123@1700000000" {
+				t.Errorf("RunID = %q", builds[0].RunID)
+			}
+		})
+	}
+}
+
+func TestHarborUntaggedArtifact(t *testing.T) {
+	body := `{"type": "PUSH_ARTIFACT", "event_data": {"resources": [{"digest": "sha256:0123456789abcdef0123"}], "repository": {"repo_full_name": "team/app"}}}`
+	builds := parseBuilds(t, harborSource{}, http.Header{}, body)
+	if len(builds) != 1 || builds[0].BuildName != "sha256:0123456789ab" {
+		t.Errorf("builds = %+v, want one named after the short digest", summarize(builds))
+	}
+}
+
+func TestHarborVerify(t *testing.T) {
+	src := harborSource{cfg: HarborConfig{AuthHeader: "Bearer token"}}
+	for auth, ok := range map[string]bool{"Bearer token": true, "Bearer other": false, "": false} {
+		req, _ := http.NewRequest(http.MethodPost, "/webhook/harbor", nil)
+		req.Header.Set("Authorization", auth)
+		if err := src.Verify(req, nil); (err == nil) != ok {
+			t.Errorf("Verify() with %q = %v, want ok %v", auth, err, ok)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// historySize is how many delivered events are kept for replay
+const historySize = 100
+
+// deliveredEvent is an event as it was delivered, kept so it can be
+// replayed through the admin API
+type deliveredEvent struct {
+	ID           int              `json:"id"`
+	Time         time.Time        `json:"time"`
+	Source       string           `json:"source"`
+	Project      string           `json:"project"`
+	Build        string           `json:"build"`
+	Event        string           `json:"event"`
+	Tags         []string         `json:"tags,omitempty"`
+	Destinations []deliveryResult `json:"destinations"`
+
+	build BuildEvent
+}
+
+// eventHistory keeps the most recently delivered events
+type eventHistory struct {
+	mu     sync.Mutex
+	events []deliveredEvent
+	nextID int
+}
+
+func newEventHistory() *eventHistory {
+	return &eventHistory{nextID: 1}
+}
+
+// add records an event with the results of delivering it, dropping the
+// oldest event when the history is full
+func (h *eventHistory) add(build BuildEvent, results []deliveryResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.events = append(h.events, deliveredEvent{
+		ID:           h.nextID,
+		Time:         build.Time,
+		Source:       build.Source,
+		Project:      build.ProjectName,
+		Build:        build.BuildName,
+		Event:        build.Event,
+		Tags:         build.Tags,
+		Destinations: results,
+		build:        build,
+	})
+	h.nextID++
+	if len(h.events) > historySize {
+		h.events = h.events[len(h.events)-historySize:]
+	}
+}
+
+// list returns the recorded events, newest first
+func (h *eventHistory) list() []deliveredEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	events := make([]deliveredEvent, len(h.events))
+	for i, event := range h.events {
+		events[len(events)-1-i] = event
+	}
+	return events
+}
+
+// get returns the event with the given ID, if it is still recorded
+func (h *eventHistory) get(id int) (deliveredEvent, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, event := range h.events {
+		if event.ID == id {
+			return event, true
+		}
+	}
+	return deliveredEvent{}, false
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// IRCConfig configures the IRC destination
+type IRCConfig struct {
+	Server       string `yaml:"server"` // host:port
+	TLS          bool   `yaml:"tls"`
+	Channel      string `yaml:"channel"`
+	Nick         string `yaml:"nick"`
+	SASLUsername string `yaml:"sasl_username"`
+	SASLPassword string `yaml:"sasl_password"`
+}
+
+type ircDestination struct {
+	destinationID
+	cfg IRCConfig
+}
+
+func (d *ircDestination) Name() string {
+	return "irc"
+}
+
+func (d *ircDestination) pingAddress() string {
+	scheme := "tcp"
+	if d.cfg.TLS {
+		scheme = "tls"
+	}
+	return scheme + "://" + d.cfg.Server
+}
+
+func (d *ircDestination) Send(build BuildEvent) error {
+	return d.sendToIRC(d.convertToIRCLine(build))
+}
+
+// mIRC color codes
+const (
+	ircBold  = "\x02"
+	ircColor = "\x03"
+	ircReset = "\x0f"
+)
+
+// getIRCColor maps the event to an mIRC color number
+func (d *ircDestination) getIRCColor(event string) string {
+	switch event {
+	case "success":
+		return "03" // Green
+	case "failure", "failed":
+		return "04" // Red
+	case "unstable":
+		return "07" // Orange
+	case "started":
+		return "12" // Blue
+	default:
+		return "14" // Gray
+	}
+}
+
+func (d *ircDestination) convertToIRCLine(build BuildEvent) string {
+	line := fmt.Sprintf("%s%s%s %s %s%s%s%s",
+		ircBold, build.ProjectName, ircReset,
+		build.BuildName,
+		ircColor, d.getIRCColor(build.Event), strings.ToUpper(build.Event), ircReset)
+
+	if build.Duration > 0 {
+		line += " in " + formatDuration(build.Duration)
+	}
+	if build.BuildURL != "" {
+		line += " " + build.BuildURL
+	}
+
+	// IRC messages end at the first line break
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(line)
+}
+
+// ircConn is a short-lived client connection used to deliver one message
+type ircConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (c *ircConn) send(format string, args ...interface{}) error {
+	_, err := fmt.Fprintf(c.conn, format+"\r\n", args...)
+	return err
+}
+
+// readMessage returns the command and parameters of the next message,
+// answering server PINGs along the way
+func (c *ircConn) readMessage() (string, []string, error) {
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return "", nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		// Drop the optional source prefix
+		if strings.HasPrefix(line, ":") {
+			if i := strings.IndexByte(line, ' '); i >= 0 {
+				line = line[i+1:]
+			}
+		}
+
+		// Split middle parameters from the trailing one
+		var params []string
+		trailing := ""
+		if i := strings.Index(line, " :"); i >= 0 {
+			trailing = line[i+2:]
+			line = line[:i]
+			params = append(strings.Fields(line), trailing)
+		} else {
+			params = strings.Fields(line)
+		}
+		if len(params) == 0 {
+			continue
+		}
+
+		command, params := params[0], params[1:]
+		if command == "PING" {
+			if err := c.send("PONG :%s", strings.Join(params, " ")); err != nil {
+				return "", nil, err
+			}
+			continue
+		}
+		return command, params, nil
+	}
+}
+
+// waitFor reads messages until one of the given commands arrives, failing
+// on ERROR or any of the fatal numerics
+func (c *ircConn) waitFor(commands []string, fatal []string) (string, []string, error) {
+	for {
+		command, params, err := c.readMessage()
+		if err != nil {
+			return "", nil, err
+		}
+		for _, want := range commands {
+			if command == want {
+				return command, params, nil
+			}
+		}
+		for _, bad := range fatal {
+			if command == bad {
+				return "", nil, fmt.Errorf("server replied %s %s", command, strings.Join(params, " "))
+			}
+		}
+		if command == "ERROR" {
+			return "", nil, fmt.Errorf("server error: %s", strings.Join(params, " "))
+		}
+	}
+}
+
+func (d *ircDestination) sendToIRC(line string) error {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if d.cfg.TLS {
+		host, _, _ := net.SplitHostPort(d.cfg.Server)
+		conn, err = tls.DialWithDialer(dialer, "tcp", d.cfg.Server, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", d.cfg.Server)
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %w", d.cfg.Server, err)
+	}
+	defer conn.Close()
+
+	// Bound the whole exchange so a silent server cannot hang the request
+	conn.SetDeadline(time.Now().Add(60 * time.Second))
+	c := &ircConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	if err := d.registerIRC(c); err != nil {
+		return err
+	}
+
+	channel := d.cfg.Channel
+	if err := c.send("JOIN %s", channel); err != nil {
+		return err
+	}
+	// 366 is the end of the NAMES list sent after a successful join
+	if _, _, err := c.waitFor([]string{"366"}, []string{"403", "405", "471", "473", "474", "475"}); err != nil {
+		return fmt.Errorf("error joining %s: %w", channel, err)
+	}
+
+	if err := c.send("PRIVMSG %s :%s", channel, line); err != nil {
+		return fmt.Errorf("error sending message: %w", err)
+	}
+	if err := c.send("QUIT :done"); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully sent message to IRC channel %s", channel)
+	return nil
+}
+
+// registerIRC performs the connection registration, with SASL PLAIN when
+// credentials are configured
+func (d *ircDestination) registerIRC(c *ircConn) error {
+	useSASL := d.cfg.SASLUsername != ""
+	if useSASL {
+		if err := c.send("CAP REQ :sasl"); err != nil {
+			return err
+		}
+	}
+
+	nick := d.cfg.Nick
+	if err := c.send("NICK %s", nick); err != nil {
+		return err
+	}
+	if err := c.send("USER %s 0 * :Jenkins CI/CD", nick); err != nil {
+		return err
+	}
+
+	if useSASL {
+		command, params, err := c.waitFor([]string{"CAP"}, nil)
+		if err != nil {
+			return fmt.Errorf("error negotiating SASL: %w", err)
+		}
+		if len(params) < 2 || params[1] != "ACK" {
+			return fmt.Errorf("server refused SASL capability: %s %s", command, strings.Join(params, " "))
+		}
+
+		if err := c.send("AUTHENTICATE PLAIN"); err != nil {
+			return err
+		}
+		if _, _, err := c.waitFor([]string{"AUTHENTICATE"}, nil); err != nil {
+			return fmt.Errorf("error negotiating SASL: %w", err)
+		}
+
+		user := d.cfg.SASLUsername
+		token := base64.StdEncoding.EncodeToString([]byte(user + "\x00" + user + "\x00" + d.cfg.SASLPassword))
+		if err := c.send("AUTHENTICATE %s", token); err != nil {
+			return err
+		}
+		// 903 is RPL_SASLSUCCESS, 902/904/905 are failures
+		if _, _, err := c.waitFor([]string{"903"}, []string{"902", "904", "905"}); err != nil {
+			return fmt.Errorf("SASL authentication failed: %w", err)
+		}
+		if err := c.send("CAP END"); err != nil {
+			return err
+		}
+	}
+
+	for {
+		// 001 is RPL_WELCOME, 433 means the nickname is taken
+		command, _, err := c.waitFor([]string{"001", "433"}, []string{"432", "465"})
+		if err != nil {
+			return fmt.Errorf("error registering with server: %w", err)
+		}
+		if command == "001" {
+			return nil
+		}
+
+		nick += "_"
+		if err := c.send("NICK %s", nick); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// ircServer is a minimal IRC server that pings the client, refuses the nick
+// taken, and records the lines the client sends
+type ircServer struct {
+	listener net.Listener
+	taken    string
+	mu       sync.Mutex
+	lines    []string
+	done     chan struct{}
+}
+
+func newIRCServer(t *testing.T, taken string) *ircServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &ircServer{listener: listener, taken: taken, done: make(chan struct{})}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *ircServer) serve() {
+	defer close(s.done)
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	reply := func(format string, args ...interface{}) { fmt.Fprintf(conn, format+"\r\n", args...) }
+
+	reply(":irc.example.com PING :token")
+	nick, registered := "", false
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		s.mu.Lock()
+		s.lines = append(s.lines, line)
+		s.mu.Unlock()
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "NICK":
+			if fields[1] == s.taken {
+				reply(":irc.example.com 433 * %s :Nickname is already in use", fields[1])
+				continue
+			}
+			nick = fields[1]
+		case "USER":
+			registered = true
+		case "JOIN":
+			reply(":irc.example.com 366 %s %s :End of /NAMES list.", nick, fields[1])
+		case "QUIT":
+			return
+		}
+		if nick != "" && registered && (fields[0] == "NICK" || fields[0] == "USER") {
+			reply(":irc.example.com 001 %s :Welcome", nick)
+		}
+	}
+}
+
+func TestIRCSend(t *testing.T) {
+	server := newIRCServer(t, "jenkins")
+	d := &ircDestination{cfg: IRCConfig{Server: server.listener.Addr().String(), Channel: "#ci", Nick: "jenkins"}}
+	build := testBuild("app", "failure")
+	build.BuildURL = "https://ci.example.com/job/app/1/"
+
+	if err := d.Send(build); err != nil {
+		t.Fatal(err)
+	}
+	<-server.done
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	want := []string{
+		"NICK jenkins",
+		"USER jenkins 0 * :Jenkins CI/CD",
+		"PONG :token",
+		"NICK jenkins_",
+		"JOIN #ci",
+		"PRIVMSG #ci :\x02app\x0f #0 \x0304FAILURE\x0f in 1m 30s https://ci.example.com/job/app/1/",
+		"QUIT :done",
+	}
+	if strings.Join(server.lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("client sent\n%q\nwant\n%q", server.lines, want)
+	}
+}
+
+func TestIRCLineHasNoBreaks(t *testing.T) {
+	d := &ircDestination{}
+	build := testBuild("app\r\nQUIT", "success")
+	if line := d.convertToIRCLine(build); strings.ContainsAny(line, "\r\n") {
+		t.Errorf("line %q has a line break", line)
+	}
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Jenkins webhook payload structures
+type JenkinsWebhook struct {
+	BuildName   string `json:"buildName"`
+	BuildUrl    string `json:"buildUrl"`
+	BuildVars   string `json:"buildVars"`
+	Event       string `json:"event"`
+	ProjectName string `json:"projectName"`
+}
+
+// JenkinsNotification is the payload sent by the Jenkins Notification Plugin.
+// It is told apart from JenkinsWebhook by its nested build object.
+type JenkinsNotification struct {
+	Name        string                    `json:"name"`
+	DisplayName string                    `json:"display_name"`
+	URL         string                    `json:"url"`
+	Build       *JenkinsNotificationBuild `json:"build"`
+}
+
+type JenkinsNotificationBuild struct {
+	FullURL    string             `json:"full_url"`
+	Number     int64              `json:"number"`
+	Phase      string             `json:"phase"`
+	Status     string             `json:"status"`
+	Result     string             `json:"result"`
+	URL        string             `json:"url"`
+	Duration   int64              `json:"duration"`
+	SCM        *JenkinsSCM        `json:"scm,omitempty"`
+	Parameters map[string]string  `json:"parameters,omitempty"`
+	ChangeSets []JenkinsChangeSet `json:"changeSets,omitempty"`
+}
+
+// JenkinsChangeSet holds the commits built from one repository, as the
+// Jenkins API describes them
+type JenkinsChangeSet struct {
+	Kind  string              `json:"kind"`
+	Items []JenkinsChangeItem `json:"items"`
+}
+
+type JenkinsChangeItem struct {
+	CommitID string `json:"commitId"`
+	Message  string `json:"msg"`
+	Author   struct {
+		FullName string `json:"fullName"`
+	} `json:"author"`
+	AuthorEmail string `json:"authorEmail"`
+}
+
+// JenkinsCloudEventData is the data of a CloudEvent sent by the Jenkins
+// CloudEvents plugin; job events describe the build like the Notification
+// Plugin does, with the phase carried in the event type
+type JenkinsCloudEventData struct {
+	JenkinsNotification
+	JobName string `json:"jobName"`
+}
+
+// jenkinsCloudEventPhases maps CloudEvents plugin event types to build phases
+var jenkinsCloudEventPhases = map[string]string{
+	"org.jenkinsci.job.started":   "STARTED",
+	"org.jenkinsci.job.completed": "COMPLETED",
+}
+
+type JenkinsSCM struct {
+	URL      string   `json:"url"`
+	Branch   string   `json:"branch"`
+	Commit   string   `json:"commit"`
+	Culprits []string `json:"culprits,omitempty"`
+}
+
+// jenkinsSource parses Jenkins webhooks. With user and apiToken set, the
+// test results of completed builds, the console log tail of failed ones
+// when consoleLines is set and up to artifacts of their artifacts are read
+// from the Jenkins API.
+type jenkinsSource struct {
+	jenkinsURL     string
+	user, apiToken string
+	consoleLines   int
+	artifacts      int
+	client         *http.Client
+}
+
+func newJenkinsSource(config *Config, client *http.Client) jenkinsSource {
+	return jenkinsSource{
+		jenkinsURL:   config.JenkinsURL,
+		user:         config.JenkinsUser,
+		apiToken:     config.JenkinsAPIToken,
+		consoleLines: config.JenkinsConsoleLines,
+		artifacts:    config.JenkinsArtifacts,
+		client:       client,
+	}
+}
+
+// apiEnabled reports whether Jenkins credentials are configured
+func (s jenkinsSource) apiEnabled() bool {
+	return s.user != ""
+}
+
+func (s jenkinsSource) Name() string {
+	return "jenkins"
+}
+
+// Detect recognises CloudEvents plugin events and the fields the generic
+// and Notification Plugin payloads always send
+func (s jenkinsSource) Detect(header http.Header, body []byte) bool {
+	if isCloudEvent(header) {
+		event, err := parseCloudEvent(header, body)
+		return err == nil && strings.HasPrefix(event.Type, "org.jenkinsci.")
+	}
+	return jsonHasKeys(body, "projectName", "event") || jsonHasKeys(body, "name", "build")
+}
+
+// Verify accepts every request; Jenkins has no webhook secret
+func (s jenkinsSource) Verify(req *http.Request, body []byte) error {
+	return nil
+}
+
+// Parse ignores queued and finalized phases, and queue or node CloudEvents
+func (s jenkinsSource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	build, ok, err := s.parsePayload(header, body)
+	if err != nil {
+		return nil, err
+	}
+	return singleBuild(build, ok), nil
+}
+
+// parsePayload detects which Jenkins payload variant arrived and converts it
+// into a BuildEvent
+func (s jenkinsSource) parsePayload(header http.Header, body []byte) (BuildEvent, bool, error) {
+	if isCloudEvent(header) {
+		event, err := parseCloudEvent(header, body)
+		if err != nil {
+			return BuildEvent{}, false, err
+		}
+		return s.parseCloudEvent(event)
+	}
+
+	var probe struct {
+		Build json.RawMessage `json:"build"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return BuildEvent{}, false, err
+	}
+
+	if len(probe.Build) > 0 && probe.Build[0] == '{' {
+		var payload JenkinsNotification
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return BuildEvent{}, false, err
+		}
+		build, ok := payload.toBuildEvent(s.jenkinsURL)
+		if ok {
+			build.details = s.buildDetails(payload)
+		}
+		return build, ok, nil
+	}
+
+	var payload JenkinsWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return BuildEvent{}, false, err
+	}
+	return payload.toBuildEvent(), true, nil
+}
+
+// parseCloudEvent converts a job started or completed CloudEvent into a
+// BuildEvent, returning false for every other event type
+func (s jenkinsSource) parseCloudEvent(event CloudEvent) (BuildEvent, bool, error) {
+	phase, ok := jenkinsCloudEventPhases[event.Type]
+	if !ok {
+		return BuildEvent{}, false, nil
+	}
+
+	var data JenkinsCloudEventData
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		return BuildEvent{}, false, err
+	}
+	if data.Name == "" {
+		data.Name = data.JobName
+	}
+	if data.Build == nil {
+		data.Build = &JenkinsNotificationBuild{}
+	}
+	data.Build.Phase = phase
+
+	build, ok := data.JenkinsNotification.toBuildEvent(s.jenkinsURL)
+	if ok {
+		build.details = s.buildDetails(data.JenkinsNotification)
+	}
+	return build, ok, nil
+}
+
+// buildDetails returns the fetch of what the Jenkins API knows about the
+// build beyond the payload, or nil when Jenkins credentials aren't configured
+func (s jenkinsSource) buildDetails(n JenkinsNotification) func(*BuildEvent, bool) {
+	if !s.apiEnabled() {
+		return nil
+	}
+	buildURL := s.apiBuildURL(n)
+	if buildURL == "" {
+		return nil
+	}
+	return func(build *BuildEvent, describe bool) {
+		s.addEstimate(build, buildURL)
+		s.addTestReport(build, buildURL)
+		s.addStages(build, buildURL)
+		s.addConsoleLog(build, buildURL)
+		if describe {
+			s.addDescription(build, buildURL)
+		}
+		s.addArtifacts(build, buildURL)
+	}
+}
+
+// addEstimate adds Jenkins' estimate of how long a started build takes, the
+// average of the job's recent successful builds. Errors are logged, as the
+// build is notified either way.
+func (s jenkinsSource) addEstimate(build *BuildEvent, buildURL string) {
+	if build.Event != "started" {
+		return
+	}
+	resp, err := s.apiGet(buildURL, "api/json?tree=estimatedDuration")
+	if err != nil || resp == nil {
+		if err != nil {
+			log.Printf("Error fetching estimated duration for %s %s: %v", build.ProjectName, build.BuildName, err)
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	var details struct {
+		EstimatedDuration int64 `json:"estimatedDuration"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
+		log.Printf("Error decoding estimated duration for %s %s: %v", build.ProjectName, build.BuildName, err)
+		return
+	}
+	// Jenkins sends -1 for jobs without a successful build
+	if details.EstimatedDuration > 0 {
+		build.EstimatedDuration = time.Duration(details.EstimatedDuration) * time.Millisecond
+	}
+}
+
+// apiBuildURL returns the URL of the build under JENKINS_URL, or "" when
+// the payload points elsewhere. The credentials are only ever sent to
+// JENKINS_URL, as anyone can send a payload with any URL.
+func (s jenkinsSource) apiBuildURL(n JenkinsNotification) string {
+	base := strings.TrimSuffix(s.jenkinsURL, "/") + "/"
+	if n.Build.URL != "" && !strings.Contains(n.Build.URL, "://") {
+		return base + strings.TrimPrefix(n.Build.URL, "/")
+	}
+	if strings.HasPrefix(n.Build.FullURL, base) {
+		return n.Build.FullURL
+	}
+	return ""
+}
+
+// apiGet requests path below the build. The response is nil when Jenkins
+// has no such page for the build.
+func (s jenkinsSource) apiGet(buildURL, path string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(buildURL, "/")+"/"+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.SetBasicAuth(s.user, s.apiToken)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Jenkins returned status: %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// apiPost posts form to path below jobURL
+func (s jenkinsSource) apiPost(jobURL, path string, form url.Values) error {
+	req, err := http.NewRequest("POST", strings.TrimSuffix(jobURL, "/")+"/"+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(s.user, s.apiToken)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Jenkins returned status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// rebuild starts the job of the build at the relative path again, with the
+// parameters the build had
+func (s jenkinsSource) rebuild(buildPath string) error {
+	base := strings.TrimSuffix(s.jenkinsURL, "/") + "/"
+	buildURL := base + strings.TrimPrefix(buildPath, "/")
+	resp, err := s.apiGet(buildURL, "api/json?tree=actions[parameters[name,value]]")
+	if err != nil {
+		return err
+	}
+	if resp == nil {
+		return fmt.Errorf("build not found")
+	}
+	defer resp.Body.Close()
+
+	var details struct {
+		Actions []struct {
+			Parameters []struct {
+				Name  string      `json:"name"`
+				Value interface{} `json:"value"`
+			} `json:"parameters"`
+		} `json:"actions"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
+		return fmt.Errorf("error decoding build: %w", err)
+	}
+
+	// The job is the build's URL without its number
+	jobURL := buildURL[:strings.LastIndex(strings.TrimSuffix(buildURL, "/"), "/")+1]
+	form := url.Values{}
+	for _, action := range details.Actions {
+		for _, parameter := range action.Parameters {
+			if parameter.Value != nil {
+				form.Set(parameter.Name, fmt.Sprint(parameter.Value))
+			}
+		}
+	}
+	if len(form) == 0 {
+		return s.apiPost(jobURL, "build", nil)
+	}
+	return s.apiPost(jobURL, "buildWithParameters", form)
+}
+
+// relativeBuildPath returns the path of the build below JENKINS_URL, or ""
+// when it isn't a Jenkins build there
+func (s jenkinsSource) relativeBuildPath(build BuildEvent) string {
+	base := strings.TrimSuffix(s.jenkinsURL, "/") + "/"
+	if build.Source != "jenkins" || s.jenkinsURL == "" || !strings.HasPrefix(build.BuildURL, base) {
+		return ""
+	}
+	return strings.TrimPrefix(build.BuildURL, base)
+}
+
+// toBuildEvent converts the Jenkins payload into a BuildEvent
+func (j JenkinsWebhook) toBuildEvent() BuildEvent {
+	return BuildEvent{
+		Source:      "jenkins",
+		ProjectName: j.ProjectName,
+		BuildName:   j.BuildName,
+		BuildURL:    j.BuildUrl,
+		Event:       j.Event,
+		Vars:        parseBuildVars(j.BuildVars),
+		Payload:     j,
+	}
+}
+
+// toBuildEvent converts a Notification Plugin payload into a BuildEvent,
+// returning false for the queued and finalized phases. Relative build URLs
+// are resolved against jenkinsURL.
+func (n JenkinsNotification) toBuildEvent(jenkinsURL string) (BuildEvent, bool) {
+	b := n.Build
+	build := BuildEvent{
+		Source:      "jenkins",
+		ProjectName: n.Name,
+		BuildName:   "#" + strconv.FormatInt(b.Number, 10),
+		BuildURL:    b.FullURL,
+		Payload:     n,
+	}
+	if build.BuildURL == "" && jenkinsURL != "" && b.URL != "" {
+		build.BuildURL = strings.TrimSuffix(jenkinsURL, "/") + "/" + strings.TrimPrefix(b.URL, "/")
+	}
+	if b.Duration > 0 {
+		build.Duration = time.Duration(b.Duration) * time.Millisecond
+	}
+
+	switch b.Phase {
+	case "STARTED":
+		build.Event = "started"
+	case "COMPLETED":
+		status := b.Status
+		if status == "" {
+			status = b.Result
+		}
+		build.Result = status
+		switch status {
+		case "SUCCESS":
+			build.Event = "success"
+		case "UNSTABLE":
+			build.Event = "unstable"
+		case "ABORTED", "NOT_BUILT":
+			build.Event = "aborted"
+		default:
+			build.Event = "failure"
+		}
+	default:
+		return BuildEvent{}, false
+	}
+
+	if scm := b.SCM; scm != nil {
+		if scm.Branch != "" {
+			build.Vars = append(build.Vars, BuildVar{Key: "Branch", Value: scm.Branch})
+		}
+		if len(scm.Commit) >= 8 {
+			build.Vars = append(build.Vars, BuildVar{Key: "Commit", Value: scm.Commit[:8]})
+		}
+		if len(scm.Culprits) > 0 {
+			build.Culprits = scm.Culprits
+			build.Vars = append(build.Vars, BuildVar{Key: "Culprits", Value: strings.Join(scm.Culprits, ", ")})
+		}
+	}
+
+	build.SCM = n.scmContext()
+
+	for _, changeSet := range b.ChangeSets {
+		for _, item := range changeSet.Items {
+			author := item.Author.FullName
+			if author == "" {
+				author = item.AuthorEmail
+			}
+			build.Commits = append(build.Commits, Commit{ID: item.CommitID, Message: item.Message, Author: author})
+		}
+	}
+
+	// Parameters are sorted so repeated notifications render the same
+	keys := make([]string, 0, len(b.Parameters))
+	for key := range b.Parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		build.Vars = append(build.Vars, BuildVar{Key: key, Value: b.Parameters[key]})
+	}
+
+	return build, true
+}
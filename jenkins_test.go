@@ -0,0 +1,128 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJenkinsNotificationParse(t *testing.T) {
+	notification := func(phase, status string) string {
+		return `{"name": "app", "url": "job/app/", "build": {"number": 42, "phase": "` + phase + `", "status": "` + status + `",
+		  "url": "job/app/42/", "duration": 90000, "scm": {"branch": "main", "commit": "0123456789abcdef", "culprits": ["ana"]},
+		  "parameters": {"TARGET": "prod", "DRY_RUN": "false"}}}`
+	}
+	buildURL := "https://ci.example.com/job/app/42/"
+	tests := []struct {
+		name string
+		body string
+		want []buildSummary
+	}{
+		{"started", notification("STARTED", ""), []buildSummary{{"app", "#42", buildURL, "started"}}},
+		{"succeeded", notification("COMPLETED", "SUCCESS"), []buildSummary{{"app", "#42", buildURL, "success"}}},
+		{"unstable", notification("COMPLETED", "UNSTABLE"), []buildSummary{{"app", "#42", buildURL, "unstable"}}},
+		{"aborted", notification("COMPLETED", "ABORTED"), []buildSummary{{"app", "#42", buildURL, "aborted"}}},
+		{"failed", notification("COMPLETED", "FAILURE"), []buildSummary{{"app", "#42", buildURL, "failure"}}},
+		{"queued", notification("QUEUED", ""), nil},
+		{"finalized", notification("FINALIZED", "SUCCESS"), nil},
+	}
+	src := jenkinsSource{jenkinsURL: "https://ci.example.com/"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name := detectSource(t, http.Header{}, tt.body); name != "jenkins" {
+				t.Errorf("detected as %q, want jenkins", name)
+			}
+			builds := parseBuilds(t, src, http.Header{}, tt.body)
+			if got := summarize(builds); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("builds = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJenkinsNotificationDetails(t *testing.T) {
+	body := `{"name": "app", "build": {"full_url": "https://ci.example.com/job/app/7/", "number": 7, "phase": "COMPLETED", "result": "FAILURE",
+	  "duration": 90000, "scm": {"branch": "main", "commit": "0123456789abcdef", "culprits": ["ana", "bo"]},
+	  "parameters": {"TARGET": "prod", "DRY_RUN": "false"},
+	  "changeSets": [{"kind": "git", "items": [{"commitId": "0123456789abcdef", "msg": "Fix the login", "author": {"fullName": "Ana"}},
+	    {"commitId": "fedcba9876543210", "msg": "Bump deps", "authorEmail": "bo@example.com"}]}]}}`
+	build := parseBuilds(t, jenkinsSource{}, http.Header{}, body)[0]
+
+	if build.Result != "FAILURE" || build.Duration != 90*time.Second {
+		t.Errorf("result %q and duration %v, want FAILURE and 1m30s", build.Result, build.Duration)
+	}
+	wantVars := []BuildVar{
+		{Key: "Branch", Value: "main"},
+		{Key: "Commit", Value: "01234567"},
+		{Key: "Culprits", Value: "ana, bo"},
+		{Key: "DRY_RUN", Value: "false"},
+		{Key: "TARGET", Value: "prod"},
+	}
+	if !reflect.DeepEqual(build.Vars, wantVars) {
+		t.Errorf("vars = %+v, want %+v", build.Vars, wantVars)
+	}
+	wantCommits := []Commit{
+		{ID: "0123456789abcdef", Message: "Fix the login", Author: "Ana"},
+		{ID: "fedcba9876543210", Message: "Bump deps", Author: "bo@example.com"},
+	}
+	if !reflect.DeepEqual(build.Commits, wantCommits) {
+		t.Errorf("commits = %+v, want %+v", build.Commits, wantCommits)
+	}
+}
+
+func TestJenkinsGenericWebhook(t *testing.T) {
+	body := `{"projectName": "app", "buildName": "#3", "buildUrl": "https://ci.example.com/job/app/3/", "event": "failure"}`
+	if name := detectSource(t, http.Header{}, body); name != "jenkins" {
+		t.Errorf("detected as %q, want jenkins", name)
+	}
+	want := []buildSummary{{"app", "#3", "https://ci.example.com/job/app/3/", "failure"}}
+	if got := summarize(parseBuilds(t, jenkinsSource{}, http.Header{}, body)); !reflect.DeepEqual(got, want) {
+		t.Errorf("builds = %+v, want %+v", got, want)
+	}
+}
+
+func TestJenkinsCloudEventParse(t *testing.T) {
+	data := `{"jobName": "app", "build": {"number": 9, "full_url": "https://ci.example.com/job/app/9/", "status": "SUCCESS"}}`
+	tests := []struct {
+		name   string
+		header http.Header
+		body   string
+		want   []buildSummary
+	}{
+		{
+			"binary job started",
+			http.Header{"Ce-Type": {"org.jenkinsci.job.started"}},
+			data,
+			[]buildSummary{{"app", "#9", "https://ci.example.com/job/app/9/", "started"}},
+		},
+		{
+			"structured job completed",
+			http.Header{"Content-Type": {"application/cloudevents+json"}},
+			`{"specversion": "1.0", "type": "org.jenkinsci.job.completed", "data": ` + data + `}`,
+			[]buildSummary{{"app", "#9", "https://ci.example.com/job/app/9/", "success"}},
+		},
+		{
+			"queue event",
+			http.Header{"Ce-Type": {"org.jenkinsci.queue.entered_waiting"}},
+			`{"displayName": "app"}`,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name := detectSource(t, tt.header, tt.body); name != "jenkins" {
+				t.Errorf("detected as %q, want jenkins", name)
+			}
+			builds := parseBuilds(t, jenkinsSource{}, tt.header, tt.body)
+			if got := summarize(builds); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("builds = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	other := http.Header{"Ce-Type": {"dev.tekton.event.pipelinerun.started.v1"}}
+	if (jenkinsSource{}).Detect(other, []byte(`{}`)) {
+		t.Error("Detect() took another system's CloudEvent for a Jenkins one")
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir holds the credentials Kubernetes mounts into every pod
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeConfigRef names the key of a ConfigMap or Secret holding the config
+// file, written configmap://[namespace/]name/key or secret://[namespace/]name/key
+type kubeConfigRef struct {
+	resource  string // "configmaps" or "secrets"
+	namespace string
+	name      string
+	key       string
+}
+
+func isKubeConfig(path string) bool {
+	return strings.HasPrefix(path, "configmap://") || strings.HasPrefix(path, "secret://")
+}
+
+// parseKubeConfigRef parses a configmap:// or secret:// config path. Without
+// a namespace the pod's own namespace is used.
+func parseKubeConfigRef(path string) (kubeConfigRef, error) {
+	scheme, rest, _ := strings.Cut(path, "://")
+	ref := kubeConfigRef{resource: scheme + "s"}
+
+	parts := strings.Split(rest, "/")
+	switch len(parts) {
+	case 2:
+		namespace, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return kubeConfigRef{}, fmt.Errorf("error reading pod namespace: %w", err)
+		}
+		ref.namespace = strings.TrimSpace(string(namespace))
+		ref.name, ref.key = parts[0], parts[1]
+	case 3:
+		ref.namespace, ref.name, ref.key = parts[0], parts[1], parts[2]
+	default:
+		return kubeConfigRef{}, fmt.Errorf("invalid config file URL %s: expected %s://[namespace/]name/key", path, scheme)
+	}
+	if ref.namespace == "" || ref.name == "" || ref.key == "" {
+		return kubeConfigRef{}, fmt.Errorf("invalid config file URL %s: expected %s://[namespace/]name/key", path, scheme)
+	}
+	return ref, nil
+}
+
+// kubeObject is the part of a ConfigMap or Secret the config is read from
+type kubeObject struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Data map[string]string `json:"data"`
+}
+
+// content returns the config file held in the object, decoding Secret data
+// from base64
+func (o kubeObject) content(ref kubeConfigRef) ([]byte, error) {
+	value, ok := o.Data[ref.key]
+	if !ok {
+		return nil, fmt.Errorf("%s %s/%s has no key %s", strings.TrimSuffix(ref.resource, "s"), ref.namespace, ref.name, ref.key)
+	}
+	if ref.resource == "secrets" {
+		return base64.StdEncoding.DecodeString(value)
+	}
+	return []byte(value), nil
+}
+
+// kubeClient talks to the API server of the cluster the pod runs in, with
+// the pod's service account
+type kubeClient struct {
+	host   string
+	client *http.Client
+}
+
+func newKubeClient(timeout time.Duration) (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster (KUBERNETES_SERVICE_HOST is not set)")
+	}
+
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("error reading cluster CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("no certificates found in cluster CA")
+	}
+
+	return &kubeClient{
+		host: "https://" + net.JoinHostPort(host, port),
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+// get performs a GET against the API server. The service account token is
+// read on every request because Kubernetes rotates it.
+func (k *kubeClient) get(path string, query url.Values) (*http.Response, error) {
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("error reading service account token: %w", err)
+	}
+
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	req, err := http.NewRequest("GET", k.host+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Kubernetes API returned status: %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// fetch reads the object ref points to
+func (k *kubeClient) fetch(ref kubeConfigRef) (kubeObject, error) {
+	resp, err := k.get(fmt.Sprintf("/api/v1/namespaces/%s/%s/%s",
+		url.PathEscape(ref.namespace), ref.resource, url.PathEscape(ref.name)), nil)
+	if err != nil {
+		return kubeObject{}, err
+	}
+	defer resp.Body.Close()
+
+	var object kubeObject
+	if err := json.NewDecoder(resp.Body).Decode(&object); err != nil {
+		return kubeObject{}, fmt.Errorf("error decoding %s: %w", ref.resource, err)
+	}
+	return object, nil
+}
+
+// fetchKubeConfig reads the config file from a ConfigMap or Secret,
+// returning the object's resource version as the content version
+func fetchKubeConfig(path string) ([]byte, string, error) {
+	ref, err := parseKubeConfigRef(path)
+	if err != nil {
+		return nil, "", err
+	}
+	client, err := newKubeClient(30 * time.Second)
+	if err != nil {
+		return nil, "", err
+	}
+
+	object, err := client.fetch(ref)
+	if err != nil {
+		return nil, "", fmt.Errorf("error fetching config file: %w", err)
+	}
+	content, err := object.content(ref)
+	if err != nil {
+		return nil, "", err
+	}
+	return content, object.Metadata.ResourceVersion, nil
+}
+
+// watchKubeConfig watches the ConfigMap or Secret at path through the API
+// server and reloads whenever the config key in it changes. The watch is
+// restarted when the API server closes it, as it does every few minutes.
+func (w *WebhookHandler) watchKubeConfig(path, port string) {
+	ref, err := parseKubeConfigRef(path)
+	if err == nil {
+		var client *kubeClient
+		if client, err = newKubeClient(0); err == nil {
+			go w.watchKubeObject(client, ref, path, port)
+			return
+		}
+	}
+	log.Printf("Error watching config file %s, reload with SIGHUP instead: %v", path, err)
+}
+
+func (w *WebhookHandler) watchKubeObject(client *kubeClient, ref kubeConfigRef, path, port string) {
+	var current string
+	resourceVersion := ""
+	for {
+		// Start from the current object, which is also how a watch that
+		// fell too far behind (410 Gone) recovers
+		if resourceVersion == "" {
+			object, err := client.fetch(ref)
+			if err != nil {
+				log.Printf("Error fetching config file %s: %v", path, err)
+				time.Sleep(10 * time.Second)
+				continue
+			}
+			content, _ := object.content(ref)
+			if current != "" && string(content) != current {
+				w.reloadConfig(path, port)
+			}
+			current = string(content)
+			resourceVersion = object.Metadata.ResourceVersion
+		}
+
+		resp, err := client.get(fmt.Sprintf("/api/v1/namespaces/%s/%s", url.PathEscape(ref.namespace), ref.resource), url.Values{
+			"watch":           {"true"},
+			"fieldSelector":   {"metadata.name=" + ref.name},
+			"resourceVersion": {resourceVersion},
+			"timeoutSeconds":  {"300"},
+		})
+		if err != nil {
+			log.Printf("Error watching config file %s: %v", path, err)
+			resourceVersion = ""
+			time.Sleep(10 * time.Second)
+			continue
+		}
+
+		decoder := json.NewDecoder(resp.Body)
+		for {
+			var event struct {
+				Type   string          `json:"type"`
+				Object json.RawMessage `json:"object"`
+			}
+			if err := decoder.Decode(&event); err != nil {
+				break
+			}
+			if event.Type == "ERROR" {
+				resourceVersion = ""
+				break
+			}
+
+			var object kubeObject
+			if err := json.Unmarshal(event.Object, &object); err != nil {
+				continue
+			}
+			resourceVersion = object.Metadata.ResourceVersion
+			if event.Type != "ADDED" && event.Type != "MODIFIED" {
+				continue
+			}
+
+			// Label and annotation updates also bump the version, so only
+			// reload when the config itself changed
+			content, err := object.content(ref)
+			if err != nil {
+				log.Printf("Error reading config file %s: %v", path, err)
+				continue
+			}
+			if string(content) != current {
+				current = string(content)
+				w.reloadConfig(path, port)
+			}
+		}
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultRedactPatterns are the build parameter and payload keys whose
+// values are masked in the logs, matched case-insensitively
+var defaultRedactPatterns = []string{"*PASSWORD*", "*TOKEN*", "*SECRET*", "*CREDENTIAL*", "*API_KEY*", "*PRIVATE_KEY*"}
+
+// minRedactedSecret is the shortest configured secret replaced in the logs,
+// so very short values don't mangle unrelated output
+const minRedactedSecret = 4
+
+var (
+	// discordWebhookPattern matches the token part of Discord webhook URLs,
+	// including ones that aren't configured such as in payloads
+	discordWebhookPattern = regexp.MustCompile(`(discord(?:app)?\.com/api/webhooks/\d+/)[\w-]+`)
+
+	// keyValuePattern matches JSON "key": value and key=value pairs, as
+	// well as Jenkins {"name": "KEY", "value": "..."} parameters. Plain
+	// "key: value" isn't matched, as log messages read like that.
+	keyValuePattern = regexp.MustCompile(`("name"\s*:\s*"([\w.-]+)"\s*,\s*"value"\s*:\s*)("(?:[^"\\]|\\.)*")` +
+		`|("([\w.-]+)"\s*:\s*)("(?:[^"\\]|\\.)*"|[^\s,}\]&"]+)` +
+		`|(([\w.-]+)=)("(?:[^"\\]|\\.)*"|[^\s,}&"]+)`)
+)
+
+// logRedactor scrubs every log line written by the process, with the
+// secrets of the config currently loaded
+var logRedactor = &redactor{}
+
+// redactor masks secrets in log output
+type redactor struct {
+	rules atomic.Pointer[redactRules]
+}
+
+type redactRules struct {
+	// secrets maps configured secret values to what is shown instead,
+	// longest first so a secret containing another is replaced whole
+	secrets  []secretReplacement
+	patterns []string
+}
+
+type secretReplacement struct {
+	secret, replacement string
+}
+
+// LogConfig configures what the logs leave out. RedactPatterns are glob
+// patterns, such as *PASSWORD*, of the build parameter and payload keys
+// whose values are masked.
+type LogConfig struct {
+	RedactPatterns []string `yaml:"redact_patterns"`
+}
+
+// update replaces the secrets and key patterns masked in the logs with the
+// ones of config
+func (r *redactor) update(config *Config) {
+	rules := &redactRules{patterns: defaultRedactPatterns}
+	if len(config.Log.RedactPatterns) > 0 {
+		rules.patterns = nil
+		for _, pattern := range config.Log.RedactPatterns {
+			rules.patterns = append(rules.patterns, strings.ToUpper(pattern))
+		}
+	}
+
+	// The secrets are the settings config dump redacts, shown the way it
+	// shows them
+	var original, redacted yaml.Node
+	if original.Encode(config) == nil && redacted.Encode(config) == nil {
+		redactNode(&redacted, "")
+		collectSecrets(&original, &redacted, &rules.secrets)
+	}
+	sort.Slice(rules.secrets, func(i, j int) bool {
+		return len(rules.secrets[i].secret) > len(rules.secrets[j].secret)
+	})
+	r.rules.Store(rules)
+}
+
+// collectSecrets records the scalars that redaction changed
+func collectSecrets(original, redacted *yaml.Node, secrets *[]secretReplacement) {
+	if original.Kind == yaml.ScalarNode {
+		if original.Value != redacted.Value && len(original.Value) >= minRedactedSecret {
+			*secrets = append(*secrets, secretReplacement{original.Value, redacted.Value})
+		}
+		return
+	}
+	for i := range original.Content {
+		if i < len(redacted.Content) {
+			collectSecrets(original.Content[i], redacted.Content[i], secrets)
+		}
+	}
+}
+
+// redact masks the secrets in s
+func (r *redactor) redact(s string) string {
+	rules := r.rules.Load()
+	if rules == nil {
+		rules = &redactRules{patterns: defaultRedactPatterns}
+	}
+
+	for _, secret := range rules.secrets {
+		s = strings.ReplaceAll(s, secret.secret, secret.replacement)
+	}
+	s = discordWebhookPattern.ReplaceAllString(s, "${1}"+redacted)
+
+	return rules.redactPairs(s)
+}
+
+// redactPairs masks the values of sensitive keys. Other quoted values are
+// searched too, as they may hold pairs such as the query of a logged URL.
+func (r *redactRules) redactPairs(s string) string {
+	return keyValuePattern.ReplaceAllStringFunc(s, func(pair string) string {
+		match := keyValuePattern.FindStringSubmatch(pair)
+		// Take the groups of whichever alternative matched
+		var prefix, key, value string
+		for i := 1; i < len(match); i += 3 {
+			if match[i] != "" {
+				prefix, key, value = match[i], match[i+1], match[i+2]
+				break
+			}
+		}
+		quoted := len(value) >= 2 && strings.HasPrefix(value, `"`)
+		switch {
+		case r.sensitive(key) && quoted:
+			return prefix + `"` + redacted + `"`
+		case r.sensitive(key):
+			return prefix + redacted
+		case quoted:
+			return prefix + `"` + r.redactPairs(value[1:len(value)-1]) + `"`
+		}
+		return pair
+	})
+}
+
+// sensitive reports whether values of the key are masked
+func (r *redactRules) sensitive(key string) bool {
+	key = strings.ToUpper(key)
+	for _, pattern := range r.patterns {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// redactingWriter writes output with its secrets masked
+type redactingWriter struct {
+	out io.Writer
+}
+
+func (w redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.out, logRedactor.redact(string(p))); err != nil {
+		return 0, err
+	}
+	// Report the original length, as callers check it against what they wrote
+	return len(p), nil
+}
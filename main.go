@@ -1,244 +1,354 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/crypto/acme/autocert"
 )
 
-// Jenkins webhook payload structures
-type JenkinsWebhook struct {
-	BuildName   string `json:"buildName"`
-	BuildUrl    string `json:"buildUrl"`
-	BuildVars   string `json:"buildVars"`
-	Event       string `json:"event"`
-	ProjectName string `json:"projectName"`
-}
-
-// Discord webhook payload structures
-type DiscordWebhook struct {
-	Content string         `json:"content,omitempty"`
-	Embeds  []DiscordEmbed `json:"embeds,omitempty"`
-}
-
-type DiscordEmbed struct {
-	Title       string              `json:"title,omitempty"`
-	Description string              `json:"description,omitempty"`
-	URL         string              `json:"url,omitempty"`
-	Color       int                 `json:"color,omitempty"`
-	Fields      []DiscordEmbedField `json:"fields,omitempty"`
-	Timestamp   string              `json:"timestamp,omitempty"`
-	Footer      *DiscordEmbedFooter `json:"footer,omitempty"`
-}
-
-type DiscordEmbedField struct {
-	Name   string `json:"name"`
-	Value  string `json:"value"`
-	Inline bool   `json:"inline,omitempty"`
-}
-
-type DiscordEmbedFooter struct {
-	Text string `json:"text"`
+type WebhookHandler struct {
+	client *http.Client
+	state  atomic.Pointer[handlerState]
+	builds *buildTracker
+
+	ipLimits, jobLimits *rateLimiters
+	mutes               *muteList
+	history             *eventHistory
+	nonces              *nonceCache
+	duplicates          *nonceCache
+	audit               *auditLog
+	sessions            *sessionStore
+	// queue holds outbound notifications when QUEUE_PATH is set
+	queue *outboundQueue
+	// workers deliver the events unless DELIVERY_WORKERS is -1
+	workers *deliveryWorkers
 }
 
-type WebhookHandler struct {
-	client     *http.Client
-	discordURL string
-	jenkinsURL string
+// handlerState holds everything the handler builds from the config. It is
+// replaced whole on reload, so a request sees one consistent version of it.
+type handlerState struct {
+	destinations  []Destination
+	sources       []SourceAdapter
+	notifications NotifySettings
+	jobs          []JobOverride
+	classifiers   []FailureClassifier
+	auth          AuthConfig
+	allowlist     AllowlistConfig
+	rateLimit     RateLimitConfig
+	admin         AdminConfig
+	maxBodySize   int64
+	replay        ReplayConfig
+	dedup         DedupConfig
+	discord       DiscordConfig
+	jenkins       jenkinsSource
 }
 
-func NewWebhookHandler(discordURL, jenkinsURL string) *WebhookHandler {
+func NewWebhookHandler(config *Config) (*WebhookHandler, error) {
 	timeout := 30 * time.Second
-	client := &http.Client{
-		Timeout: timeout,
+	w := &WebhookHandler{
+		client: &http.Client{
+			Timeout: timeout,
+		},
+		builds:     newBuildTracker(),
+		ipLimits:   newRateLimiters(),
+		jobLimits:  newRateLimiters(),
+		mutes:      newMuteList(),
+		history:    newEventHistory(),
+		nonces:     newNonceCache(),
+		duplicates: newNonceCache(),
+		audit:      newAuditLog(),
+		sessions:   newSessionStore(),
 	}
 
-	return &WebhookHandler{
-		client:     client,
-		discordURL: discordURL,
-		jenkinsURL: jenkinsURL,
+	if err := w.Reload(config); err != nil {
+		return nil, err
+	}
+	if config.Queue.Path != "" {
+		queue, err := openQueue(config.Queue, config.Encryption)
+		if err != nil {
+			return nil, err
+		}
+		w.queue = queue
+		queue.start(config.Queue.Workers, func() []Destination { return w.state.Load().destinations })
+	}
+	if config.Delivery.Workers > 0 {
+		w.workers = newDeliveryWorkers(config.Delivery, w.process)
 	}
+	return w, nil
 }
 
-func (w *WebhookHandler) HandleJenkinsWebhook(c echo.Context) error {
-	var payload JenkinsWebhook
-
-	if err := c.Bind(&payload); err != nil {
-		log.Printf("Error binding payload: %v", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid payload"})
+// deliver fans the events out to every destination and reports the outcome
+// to the system that sent them. With delivery workers, the events are handed
+// to them and the sender is answered right away.
+func (w *WebhookHandler) deliver(c echo.Context, builds ...BuildEvent) error {
+	state := w.state.Load()
+	if w.workers != nil {
+		return w.submit(c, state, builds)
 	}
 
-	log.Printf("Received Jenkins webhook: %s - %s - %s",
-		payload.ProjectName, payload.BuildName, payload.Event)
-
-	discordPayload := w.convertToDiscordPayload(payload)
+	var results []deliveryResult
+	limited, duplicates := 0, 0
+	for _, build := range builds {
+		delivered, outcome := w.process(state, build)
+		switch outcome {
+		case "rate_limited":
+			limited++
+		case "duplicate":
+			duplicates++
+		}
+		results = append(results, delivered...)
+	}
+	audit := auditRequest(c)
+	if len(results) == 0 && limited > 0 {
+		audit.Outcome = "rate_limited"
+		c.Response().Header().Set("Retry-After", "60")
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Rate limit exceeded"})
+	}
+	if len(results) == 0 && duplicates == len(builds) {
+		// A 2xx answer keeps the sender from sending it yet again
+		audit.Outcome = "duplicate"
+		return c.JSON(http.StatusOK, map[string]string{"status": "duplicate"})
+	}
+	if len(results) == 0 {
+		// Every event was filtered out by the notification settings
+		audit.Outcome = "ignored"
+		return c.JSON(http.StatusOK, map[string]string{"status": "ignored"})
+	}
 
-	if err := w.sendToDiscord(discordPayload); err != nil {
-		log.Printf("Error sending to Discord: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to send to Discord"})
+	failed, retrying, queued := 0, 0, 0
+	for _, r := range results {
+		switch r.Status {
+		case "queued":
+			queued++
+		case "error":
+			log.Printf("Error sending to %s: %s", r.Destination, r.Error)
+			failed++
+		case "retrying":
+			log.Printf("Error sending to %s, retrying: %s", r.Destination, r.Error)
+			retrying++
+		}
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{"status": "success"})
+	switch {
+	case failed == len(results):
+		audit.Outcome = "failed"
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error":        "Failed to send notification",
+			"destinations": results,
+		})
+	case failed > 0:
+		// Report success to the sender so it doesn't resend to destinations that got it
+		audit.Outcome = "partial"
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"status":       "partial",
+			"destinations": results,
+		})
+	case queued == len(results):
+		// Delivery is up to the queue's workers
+		audit.Outcome = "queued"
+		return c.JSON(http.StatusAccepted, map[string]interface{}{
+			"status":       "accepted",
+			"destinations": results,
+		})
+	case retrying > 0 || queued > 0:
+		// The retries may still fail, which the sender can't be told
+		audit.Outcome = "retrying"
+		return c.JSON(http.StatusAccepted, map[string]interface{}{
+			"status":       "accepted",
+			"destinations": results,
+		})
+	default:
+		audit.Outcome = "delivered"
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"status":       "success",
+			"destinations": results,
+		})
+	}
 }
 
-func (w *WebhookHandler) convertToDiscordPayload(jenkins JenkinsWebhook) DiscordWebhook {
-	// Determine color based on event status
-	color := w.getEventColor(jenkins.Event)
+// process drops duplicate events and delivers the others. It returns the
+// results, or why the event wasn't delivered: "duplicate", "ignored",
+// "muted" or "rate_limited".
+func (w *WebhookHandler) process(state *handlerState, build BuildEvent) ([]deliveryResult, string) {
+	key, dedup := state.dedup.key(build)
+	if dedup && !w.duplicates.add(key, state.dedup.window) {
+		log.Printf("Dropped duplicate %s notification for %s %s %s", build.SourceName(), build.ProjectName, build.BuildName, build.Event)
+		return nil, "duplicate"
+	}
+	results, outcome := w.processEvent(state, build)
+	if dedup && (outcome == "rate_limited" || allFailed(results)) {
+		// The sender may send it again, which is no duplicate
+		w.duplicates.forget(key)
+	}
+	return results, outcome
+}
 
-	// Current timestamp
-	timestamp := time.Now().Format(time.RFC3339)
+// processEvent runs the event through the notification settings, mutes and
+// job rate limits and delivers it
+func (w *WebhookHandler) processEvent(state *handlerState, build BuildEvent) ([]deliveryResult, string) {
+	// Prefer the duration reported by the source, falling back to our own timing
+	if elapsed := w.builds.track(build); build.Duration == 0 {
+		build.Duration = elapsed
+	}
+	build.Time = time.Now()
+	w.builds.estimate(&build)
+	w.builds.collectChanges(&build)
+	settings := state.notifySettings(build)
+	if !settings.wants(build) {
+		return nil, "ignored"
+	}
+	if w.mutes.muted(build.ProjectName) {
+		log.Printf("Muted %s notification for %s", build.SourceName(), build.ProjectName)
+		return nil, "muted"
+	}
+	if !w.allowJob(state.rateLimit, build) {
+		log.Printf("Dropped %s notification for %s: rate limit exceeded", build.SourceName(), build.ProjectName)
+		return nil, "rate_limited"
+	}
 
-	// Parse build variables
-	buildVarsFormatted := w.formatBuildVars(jenkins.BuildVars)
+	// Only events that will be sent are worth the source's API calls
+	build.addDetails(state.classifiers)
+	classify(state.classifiers, &build)
+	settings.apply(&build)
 
-	// Create embed fields
-	fields := []DiscordEmbedField{
-		{
-			Name:   "Build",
-			Value:  jenkins.BuildName,
-			Inline: true,
-		},
-		{
-			Name:   "Status",
-			Value:  w.getEventText(jenkins.Event),
-			Inline: true,
-		},
-		{
-			Name:   "Project",
-			Value:  jenkins.ProjectName,
-			Inline: true,
-		},
+	var delivered []deliveryResult
+	if w.queue != nil {
+		delivered = w.queue.enqueue(state.destinations, build)
+	} else {
+		delivered = notify(state.destinations, build)
 	}
+	w.history.add(build, delivered)
+	return delivered, ""
+}
 
-	// Add build variables if available
-	if buildVarsFormatted != "" {
-		fields = append(fields, DiscordEmbedField{
-			Name:   "Build Variables",
-			Value:  buildVarsFormatted,
-			Inline: false,
-		})
-	}
+// deliveryResult is the outcome of sending one event to one destination
+type deliveryResult struct {
+	Destination string `json:"destination"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+}
 
-	embed := DiscordEmbed{
-		Title:       fmt.Sprintf("%s - %s", jenkins.ProjectName, jenkins.BuildName),
-		Description: fmt.Sprintf("Build %s", jenkins.Event),
-		URL:         jenkins.BuildUrl,
-		Color:       color,
-		Fields:      fields,
-		Timestamp:   timestamp,
-		Footer: &DiscordEmbedFooter{
-			Text: "Jenkins CI/CD",
-		},
+// notify delivers the event to every destination concurrently
+func notify(destinations []Destination, build BuildEvent) []deliveryResult {
+	results := make([]deliveryResult, len(destinations))
+
+	var wg sync.WaitGroup
+	for i, d := range destinations {
+		wg.Add(1)
+		go func(i int, d Destination) {
+			defer wg.Done()
+
+			result := deliveryResult{Destination: d.ID(), Status: "success"}
+			err := send(d, build, deliveries.start(build, d.ID(), "sending"))
+			if err != nil {
+				result.Status = "error"
+				if errors.As(err, &retryingError{}) {
+					result.Status = "retrying"
+				}
+				result.Error = err.Error()
+			}
+			results[i] = result
+		}(i, d)
 	}
+	wg.Wait()
 
-	return DiscordWebhook{
-		Embeds: []DiscordEmbed{embed},
-	}
+	return results
 }
 
-func (w *WebhookHandler) getEventColor(event string) int {
-	switch event {
-	case "success":
-		return 0x00FF00 // Green
-	case "failure", "failed":
-		return 0xFF0000 // Red
-	case "unstable":
-		return 0xFFA500 // Orange
-	case "aborted":
-		return 0x808080 // Gray
-	case "started":
-		return 0x0099FF // Blue
-	default:
-		return 0x808080 // Gray
-	}
+// defaultColors are the colors of events and results that the colors
+// setting doesn't replace; other events are gray
+var defaultColors = map[string]int{
+	"success":   0x00FF00, // Green
+	"failure":   0xFF0000, // Red
+	"failed":    0xFF0000,
+	"unstable":  0xFFA500, // Orange
+	"aborted":   0x808080, // Gray
+	"not_built": 0xC0C0C0, // Silver
+	"started":   0x0099FF, // Blue
 }
 
-func (w *WebhookHandler) getEventText(event string) string {
-	switch event {
-	case "success":
-		return "✅ Success"
-	case "failure", "failed":
-		return "❌ Failure"
-	case "unstable":
-		return "⚠️ Unstable"
-	case "aborted":
-		return "🛑 Aborted"
-	case "started":
-		return "🔄 Started"
-	default:
-		return event
-	}
+// isFailureEvent reports whether the event marks a failed build
+func isFailureEvent(event string) bool {
+	return event == "failure" || event == "failed"
 }
 
-func (w *WebhookHandler) formatBuildVars(buildVars string) string {
-	if buildVars == "" {
-		return ""
-	}
+// defaultStatusTexts are the status texts of events and results that the
+// status_texts setting doesn't replace; others are shown as they are
+var defaultStatusTexts = map[string]string{
+	"success":   "✅ Success",
+	"failure":   "❌ Failure",
+	"failed":    "❌ Failure",
+	"unstable":  "⚠️ Unstable",
+	"aborted":   "🛑 Aborted",
+	"not_built": "⏭️ Not Built",
+	"started":   "🔄 Started",
+	"queued":    "⏳ Queued",
+	"finalized": "🏁 Finalized",
+}
+
+// BuildVar is a single KEY=value pair describing the build
+type BuildVar struct {
+	Key   string
+	Value string
+}
 
-	// Remove curly braces and format the variables
+// parseBuildVars splits the Jenkins "{KEY=value, OTHER=value}" string into pairs
+func parseBuildVars(buildVars string) []BuildVar {
+	// Remove curly braces
 	cleanVars := strings.Trim(buildVars, "{}")
 	if cleanVars == "" {
-		return ""
+		return nil
 	}
 
-	// Split by comma and format each variable
-	vars := strings.Split(cleanVars, ", ")
-	var formatted []string
-
-	for _, v := range vars {
+	// Split by comma and collect each variable
+	var parsed []BuildVar
+	for _, v := range strings.Split(cleanVars, ", ") {
 		parts := strings.SplitN(v, "=", 2)
 		if len(parts) == 2 {
-			formatted = append(formatted, fmt.Sprintf("**%s**: %s", strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])))
+			parsed = append(parsed, BuildVar{
+				Key:   strings.TrimSpace(parts[0]),
+				Value: strings.TrimSpace(parts[1]),
+			})
 		}
 	}
 
-	return strings.Join(formatted, "\n")
+	return parsed
 }
 
-func (w *WebhookHandler) sendToDiscord(payload DiscordWebhook) error {
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("error marshaling Discord payload: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", w.discordURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("error creating request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := w.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("error sending request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("discord API returned status: %d", resp.StatusCode)
+func formatBuildVars(vars []BuildVar) string {
+	var formatted []string
+	for _, v := range vars {
+		formatted = append(formatted, fmt.Sprintf("**%s**: %s", v.Key, v.Value))
 	}
 
-	log.Printf("Successfully sent webhook to Discord")
-	return nil
+	return strings.Join(formatted, "\n")
 }
 
 func (w *WebhookHandler) HandlePrintRequestBody(c echo.Context) error {
+	if client, ok := w.state.Load().allowlist.allows(c.Request(), ""); !ok {
+		log.Printf("Rejected request from %s: address not allowed", client)
+		auditRequest(c).Auth = "address_not_allowed"
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Forbidden"})
+	}
+
 	// Read the request body using io.ReadAll
 	bodyBytes, err := io.ReadAll(c.Request().Body)
 	if err != nil {
-		log.Printf("Error reading request body: %v", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to read request body"})
+		return readError(c, err)
 	}
+	auditRequest(c).setPayload(bodyBytes)
 
 	bodyContent := string(bodyBytes)
 
@@ -253,49 +363,118 @@ func (w *WebhookHandler) HandlePrintRequestBody(c echo.Context) error {
 	})
 }
 
-func main() {
-	// Get environment variables
-	discordURL := os.Getenv("DISCORD_WEBHOOK_URL")
-	if discordURL == "" {
-		log.Fatal("DISCORD_WEBHOOK_URL environment variable is required")
-	}
-
-	jenkinsURL := os.Getenv("JENKINS_URL")
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+// serve runs the webhook server until it fails
+func serve(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := configFlag(flags)
+	refresh := flags.Duration("config-refresh", time.Minute,
+		"how often to check a remote config file for changes (CONFIG_REFRESH_INTERVAL)")
+	if value := os.Getenv("CONFIG_REFRESH_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("invalid CONFIG_REFRESH_INTERVAL value: %s", value)
+		}
+		*refresh = interval
 	}
+	flags.Parse(args)
 
-	// Validate port
-	if _, err := strconv.Atoi(port); err != nil {
-		log.Fatalf("Invalid PORT value: %s", port)
+	// Read the config file and environment variables
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
 	}
+	port := config.Port
 
 	// Create Echo instance
 	e := echo.New()
 
 	// Middleware
-	e.Use(middleware.Logger())
+	e.Logger.SetOutput(redactingWriter{os.Stdout})
+	e.StdLogger.SetOutput(redactingWriter{os.Stderr})
+	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{Output: redactingWriter{os.Stdout}}))
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
 
 	// Create webhook handler
-	handler := NewWebhookHandler(discordURL, jenkinsURL)
+	handler, err := NewWebhookHandler(config)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook handler: %w", err)
+	}
+	e.Use(handler.auditWebhooks, handler.limitBody)
 
 	// Routes
-	e.POST("/webhook/jenkins", handler.HandleJenkinsWebhook)
-	e.POST("/webhook/print", handler.HandlePrintRequestBody)
+	webhookMiddleware := []echo.MiddlewareFunc{handler.limitByIP}
+	if config.TLS.ClientCAFile != "" {
+		webhookMiddleware = append(webhookMiddleware, requireClientCert)
+	}
+	e.POST("/webhook", handler.HandleWebhook, webhookMiddleware...)
+	for _, src := range handler.state.Load().sources {
+		e.POST("/webhook/"+src.Name(), handler.sourceHandler(src.Name()), webhookMiddleware...)
+	}
+	if config.Admin.DebugEndpoints {
+		if config.Admin.Password == "" {
+			log.Printf("Debug endpoints are enabled without ADMIN_PASSWORD, anyone can reach them")
+		}
+		e.POST("/webhook/print", handler.HandlePrintRequestBody, append(webhookMiddleware, handler.adminAuth())...)
+	}
+	e.POST("/discord/interactions", handler.handleDiscordInteraction)
+	handler.registerAdminAPI(e, *configPath, port)
 	e.GET("/health", func(c echo.Context) error {
 		return c.JSON(http.StatusOK, map[string]string{"status": "healthy"})
 	})
 
 	// Start server
+	scheme := "http"
+	if config.TLS.enabled() {
+		scheme = "https"
+	}
 	log.Printf("Starting server on port %s", port)
-	log.Printf("Jenkins webhook endpoint: http://localhost:%s/webhook/jenkins", port)
-	log.Printf("Print request body endpoint: http://localhost:%s/webhook/print", port)
-	log.Printf("Health check endpoint: http://localhost:%s/health", port)
+	log.Printf("Webhook endpoint for any source: %s://localhost:%s/webhook", scheme, port)
+	for _, src := range handler.state.Load().sources {
+		log.Printf("%s webhook endpoint: %s://localhost:%s/webhook/%s", sourceName(src.Name()), scheme, port, src.Name())
+	}
+	if config.Admin.DebugEndpoints {
+		log.Printf("Print request body endpoint: %s://localhost:%s/webhook/print", scheme, port)
+	}
+	log.Printf("Health check endpoint: %s://localhost:%s/health", scheme, port)
+
+	handler.reloadOnSignal(*configPath, port)
+	switch {
+	case isKubeConfig(*configPath):
+		handler.watchKubeConfig(*configPath, port)
+	case isRemoteConfig(*configPath):
+		handler.watchRemoteConfig(*configPath, port, *refresh)
+	}
+	if config.Vault.enabled() {
+		go newVaultClient(config.Vault).renewToken()
+	}
 
-	if err := e.Start(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	start := func() error { return e.Start(":" + port) }
+	if config.TLS.enabled() {
+		var manager *autocert.Manager
+		if config.TLS.acme() {
+			manager = config.TLS.acmeManager()
+			log.Printf("Obtaining certificates for %s from ACME", strings.Join(config.TLS.ACMEHosts, ", "))
+		}
+		tlsConfig, err := config.TLS.serverTLSConfig(manager)
+		if err != nil {
+			return err
+		}
+		if config.TLS.RedirectPort != "" {
+			go redirectToHTTPS(config.TLS.RedirectPort, port, manager)
+		}
+		start = func() error { return e.StartServer(&http.Server{Addr: ":" + port, TLSConfig: tlsConfig}) }
 	}
+
+	signals := shutdownSignals()
+	failed := make(chan error, 1)
+	go func() { failed <- start() }()
+	select {
+	case err := <-failed:
+		return fmt.Errorf("failed to start server: %w", err)
+	case sig := <-signals:
+		log.Printf("Received %v, shutting down", sig)
+	}
+	handler.shutdown(e, config.shutdownTimeout)
+	return nil
 }
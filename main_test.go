@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// newTestHandler starts a handler with config as its config file, read like
+// the server reads it
+func newTestHandler(t *testing.T, config string) *WebhookHandler {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWebhookHandler(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// postWebhook sends body to the webhook route at path, served like the
+// server serves it
+func postWebhook(t *testing.T, w *WebhookHandler, path string, header http.Header, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := echo.New()
+	e.POST("/webhook", w.HandleWebhook)
+	for _, src := range w.state.Load().sources {
+		e.POST("/webhook/"+src.Name(), w.sourceHandler(src.Name()))
+	}
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestFanOut(t *testing.T) {
+	// Every case fails Mattermost, which mustn't open its circuit
+	setBreakers(t, -1, defaultBreakerCooldown)
+	slack := newRecordingServer(t, http.StatusOK, "ok")
+	mattermost := newRecordingServer(t, http.StatusInternalServerError, "down")
+	body := `{"projectName": "app", "buildName": "#1", "event": "failure"}`
+
+	tests := []struct {
+		name   string
+		config string
+		status int
+		want   string
+	}{
+		{"every destination", `
+slack:
+  webhook_url: ` + slack.server.URL + `
+mattermost:
+  webhook_url: ` + mattermost.server.URL + `
+delivery:
+  workers: -1
+`, http.StatusOK, "partial"},
+		{"selected destinations", `
+slack:
+  webhook_url: ` + slack.server.URL + `
+mattermost:
+  webhook_url: ` + mattermost.server.URL + `
+destinations: [slack]
+delivery:
+  workers: -1
+`, http.StatusOK, "success"},
+		{"all failed", `
+mattermost:
+  webhook_url: ` + mattermost.server.URL + `
+delivery:
+  workers: -1
+`, http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestHandler(t, tt.config)
+			rec := postWebhook(t, w, "/webhook", nil, body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			var response struct {
+				Status       string           `json:"status"`
+				Destinations []deliveryResult `json:"destinations"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Status != tt.want {
+				t.Errorf("status = %q, want %q", response.Status, tt.want)
+			}
+			want := len(w.state.Load().destinations)
+			if len(response.Destinations) != want {
+				t.Errorf("got %d results, want one for each of the %d destinations", len(response.Destinations), want)
+			}
+		})
+	}
+	if len(slack.requests()) != 2 || len(mattermost.requests()) != 2 {
+		t.Errorf("slack got %d and mattermost %d posts, want 2 each", len(slack.requests()), len(mattermost.requests()))
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// JobMatch selects builds by job name, either exactly, by prefix or by
+// regular expression, and by the SCM branch and build parameters. Branch
+// and parameter values are glob patterns such as "feature/*". At most one
+// of the job name criteria may be set, and every criterion that is set
+// must match.
+type JobMatch struct {
+	Exact  string `yaml:"exact"`
+	Prefix string `yaml:"prefix"`
+	Regex  string `yaml:"regex"`
+
+	Branch     string            `yaml:"branch"`
+	Parameters map[string]string `yaml:"parameters"`
+
+	re *regexp.Regexp
+}
+
+// compile validates the match and prepares its regular expression
+func (m *JobMatch) compile() error {
+	set := 0
+	for _, v := range []string{m.Exact, m.Prefix, m.Regex} {
+		if v != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return errors.New("only one of exact, prefix or regex may be set")
+	}
+	if set == 0 && m.Branch == "" && len(m.Parameters) == 0 {
+		return errors.New("one of exact, prefix, regex, branch or parameters is required")
+	}
+
+	if m.Regex != "" {
+		re, err := regexp.Compile(m.Regex)
+		if err != nil {
+			return err
+		}
+		m.re = re
+	}
+
+	// Malformed globs only fail when matched, so check them up front
+	if _, err := path.Match(m.Branch, ""); err != nil {
+		return fmt.Errorf("invalid branch pattern %q: %w", m.Branch, err)
+	}
+	for name, pattern := range m.Parameters {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q for parameter %s: %w", pattern, name, err)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the build satisfies every criterion of the match
+func (m JobMatch) matches(build BuildEvent) bool {
+	return m.matchesJob(build.ProjectName) &&
+		(m.Branch == "" || globMatch(m.Branch, build.branch())) &&
+		m.matchesParameters(build)
+}
+
+func (m JobMatch) matchesJob(job string) bool {
+	switch {
+	case m.Exact != "":
+		return job == m.Exact
+	case m.Prefix != "":
+		return strings.HasPrefix(job, m.Prefix)
+	case m.re != nil:
+		return m.re.MatchString(job)
+	default:
+		return true
+	}
+}
+
+// matchesParameters compares the parameters against the build variables,
+// which is where sources put build parameters
+func (m JobMatch) matchesParameters(build BuildEvent) bool {
+	for name, pattern := range m.Parameters {
+		value, ok := build.variable(name)
+		if !ok || !globMatch(pattern, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// globMatch matches value against a glob pattern already checked by compile
+func globMatch(pattern, value string) bool {
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// MattermostConfig configures the Mattermost destination
+type MattermostConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
+}
+
+type mattermostDestination struct {
+	destinationID
+	httpSender
+	cfg MattermostConfig
+}
+
+func (d *mattermostDestination) Name() string {
+	return "mattermost"
+}
+
+func (d *mattermostDestination) pingAddress() string {
+	return d.cfg.WebhookURL
+}
+
+func (d *mattermostDestination) Send(build BuildEvent) error {
+	return d.sendToMattermost(d.convertToMattermostPayload(build))
+}
+
+// Mattermost incoming webhook payload structures
+type MattermostWebhook struct {
+	Text        string                 `json:"text,omitempty"`
+	Attachments []MattermostAttachment `json:"attachments,omitempty"`
+}
+
+type MattermostAttachment struct {
+	Fallback  string                      `json:"fallback"`
+	Color     string                      `json:"color,omitempty"`
+	Title     string                      `json:"title,omitempty"`
+	TitleLink string                      `json:"title_link,omitempty"`
+	Text      string                      `json:"text,omitempty"`
+	Fields    []MattermostAttachmentField `json:"fields,omitempty"`
+	Footer    string                      `json:"footer,omitempty"`
+}
+
+type MattermostAttachmentField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+func (d *mattermostDestination) convertToMattermostPayload(build BuildEvent) MattermostWebhook {
+	title := fmt.Sprintf("%s - %s", build.ProjectName, build.BuildName)
+
+	fields := []MattermostAttachmentField{
+		{Title: "Build", Value: build.BuildName, Short: true},
+		{Title: "Status", Value: build.StatusText(), Short: true},
+		{Title: "Project", Value: build.ProjectName, Short: true},
+	}
+
+	// Mattermost renders the same markdown as Discord
+	if buildVarsFormatted := formatBuildVars(build.Vars); buildVarsFormatted != "" {
+		fields = append(fields, MattermostAttachmentField{
+			Title: "Build Variables",
+			Value: buildVarsFormatted,
+			Short: false,
+		})
+	}
+
+	return MattermostWebhook{
+		Attachments: []MattermostAttachment{
+			{
+				Fallback:  fmt.Sprintf("%s: %s", title, build.StatusText()),
+				Color:     fmt.Sprintf("#%06X", build.EventColor()),
+				Title:     title,
+				TitleLink: build.BuildURL,
+				Text:      fmt.Sprintf("Build %s", build.Event),
+				Fields:    fields,
+				Footer:    build.Footer(),
+			},
+		},
+	}
+}
+
+func (d *mattermostDestination) sendToMattermost(payload MattermostWebhook) error {
+	if err := d.postJSON(d.cfg.WebhookURL, payload, nil); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully sent webhook to Mattermost")
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMattermostSend(t *testing.T) {
+	server := newRecordingServer(t, http.StatusOK, "ok")
+	d := &mattermostDestination{httpSender: server.sender(), cfg: MattermostConfig{WebhookURL: "https://chat.example.com/hooks/abc"}}
+	build := testBuild("app", "success")
+	build.BuildURL = "https://ci.example.com/job/app/1/"
+
+	if err := d.Send(build); err != nil {
+		t.Fatal(err)
+	}
+	request := server.only(t)
+	if request.Path != "/hooks/abc" {
+		t.Errorf("path = %s, want the webhook's", request.Path)
+	}
+	var payload MattermostWebhook
+	request.decode(t, &payload)
+	if len(payload.Attachments) != 1 {
+		t.Fatalf("attachments = %+v, want one", payload.Attachments)
+	}
+	attachment := payload.Attachments[0]
+	if attachment.Title != "app - #0" || attachment.TitleLink != build.BuildURL {
+		t.Errorf("title = %q linking %q, want the build linked", attachment.Title, attachment.TitleLink)
+	}
+	if attachment.Color != fmt.Sprintf("#%06X", build.EventColor()) || attachment.Footer != build.Footer() {
+		t.Errorf("color %q and footer %q, want the build's", attachment.Color, attachment.Footer)
+	}
+	last := attachment.Fields[len(attachment.Fields)-1]
+	if last.Title != "Build Variables" || !strings.Contains(last.Value, "send-test") || last.Short {
+		t.Errorf("last field = %+v, want the build variables", last)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// jobMute silences the notifications of the jobs matching Job, a glob
+// pattern as in path.Match, until Until or, when that is zero, until it
+// is removed
+type jobMute struct {
+	Job    string    `json:"job"`
+	Until  time.Time `json:"until,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+func (m jobMute) expired(now time.Time) bool {
+	return !m.Until.IsZero() && now.After(m.Until)
+}
+
+// muteList holds the mutes set through the admin API. Mutes are kept in
+// memory, across reloads but not restarts.
+type muteList struct {
+	mu    sync.Mutex
+	mutes map[string]jobMute
+}
+
+func newMuteList() *muteList {
+	return &muteList{mutes: make(map[string]jobMute)}
+}
+
+// muted reports whether the notifications of the job are muted
+func (l *muteList) muted(job string) bool {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for pattern, mute := range l.mutes {
+		if mute.expired(now) {
+			delete(l.mutes, pattern)
+			continue
+		}
+		if matched, _ := path.Match(pattern, job); matched || pattern == job {
+			return true
+		}
+	}
+	return false
+}
+
+// set adds the mute, replacing any mute of the same pattern
+func (l *muteList) set(mute jobMute) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mutes[mute.Job] = mute
+}
+
+// remove deletes the mute of the pattern, reporting whether there was one
+func (l *muteList) remove(job string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, ok := l.mutes[job]
+	delete(l.mutes, job)
+	return ok
+}
+
+// list returns the mutes in effect, by pattern
+func (l *muteList) list() []jobMute {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	mutes := []jobMute{}
+	for pattern, mute := range l.mutes {
+		if mute.expired(now) {
+			delete(l.mutes, pattern)
+			continue
+		}
+		mutes = append(mutes, mute)
+	}
+	sort.Slice(mutes, func(i, j int) bool { return mutes[i].Job < mutes[j].Job })
+	return mutes
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// NexusConfig configures the Sonatype Nexus Repository webhook source. When
+// Secret is set, requests must carry a matching HMAC-SHA1 in
+// X-Nexus-Webhook-Signature. URL, when set, links notifications to the
+// repository browser.
+type NexusConfig struct {
+	Secret string `yaml:"secret"`
+	URL    string `yaml:"url"`
+}
+
+// Nexus repository component webhook payload structures
+type NexusWebhook struct {
+	Initiator      string          `json:"initiator"`
+	RepositoryName string          `json:"repositoryName"`
+	Action         string          `json:"action"`
+	Component      *NexusComponent `json:"component,omitempty"`
+}
+
+type NexusComponent struct {
+	Format  string `json:"format"`
+	Name    string `json:"name"`
+	Group   string `json:"group"`
+	Version string `json:"version"`
+}
+
+type nexusSource struct {
+	cfg NexusConfig
+}
+
+func (s nexusSource) Name() string {
+	return "nexus"
+}
+
+func (s nexusSource) Detect(header http.Header, body []byte) bool {
+	return strings.HasPrefix(header.Get("X-Nexus-Webhook-ID"), "rm:")
+}
+
+func (s nexusSource) Verify(req *http.Request, body []byte) error {
+	if !s.cfg.verifySignature(req.Header.Get("X-Nexus-Webhook-Signature"), body) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// signedAt reports requests as signed when a secret is configured. The
+// signature doesn't cover a send time.
+func (s nexusSource) signedAt(header http.Header) (time.Time, bool) {
+	return time.Time{}, s.cfg.Secret != ""
+}
+
+func (s nexusSource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	if header.Get("X-Nexus-Webhook-ID") != "rm:repository:component" {
+		// A component is published as several assets, so asset events would repeat it
+		return nil, nil
+	}
+
+	var payload NexusWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return singleBuild(payload.toBuildEvent(s.cfg.URL)), nil
+}
+
+// verifySignature checks the hex HMAC-SHA1 of the body Nexus sends
+func (c NexusConfig) verifySignature(header string, body []byte) bool {
+	if c.Secret == "" {
+		return true
+	}
+
+	decoded, err := hex.DecodeString(header)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha1.New, []byte(c.Secret))
+	mac.Write(body)
+	return hmac.Equal(decoded, mac.Sum(nil))
+}
+
+// toBuildEvent converts a created component into a successful BuildEvent,
+// returning false for updates and deletions
+func (p NexusWebhook) toBuildEvent(nexusURL string) (BuildEvent, bool) {
+	component := p.Component
+	if component == nil || p.Action != "CREATED" {
+		return BuildEvent{}, false
+	}
+
+	name := component.Name
+	if component.Group != "" {
+		name = component.Group + "/" + name
+	}
+	if component.Version != "" {
+		name += "@" + component.Version
+	}
+
+	build := BuildEvent{
+		Source:      "nexus",
+		ProjectName: p.RepositoryName,
+		BuildName:   name,
+		Event:       "success",
+		Payload:     p,
+	}
+	if nexusURL != "" {
+		build.BuildURL = strings.TrimSuffix(nexusURL, "/") + "/#browse/browse:" + url.PathEscape(p.RepositoryName)
+	}
+
+	if component.Format != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Format", Value: component.Format})
+	}
+	// The initiator is "user/address"; only the user is worth showing
+	if user, _, _ := strings.Cut(p.Initiator, "/"); user != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Deployed by", Value: user})
+	}
+
+	return build, true
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestNexusParse(t *testing.T) {
+	component := func(action string) string {
+		return `{"initiator": "ana/10.0.0.5", "repositoryName": "maven-releases", "action": "` + action + `",
+		  "component": {"format": "maven2", "name": "app", "group": "com.acme", "version": "1.2.0"}}`
+	}
+	tests := []struct {
+		name   string
+		hookID string
+		body   string
+		want   []buildSummary
+	}{
+		{
+			"component created", "rm:repository:component", component("CREATED"),
+			[]buildSummary{{"maven-releases", "com.acme/app@1.2.0", "https://nexus.example.com/#browse/browse:maven-releases", "success"}},
+		},
+		{"component updated", "rm:repository:component", component("UPDATED"), nil},
+		{"asset created", "rm:repository:asset", `{"action": "CREATED", "asset": {"name": "app-1.2.0.jar"}}`, nil},
+	}
+	src := nexusSource{cfg: NexusConfig{URL: "https://nexus.example.com/"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{"X-Nexus-Webhook-Id": {tt.hookID}}
+			if name := detectSource(t, header, tt.body); name != "nexus" {
+				t.Errorf("detected as %q, want nexus", name)
+			}
+			builds := parseBuilds(t, src, header, tt.body)
+			if got := summarize(builds); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("builds = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	header := http.Header{"X-Nexus-Webhook-Id": {"rm:repository:component"}}
+	builds := parseBuilds(t, src, header, component("CREATED"))
+	want := []BuildVar{{Key: "Format", Value: "maven2"}, {Key: "Deployed by", Value: "ana"}}
+	if !reflect.DeepEqual(builds[0].Vars, want) {
+		t.Errorf("vars = %+v, want %+v", builds[0].Vars, want)
+	}
+}
+
+func TestNexusVerify(t *testing.T) {
+	body := []byte(`{"action": "CREATED"}`)
+	mac := hmac.New(sha1.New, []byte("secret"))
+	mac.Write(body)
+	src := nexusSource{cfg: NexusConfig{Secret: "secret"}}
+
+	for signature, ok := range map[string]bool{hex.EncodeToString(mac.Sum(nil)): true, hex.EncodeToString(make([]byte, 20)): false, "": false} {
+		req, _ := http.NewRequest(http.MethodPost, "/webhook/nexus", nil)
+		req.Header.Set("X-Nexus-Webhook-Signature", signature)
+		if err := src.Verify(req, body); (err == nil) != ok {
+			t.Errorf("Verify() with %q = %v, want ok %v", signature, err, ok)
+		}
+	}
+}
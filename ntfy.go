@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// NtfyConfig configures the ntfy destination
+type NtfyConfig struct {
+	URL   string `yaml:"url"`
+	Topic string `yaml:"topic"`
+	Token string `yaml:"token"`
+}
+
+type ntfyDestination struct {
+	destinationID
+	httpSender
+	cfg NtfyConfig
+}
+
+func (d *ntfyDestination) Name() string {
+	return "ntfy"
+}
+
+func (d *ntfyDestination) pingAddress() string {
+	return d.cfg.URL
+}
+
+func (d *ntfyDestination) Send(build BuildEvent) error {
+	return d.sendToNtfy(d.convertToNtfyMessage(build))
+}
+
+// ntfy JSON publish payload
+type NtfyMessage struct {
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title,omitempty"`
+	Message  string   `json:"message"`
+	Tags     []string `json:"tags,omitempty"`
+	Priority int      `json:"priority,omitempty"`
+	Click    string   `json:"click,omitempty"`
+}
+
+// getNtfyTag maps the event to an ntfy emoji short code
+func (d *ntfyDestination) getNtfyTag(event string) string {
+	switch event {
+	case "success":
+		return "white_check_mark"
+	case "failure", "failed":
+		return "x"
+	case "unstable":
+		return "warning"
+	case "aborted":
+		return "stop_sign"
+	case "started":
+		return "arrows_counterclockwise"
+	default:
+		return "grey_question"
+	}
+}
+
+// getNtfyPriority maps the event to an ntfy priority (1 = min, 5 = max)
+func (d *ntfyDestination) getNtfyPriority(event string) int {
+	switch event {
+	case "failure", "failed":
+		return 4
+	case "unstable":
+		return 3
+	case "started":
+		return 2
+	default:
+		return 3
+	}
+}
+
+func (d *ntfyDestination) convertToNtfyMessage(build BuildEvent) NtfyMessage {
+	lines := []string{fmt.Sprintf("Build %s", build.Event)}
+	if build.Duration > 0 {
+		lines = append(lines, "Duration: "+formatDuration(build.Duration))
+	}
+	for _, v := range build.Vars {
+		lines = append(lines, fmt.Sprintf("%s: %s", v.Key, v.Value))
+	}
+
+	return NtfyMessage{
+		Topic:    d.cfg.Topic,
+		Title:    fmt.Sprintf("%s - %s", build.ProjectName, build.BuildName),
+		Message:  strings.Join(lines, "\n"),
+		Tags:     []string{d.getNtfyTag(build.Event), build.Source},
+		Priority: d.getNtfyPriority(build.Event),
+		Click:    build.BuildURL,
+	}
+}
+
+func (d *ntfyDestination) sendToNtfy(message NtfyMessage) error {
+	var headers map[string]string
+	if d.cfg.Token != "" {
+		headers = map[string]string{"Authorization": "Bearer " + d.cfg.Token}
+	}
+
+	// JSON messages are published to the server root with the topic in the body
+	if err := d.postJSON(strings.TrimRight(d.cfg.URL, "/"), message, headers); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully published to ntfy topic %s", message.Topic)
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNtfySend(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		event    string
+		tag      string
+		priority int
+	}{
+		{"failure", "tk_secret", "failure", "x", 4},
+		{"started without a token", "", "started", "arrows_counterclockwise", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRecordingServer(t, http.StatusOK, `{"id":"1"}`)
+			d := &ntfyDestination{httpSender: server.sender(), cfg: NtfyConfig{URL: "https://ntfy.example.com/", Topic: "builds", Token: tt.token}}
+			build := testBuild("app", tt.event)
+			build.BuildURL = "https://ci.example.com/job/app/1/"
+
+			if err := d.Send(build); err != nil {
+				t.Fatal(err)
+			}
+			request := server.only(t)
+			if request.Path != "" && request.Path != "/" {
+				t.Errorf("path = %s, want the server root", request.Path)
+			}
+			wantAuth := ""
+			if tt.token != "" {
+				wantAuth = "Bearer " + tt.token
+			}
+			if auth := request.Header.Get("Authorization"); auth != wantAuth {
+				t.Errorf("Authorization = %q, want %q", auth, wantAuth)
+			}
+			var message NtfyMessage
+			request.decode(t, &message)
+			if message.Topic != "builds" || message.Title != "app - #0" || message.Click != build.BuildURL {
+				t.Errorf("message = %+v, want the build published to builds", message)
+			}
+			if message.Priority != tt.priority || len(message.Tags) != 2 || message.Tags[0] != tt.tag || message.Tags[1] != "jenkins" {
+				t.Errorf("priority %d and tags %v, want %d and [%s jenkins]", message.Priority, message.Tags, tt.priority, tt.tag)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// GrafanaOnCallConfig configures the Grafana OnCall destination
+type GrafanaOnCallConfig struct {
+	URL string `yaml:"url"`
+}
+
+type grafanaOnCallDestination struct {
+	destinationID
+	httpSender
+	cfg GrafanaOnCallConfig
+}
+
+func (d *grafanaOnCallDestination) Name() string {
+	return "grafana-oncall"
+}
+
+func (d *grafanaOnCallDestination) pingAddress() string {
+	return d.cfg.URL
+}
+
+func (d *grafanaOnCallDestination) Send(build BuildEvent) error {
+	if !isFailureEvent(build.Event) && build.Event != "success" {
+		return nil
+	}
+	return d.sendToGrafanaOnCall(d.convertToGrafanaOnCallAlert(build))
+}
+
+// Grafana OnCall formatted webhook payload
+type GrafanaOnCallAlert struct {
+	AlertUID              string `json:"alert_uid"`
+	Title                 string `json:"title"`
+	State                 string `json:"state"`
+	Message               string `json:"message,omitempty"`
+	LinkToUpstreamDetails string `json:"link_to_upstream_details,omitempty"`
+}
+
+// convertToGrafanaOnCallAlert fires an alert for failed builds and resolves
+// it when the job succeeds; alerts share a per-job uid so OnCall groups them
+func (d *grafanaOnCallDestination) convertToGrafanaOnCallAlert(build BuildEvent) GrafanaOnCallAlert {
+	state := "ok"
+	if isFailureEvent(build.Event) {
+		state = "alerting"
+	}
+
+	message := fmt.Sprintf("Build %s", build.Event)
+	if buildVarsFormatted := formatBuildVars(build.Vars); buildVarsFormatted != "" {
+		message += "\n" + buildVarsFormatted
+	}
+
+	return GrafanaOnCallAlert{
+		AlertUID:              build.Source + "/" + build.ProjectName,
+		Title:                 fmt.Sprintf("%s build %s: %s - %s", build.SourceName(), build.Event, build.ProjectName, build.BuildName),
+		State:                 state,
+		Message:               message,
+		LinkToUpstreamDetails: build.BuildURL,
+	}
+}
+
+func (d *grafanaOnCallDestination) sendToGrafanaOnCall(alert GrafanaOnCallAlert) error {
+	if err := d.postJSON(d.cfg.URL, alert, nil); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully sent %s alert to Grafana OnCall (%s)", alert.State, alert.AlertUID)
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGrafanaOnCallSend(t *testing.T) {
+	tests := []struct {
+		event string
+		state string
+	}{
+		{"failure", "alerting"},
+		{"success", "ok"},
+		{"started", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.event, func(t *testing.T) {
+			server := newRecordingServer(t, http.StatusOK, "ok")
+			d := &grafanaOnCallDestination{httpSender: server.sender(), cfg: GrafanaOnCallConfig{URL: "https://oncall.example.com/integrations/v1/formatted_webhook/abc/"}}
+			build := testBuild("app", tt.event)
+			build.BuildURL = "https://ci.example.com/job/app/1/"
+
+			if err := d.Send(build); err != nil {
+				t.Fatal(err)
+			}
+			if tt.state == "" {
+				if requests := server.requests(); len(requests) != 0 {
+					t.Errorf("got %d alerts, want none", len(requests))
+				}
+				return
+			}
+			var alert GrafanaOnCallAlert
+			server.only(t).decode(t, &alert)
+			if alert.AlertUID != "jenkins/app" || alert.State != tt.state || alert.LinkToUpstreamDetails != build.BuildURL {
+				t.Errorf("alert = %+v, want the job's alert in state %s", alert, tt.state)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// OpsgenieConfig configures the Opsgenie destination
+type OpsgenieConfig struct {
+	APIKey string `yaml:"api_key"`
+	APIURL string `yaml:"api_url"`
+}
+
+type opsgenieDestination struct {
+	destinationID
+	httpSender
+	cfg    OpsgenieConfig
+	source string
+}
+
+func (d *opsgenieDestination) Name() string {
+	return "opsgenie"
+}
+
+func (d *opsgenieDestination) pingAddress() string {
+	return d.cfg.APIURL
+}
+
+func (d *opsgenieDestination) Send(build BuildEvent) error {
+	switch {
+	case isFailureEvent(build.Event) || build.Event == "unstable":
+		return d.createOpsgenieAlert(d.convertToOpsgenieAlert(build))
+	case build.Event == "success":
+		return d.closeOpsgenieAlert(build)
+	}
+	return nil
+}
+
+// Opsgenie Alert API payload structures
+type OpsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Priority    string            `json:"priority"`
+	Source      string            `json:"source,omitempty"`
+	Entity      string            `json:"entity,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+type OpsgenieCloseRequest struct {
+	Source string `json:"source,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+// opsgenieAlias groups every failing build of a job into one open alert,
+// which lets a later successful build close it without keeping any state
+func opsgenieAlias(build BuildEvent) string {
+	return build.Source + "/" + build.ProjectName
+}
+
+// getOpsgeniePriority maps the build result to an alert priority
+func (d *opsgenieDestination) getOpsgeniePriority(event string) string {
+	if isFailureEvent(event) {
+		return "P2"
+	}
+	return "P3"
+}
+
+func (d *opsgenieDestination) convertToOpsgenieAlert(build BuildEvent) OpsgenieAlert {
+	message := fmt.Sprintf("%s build %s: %s - %s", build.SourceName(), build.Event, build.ProjectName, build.BuildName)
+	// Opsgenie rejects messages longer than 130 characters
+	if len(message) > 130 {
+		message = message[:127] + "..."
+	}
+
+	details := map[string]string{
+		"project":  build.ProjectName,
+		"build":    build.BuildName,
+		"event":    build.Event,
+		"buildUrl": build.BuildURL,
+	}
+	for _, v := range build.Vars {
+		details[v.Key] = v.Value
+	}
+
+	return OpsgenieAlert{
+		Message:     message,
+		Alias:       opsgenieAlias(build),
+		Description: fmt.Sprintf("%s - %s finished with status %s\n%s", build.ProjectName, build.BuildName, build.Event, build.BuildURL),
+		Priority:    d.getOpsgeniePriority(build.Event),
+		Source:      d.source,
+		Entity:      build.ProjectName,
+		Tags:        []string{build.Source, build.Event},
+		Details:     details,
+	}
+}
+
+func (d *opsgenieDestination) opsgenieHeaders() map[string]string {
+	return map[string]string{"Authorization": "GenieKey " + d.cfg.APIKey}
+}
+
+func (d *opsgenieDestination) createOpsgenieAlert(alert OpsgenieAlert) error {
+	endpoint := strings.TrimRight(d.cfg.APIURL, "/") + "/v2/alerts"
+	if err := d.postJSON(endpoint, alert, d.opsgenieHeaders()); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully created Opsgenie alert %s", alert.Alias)
+	return nil
+}
+
+func (d *opsgenieDestination) closeOpsgenieAlert(build BuildEvent) error {
+	alias := opsgenieAlias(build)
+	endpoint := fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias",
+		strings.TrimRight(d.cfg.APIURL, "/"), url.PathEscape(alias))
+
+	request := OpsgenieCloseRequest{
+		Source: d.source,
+		Note:   fmt.Sprintf("Recovered in %s", build.BuildName),
+	}
+	if err := d.postJSON(endpoint, request, d.opsgenieHeaders()); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully requested close of Opsgenie alert %s", alias)
+	return nil
+}
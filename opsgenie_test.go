@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestOpsgenieSend(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    string
+		path     string
+		priority string
+	}{
+		{"failure opens an alert", "failure", "/v2/alerts", "P2"},
+		{"unstable opens an alert", "unstable", "/v2/alerts", "P3"},
+		{"success closes it", "success", "/v2/alerts/jenkins%2Fapp/close", ""},
+		{"started is ignored", "started", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRecordingServer(t, http.StatusAccepted, `{"result":"Request will be processed"}`)
+			d := &opsgenieDestination{httpSender: server.sender(), cfg: OpsgenieConfig{APIKey: "secret", APIURL: "https://api.opsgenie.com/"}, source: "jenkins.example.com"}
+
+			if err := d.Send(testBuild("app", tt.event)); err != nil {
+				t.Fatal(err)
+			}
+			requests := server.requests()
+			if tt.path == "" {
+				if len(requests) != 0 {
+					t.Errorf("got %d requests, want none", len(requests))
+				}
+				return
+			}
+			request := server.only(t)
+			if request.Path != tt.path {
+				t.Errorf("path = %s, want %s", request.Path, tt.path)
+			}
+			if auth := request.Header.Get("Authorization"); auth != "GenieKey secret" {
+				t.Errorf("Authorization = %q, want the API key", auth)
+			}
+			if tt.priority == "" {
+				if request.Query.Get("identifierType") != "alias" {
+					t.Errorf("query = %v, want the alert closed by alias", request.Query)
+				}
+				return
+			}
+			var alert OpsgenieAlert
+			request.decode(t, &alert)
+			if alert.Alias != "jenkins/app" || alert.Priority != tt.priority || alert.Source != "jenkins.example.com" {
+				t.Errorf("alert = %+v, want alias jenkins/app with priority %s", alert, tt.priority)
+			}
+		})
+	}
+}
+
+func TestOpsgenieMessageLimit(t *testing.T) {
+	d := &opsgenieDestination{}
+	build := testBuild(strings.Repeat("app", 60), "failure")
+	if message := d.convertToOpsgenieAlert(build).Message; len(message) != 130 {
+		t.Errorf("message is %d characters, want it cut to 130", len(message))
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// PagerDutyConfig configures the PagerDuty destination
+type PagerDutyConfig struct {
+	RoutingKey string `yaml:"routing_key"`
+}
+
+type pagerDutyDestination struct {
+	destinationID
+	httpSender
+	cfg       PagerDutyConfig
+	source    string
+	incidents *pagerDutyIncidents
+}
+
+func (d *pagerDutyDestination) Name() string {
+	return "pagerduty"
+}
+
+func (d *pagerDutyDestination) pingAddress() string {
+	return pagerDutyEventsURL
+}
+
+func (d *pagerDutyDestination) Send(build BuildEvent) error {
+	event, ok := d.convertToPagerDutyEvent(build)
+	if !ok {
+		return nil
+	}
+	return d.sendToPagerDuty(event, build)
+}
+
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDuty Events API v2 payload structures
+type PagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *PagerDutyPayload `json:"payload,omitempty"`
+	Links       []PagerDutyLink   `json:"links,omitempty"`
+}
+
+type PagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Component     string            `json:"component,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+type PagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+// pagerDutyIncidents remembers which build opened the incident for each job,
+// so the next successful build of the job can resolve it
+type pagerDutyIncidents struct {
+	mu   sync.Mutex
+	open map[string]string
+}
+
+func newPagerDutyIncidents() *pagerDutyIncidents {
+	return &pagerDutyIncidents{
+		open: make(map[string]string),
+	}
+}
+
+// pagerDutyDedupKey identifies the incident raised for one build
+func pagerDutyDedupKey(build BuildEvent) string {
+	return fmt.Sprintf("%s/%s/%s", build.Source, build.ProjectName, build.BuildName)
+}
+
+// convertToPagerDutyEvent returns the event for the payload and false when
+// the payload neither opens nor resolves an incident
+func (d *pagerDutyDestination) convertToPagerDutyEvent(build BuildEvent) (PagerDutyEvent, bool) {
+	switch {
+	case isFailureEvent(build.Event):
+		details := map[string]string{
+			"project": build.ProjectName,
+			"build":   build.BuildName,
+			"event":   build.Event,
+		}
+		for _, v := range build.Vars {
+			details[v.Key] = v.Value
+		}
+
+		event := PagerDutyEvent{
+			RoutingKey:  d.cfg.RoutingKey,
+			EventAction: "trigger",
+			DedupKey:    pagerDutyDedupKey(build),
+			Payload: &PagerDutyPayload{
+				Summary:       fmt.Sprintf("%s build failed: %s - %s", build.SourceName(), build.ProjectName, build.BuildName),
+				Source:        d.source,
+				Severity:      "error",
+				Component:     build.ProjectName,
+				CustomDetails: details,
+			},
+		}
+		if build.BuildURL != "" {
+			event.Links = []PagerDutyLink{{Href: build.BuildURL, Text: "View build"}}
+		}
+		return event, true
+
+	case build.Event == "success":
+		d.incidents.mu.Lock()
+		dedupKey, ok := d.incidents.open[build.ProjectName]
+		d.incidents.mu.Unlock()
+		if !ok {
+			return PagerDutyEvent{}, false
+		}
+
+		return PagerDutyEvent{
+			RoutingKey:  d.cfg.RoutingKey,
+			EventAction: "resolve",
+			DedupKey:    dedupKey,
+		}, true
+	}
+
+	return PagerDutyEvent{}, false
+}
+
+func (d *pagerDutyDestination) sendToPagerDuty(event PagerDutyEvent, build BuildEvent) error {
+	if err := d.postJSON(pagerDutyEventsURL, event, nil); err != nil {
+		return err
+	}
+
+	// Only update the open incidents once PagerDuty has accepted the event
+	d.incidents.mu.Lock()
+	if event.EventAction == "trigger" {
+		d.incidents.open[build.ProjectName] = event.DedupKey
+	} else {
+		delete(d.incidents.open, build.ProjectName)
+	}
+	d.incidents.mu.Unlock()
+
+	log.Printf("Successfully sent %s event to PagerDuty (%s)", event.EventAction, event.DedupKey)
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPagerDutyTriggersAndResolves(t *testing.T) {
+	server := newRecordingServer(t, http.StatusAccepted, `{"status":"success"}`)
+	d := &pagerDutyDestination{httpSender: server.sender(), cfg: PagerDutyConfig{RoutingKey: "key"}, source: "jenkins.example.com", incidents: newPagerDutyIncidents()}
+
+	builds := []BuildEvent{
+		testBuild("app", "success"),
+		testBuild("app", "failure"),
+		testBuild("app", "started"),
+		testBuild("app", "success"),
+	}
+	builds[1].BuildName = "#1"
+	for _, build := range builds {
+		if err := d.Send(build); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	requests := server.requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d events, want a trigger and a resolve only", len(requests))
+	}
+	var trigger, resolve PagerDutyEvent
+	requests[0].decode(t, &trigger)
+	requests[1].decode(t, &resolve)
+	if trigger.EventAction != "trigger" || trigger.DedupKey != "jenkins/app/#1" || trigger.RoutingKey != "key" {
+		t.Errorf("first event = %+v, want a trigger of the failed build", trigger)
+	}
+	if trigger.Payload == nil || trigger.Payload.Severity != "error" || trigger.Payload.Source != "jenkins.example.com" {
+		t.Errorf("trigger payload = %+v, want an error from the source", trigger.Payload)
+	}
+	if resolve.EventAction != "resolve" || resolve.DedupKey != trigger.DedupKey || resolve.Payload != nil {
+		t.Errorf("second event = %+v, want the incident resolved", resolve)
+	}
+}
+
+func TestPagerDutyKeepsIncidentWhenRejected(t *testing.T) {
+	server := newRecordingServer(t, http.StatusBadRequest, `{"status":"invalid event"}`)
+	d := &pagerDutyDestination{httpSender: server.sender(), incidents: newPagerDutyIncidents()}
+
+	if err := d.Send(testBuild("app", "failure")); err == nil {
+		t.Fatal("rejected trigger returned no error")
+	}
+	if err := d.Send(testBuild("app", "success")); err != nil {
+		t.Fatal(err)
+	}
+	if requests := server.requests(); len(requests) != 1 {
+		t.Errorf("got %d events, want no resolve for an incident that wasn't opened", len(requests))
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// previewRequest is a webhook payload to render, along with templates to
+// try in place of the configured ones of the payload's job
+type previewRequest struct {
+	// Source names the webhook source of the payload, jenkins by default
+	Source   string          `json:"source"`
+	Payload  json.RawMessage `json:"payload"`
+	Template string          `json:"template"`
+	Title    string          `json:"title"`
+	Fields   []FieldTemplate `json:"fields"`
+}
+
+// previewMessage is the Discord message a build would be posted as
+type previewMessage struct {
+	Project string         `json:"project"`
+	Build   string         `json:"build"`
+	Event   string         `json:"event"`
+	Target  string         `json:"target,omitempty"`
+	Message DiscordWebhook `json:"message"`
+}
+
+// handlePreview renders the Discord messages of a payload without sending
+// them, so templates can be tried out before they go in the config
+func (w *WebhookHandler) handlePreview(c echo.Context) error {
+	var request previewRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil || len(request.Payload) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Expected a JSON object with a payload"})
+	}
+	if request.Source == "" {
+		request.Source = "jenkins"
+	}
+
+	state := w.state.Load()
+	src := state.source(request.Source)
+	if src == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown webhook source"})
+	}
+	override := NotifySettings{Template: request.Template, Title: request.Title, Fields: request.Fields}
+	if err := override.compile(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	builds, err := src.Parse(c.Request().Header, request.Payload)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid payload: " + err.Error()})
+	}
+
+	discord := &discordDestination{cfg: state.discord, jenkins: state.jenkins}
+	messages := []previewMessage{}
+	for _, build := range builds {
+		build.addDetails(state.classifiers)
+		build.Time = time.Now()
+		settings := state.notifySettings(build).merge(override)
+		// Template errors are only logged when notifying, so they are
+		// reported here
+		if err := settings.checkTemplates(newTemplateData(build)); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		if !settings.apply(&build) {
+			continue
+		}
+
+		target := state.discord.target(build)
+		preview := previewMessage{
+			Project: build.ProjectName,
+			Build:   build.BuildName,
+			Event:   build.Event,
+			Target:  target.channelID,
+			Message: discord.message(build, target),
+		}
+		if target.webhookURL != "" {
+			preview.Target = "webhook"
+		}
+		messages = append(messages, preview)
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"messages": messages})
+}
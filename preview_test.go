@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+func TestPreview(t *testing.T) {
+	t.Setenv("PREVIEW_TEST_SECRET", "leaked")
+	w := newTestHandler(t, `
+discord:
+  webhook_url: https://discord.com/api/webhooks/1/token
+admin:
+  jwt_secret: secret
+`)
+	e := echo.New()
+	w.registerAdminAPI(e, "", "8080")
+	token := func(role string) string {
+		return signToken(t, jwt.SigningMethodHS256, []byte("secret"), jwt.MapClaims{"sub": "me", "roles": role, "exp": time.Now().Add(time.Hour).Unix()})
+	}
+	payload := `"payload": {"name": "app", "build": {"number": 1, "phase": "COMPLETED", "status": "FAILURE"}}`
+
+	tests := []struct {
+		name   string
+		role   string
+		body   string
+		status int
+		want   string
+	}{
+		{"renders the template", roleOperator, `{` + payload + `, "template": "{{.ProjectName}} broke"}`, http.StatusOK, "app broke"},
+		{"viewers can't preview", roleViewer, `{` + payload + `, "template": "{{.ProjectName}} broke"}`, http.StatusForbidden, ""},
+		{"env", roleOperator, `{` + payload + `, "template": "{{env \"PREVIEW_TEST_SECRET\"}}"}`, http.StatusBadRequest, "not defined"},
+		{"expandenv", roleOperator, `{` + payload + `, "template": "{{expandenv \"$PREVIEW_TEST_SECRET\"}}"}`, http.StatusBadRequest, "not defined"},
+		{"getHostByName", roleOperator, `{` + payload + `, "title": "{{getHostByName \"example.com\"}}"}`, http.StatusBadRequest, "not defined"},
+		{"template error", roleOperator, `{` + payload + `, "template": "{{.Missing.Field}}"}`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/preview", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+token(tt.role))
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("body = %s, want it to contain %q", rec.Body, tt.want)
+			}
+			if strings.Contains(rec.Body.String(), "leaked") {
+				t.Errorf("body = %s, leaks the environment", rec.Body)
+			}
+		})
+	}
+}
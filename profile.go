@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// applyProfile merges the profile called name from the profiles section of
+// the config file over the rest of the file, then drops the section. Maps
+// are merged key by key; lists and plain values in the profile replace the
+// base value. Without a name only the base settings are used. It reports
+// whether the file had a profiles section.
+func applyProfile(doc *yaml.Node, name string) (bool, error) {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return false, nil
+	}
+	root := doc.Content[0]
+
+	var profiles *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "profiles" {
+			profiles = root.Content[i+1]
+			root.Content = append(root.Content[:i], root.Content[i+2:]...)
+			break
+		}
+	}
+	// APP_ENV is often set for other reasons, so files without profiles
+	// ignore it
+	if profiles == nil {
+		return false, nil
+	}
+	if profiles.Kind != yaml.MappingNode {
+		return false, fmt.Errorf("line %d: profiles must map profile names to settings", profiles.Line)
+	}
+
+	var names []string
+	var selected *yaml.Node
+	for i := 0; i+1 < len(profiles.Content); i += 2 {
+		profileName, profile := profiles.Content[i].Value, profiles.Content[i+1]
+		// Every profile is checked, not just the one in use, so a typo in
+		// the prod profile fails in dev too
+		if err := checkProfile(profile); err != nil {
+			return false, fmt.Errorf("profile %q: %w", profileName, err)
+		}
+		if profileName == name {
+			selected = profile
+		}
+		names = append(names, profileName)
+	}
+
+	if name == "" {
+		return true, nil
+	}
+	if selected == nil {
+		sort.Strings(names)
+		return false, fmt.Errorf("profile %q is not defined, expected one of %v", name, names)
+	}
+	mergeNodes(root, selected)
+	return true, nil
+}
+
+// checkProfile rejects unknown keys in a profile the way the config file's
+// own keys are rejected
+func checkProfile(profile *yaml.Node) error {
+	if profile.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: a profile must be a map of settings", profile.Line)
+	}
+	for i := 0; i < len(profile.Content); i += 2 {
+		if profile.Content[i].Value == "profiles" {
+			return fmt.Errorf("line %d: profiles can't be nested", profile.Content[i].Line)
+		}
+	}
+
+	content, err := yaml.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	return decoder.Decode(&Config{})
+}
+
+// mergeNodes merges the mapping over into base
+func mergeNodes(base, over *yaml.Node) {
+	for i := 0; i+1 < len(over.Content); i += 2 {
+		key, value := over.Content[i], over.Content[i+1]
+
+		merged := false
+		for j := 0; j+1 < len(base.Content); j += 2 {
+			if base.Content[j].Value != key.Value {
+				continue
+			}
+			if value.Kind == yaml.MappingNode && base.Content[j+1].Kind == yaml.MappingNode {
+				mergeNodes(base.Content[j+1], value)
+			} else {
+				base.Content[j+1] = value
+			}
+			merged = true
+			break
+		}
+		if !merged {
+			base.Content = append(base.Content, key, value)
+		}
+	}
+}
@@ -0,0 +1,576 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Defaults of the outbound queue. With the backoff capped at
+// maxRetryBackoff, 20 attempts keep trying for about an hour.
+const (
+	defaultQueueWorkers     = 4
+	defaultQueueMaxAttempts = 20
+)
+
+// queueBucket is the bbolt bucket queued deliveries are kept in
+var queueBucket = []byte("outbound")
+
+// QueueConfig keeps outbound notifications in an embedded database at Path
+// until they are delivered, so they survive restarts and destination
+// outages. Workers deliver them, retrying failed deliveries with
+// exponential backoff up to MaxAttempts times.
+type QueueConfig struct {
+	Path        string `yaml:"path"`
+	Workers     int    `yaml:"workers"`
+	MaxAttempts int    `yaml:"max_attempts"`
+}
+
+func (c *QueueConfig) compile() error {
+	if c.Workers < 0 {
+		return fmt.Errorf("invalid QUEUE_WORKERS value: %d", c.Workers)
+	}
+	if c.MaxAttempts < 0 {
+		return fmt.Errorf("invalid QUEUE_MAX_ATTEMPTS value: %d", c.MaxAttempts)
+	}
+	if c.Workers == 0 {
+		c.Workers = defaultQueueWorkers
+	}
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = defaultQueueMaxAttempts
+	}
+	return nil
+}
+
+// queuedDelivery is the delivery of one event to the destination with the
+// ID Destination. The source's payload is kept beside the event, which
+// leaves it out of JSON, along with the name of its type.
+type queuedDelivery struct {
+	Destination string          `json:"destination"`
+	Build       BuildEvent      `json:"build"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	PayloadType string          `json:"payload_type,omitempty"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	Enqueued    time.Time       `json:"enqueued"`
+}
+
+// outboundQueue is the persistent queue of deliveries. Deliveries are
+// sealed with the config encryption key when one is set, as events may
+// carry build parameters.
+type outboundQueue struct {
+	db          *bolt.DB
+	box         *secretBox
+	path        string
+	maxAttempts int
+	wake        chan struct{}
+	stop        chan struct{}
+	workers     sync.WaitGroup
+
+	// due indexes the deliveries no worker has claimed by when they are
+	// due. Only the first delivery of each line, the deliveries of a job to
+	// a destination, is in it; the later ones wait in their line until it
+	// is done, so the events of a job are delivered in order.
+	mu    sync.Mutex
+	due   dueDeliveries
+	lines map[string][]dueDelivery
+
+	// records tracks the deliveries queued since the process started
+	recordsMu sync.Mutex
+	records   map[uint64]*deliveryRecord
+}
+
+// openQueue opens the queue database, creating it when it doesn't exist,
+// and indexes the deliveries in it. Deliveries that can't be read, such as
+// ones sealed with another key, are dropped.
+func openQueue(cfg QueueConfig, encryption EncryptionConfig) (*outboundQueue, error) {
+	db, err := bolt.Open(cfg.Path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening queue %s: %w", cfg.Path, err)
+	}
+
+	q := &outboundQueue{
+		db:          db,
+		path:        cfg.Path,
+		maxAttempts: cfg.MaxAttempts,
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		lines:       make(map[string][]dueDelivery),
+		records:     make(map[uint64]*deliveryRecord),
+	}
+	if encryption.enabled() {
+		if q.box, err = encryption.box(); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(queueBucket)
+		if err != nil {
+			return err
+		}
+		var unreadable [][]byte
+		err = bucket.ForEach(func(k, v []byte) error {
+			id := binary.BigEndian.Uint64(k)
+			delivery, err := q.decode(v)
+			if err != nil {
+				log.Printf("Dropping unreadable queued delivery %d: %v", id, err)
+				unreadable = append(unreadable, append([]byte(nil), k...))
+				return nil
+			}
+			q.schedule(dueDelivery{id: id, next: delivery.NextAttempt, line: delivery.line()})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range unreadable {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error opening queue %s: %w", cfg.Path, err)
+	}
+	return q, nil
+}
+
+// queuePath is the path of the queue database, if there is one
+func (q *outboundQueue) queuePath() string {
+	if q == nil {
+		return ""
+	}
+	return q.path
+}
+
+// start runs the workers, which deliver to the current destinations
+func (q *outboundQueue) start(workers int, destinations func() []Destination) {
+	if pending := q.pending(); pending > 0 {
+		log.Printf("Resuming %d queued deliveries", pending)
+	}
+	for i := 0; i < workers; i++ {
+		q.workers.Add(1)
+		go q.work(destinations)
+	}
+}
+
+// close stops the workers once their current deliveries are done and
+// closes the database. When ctx is done first the workers are still waited
+// for, as they update the database after each delivery. What is left stays
+// queued for the next start.
+func (q *outboundQueue) close(ctx context.Context) {
+	if q == nil {
+		return
+	}
+	close(q.stop)
+	done := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Shutdown timed out, waiting for the current queued deliveries to end")
+		<-done
+	}
+	if pending := q.pending(); pending > 0 {
+		log.Printf("Keeping %d queued deliveries for the next start", pending)
+	}
+	if err := q.db.Close(); err != nil {
+		log.Printf("Error closing queue: %v", err)
+	}
+}
+
+// enqueue queues the event for every destination. A destination it can't
+// be queued for is sent the event directly.
+func (q *outboundQueue) enqueue(destinations []Destination, build BuildEvent) []deliveryResult {
+	results := make([]deliveryResult, len(destinations))
+	var direct []Destination
+	var directIndex []int
+	for i, d := range destinations {
+		record := deliveries.start(build, d.ID(), "queued")
+		if err := q.add(d.ID(), build, record); err != nil {
+			log.Printf("Error queueing delivery to %s, sending it directly: %v", d.ID(), err)
+			deliveries.attempt(record, time.Now(), fmt.Errorf("error queueing: %w", err))
+			direct = append(direct, d)
+			directIndex = append(directIndex, i)
+			continue
+		}
+		results[i] = deliveryResult{Destination: d.ID(), Status: "queued"}
+	}
+	if len(direct) > 0 {
+		for i, result := range notify(direct, build) {
+			results[directIndex[i]] = result
+		}
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return results
+}
+
+func (q *outboundQueue) add(destination string, build BuildEvent, record *deliveryRecord) error {
+	delivery := queuedDelivery{Destination: destination, Build: build, Enqueued: time.Now()}
+	if build.Payload != nil {
+		payload, err := json.Marshal(build.Payload)
+		if err != nil {
+			return fmt.Errorf("error marshaling payload: %w", err)
+		}
+		delivery.Payload = payload
+		delivery.PayloadType = reflect.TypeOf(build.Payload).String()
+	}
+	delivery.NextAttempt = delivery.Enqueued
+
+	var id uint64
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(queueBucket)
+		var err error
+		if id, err = bucket.NextSequence(); err != nil {
+			return err
+		}
+		return q.put(bucket, id, delivery)
+	})
+	if err != nil {
+		return err
+	}
+	q.setRecord(id, record)
+	q.schedule(dueDelivery{id: id, next: delivery.NextAttempt, line: delivery.line()})
+	return nil
+}
+
+// line names the line of the delivery: its destination and job
+func (d queuedDelivery) line() string {
+	return d.Destination + "/" + d.Build.Source + "/" + d.Build.ProjectName
+}
+
+// schedule puts the delivery at the end of its line, making it due at its
+// next time when the line was empty
+func (q *outboundQueue) schedule(entry dueDelivery) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	line := q.lines[entry.line]
+	q.lines[entry.line] = append(line, entry)
+	if len(line) == 0 {
+		heap.Push(&q.due, entry)
+	}
+}
+
+// retry makes the claimed first delivery of a line due again at next
+func (q *outboundQueue) retry(entry dueDelivery, next time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entry.next = next
+	q.lines[entry.line][0] = entry
+	heap.Push(&q.due, entry)
+}
+
+// advance drops the claimed first delivery of a line once it is done,
+// making the next one in the line due
+func (q *outboundQueue) advance(entry dueDelivery) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	line := q.lines[entry.line][1:]
+	if len(line) == 0 {
+		delete(q.lines, entry.line)
+		return
+	}
+	q.lines[entry.line] = line
+	heap.Push(&q.due, line[0])
+}
+
+func (q *outboundQueue) put(bucket *bolt.Bucket, id uint64, delivery queuedDelivery) error {
+	value, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("error marshaling delivery: %w", err)
+	}
+	if q.box != nil {
+		sealed, err := q.box.seal(string(value))
+		if err != nil {
+			return err
+		}
+		value = []byte(sealed)
+	}
+	return bucket.Put(queueKey(id), value)
+}
+
+func (q *outboundQueue) decode(value []byte) (queuedDelivery, error) {
+	var delivery queuedDelivery
+	if q.box != nil {
+		opened, err := q.box.open(string(value))
+		if err != nil {
+			return delivery, err
+		}
+		value = []byte(opened)
+	}
+	err := json.Unmarshal(value, &delivery)
+	return delivery, err
+}
+
+// queueKey orders deliveries by the sequence numbers they were queued with
+func queueKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// pending counts the queued deliveries
+func (q *outboundQueue) pending() int {
+	count := 0
+	q.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(queueBucket).Stats().KeyN
+		return nil
+	})
+	return count
+}
+
+// claim takes the delivery that is due first off the index, so no other
+// worker takes it, and reads it. Until it is done its line has no
+// delivery in the index. Deliveries that can't be read are dropped.
+func (q *outboundQueue) claim() (dueDelivery, queuedDelivery, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.due) == 0 || q.due[0].next.After(time.Now()) {
+			q.mu.Unlock()
+			return dueDelivery{}, queuedDelivery{}, false
+		}
+		entry := heap.Pop(&q.due).(dueDelivery)
+		q.mu.Unlock()
+
+		var value []byte
+		q.db.View(func(tx *bolt.Tx) error {
+			value = append([]byte(nil), tx.Bucket(queueBucket).Get(queueKey(entry.id))...)
+			return nil
+		})
+		if len(value) == 0 {
+			q.advance(entry)
+			continue
+		}
+		delivery, err := q.decode(value)
+		if err != nil {
+			log.Printf("Dropping unreadable queued delivery %d: %v", entry.id, err)
+			q.remove(entry, delivery)
+			continue
+		}
+		return entry, delivery, true
+	}
+}
+
+// work delivers queued deliveries until the queue is closed, waiting for
+// new ones or a second when none are due
+func (q *outboundQueue) work(destinations func() []Destination) {
+	defer q.workers.Done()
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+		entry, delivery, ok := q.claim()
+		if !ok {
+			select {
+			case <-q.stop:
+				return
+			case <-q.wake:
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		q.deliver(entry, delivery, destinations())
+	}
+}
+
+// deliver sends a claimed delivery, removing it from the queue once it is
+// delivered or given up on, and scheduling its next attempt otherwise
+func (q *outboundQueue) deliver(entry dueDelivery, delivery queuedDelivery, destinations []Destination) {
+	record := q.record(entry.id)
+	if record == nil {
+		// Queued before the process started
+		record = deliveries.start(delivery.Build, delivery.Destination, "queued")
+		q.setRecord(entry.id, record)
+	}
+	var destination Destination
+	for _, d := range destinations {
+		if d.ID() == delivery.Destination {
+			destination = d
+			break
+		}
+	}
+
+	build := delivery.Build
+	build.queued = true
+	if len(delivery.Payload) > 0 {
+		payload, err := restorePayload(delivery.PayloadType, delivery.Payload)
+		if err != nil {
+			log.Printf("Error restoring the payload of queued delivery %d: %v", entry.id, err)
+		}
+		build.Payload = payload
+	}
+
+	if destination == nil {
+		log.Printf("Dropping queued delivery to %s, which is no longer configured", delivery.Destination)
+		q.remove(entry, delivery)
+		return
+	}
+
+	err := send(destination, build, record)
+	if errors.Is(err, errCircuitOpen) {
+		// The destination wasn't tried, so this isn't an attempt
+		deliveries.setStatus(record, "queued")
+		delivery.NextAttempt = destinationBreakers.probeAt(circuitName(destination, build))
+		q.reschedule(entry, delivery)
+		return
+	}
+	delivery.Attempts++
+	switch {
+	case err == nil:
+		if delivery.Attempts > 1 {
+			log.Printf("Delivered to %s on attempt %d", delivery.Destination, delivery.Attempts)
+		}
+	case permanent(err) || delivery.Attempts >= q.maxAttempts:
+		log.Printf("Giving up on delivering to %s after %d attempts: %v", delivery.Destination, delivery.Attempts, err)
+	default:
+		log.Printf("Attempt %d of %d to %s failed: %v", delivery.Attempts, q.maxAttempts, delivery.Destination, err)
+		deliveries.setStatus(record, "queued")
+		delivery.NextAttempt = time.Now().Add(retryWait(err, defaultRetryBackoff, delivery.Attempts))
+		q.reschedule(entry, delivery)
+		return
+	}
+	q.remove(entry, delivery)
+}
+
+// payloadTypes are the types the sources parse their payloads into, by
+// name, so queued payloads are restored as the type templates such as
+// {{.Payload.BuildUrl}} were written for
+var payloadTypes = typesByName(
+	AlertmanagerAlert{}, ArgoCDWebhook{}, ArtifactoryWebhook{}, AzureDevOpsWebhook{},
+	BitbucketWebhook{}, BuildkiteWebhook{}, CircleCIWebhook{}, DroneWebhook{},
+	GiteaWebhook{}, GitLabWebhook{}, HarborWebhook{}, JenkinsWebhook{},
+	JenkinsNotification{}, NexusWebhook{}, SonarQubeWebhook{}, SpinnakerEvent{},
+	TeamCityBuild{}, TektonEventData{}, TravisWebhook{}, WoodpeckerWebhook{},
+)
+
+func typesByName(values ...interface{}) map[string]reflect.Type {
+	types := make(map[string]reflect.Type, len(values))
+	for _, value := range values {
+		t := reflect.TypeOf(value)
+		types[t.String()] = t
+	}
+	return types
+}
+
+// restorePayload decodes a queued payload into the type it was queued as,
+// or into maps and slices when that type isn't known, as for deliveries
+// queued before types were recorded
+func restorePayload(typeName string, data json.RawMessage) (interface{}, error) {
+	t, ok := payloadTypes[typeName]
+	if !ok {
+		var payload interface{}
+		err := json.Unmarshal(data, &payload)
+		return payload, err
+	}
+	payload := reflect.New(t)
+	if err := json.Unmarshal(data, payload.Interface()); err != nil {
+		return nil, err
+	}
+	return payload.Elem().Interface(), nil
+}
+
+// reschedule saves the delivery for its next attempt, which the later
+// deliveries of its line wait for
+func (q *outboundQueue) reschedule(entry dueDelivery, delivery queuedDelivery) {
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		return q.put(tx.Bucket(queueBucket), entry.id, delivery)
+	})
+	if err != nil {
+		log.Printf("Error updating queued delivery to %s: %v", delivery.Destination, err)
+	}
+	q.retry(entry, delivery.NextAttempt)
+}
+
+// remove drops a claimed delivery, letting the next one of its line go
+func (q *outboundQueue) remove(entry dueDelivery, delivery queuedDelivery) {
+	q.setRecord(entry.id, nil)
+
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(queueBucket).Delete(queueKey(entry.id))
+	})
+	if err != nil {
+		log.Printf("Error removing queued delivery to %s: %v", delivery.Destination, err)
+	}
+	q.advance(entry)
+}
+
+// permanent reports whether a failed delivery would fail again the same
+// way: when the destination rejected the request itself. Other errors, of
+// HTTP and other protocols alike, are retried.
+func permanent(err error) bool {
+	var statusErr statusError
+	return errors.As(err, &statusErr) && statusErr.status >= 400 && statusErr.status < 500 &&
+		statusErr.status != http.StatusTooManyRequests && statusErr.status != http.StatusRequestTimeout
+}
+
+func (q *outboundQueue) record(id uint64) *deliveryRecord {
+	q.recordsMu.Lock()
+	defer q.recordsMu.Unlock()
+	return q.records[id]
+}
+
+// setRecord tracks the delivery with the given ID in record, or stops
+// tracking it when record is nil
+func (q *outboundQueue) setRecord(id uint64, record *deliveryRecord) {
+	q.recordsMu.Lock()
+	defer q.recordsMu.Unlock()
+	if record == nil {
+		delete(q.records, id)
+		return
+	}
+	q.records[id] = record
+}
+
+// dueDelivery is a delivery in the index of the queue
+type dueDelivery struct {
+	id   uint64
+	next time.Time
+	line string
+}
+
+// dueDeliveries is a heap of deliveries ordered by when they are due, then
+// by the order they were queued in
+type dueDeliveries []dueDelivery
+
+func (h dueDeliveries) Len() int { return len(h) }
+
+func (h dueDeliveries) Less(i, j int) bool {
+	if !h[i].next.Equal(h[j].next) {
+		return h[i].next.Before(h[j].next)
+	}
+	return h[i].id < h[j].id
+}
+
+func (h dueDeliveries) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *dueDeliveries) Push(x interface{}) { *h = append(*h, x.(dueDelivery)) }
+
+func (h *dueDeliveries) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openTestQueue opens a queue in a temporary directory, closed when the
+// test ends
+func openTestQueue(t *testing.T, cfg QueueConfig) *outboundQueue {
+	t.Helper()
+	cfg.Path = filepath.Join(t.TempDir(), "queue.db")
+	if err := cfg.compile(); err != nil {
+		t.Fatal(err)
+	}
+	q, err := openQueue(cfg, EncryptionConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.close(context.Background()) })
+	return q
+}
+
+func TestQueueDeliversToEachDestination(t *testing.T) {
+	first, second := newTestDestination("discord-00000001"), newTestDestination("discord-00000002")
+	destinations := []Destination{first, second}
+	q := openTestQueue(t, QueueConfig{})
+	q.start(2, func() []Destination { return destinations })
+
+	for _, result := range q.enqueue(destinations, BuildEvent{Source: "jenkins", ProjectName: "app", BuildName: "#1", Event: "success"}) {
+		if result.Status != "queued" {
+			t.Errorf("%s status = %s, want queued", result.Destination, result.Status)
+		}
+	}
+	for _, d := range destinations {
+		if builds := d.(*testDestination).waitFor(t, 1); builds[0].ProjectName != "app" {
+			t.Errorf("%s got %+v", d.ID(), builds[0])
+		}
+	}
+}
+
+func TestQueueDeliversJobsInOrder(t *testing.T) {
+	d := newTestDestination("ordered")
+	var once sync.Once
+	d.fail = func(build BuildEvent) error {
+		// The started event of app fails once, so it is retried after a
+		// backoff
+		var err error
+		if build.ProjectName == "app" && build.Event == "started" {
+			once.Do(func() { err = statusError{status: http.StatusServiceUnavailable} })
+		}
+		return err
+	}
+	destinations := []Destination{d}
+	q := openTestQueue(t, QueueConfig{})
+	q.start(4, func() []Destination { return destinations })
+
+	q.enqueue(destinations, BuildEvent{Source: "jenkins", ProjectName: "app", BuildName: "#1", Event: "started"})
+	q.enqueue(destinations, BuildEvent{Source: "jenkins", ProjectName: "app", BuildName: "#1", Event: "success"})
+	q.enqueue(destinations, BuildEvent{Source: "jenkins", ProjectName: "other", BuildName: "#1", Event: "success"})
+
+	builds := d.waitFor(t, 3)
+	if builds[0].ProjectName != "other" {
+		t.Errorf("first delivery is %s %s, want the other job's, which doesn't wait for app", builds[0].ProjectName, builds[0].Event)
+	}
+	var events []string
+	for _, build := range builds {
+		if build.ProjectName == "app" {
+			events = append(events, build.Event)
+		}
+	}
+	if len(events) != 2 || events[0] != "started" || events[1] != "success" {
+		t.Errorf("app events were delivered as %v, want [started success]", events)
+	}
+}
+
+func TestQueueResumesAfterRestart(t *testing.T) {
+	cfg := QueueConfig{Path: filepath.Join(t.TempDir(), "queue.db")}
+	if err := cfg.compile(); err != nil {
+		t.Fatal(err)
+	}
+	d := newTestDestination("resumed")
+	destinations := []Destination{d}
+
+	q, err := openQueue(cfg, EncryptionConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.enqueue(destinations, BuildEvent{Source: "jenkins", ProjectName: "app", BuildName: "#1", Event: "started"})
+	q.enqueue(destinations, BuildEvent{Source: "jenkins", ProjectName: "app", BuildName: "#1", Event: "failure"})
+	q.close(context.Background())
+
+	q, err = openQueue(cfg, EncryptionConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.close(context.Background())
+	if pending := q.pending(); pending != 2 {
+		t.Fatalf("pending() = %d after the restart, want 2", pending)
+	}
+	q.start(4, func() []Destination { return destinations })
+	builds := d.waitFor(t, 2)
+	if builds[0].Event != "started" || builds[1].Event != "failure" {
+		t.Errorf("events were delivered as %s, %s, want started, failure", builds[0].Event, builds[1].Event)
+	}
+}
+
+func TestQueueRestoresPayloads(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload interface{}
+	}{
+		{"Jenkins webhook", JenkinsWebhook{ProjectName: "app", BuildName: "#1", BuildUrl: "https://jenkins.example.com/job/app/1/", Event: "success"}},
+		{"Jenkins notification", JenkinsNotification{Name: "app", Build: &JenkinsNotificationBuild{Number: 1, Phase: "COMPLETED", Status: "FAILURE", Parameters: map[string]string{"BRANCH": "main"}}}},
+		{"GitLab", GitLabWebhook{ObjectKind: "pipeline", Project: &GitLabProject{}, BuildDuration: 12.5}},
+		{"Alertmanager", AlertmanagerAlert{Status: "firing", Labels: map[string]string{"alertname": "Down"}, StartsAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := openTestQueue(t, QueueConfig{})
+			if err := q.add("test", BuildEvent{Source: "jenkins", ProjectName: "app", Payload: tt.payload}, nil); err != nil {
+				t.Fatal(err)
+			}
+			_, delivery, ok := q.claim()
+			if !ok {
+				t.Fatal("claim() found no delivery")
+			}
+			payload, err := restorePayload(delivery.PayloadType, delivery.Payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(payload, tt.payload) {
+				t.Errorf("restored payload = %#v, want %#v", payload, tt.payload)
+			}
+		})
+	}
+}
+
+func TestRestorePayloadOfUnknownType(t *testing.T) {
+	payload, err := restorePayload("", []byte(`{"buildUrl": "https://jenkins.example.com/job/app/1/"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"buildUrl": "https://jenkins.example.com/job/app/1/"}; !reflect.DeepEqual(payload, want) {
+		t.Errorf("restorePayload() = %#v, want %#v", payload, want)
+	}
+}
+
+func TestQueuedGenericTemplateUsesPayload(t *testing.T) {
+	bodies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer server.Close()
+
+	cfg := GenericConfig{URL: server.URL, Template: `{{.Payload.BuildUrl}}`}
+	tmpl, err := parseGenericTemplate(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	generic := &genericDestination{httpSender: httpSender{client: server.Client()}, cfg: cfg, template: tmpl}
+	generic.setID("generic-queued")
+	destinations := []Destination{generic}
+	q := openTestQueue(t, QueueConfig{})
+	q.start(1, func() []Destination { return destinations })
+
+	payload := JenkinsWebhook{ProjectName: "app", BuildName: "#1", BuildUrl: "https://jenkins.example.com/job/app/1/", Event: "success"}
+	q.enqueue(destinations, payload.toBuildEvent())
+	select {
+	case body := <-bodies:
+		if body != payload.BuildUrl {
+			t.Errorf("body = %q, want %q", body, payload.BuildUrl)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the queued delivery wasn't sent")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitConfig limits how often webhooks are accepted, as token buckets
+// refilled at the given number of requests per minute. PerIP limits each
+// client address and PerJob the notifications of each job, so a job stuck
+// retriggering itself can't flood the destinations. Burst is the size of
+// the buckets, defaulting to the per-minute rate.
+type RateLimitConfig struct {
+	PerIP  int `yaml:"per_ip"`
+	PerJob int `yaml:"per_job"`
+	Burst  int `yaml:"burst"`
+}
+
+func (c RateLimitConfig) validate() error {
+	if c.PerIP < 0 || c.PerJob < 0 || c.Burst < 0 {
+		return fmt.Errorf("rate limits must not be negative")
+	}
+	return nil
+}
+
+// burst returns the bucket size for a limit of perMinute
+func (c RateLimitConfig) burst(perMinute int) int {
+	if c.Burst > 0 {
+		return c.Burst
+	}
+	return perMinute
+}
+
+// rateLimiters holds a token bucket per key. They outlive config reloads
+// so a reload doesn't hand every client a full bucket.
+type rateLimiters struct {
+	mu      sync.Mutex
+	buckets map[string]*rate.Limiter
+	swept   time.Time
+}
+
+func newRateLimiters() *rateLimiters {
+	return &rateLimiters{buckets: make(map[string]*rate.Limiter)}
+}
+
+// allow takes a token from the bucket of key, filled at perMinute tokens a
+// minute up to burst. A perMinute of zero allows everything.
+func (r *rateLimiters) allow(key string, perMinute, burst int) bool {
+	if perMinute <= 0 {
+		return true
+	}
+	limit := rate.Limit(float64(perMinute) / 60)
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sweep(now)
+	bucket, ok := r.buckets[key]
+	if !ok {
+		bucket = rate.NewLimiter(limit, burst)
+		r.buckets[key] = bucket
+	} else if bucket.Limit() != limit || bucket.Burst() != burst {
+		// The limits were changed by a reload
+		bucket.SetLimitAt(now, limit)
+		bucket.SetBurstAt(now, burst)
+	}
+	return bucket.AllowN(now, 1)
+}
+
+// sweep drops the buckets that have filled up again, which behave like new
+// ones, so clients and jobs that stopped sending don't use memory forever
+func (r *rateLimiters) sweep(now time.Time) {
+	if now.Sub(r.swept) < time.Minute {
+		return
+	}
+	r.swept = now
+	for key, bucket := range r.buckets {
+		if bucket.TokensAt(now) >= float64(bucket.Burst()) {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+// limitByIP rejects webhooks from client addresses over the per-IP rate
+// limit before their body is read
+func (w *WebhookHandler) limitByIP(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		state := w.state.Load()
+		limits := state.rateLimit
+		client := state.allowlist.client(c.Request())
+		if !w.ipLimits.allow(client, limits.PerIP, limits.burst(limits.PerIP)) {
+			log.Printf("Rejected webhook from %s: rate limit exceeded", client)
+			auditRequest(c).Outcome = "rate_limited"
+			c.Response().Header().Set("Retry-After", "60")
+			return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Rate limit exceeded"})
+		}
+		return next(c)
+	}
+}
+
+// allowJob applies the per-job rate limit to a build's notification
+func (w *WebhookHandler) allowJob(limits RateLimitConfig, build BuildEvent) bool {
+	return w.jobLimits.allow(build.Source+"/"+build.ProjectName, limits.PerJob, limits.burst(limits.PerJob))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Reload rebuilds the destinations and sources from config and swaps them
+// in. Requests already being handled finish with the state they started with.
+func (w *WebhookHandler) Reload(config *Config) error {
+	destinations, err := buildDestinations(config, w.client)
+	if err != nil {
+		return err
+	}
+
+	sources, err := buildSources(config, w.client)
+	if err != nil {
+		return err
+	}
+
+	if err := w.audit.configure(config.Audit); err != nil {
+		return err
+	}
+	logRedactor.update(config)
+	destinationBreakers.configure(config.Breaker)
+	if old := w.state.Load(); old != nil {
+		carryOverIncidents(old.destinations, destinations)
+	}
+	w.state.Store(&handlerState{
+		destinations:  destinations,
+		sources:       sources,
+		notifications: config.Notifications,
+		jobs:          config.Jobs,
+		classifiers:   config.Classifiers,
+		auth:          config.Auth,
+		allowlist:     config.Allowlist,
+		rateLimit:     config.RateLimit,
+		admin:         config.Admin,
+		maxBodySize:   config.maxBodyBytes,
+		replay:        config.Replay,
+		dedup:         config.Dedup,
+		discord:       config.Discord,
+		jenkins:       newJenkinsSource(config, w.client),
+	})
+	return nil
+}
+
+// reloadOnSignal reloads the config file at path whenever the process gets
+// SIGHUP. A config that fails to load is logged and the current one is kept.
+func (w *WebhookHandler) reloadOnSignal(path, port string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for range signals {
+			w.reloadConfig(path, port)
+		}
+	}()
+}
+
+// reloadConfig loads the config at path and swaps it in, reporting whether
+// it did. Errors are logged and leave the current config in place.
+func (w *WebhookHandler) reloadConfig(path, port string) bool {
+	config, err := loadConfig(path)
+	if err == nil {
+		err = w.Reload(config)
+	}
+	if err != nil {
+		log.Printf("Error reloading config, keeping the current one: %v", err)
+		return false
+	}
+
+	if config.Port != port {
+		log.Printf("PORT changed to %s, restart to listen on it", config.Port)
+	}
+	if config.Queue.Path != w.queue.queuePath() {
+		log.Printf("QUEUE_PATH changed, restart to use it")
+	}
+	if max(config.Delivery.Workers, 0) != w.workers.count() {
+		log.Printf("DELIVERY_WORKERS changed to %d, restart to use them", config.Delivery.Workers)
+	}
+	log.Printf("Reloaded config")
+	return true
+}
+
+// carryOverIncidents hands the open incidents of each PagerDuty destination
+// to its replacement with the same routing key, so builds fixed after a
+// reload still resolve the incidents raised before it
+func carryOverIncidents(old, replacements []Destination) {
+	incidents := make(map[string]*pagerDutyIncidents)
+	for _, d := range old {
+		if pd, ok := d.(*pagerDutyDestination); ok {
+			incidents[pd.cfg.RoutingKey] = pd.incidents
+		}
+	}
+
+	for _, d := range replacements {
+		if pd, ok := d.(*pagerDutyDestination); ok {
+			if open, ok := incidents[pd.cfg.RoutingKey]; ok {
+				pd.incidents = open
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// configClient fetches remote config files
+var configClient = &http.Client{Timeout: 30 * time.Second}
+
+// isRemoteConfig reports whether path is an http(s):// or s3:// URL rather
+// than a local file
+func isRemoteConfig(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") ||
+		strings.HasPrefix(path, "s3://")
+}
+
+// configDisplayName is path with any password in it masked, for logs and errors
+func configDisplayName(path string) string {
+	if u, err := url.Parse(path); err == nil && isRemoteConfig(path) {
+		return u.Redacted()
+	}
+	return path
+}
+
+// fetchConfig reads the config file at path: a local file, an http(s) URL,
+// an s3://bucket/key object or a key of a Kubernetes ConfigMap or Secret. For remote files etag is sent as
+// If-None-Match, and changed is false when the server answers that the file
+// is unchanged. The returned version identifies the content for the next call.
+func fetchConfig(path, etag string) (content []byte, version string, changed bool, err error) {
+	if isKubeConfig(path) {
+		content, version, err = fetchKubeConfig(path)
+		return content, version, err == nil && version != etag, err
+	}
+	if !isRemoteConfig(path) {
+		content, err = os.ReadFile(path)
+		if err != nil {
+			return nil, "", false, fmt.Errorf("error opening config file: %w", err)
+		}
+		return content, "", true, nil
+	}
+
+	req, err := newConfigRequest(path)
+	if err != nil {
+		return nil, "", false, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if strings.HasPrefix(path, "s3://") {
+		signS3Request(req)
+	}
+
+	resp, err := configClient.Do(req)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("error fetching config file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, etag, false, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", false, fmt.Errorf("error fetching config file: server returned status: %d", resp.StatusCode)
+	}
+
+	content, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	// Servers without ETags are compared by content instead
+	version = resp.Header.Get("ETag")
+	if version == "" {
+		version = sha256Hex(content)
+		if version == etag {
+			return nil, etag, false, nil
+		}
+	}
+	return content, version, true, nil
+}
+
+// newConfigRequest builds the GET request for a remote config file, turning
+// s3://bucket/key into the bucket's virtual-hosted URL in AWS_REGION
+func newConfigRequest(path string) (*http.Request, error) {
+	if strings.HasPrefix(path, "s3://") {
+		bucket, key, ok := strings.Cut(strings.TrimPrefix(path, "s3://"), "/")
+		if !ok || bucket == "" || key == "" {
+			return nil, fmt.Errorf("invalid config file URL %s: expected s3://bucket/key", path)
+		}
+		path = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, awsRegion(), key)
+	}
+
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file URL: %w", err)
+	}
+	return req, nil
+}
+
+// signS3Request signs a config file request with the AWS credentials from
+// the environment, as for SNS
+func signS3Request(req *http.Request) {
+	signAWSRequest(req, nil, envAWSCredentials(), awsRegion(), "s3", time.Now())
+}
+
+// envAWSCredentials returns the AWS credentials set in the environment, for
+// the AWS calls made before the config is loaded
+func envAWSCredentials() awsCredentials {
+	return awsCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+func awsRegion() string {
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return "us-east-1"
+}
+
+// watchRemoteConfig polls the remote config file at path every interval and
+// reloads when its ETag (or content) changes
+func (w *WebhookHandler) watchRemoteConfig(path, port string, interval time.Duration) {
+	_, version, _, err := fetchConfig(path, "")
+	if err != nil {
+		log.Printf("Error fetching config file %s: %v", configDisplayName(path), err)
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			_, latest, changed, err := fetchConfig(path, version)
+			if err != nil {
+				log.Printf("Error fetching config file %s: %v", configDisplayName(path), err)
+				continue
+			}
+			if !changed {
+				continue
+			}
+
+			if w.reloadConfig(path, port) {
+				version = latest
+			}
+		}
+	}()
+}
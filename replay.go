@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const defaultReplayTolerance = 5 * time.Minute
+
+// ReplayConfig rejects replayed deliveries of signed webhooks. A signed
+// request is remembered for Tolerance and rejected when it is sent again in
+// that time. Sources that sign the time a request was sent are also
+// rejected when that time is more than Tolerance away from now, so older
+// requests can't be replayed either.
+type ReplayConfig struct {
+	Disabled  bool   `yaml:"disabled"`
+	Tolerance string `yaml:"tolerance"`
+	tolerance time.Duration
+}
+
+func (c *ReplayConfig) compile() error {
+	if c.Tolerance == "" {
+		c.tolerance = defaultReplayTolerance
+		return nil
+	}
+	tolerance, err := time.ParseDuration(c.Tolerance)
+	if err != nil || tolerance <= 0 {
+		return fmt.Errorf("invalid REPLAY_TOLERANCE value: %s", c.Tolerance)
+	}
+	c.tolerance = tolerance
+	return nil
+}
+
+// signedSource is implemented by sources that can sign their requests
+type signedSource interface {
+	// signedAt reports whether the request is signed, which it is when
+	// the source has a secret configured, and returns the time the
+	// signature says it was sent, or zero when it doesn't cover one
+	signedAt(header http.Header) (time.Time, bool)
+}
+
+// checkReplay returns the nonce of a signed request, or "" for a request
+// that isn't signed, or an error when the request is too old or was seen
+// before. The nonce is a digest of what the signature covers, which a
+// replay can't change without breaking the signature.
+func (w *WebhookHandler) checkReplay(cfg ReplayConfig, src SourceAdapter, header http.Header, body []byte) (string, error) {
+	signed, ok := src.(signedSource)
+	if cfg.Disabled || !ok {
+		return "", nil
+	}
+	sentAt, ok := signed.signedAt(header)
+	if !ok {
+		return "", nil
+	}
+
+	if !sentAt.IsZero() {
+		if age := time.Since(sentAt); age > cfg.tolerance || age < -cfg.tolerance {
+			return "", fmt.Errorf("timestamp %s is outside the %s tolerance", sentAt.Format(time.RFC3339), cfg.tolerance)
+		}
+	}
+
+	digest := sha256.New()
+	digest.Write([]byte(src.Name() + "\n" + strconv.FormatInt(sentAt.Unix(), 10) + "\n"))
+	digest.Write(body)
+	nonce := hex.EncodeToString(digest.Sum(nil))
+	if !w.nonces.add(nonce, cfg.tolerance) {
+		return "", fmt.Errorf("replayed delivery")
+	}
+	return nonce, nil
+}
+
+// nonceCache remembers the nonces of recent requests until they expire
+type nonceCache struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	swept  time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{nonces: make(map[string]time.Time)}
+}
+
+// add records the nonce for ttl, reporting false when it is already known
+func (n *nonceCache) add(nonce string, ttl time.Duration) bool {
+	now := time.Now()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if now.Sub(n.swept) > time.Minute {
+		n.swept = now
+		for key, expires := range n.nonces {
+			if now.After(expires) {
+				delete(n.nonces, key)
+			}
+		}
+	}
+
+	if expires, ok := n.nonces[nonce]; ok && now.Before(expires) {
+		return false
+	}
+	n.nonces[nonce] = now.Add(ttl)
+	return true
+}
+
+// forget drops a nonce, so a delivery that failed can be retried
+func (n *nonceCache) forget(nonce string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.nonces, nonce)
+}
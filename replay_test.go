@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// timestampedSource signs the send time in the X-Timestamp header
+type timestampedSource struct{}
+
+func (s timestampedSource) Name() string                                    { return "timestamped" }
+func (s timestampedSource) Detect(header http.Header, body []byte) bool     { return true }
+func (s timestampedSource) Verify(req *http.Request, body []byte) error     { return nil }
+func (s timestampedSource) Parse(http.Header, []byte) ([]BuildEvent, error) { return nil, nil }
+
+func (s timestampedSource) signedAt(header http.Header) (time.Time, bool) {
+	seconds, err := strconv.ParseInt(header.Get("X-Timestamp"), 10, 64)
+	if err != nil {
+		return time.Time{}, true
+	}
+	return time.Unix(seconds, 0), true
+}
+
+func TestCheckReplay(t *testing.T) {
+	cfg := ReplayConfig{}
+	if err := cfg.compile(); err != nil {
+		t.Fatal(err)
+	}
+	at := func(t time.Time) http.Header {
+		return http.Header{"X-Timestamp": {strconv.FormatInt(t.Unix(), 10)}}
+	}
+	now := time.Now()
+	signed := circleciSource{cfg: CircleCIConfig{Secret: "secret"}}
+
+	type delivery struct {
+		src    SourceAdapter
+		header http.Header
+		body   string
+		ok     bool
+	}
+	tests := []struct {
+		name       string
+		cfg        ReplayConfig
+		deliveries []delivery
+	}{
+		{"replayed delivery", cfg, []delivery{
+			{signed, nil, "a", true},
+			{signed, nil, "a", false},
+		}},
+		{"different bodies", cfg, []delivery{
+			{signed, nil, "a", true},
+			{signed, nil, "b", true},
+		}},
+		{"same body from another source", cfg, []delivery{
+			{signed, nil, "a", true},
+			{timestampedSource{}, nil, "a", true},
+		}},
+		{"replayed timestamped delivery", cfg, []delivery{
+			{timestampedSource{}, at(now), "a", true},
+			{timestampedSource{}, at(now), "a", false},
+		}},
+		{"same body sent again later", cfg, []delivery{
+			{timestampedSource{}, at(now), "a", true},
+			{timestampedSource{}, at(now.Add(time.Second)), "a", true},
+		}},
+		{"stale timestamp", cfg, []delivery{
+			{timestampedSource{}, at(now.Add(-2 * cfg.tolerance)), "a", false},
+		}},
+		{"future timestamp", cfg, []delivery{
+			{timestampedSource{}, at(now.Add(2 * cfg.tolerance)), "a", false},
+		}},
+		{"unsigned source", cfg, []delivery{
+			{circleciSource{}, nil, "a", true},
+			{circleciSource{}, nil, "a", true},
+		}},
+		{"disabled", ReplayConfig{Disabled: true}, []delivery{
+			{signed, nil, "a", true},
+			{signed, nil, "a", true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &WebhookHandler{nonces: newNonceCache()}
+			for i, d := range tt.deliveries {
+				_, err := w.checkReplay(tt.cfg, d.src, d.header, []byte(d.body))
+				if ok := err == nil; ok != d.ok {
+					t.Errorf("delivery %d: checkReplay() error = %v, want ok %v", i, err, d.ok)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckReplayForget(t *testing.T) {
+	cfg := ReplayConfig{}
+	if err := cfg.compile(); err != nil {
+		t.Fatal(err)
+	}
+	w := &WebhookHandler{nonces: newNonceCache()}
+	src := circleciSource{cfg: CircleCIConfig{Secret: "secret"}}
+
+	nonce, err := w.checkReplay(cfg, src, nil, []byte("a"))
+	if err != nil || nonce == "" {
+		t.Fatalf("checkReplay() = %q, %v, want a nonce", nonce, err)
+	}
+	w.nonces.forget(nonce)
+	if _, err := w.checkReplay(cfg, src, nil, []byte("a")); err != nil {
+		t.Errorf("checkReplay() after forget error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// defaultRetryBackoff is the wait before the first retry, doubling with each
+// one up to maxRetryBackoff
+const (
+	defaultRetryBackoff = time.Second
+	maxRetryBackoff     = 5 * time.Minute
+)
+
+// retryingError is returned by destinations that keep retrying a failed
+// delivery in the background. The webhook is then answered with 202.
+type retryingError struct {
+	err error
+}
+
+func (e retryingError) Error() string {
+	return fmt.Sprintf("retrying after: %v", e.err)
+}
+
+func (e retryingError) Unwrap() error {
+	return e.err
+}
+
+// retryable reports whether a failed request may succeed when repeated:
+// when it didn't get a response, or got a rate limit or server error
+func retryable(err error) bool {
+	var statusErr statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.status == http.StatusTooManyRequests || statusErr.status >= 500
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// retryDelay is how long to wait before the given retry, counting from 1:
+// base doubled for each earlier retry, capped at maxRetryBackoff, of which
+// a random half is taken off so retries of many messages spread out
+func retryDelay(base time.Duration, retry int) time.Duration {
+	delay := base
+	for i := 1; i < retry && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retryWait is the retryDelay before the given retry, or longer when the
+// failed attempt was asked to wait longer
+func retryWait(err error, base time.Duration, retry int) time.Duration {
+	delay := retryDelay(base, retry)
+	var statusErr statusError
+	if errors.As(err, &statusErr) && statusErr.retryAfter > delay {
+		return statusErr.retryAfter
+	}
+	return delay
+}
+
+// retryInBackground repeats send up to retries times with exponential
+// backoff after sending build through the named circuit failed with err,
+// recording the retries in its delivery record and logging how it ends, and
+// returns the retryingError to report meanwhile. Retries go through the
+// circuit breaker, skipping the destination while the circuit is open.
+// Errors that can't be retried are returned as they are, as are those of
+// queued events, which the queue retries.
+func retryInBackground(circuit string, build BuildEvent, retries int, base time.Duration, err error, send func() error) error {
+	if retries <= 0 || build.queued || !retryable(err) || !backgroundRetries.add() {
+		return err
+	}
+	record := build.delivery
+	go func(lastErr error) {
+		defer backgroundRetries.wg.Done()
+		for retry := 1; retry <= retries; retry++ {
+			last := false
+			select {
+			case <-time.After(retryWait(lastErr, base, retry)):
+			case <-backgroundRetries.stop:
+				// Shutting down, so this retry is the last one
+				last = true
+			}
+			started := time.Now()
+			lastErr = destinationBreakers.call(circuit, send)
+			deliveries.attempt(record, started, lastErr)
+			if lastErr == nil {
+				log.Printf("Delivered to %s on retry %d", circuit, retry)
+				return
+			}
+			if last || !retryable(lastErr) && !errors.Is(lastErr, errCircuitOpen) {
+				break
+			}
+			log.Printf("Retry %d of %d to %s failed: %v", retry, retries, circuit, lastErr)
+			if retry < retries {
+				deliveries.setStatus(record, "retrying")
+			}
+		}
+		log.Printf("Giving up on delivering to %s: %v", circuit, lastErr)
+	}(err)
+	return retryingError{err: err}
+}
+
+// backgroundRetries tracks the deliveries retried in the background, so
+// shutdown can wait for them
+var backgroundRetries = &retryTracker{stop: make(chan struct{})}
+
+type retryTracker struct {
+	wg   sync.WaitGroup
+	stop chan struct{}
+
+	mu      sync.Mutex
+	stopped bool
+}
+
+// add counts a delivery about to be retried, reporting false once the
+// retries were drained
+func (t *retryTracker) add() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return false
+	}
+	t.wg.Add(1)
+	return true
+}
+
+// drain has the retried deliveries make their next retry right away, as
+// their last, and waits for them, or for ctx to be done
+func (t *retryTracker) drain(ctx context.Context) {
+	t.mu.Lock()
+	t.stopped = true
+	close(t.stop)
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Shutdown timed out waiting for retried deliveries")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// RocketChatConfig configures the Rocket.Chat destination
+type RocketChatConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
+	Channel    string `yaml:"channel"`
+}
+
+type rocketChatDestination struct {
+	destinationID
+	httpSender
+	cfg RocketChatConfig
+}
+
+func (d *rocketChatDestination) Name() string {
+	return "rocketchat"
+}
+
+func (d *rocketChatDestination) pingAddress() string {
+	return d.cfg.WebhookURL
+}
+
+func (d *rocketChatDestination) Send(build BuildEvent) error {
+	return d.sendToRocketChat(d.convertToRocketChatPayload(build))
+}
+
+// Rocket.Chat incoming webhook payload structures
+type RocketChatWebhook struct {
+	Text        string                 `json:"text,omitempty"`
+	Channel     string                 `json:"channel,omitempty"`
+	Attachments []RocketChatAttachment `json:"attachments,omitempty"`
+}
+
+type RocketChatAttachment struct {
+	Title     string                      `json:"title,omitempty"`
+	TitleLink string                      `json:"title_link,omitempty"`
+	Text      string                      `json:"text,omitempty"`
+	Color     string                      `json:"color,omitempty"`
+	Fields    []RocketChatAttachmentField `json:"fields,omitempty"`
+}
+
+type RocketChatAttachmentField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+func (d *rocketChatDestination) convertToRocketChatPayload(build BuildEvent) RocketChatWebhook {
+	title := fmt.Sprintf("%s - %s", build.ProjectName, build.BuildName)
+
+	fields := []RocketChatAttachmentField{
+		{Title: "Build", Value: build.BuildName, Short: true},
+		{Title: "Status", Value: build.StatusText(), Short: true},
+		{Title: "Project", Value: build.ProjectName, Short: true},
+	}
+
+	// Rocket.Chat renders the same markdown as Discord
+	if buildVarsFormatted := formatBuildVars(build.Vars); buildVarsFormatted != "" {
+		fields = append(fields, RocketChatAttachmentField{
+			Title: "Build Variables",
+			Value: buildVarsFormatted,
+			Short: false,
+		})
+	}
+
+	return RocketChatWebhook{
+		Text:    fmt.Sprintf("%s: %s", title, build.StatusText()),
+		Channel: d.cfg.Channel,
+		Attachments: []RocketChatAttachment{
+			{
+				Title:     title,
+				TitleLink: build.BuildURL,
+				Text:      fmt.Sprintf("Build %s", build.Event),
+				Color:     fmt.Sprintf("#%06X", build.EventColor()),
+				Fields:    fields,
+			},
+		},
+	}
+}
+
+func (d *rocketChatDestination) sendToRocketChat(payload RocketChatWebhook) error {
+	if err := d.postJSON(d.cfg.WebhookURL, payload, nil); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully sent webhook to Rocket.Chat")
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRocketChatSend(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel string
+	}{
+		{"webhook's channel", ""},
+		{"configured channel", "#builds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRecordingServer(t, http.StatusOK, `{"success":true}`)
+			d := &rocketChatDestination{httpSender: server.sender(), cfg: RocketChatConfig{WebhookURL: "https://chat.example.com/hooks/abc/def", Channel: tt.channel}}
+			build := testBuild("app", "failure")
+
+			if err := d.Send(build); err != nil {
+				t.Fatal(err)
+			}
+			var payload RocketChatWebhook
+			server.only(t).decode(t, &payload)
+			if payload.Channel != tt.channel {
+				t.Errorf("channel = %q, want %q", payload.Channel, tt.channel)
+			}
+			if want := "app - #0: " + build.StatusText(); payload.Text != want {
+				t.Errorf("text = %q, want %q", payload.Text, want)
+			}
+			if len(payload.Attachments) != 1 || payload.Attachments[0].Text != "Build failure" {
+				t.Errorf("attachments = %+v, want one naming the event", payload.Attachments)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// SCMContext is the branch, commit and pull request a build was made from
+type SCMContext struct {
+	Branch      string
+	Commit      string
+	PullRequest string
+	// RepoURL is the web URL of the repository, and PullRequestURL that of
+	// the pull request when the CI system knows it
+	RepoURL        string
+	PullRequestURL string
+}
+
+// Build parameters that name the branch, commit, pull request and
+// repository, checked in order. They are set by multibranch pipelines, the
+// Git plugin and the GitHub and GitLab pull request builders.
+var (
+	branchParameters      = []string{"CHANGE_BRANCH", "BRANCH_NAME", "GIT_BRANCH", "ghprbSourceBranch", "gitlabSourceBranch"}
+	commitParameters      = []string{"GIT_COMMIT", "ghprbActualCommit", "gitlabMergeRequestLastCommit"}
+	pullRequestParameters = []string{"CHANGE_ID", "ghprbPullId", "gitlabMergeRequestIid"}
+	pullRequestURLs       = []string{"CHANGE_URL", "ghprbPullLink"}
+	repoParameters        = []string{"GIT_URL", "gitlabSourceRepoHomepage"}
+)
+
+// multibranchPullRequest matches the jobs multibranch pipelines create for
+// pull and merge requests
+var multibranchPullRequest = regexp.MustCompile(`^(?:PR|MR)-(\d+)$`)
+
+// scmContext collects what the payload tells about the branch, commit and
+// pull request built, returning nil when it tells nothing
+func (n JenkinsNotification) scmContext() *SCMContext {
+	b := n.Build
+	scm := &SCMContext{
+		Branch:         firstParameter(b.Parameters, branchParameters),
+		Commit:         firstParameter(b.Parameters, commitParameters),
+		PullRequest:    firstParameter(b.Parameters, pullRequestParameters),
+		PullRequestURL: firstParameter(b.Parameters, pullRequestURLs),
+		RepoURL:        repoWebURL(firstParameter(b.Parameters, repoParameters)),
+	}
+	if b.SCM != nil {
+		if b.SCM.Branch != "" {
+			scm.Branch = b.SCM.Branch
+		}
+		if b.SCM.Commit != "" {
+			scm.Commit = b.SCM.Commit
+		}
+		if repo := repoWebURL(b.SCM.URL); repo != "" {
+			scm.RepoURL = repo
+		}
+	}
+	// The Git plugin names the remote along with the branch
+	scm.Branch = strings.TrimPrefix(scm.Branch, "origin/")
+
+	if scm.Commit == "" {
+		// The last change is the one built
+		for _, changeSet := range b.ChangeSets {
+			if items := changeSet.Items; len(items) > 0 {
+				scm.Commit = items[len(items)-1].CommitID
+			}
+		}
+	}
+	if scm.PullRequest == "" {
+		job := path.Base(strings.TrimSuffix(n.URL, "/"))
+		if n.URL == "" {
+			job = n.Name
+		}
+		if m := multibranchPullRequest.FindStringSubmatch(job); m != nil {
+			scm.PullRequest = m[1]
+		}
+	}
+
+	if *scm == (SCMContext{}) {
+		return nil
+	}
+	return scm
+}
+
+func firstParameter(parameters map[string]string, keys []string) string {
+	for _, key := range keys {
+		if value := parameters[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// scpLikeURL matches the user@host:path form of SSH Git URLs
+var scpLikeURL = regexp.MustCompile(`^[\w.-]+@([\w.-]+):(.+)$`)
+
+// repoWebURL turns a Git remote URL into the repository's web URL, or ""
+// when it isn't one. Credentials in the URL are dropped.
+func repoWebURL(remote string) string {
+	if m := scpLikeURL.FindStringSubmatch(remote); m != nil {
+		remote = "https://" + m[1] + "/" + m[2]
+	}
+	u, err := url.Parse(remote)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "ssh", "git":
+		u.Scheme = "https"
+		u.Host = u.Hostname()
+	default:
+		return ""
+	}
+	u.User = nil
+	u.RawQuery, u.Fragment = "", ""
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git")
+	u.RawPath = ""
+	return u.String()
+}
+
+// scmProvider returns gitlab, bitbucket or gitea for the repositories of
+// those and github for any other, whose URL layout most hosts share
+func (s SCMContext) scmProvider() string {
+	u, err := url.Parse(s.RepoURL)
+	if err != nil {
+		return "github"
+	}
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case strings.Contains(host, "gitlab"):
+		return "gitlab"
+	case host == "bitbucket.org":
+		return "bitbucket"
+	case strings.Contains(host, "gitea"), strings.Contains(host, "codeberg"):
+		return "gitea"
+	default:
+		return "github"
+	}
+}
+
+// BranchURL links the branch in the repository, or returns ""
+func (s SCMContext) BranchURL() string {
+	if s.RepoURL == "" || s.Branch == "" {
+		return ""
+	}
+	branch := escapePath(s.Branch)
+	switch s.scmProvider() {
+	case "gitlab":
+		return s.RepoURL + "/-/tree/" + branch
+	case "bitbucket":
+		return s.RepoURL + "/branch/" + branch
+	case "gitea":
+		return s.RepoURL + "/src/branch/" + branch
+	default:
+		return s.RepoURL + "/tree/" + branch
+	}
+}
+
+// CommitURL links the commit in the repository, or returns ""
+func (s SCMContext) CommitURL() string {
+	if s.RepoURL == "" || s.Commit == "" {
+		return ""
+	}
+	commit := url.PathEscape(s.Commit)
+	switch s.scmProvider() {
+	case "gitlab":
+		return s.RepoURL + "/-/commit/" + commit
+	case "bitbucket":
+		return s.RepoURL + "/commits/" + commit
+	default:
+		return s.RepoURL + "/commit/" + commit
+	}
+}
+
+// PullRequestLink links the pull request, or returns ""
+func (s SCMContext) PullRequestLink() string {
+	if s.PullRequestURL != "" || s.PullRequest == "" || s.RepoURL == "" {
+		return s.PullRequestURL
+	}
+	number := url.PathEscape(s.PullRequest)
+	switch s.scmProvider() {
+	case "gitlab":
+		return s.RepoURL + "/-/merge_requests/" + number
+	case "bitbucket":
+		return s.RepoURL + "/pull-requests/" + number
+	case "gitea":
+		return s.RepoURL + "/pulls/" + number
+	default:
+		return s.RepoURL + "/pull/" + number
+	}
+}
+
+// ShortCommit is the commit SHA cut to 8 characters
+func (s SCMContext) ShortCommit() string {
+	if len(s.Commit) > 8 {
+		return s.Commit[:8]
+	}
+	return s.Commit
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pathSettings are the settings whose value already is a file path, so their
+// _FILE suffix doesn't ask for the file to be read in their place
+var pathSettings = map[string]bool{
+	"GENERIC_WEBHOOK_TEMPLATE_FILE": true,
+	"template_file":                 true,
+	"TLS_CERT_FILE":                 true,
+	"TLS_KEY_FILE":                  true,
+	"TLS_CLIENT_CA_FILE":            true,
+	"ADMIN_JWT_PUBLIC_KEY_FILE":     true,
+	"cert_file":                     true,
+	"key_file":                      true,
+	"client_ca_file":                true,
+	"jwt_public_key_file":           true,
+}
+
+// environment looks settings up in the environment variables, reading
+// NAME from the file named by NAME_FILE when that is set instead, as Docker
+// and Kubernetes secrets are mounted. Files are read on every load, so
+// reloading picks up rotated secrets.
+type environment struct {
+	vars map[string]string
+	// err is the first secret file that could not be read
+	err error
+}
+
+func readEnvironment() *environment {
+	env := &environment{vars: map[string]string{}}
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		env.vars[key] = value
+	}
+	return env
+}
+
+// lookup returns the variable, or the contents of its secret file
+func (e *environment) lookup(key string) string {
+	fileKey := key + "_FILE"
+	path := e.vars[fileKey]
+	if path == "" || pathSettings[fileKey] {
+		return e.vars[key]
+	}
+	if e.vars[key] != "" {
+		e.fail(fmt.Errorf("only one of %s and %s may be set", key, fileKey))
+		return ""
+	}
+
+	secret, err := readSecretFile(path)
+	if err != nil {
+		e.fail(fmt.Errorf("invalid %s: %w", fileKey, err))
+		return ""
+	}
+	return secret
+}
+
+func (e *environment) fail(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+// or returns the variable when it is set, so the environment overrides the
+// config file
+func (e *environment) or(key, fallback string) string {
+	if value := e.lookup(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// list is or for comma-separated lists
+func (e *environment) list(key string, fallback []string) []string {
+	if value := e.lookup(key); value != "" {
+		return splitList(value)
+	}
+	return fallback
+}
+
+// resolveSecretFiles replaces every name_file key in the config file with
+// name set to the contents of the file it names, reporting whether there
+// were any
+func resolveSecretFiles(node *yaml.Node) (bool, error) {
+	resolved := false
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			ok, err := resolveSecretFiles(child)
+			if err != nil {
+				return false, err
+			}
+			resolved = resolved || ok
+		}
+		return resolved, nil
+	case yaml.MappingNode:
+	default:
+		return false, nil
+	}
+
+	keys := make(map[string]bool, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keys[node.Content[i].Value] = true
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		name, ok := strings.CutSuffix(key.Value, "_file")
+		if !ok || name == "" || pathSettings[key.Value] || value.Kind != yaml.ScalarNode {
+			ok, err := resolveSecretFiles(value)
+			if err != nil {
+				return false, err
+			}
+			resolved = resolved || ok
+			continue
+		}
+
+		if keys[name] {
+			return false, fmt.Errorf("line %d: only one of %s and %s may be set", key.Line, name, key.Value)
+		}
+		secret, err := readSecretFile(value.Value)
+		if err != nil {
+			return false, fmt.Errorf("line %d: invalid %s: %w", key.Line, key.Value, err)
+		}
+		key.Value = name
+		value.SetString(secret)
+		resolved = true
+	}
+	return resolved, nil
+}
+
+// readSecretFile reads a secret, dropping the trailing newline most editors
+// and `kubectl create secret --from-file` leave behind
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultSessionTTL = 8 * time.Hour
+
+	sessionCookie = "admin_session"
+	csrfHeader    = "X-CSRF-Token"
+
+	// sessionPath scopes the session cookie to both the /admin and the /api
+	// routes
+	sessionPath = "/"
+)
+
+// adminSession is a browser session of the admin API, started with a
+// bearer token. Requests authenticated by its cookie that change anything
+// must also send its CSRF token in the X-CSRF-Token header, which other
+// sites can't read.
+type adminSession struct {
+	csrfToken string
+	claims    jwt.MapClaims
+	expires   time.Time
+}
+
+// sessionStore keeps the admin sessions in memory, so a restart ends them
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]adminSession
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]adminSession)}
+}
+
+// create starts a session with the claims of a token, ending when the
+// token expires or after ttl, whichever is first
+func (s *sessionStore) create(claims jwt.MapClaims, ttl time.Duration) (string, adminSession, error) {
+	id, err := randomToken()
+	if err != nil {
+		return "", adminSession{}, err
+	}
+	csrfToken, err := randomToken()
+	if err != nil {
+		return "", adminSession{}, err
+	}
+
+	session := adminSession{csrfToken: csrfToken, claims: claims, expires: time.Now().Add(ttl)}
+	if exp, ok := claims["exp"].(float64); ok {
+		if tokenExpiry := time.Unix(int64(exp), 0); tokenExpiry.Before(session.expires) {
+			session.expires = tokenExpiry
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for key, existing := range s.sessions {
+		if now.After(existing.expires) {
+			delete(s.sessions, key)
+		}
+	}
+	s.sessions[id] = session
+	return id, session, nil
+}
+
+// get returns the session with the given ID, if it hasn't expired
+func (s *sessionStore) get(id string) (adminSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if ok && time.Now().After(session.expires) {
+		delete(s.sessions, id)
+		return adminSession{}, false
+	}
+	return session, ok
+}
+
+func (s *sessionStore) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// sessionClaims authenticates an admin request by its session cookie,
+// checking the CSRF token of requests that change anything
+func (w *WebhookHandler) sessionClaims(c echo.Context) (jwt.MapClaims, error) {
+	cookie, err := c.Cookie(sessionCookie)
+	if err != nil {
+		return nil, errors.New("no bearer token or session")
+	}
+	session, ok := w.sessions.get(cookie.Value)
+	if !ok {
+		return nil, errors.New("unknown or expired session")
+	}
+
+	switch c.Request().Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		token := c.Request().Header.Get(csrfHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(session.csrfToken)) != 1 {
+			return nil, errors.New("missing or invalid CSRF token")
+		}
+	}
+	return session.claims, nil
+}
+
+// handleCreateSession starts a session for the bearer of a token, setting
+// its cookie and returning its CSRF token
+func (w *WebhookHandler) handleCreateSession(c echo.Context) error {
+	claims, _ := c.Get(adminClaimsKey).(jwt.MapClaims)
+	id, session, err := w.sessions.create(claims, w.state.Load().admin.sessionTTL)
+	if err != nil {
+		log.Printf("Error creating admin session: %v", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create session"})
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     sessionPath,
+		Expires:  session.expires,
+		Secure:   c.Scheme() == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	log.Printf("Started admin session for %v", claims["sub"])
+	return c.JSON(http.StatusCreated, sessionResponse(session))
+}
+
+// handleGetSession returns the CSRF token of the current session, so a page
+// loaded again can pick it up
+func (w *WebhookHandler) handleGetSession(c echo.Context) error {
+	cookie, err := c.Cookie(sessionCookie)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "No session"})
+	}
+	session, ok := w.sessions.get(cookie.Value)
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "No session"})
+	}
+	return c.JSON(http.StatusOK, sessionResponse(session))
+}
+
+// handleDeleteSession ends the current session
+func (w *WebhookHandler) handleDeleteSession(c echo.Context) error {
+	if cookie, err := c.Cookie(sessionCookie); err == nil {
+		w.sessions.remove(cookie.Value)
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     sessionCookie,
+		Path:     sessionPath,
+		MaxAge:   -1,
+		Secure:   c.Scheme() == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return c.NoContent(http.StatusNoContent)
+}
+
+func sessionResponse(session adminSession) map[string]interface{} {
+	return map[string]interface{}{
+		"csrf_token": session.csrfToken,
+		"expires":    session.expires.UTC(),
+		"subject":    session.claims["sub"],
+	}
+}
+
+// parseSessionTTL reads how long admin sessions last
+func (c *AdminConfig) parseSessionTTL() error {
+	c.sessionTTL = defaultSessionTTL
+	if strings.TrimSpace(c.SessionTTL) == "" {
+		return nil
+	}
+	ttl, err := time.ParseDuration(c.SessionTTL)
+	if err != nil || ttl <= 0 {
+		return fmt.Errorf("invalid ADMIN_SESSION_TTL value: %s", c.SessionTTL)
+	}
+	c.sessionTTL = ttl
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+func TestSessionClaims(t *testing.T) {
+	w := &WebhookHandler{sessions: newSessionStore()}
+	id, session, err := w.sessions.create(jwt.MapClaims{"sub": "me"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _, err := w.sessions.create(jwt.MapClaims{"sub": "me", "exp": float64(time.Now().Add(-time.Minute).Unix())}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		cookie string
+		csrf   string
+		ok     bool
+	}{
+		{"GET without CSRF token", http.MethodGet, id, "", true},
+		{"HEAD without CSRF token", http.MethodHead, id, "", true},
+		{"POST with CSRF token", http.MethodPost, id, session.csrfToken, true},
+		{"POST without CSRF token", http.MethodPost, id, "", false},
+		{"POST with wrong CSRF token", http.MethodPost, id, "0" + session.csrfToken[1:], false},
+		{"DELETE without CSRF token", http.MethodDelete, id, "", false},
+		{"unknown session", http.MethodGet, "unknown", "", false},
+		{"session ended with its token", http.MethodGet, expired, "", false},
+		{"no cookie", http.MethodGet, "", "", false},
+	}
+	e := echo.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/deliveries", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: sessionCookie, Value: tt.cookie})
+			}
+			if tt.csrf != "" {
+				req.Header.Set(csrfHeader, tt.csrf)
+			}
+			claims, err := w.sessionClaims(e.NewContext(req, httptest.NewRecorder()))
+			if ok := err == nil; ok != tt.ok {
+				t.Fatalf("sessionClaims() error = %v, want ok %v", err, tt.ok)
+			}
+			if tt.ok && claims["sub"] != "me" {
+				t.Errorf("sessionClaims() = %v, want the session claims", claims)
+			}
+		})
+	}
+}
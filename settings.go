@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	// Embedded so TIMEZONE works in images without a zoneinfo database
+	_ "time/tzdata"
+)
+
+// NotifySettings control how builds are notified. They are set globally
+// under notifications in the config file and overridden per job under jobs.
+type NotifySettings struct {
+	// Events lists the events that are notified; empty notifies every event
+	Events []string `yaml:"events"`
+	// Colors replaces the color of an event, or of a result the CI system
+	// reports, such as not_built, as "#RRGGBB", "#RGB" or "0xRRGGBB"
+	Colors map[string]string `yaml:"colors"`
+	// StatusTexts replaces the status text of an event or result, e.g.
+	// "🔥 Broken" for failure
+	StatusTexts map[string]string `yaml:"status_texts"`
+	// Mentions are added to the Discord message of builds whose event is
+	// in MentionEvents, failed and unstable builds by default, e.g.
+	// "<@&ROLE_ID>" or "<@USER_ID>"
+	Mentions      []string `yaml:"mentions"`
+	MentionEvents []string `yaml:"mention_events"`
+	// Template renders the Discord embed description, Title its title and
+	// Fields its fields, with the same data as the generic webhook template.
+	// Each replaces the default layout when set.
+	Template string          `yaml:"template"`
+	Title    string          `yaml:"title"`
+	Fields   []FieldTemplate `yaml:"fields"`
+	// ParameterFields are the build parameters shown as inline fields of
+	// their own, by name or glob pattern such as DEPLOY_*. The values of
+	// the ones matching RedactParameters, the log redaction patterns by
+	// default, are masked.
+	ParameterFields  []string `yaml:"parameter_fields"`
+	RedactParameters []string `yaml:"redact_parameters"`
+	// FooterTexts replace the "Jenkins CI/CD" footer text and FooterIcons
+	// set the URL of a footer icon, per event or result like Colors, with
+	// "default" applying to the others. InstanceName, e.g.
+	// "jenkins-prod.eu", is shown in the footer, telling several CI servers
+	// apart.
+	FooterTexts  map[string]string `yaml:"footer_texts"`
+	FooterIcons  map[string]string `yaml:"footer_icons"`
+	InstanceName string            `yaml:"instance_name"`
+	// Deployment marks deployment jobs, whose successful builds list what's
+	// new since the last successful deploy
+	Deployment bool `yaml:"deployment"`
+	// Timezone is the IANA time zone timestamps are shown in, e.g.
+	// "Europe/Berlin"; DateFormat is their Go time layout
+	Timezone   string `yaml:"timezone"`
+	DateFormat string `yaml:"date_format"`
+
+	colors      map[string]int
+	texts       map[string]string
+	footerTexts map[string]string
+	footerIcons map[string]string
+	template    *template.Template
+	title       *template.Template
+	fields      []fieldTemplate
+	location    *time.Location
+}
+
+// FieldTemplate is an embed field whose name and value are templates.
+// Fields whose value renders empty are left out.
+type FieldTemplate struct {
+	Name   string `yaml:"name"`
+	Value  string `yaml:"value"`
+	Inline bool   `yaml:"inline"`
+}
+
+type fieldTemplate struct {
+	name, value *template.Template
+	inline      bool
+}
+
+// defaultMentionEvents are the events mentions are added to when no
+// mention events are set
+var defaultMentionEvents = []string{"failure", "failed", "unstable"}
+
+// defaultDateFormat is used for timestamps when no date format is set
+const defaultDateFormat = "2006-01-02 15:04:05 MST"
+
+// JobOverride applies its settings over the global ones for matching jobs.
+// Every matching override applies, in order.
+type JobOverride struct {
+	JobMatch       `yaml:",inline"`
+	NotifySettings `yaml:",inline"`
+}
+
+// compile parses the colors and templates
+func (s *NotifySettings) compile() error {
+	s.colors = make(map[string]int, len(s.Colors))
+	for status, value := range s.Colors {
+		color, err := parseColor(value)
+		if err != nil {
+			return fmt.Errorf("invalid color %q for %s", value, status)
+		}
+		s.colors[strings.ToLower(status)] = color
+	}
+	for _, pattern := range append(append([]string(nil), s.ParameterFields...), s.RedactParameters...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid parameter pattern %q", pattern)
+		}
+	}
+	s.texts = lowerKeys(s.StatusTexts)
+	s.footerTexts = lowerKeys(s.FooterTexts)
+	s.footerIcons = lowerKeys(s.FooterIcons)
+	for status, icon := range s.footerIcons {
+		if u, err := url.Parse(icon); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid footer icon %q for %s", icon, status)
+		}
+	}
+
+	var err error
+	if s.template, err = parseMessageTemplate("template", s.Template); err != nil {
+		return err
+	}
+	if s.title, err = parseMessageTemplate("title", s.Title); err != nil {
+		return err
+	}
+	if s.Fields != nil {
+		s.fields = make([]fieldTemplate, 0, len(s.Fields))
+	}
+	for i, field := range s.Fields {
+		name, err := parseMessageTemplate(fmt.Sprintf("fields[%d].name", i), field.Name)
+		if err != nil {
+			return err
+		}
+		value, err := parseMessageTemplate(fmt.Sprintf("fields[%d].value", i), field.Value)
+		if err != nil {
+			return err
+		}
+		if name == nil || value == nil {
+			return fmt.Errorf("fields[%d] needs both a name and a value", i)
+		}
+		s.fields = append(s.fields, fieldTemplate{name: name, value: value, inline: field.Inline})
+	}
+
+	if s.Timezone != "" {
+		location, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", s.Timezone, err)
+		}
+		s.location = location
+	}
+	return nil
+}
+
+// parameterFields picks the build variables listed in ParameterFields, in
+// that order, masking the values of secrets
+func (s NotifySettings) parameterFields(vars []BuildVar) []MessageField {
+	if len(s.ParameterFields) == 0 {
+		return nil
+	}
+	redact := s.RedactParameters
+	if redact == nil {
+		redact = defaultRedactPatterns
+	}
+
+	var fields []MessageField
+	picked := make(map[string]bool)
+	for _, pattern := range s.ParameterFields {
+		for _, v := range vars {
+			if picked[v.Key] || !matchesKey(pattern, v.Key) {
+				continue
+			}
+			picked[v.Key] = true
+			value := v.Value
+			for _, secret := range redact {
+				if matchesKey(secret, v.Key) {
+					value = redacted
+					break
+				}
+			}
+			if value == "" {
+				// Discord rejects empty field values
+				value = "-"
+			}
+			fields = append(fields, MessageField{Name: v.Key, Value: value, Inline: true})
+		}
+	}
+	return fields
+}
+
+// matchesKey matches a parameter name against a glob pattern, ignoring case
+func matchesKey(pattern, key string) bool {
+	matched, _ := path.Match(strings.ToUpper(pattern), strings.ToUpper(key))
+	return matched
+}
+
+// parseColor parses a hex color as "#RRGGBB", "RRGGBB", "0xRRGGBB" or the
+// "#RGB" shorthand
+func parseColor(value string) (int, error) {
+	hex := strings.TrimSpace(value)
+	if strings.HasPrefix(hex, "0x") || strings.HasPrefix(hex, "0X") {
+		hex = hex[2:]
+	} else {
+		hex = strings.TrimPrefix(hex, "#")
+	}
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return 0, fmt.Errorf("expected 6 hex digits")
+	}
+	color, err := strconv.ParseUint(hex, 16, 24)
+	if err != nil {
+		return 0, err
+	}
+	return int(color), nil
+}
+
+// statusKeys are the keys colors and status texts are looked up by, in
+// order: the build's result, then its event
+func statusKeys(build BuildEvent) []string {
+	if build.Result == "" {
+		return []string{build.Event}
+	}
+	return []string{strings.ToLower(build.Result), build.Event}
+}
+
+// statusColor looks up the color of the build's result, then of its event
+func statusColor(colors map[string]int, build BuildEvent) (int, bool) {
+	for _, key := range statusKeys(build) {
+		if color, ok := colors[key]; ok {
+			return color, true
+		}
+	}
+	return 0, false
+}
+
+// statusText looks up the status text of the build's result, then of its
+// event
+func statusText(texts map[string]string, build BuildEvent) (string, bool) {
+	for _, key := range statusKeys(build) {
+		if text, ok := texts[key]; ok {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+// lowerKeys copies the map of events and results with its keys lowercased
+func lowerKeys(values map[string]string) map[string]string {
+	lowered := make(map[string]string, len(values))
+	for status, value := range values {
+		lowered[strings.ToLower(status)] = value
+	}
+	return lowered
+}
+
+// mergeStrings returns base with the values of over replacing its own
+func mergeStrings(base, over map[string]string) map[string]string {
+	if len(over) == 0 {
+		return base
+	}
+	merged := make(map[string]string, len(base)+len(over))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range over {
+		merged[key] = value
+	}
+	return merged
+}
+
+// footerValue looks up the footer text or icon of the build's result, then
+// of its event, then the default
+func footerValue(values map[string]string, build BuildEvent) string {
+	if value, ok := statusText(values, build); ok {
+		return value
+	}
+	return values["default"]
+}
+
+// merge returns s with the settings that over sets replacing its own.
+// Colors, status texts and footers are merged per event.
+func (s NotifySettings) merge(over NotifySettings) NotifySettings {
+	if over.Events != nil {
+		s.Events = over.Events
+	}
+	if len(over.colors) > 0 {
+		colors := make(map[string]int, len(s.colors)+len(over.colors))
+		for event, color := range s.colors {
+			colors[event] = color
+		}
+		for event, color := range over.colors {
+			colors[event] = color
+		}
+		s.colors = colors
+	}
+	s.texts = mergeStrings(s.texts, over.texts)
+	s.footerTexts = mergeStrings(s.footerTexts, over.footerTexts)
+	s.footerIcons = mergeStrings(s.footerIcons, over.footerIcons)
+	if over.InstanceName != "" {
+		s.InstanceName = over.InstanceName
+	}
+	if over.Mentions != nil {
+		s.Mentions = over.Mentions
+	}
+	if over.MentionEvents != nil {
+		s.MentionEvents = over.MentionEvents
+	}
+	if over.ParameterFields != nil {
+		s.ParameterFields = over.ParameterFields
+	}
+	if over.RedactParameters != nil {
+		s.RedactParameters = over.RedactParameters
+	}
+	if over.Deployment {
+		s.Deployment = true
+	}
+	if over.template != nil {
+		s.template = over.template
+	}
+	if over.title != nil {
+		s.title = over.title
+	}
+	if over.fields != nil {
+		s.fields = over.fields
+	}
+	if over.location != nil {
+		s.location = over.location
+	}
+	if over.DateFormat != "" {
+		s.DateFormat = over.DateFormat
+	}
+	return s
+}
+
+// notifySettings resolves the settings for a build from the global
+// settings and every matching override
+func (s *handlerState) notifySettings(build BuildEvent) NotifySettings {
+	settings := s.notifications
+	for _, override := range s.jobs {
+		if override.matches(build) {
+			settings = settings.merge(override.NotifySettings)
+		}
+	}
+	return settings
+}
+
+// wants reports whether the settings notify the build's event
+func (s NotifySettings) wants(build BuildEvent) bool {
+	return len(s.Events) == 0 || containsString(s.Events, build.Event)
+}
+
+// apply decorates the build with the settings, returning false when its
+// event is filtered out
+func (s NotifySettings) apply(build *BuildEvent) bool {
+	if !s.wants(*build) {
+		return false
+	}
+
+	if color, ok := statusColor(s.colors, *build); ok {
+		build.Color = color
+	}
+	if text, ok := statusText(s.texts, *build); ok {
+		build.Text = text
+	}
+	build.FooterText = footerValue(s.footerTexts, *build)
+	build.FooterIcon = footerValue(s.footerIcons, *build)
+	build.Instance = s.InstanceName
+	mentionEvents := s.MentionEvents
+	if mentionEvents == nil {
+		mentionEvents = defaultMentionEvents
+	}
+	if containsString(mentionEvents, build.Event) {
+		build.Mentions = s.Mentions
+		build.MentionCulprits = true
+	}
+
+	build.ParameterFields = s.parameterFields(build.Vars)
+	if s.Deployment && build.Event == "success" && len(build.ReleaseCommits) > 0 {
+		build.ReleaseNotes = formatReleaseNotes(build.ReleaseCommits)
+	}
+
+	if s.location != nil {
+		build.Time = build.Time.In(s.location)
+	}
+	layout := s.DateFormat
+	if layout == "" {
+		layout = defaultDateFormat
+	}
+	build.Timestamp = build.Time.Format(layout)
+
+	data := newTemplateData(*build)
+	if s.template != nil {
+		if message, err := renderTemplate(s.template, data); err != nil {
+			log.Printf("Error rendering message template for %s: %v", build.ProjectName, err)
+		} else {
+			build.Message = message
+		}
+	}
+	if s.title != nil {
+		if title, err := renderTemplate(s.title, data); err != nil {
+			log.Printf("Error rendering title template for %s: %v", build.ProjectName, err)
+		} else {
+			build.Title = title
+		}
+	}
+	if s.fields != nil {
+		fields, err := s.renderFields(data)
+		if err != nil {
+			log.Printf("Error rendering field templates for %s: %v", build.ProjectName, err)
+		} else {
+			build.Fields = fields
+		}
+	}
+	return true
+}
+
+// renderFields renders the field templates, leaving out empty fields
+func (s NotifySettings) renderFields(data genericTemplateData) ([]MessageField, error) {
+	fields := []MessageField{}
+	for _, field := range s.fields {
+		name, err := renderTemplate(field.name, data)
+		if err != nil {
+			return nil, err
+		}
+		value, err := renderTemplate(field.value, data)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(name) == "" || strings.TrimSpace(value) == "" {
+			continue
+		}
+		fields = append(fields, MessageField{Name: name, Value: value, Inline: field.inline})
+	}
+	return fields, nil
+}
+
+// checkTemplates runs every template of the settings on data
+func (s NotifySettings) checkTemplates(data genericTemplateData) error {
+	for _, tmpl := range []*template.Template{s.template, s.title} {
+		if tmpl == nil {
+			continue
+		}
+		if _, err := renderTemplate(tmpl, data); err != nil {
+			return err
+		}
+	}
+	_, err := s.renderFields(data)
+	return err
+}
+
+// parseMessageTemplate parses one of the message templates, returning nil
+// when it isn't set
+func parseMessageTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+func renderTemplate(tmpl *template.Template, data genericTemplateData) (string, error) {
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
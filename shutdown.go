@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// defaultShutdownTimeout is how long a shutdown waits for requests and
+// deliveries to finish
+const defaultShutdownTimeout = 30 * time.Second
+
+// shutdownSignals returns the channel SIGTERM and SIGINT are delivered to
+func shutdownSignals() chan os.Signal {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	return signals
+}
+
+// shutdown stops the server from taking requests and waits for the ones
+// being handled, then lets the delivery workers deliver the events waiting
+// for them, the Discord digests post what they hold back, including those of
+// destinations replaced by a reload, and the deliveries being retried make
+// a last retry, all within timeout. The outbound queue keeps what it
+// couldn't deliver.
+func (w *WebhookHandler) shutdown(e *echo.Echo, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := e.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+	w.workers.drain(ctx)
+	discordDigests.flushAll()
+	backgroundRetries.drain(ctx)
+	w.queue.close(ctx)
+	log.Printf("Shut down")
+}
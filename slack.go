@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// SlackConfig configures the Slack destination
+type SlackConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
+}
+
+type slackDestination struct {
+	destinationID
+	httpSender
+	cfg SlackConfig
+}
+
+func (d *slackDestination) Name() string {
+	return "slack"
+}
+
+func (d *slackDestination) pingAddress() string {
+	return d.cfg.WebhookURL
+}
+
+func (d *slackDestination) Send(build BuildEvent) error {
+	return d.sendToSlack(d.convertToSlackPayload(build))
+}
+
+// Slack incoming webhook payload structures (Block Kit)
+type SlackWebhook struct {
+	Text        string            `json:"text"`
+	Attachments []SlackAttachment `json:"attachments,omitempty"`
+}
+
+// SlackAttachment wraps the blocks so the message gets a colored sidebar
+type SlackAttachment struct {
+	Color  string       `json:"color,omitempty"`
+	Blocks []SlackBlock `json:"blocks"`
+}
+
+type SlackBlock struct {
+	Type     string      `json:"type"`
+	Text     *SlackText  `json:"text,omitempty"`
+	Fields   []SlackText `json:"fields,omitempty"`
+	Elements []SlackText `json:"elements,omitempty"`
+}
+
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func (d *slackDestination) convertToSlackPayload(build BuildEvent) SlackWebhook {
+	title := fmt.Sprintf("%s - %s", build.ProjectName, build.BuildName)
+	if build.BuildURL != "" {
+		title = fmt.Sprintf("<%s|%s>", build.BuildURL, title)
+	}
+
+	blocks := []SlackBlock{
+		{
+			Type: "section",
+			Text: &SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*%s*\nBuild %s", title, build.Event)},
+		},
+		{
+			Type: "section",
+			Fields: []SlackText{
+				{Type: "mrkdwn", Text: "*Build*\n" + build.BuildName},
+				{Type: "mrkdwn", Text: "*Status*\n" + build.StatusText()},
+				{Type: "mrkdwn", Text: "*Project*\n" + build.ProjectName},
+			},
+		},
+	}
+
+	// Add build variables if available
+	if vars := build.Vars; len(vars) > 0 {
+		var lines []string
+		for _, v := range vars {
+			lines = append(lines, fmt.Sprintf("*%s*: %s", v.Key, v.Value))
+		}
+		blocks = append(blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackText{Type: "mrkdwn", Text: "*Build Variables*\n" + strings.Join(lines, "\n")},
+		})
+	}
+
+	blocks = append(blocks, SlackBlock{
+		Type:     "context",
+		Elements: []SlackText{{Type: "mrkdwn", Text: build.Footer()}},
+	})
+
+	return SlackWebhook{
+		// Shown in notifications and clients that cannot render blocks
+		Text: fmt.Sprintf("%s - %s: %s", build.ProjectName, build.BuildName, build.StatusText()),
+		Attachments: []SlackAttachment{
+			{
+				Color:  fmt.Sprintf("#%06X", build.EventColor()),
+				Blocks: blocks,
+			},
+		},
+	}
+}
+
+func (d *slackDestination) sendToSlack(payload SlackWebhook) error {
+	if err := d.postJSON(d.cfg.WebhookURL, payload, nil); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully sent webhook to Slack")
+	return nil
+}
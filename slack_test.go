@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSlackSend(t *testing.T) {
+	server := newRecordingServer(t, http.StatusOK, "ok")
+	d := &slackDestination{httpSender: server.sender(), cfg: SlackConfig{WebhookURL: "https://hooks.slack.com/services/T0/B0/secret"}}
+	build := testBuild("app", "failure")
+
+	if err := d.Send(build); err != nil {
+		t.Fatal(err)
+	}
+	request := server.only(t)
+	if request.Method != http.MethodPost || request.Path != "/services/T0/B0/secret" {
+		t.Errorf("request = %s %s, want a POST to the webhook", request.Method, request.Path)
+	}
+	var payload SlackWebhook
+	request.decode(t, &payload)
+	if want := "app - #0: " + build.StatusText(); payload.Text != want {
+		t.Errorf("text = %q, want %q", payload.Text, want)
+	}
+	if len(payload.Attachments) != 1 || payload.Attachments[0].Color != fmt.Sprintf("#%06X", build.EventColor()) {
+		t.Fatalf("attachments = %+v, want one with the failure color", payload.Attachments)
+	}
+	blocks := payload.Attachments[0].Blocks
+	if len(blocks) < 2 || !strings.Contains(blocks[0].Text.Text, "Build failure") {
+		t.Errorf("blocks = %+v, want the header to name the event", blocks)
+	}
+	if last := blocks[len(blocks)-1]; last.Type != "context" || last.Elements[0].Text != build.Footer() {
+		t.Errorf("last block = %+v, want the footer", last)
+	}
+}
+
+func TestSlackSendFails(t *testing.T) {
+	server := newRecordingServer(t, http.StatusNotFound, "no_service")
+	d := &slackDestination{httpSender: server.sender(), cfg: SlackConfig{WebhookURL: "https://hooks.slack.com/services/T0/B0/gone"}}
+
+	if err := d.Send(testBuild("app", "success")); !hasStatus(err, http.StatusNotFound) {
+		t.Errorf("error = %v, want the 404 returned", err)
+	}
+}
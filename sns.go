@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SNSConfig configures the AWS SNS destination
+type SNSConfig struct {
+	TopicARN    string         `yaml:"topic_arn"`
+	Region      string         `yaml:"region"`
+	Credentials awsCredentials `yaml:"credentials"`
+}
+
+type snsDestination struct {
+	destinationID
+	httpSender
+	cfg SNSConfig
+}
+
+func (d *snsDestination) Name() string {
+	return "sns"
+}
+
+func (d *snsDestination) pingAddress() string {
+	return fmt.Sprintf("https://sns.%s.amazonaws.com/", d.snsRegion())
+}
+
+func (d *snsDestination) Send(build BuildEvent) error {
+	return d.publishToSNS(d.convertToSNSBuildEvent(build))
+}
+
+// SNSBuildEvent is the structured message published for downstream consumers
+type SNSBuildEvent struct {
+	Source          string            `json:"source"`
+	ProjectName     string            `json:"projectName"`
+	BuildName       string            `json:"buildName"`
+	BuildURL        string            `json:"buildUrl,omitempty"`
+	Event           string            `json:"event"`
+	DurationSeconds float64           `json:"durationSeconds,omitempty"`
+	Variables       map[string]string `json:"variables,omitempty"`
+	Timestamp       string            `json:"timestamp"`
+}
+
+func (d *snsDestination) convertToSNSBuildEvent(build BuildEvent) SNSBuildEvent {
+	event := SNSBuildEvent{
+		Source:          build.Source,
+		ProjectName:     build.ProjectName,
+		BuildName:       build.BuildName,
+		BuildURL:        build.BuildURL,
+		Event:           build.Event,
+		DurationSeconds: build.Duration.Seconds(),
+		Timestamp:       build.Time.Format(time.RFC3339),
+	}
+
+	if vars := build.Vars; len(vars) > 0 {
+		event.Variables = make(map[string]string, len(vars))
+		for _, v := range vars {
+			event.Variables[v.Key] = v.Value
+		}
+	}
+
+	return event
+}
+
+// snsRegion returns the configured region, falling back to the one in the topic ARN
+// (arn:aws:sns:<region>:<account>:<name>)
+func (d *snsDestination) snsRegion() string {
+	if d.cfg.Region != "" {
+		return d.cfg.Region
+	}
+	parts := strings.Split(d.cfg.TopicARN, ":")
+	if len(parts) >= 4 {
+		return parts[3]
+	}
+	return ""
+}
+
+func (d *snsDestination) publishToSNS(event SNSBuildEvent) error {
+	message, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error marshaling SNS message: %w", err)
+	}
+
+	subject := fmt.Sprintf("%s %s - %s: %s", sourceNames[event.Source], event.ProjectName, event.BuildName, event.Event)
+	// SNS subjects are limited to 100 characters
+	if len(subject) > 100 {
+		subject = subject[:100]
+	}
+
+	// Message attributes allow subscription filter policies on event and project
+	form := url.Values{
+		"Action":   {"Publish"},
+		"Version":  {"2010-03-31"},
+		"TopicArn": {d.cfg.TopicARN},
+		"Message":  {string(message)},
+		"Subject":  {subject},
+
+		"MessageAttributes.entry.1.Name":              {"event"},
+		"MessageAttributes.entry.1.Value.DataType":    {"String"},
+		"MessageAttributes.entry.1.Value.StringValue": {event.Event},
+		"MessageAttributes.entry.2.Name":              {"project"},
+		"MessageAttributes.entry.2.Value.DataType":    {"String"},
+		"MessageAttributes.entry.2.Value.StringValue": {event.ProjectName},
+	}
+	body := []byte(form.Encode())
+
+	region := d.snsRegion()
+	endpoint := fmt.Sprintf("https://sns.%s.amazonaws.com/", region)
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(string(body)))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signAWSRequest(req, body, d.cfg.Credentials, region, "sns", time.Now())
+
+	if err := d.sendRequest(req); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully published build event to SNS topic %s", d.cfg.TopicARN)
+	return nil
+}
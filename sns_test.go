@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSNSPublish(t *testing.T) {
+	tests := []struct {
+		name, region, want string
+	}{
+		{"region of the topic ARN", "", "us-east-2"},
+		{"configured region", "eu-west-1", "eu-west-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRecordingServer(t, http.StatusOK, "<PublishResponse/>")
+			d := &snsDestination{httpSender: server.sender(), cfg: SNSConfig{
+				TopicARN:    "arn:aws:sns:us-east-2:123456789012:builds",
+				Region:      tt.region,
+				Credentials: awsCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+			}}
+			build := testBuild("app", "failure")
+
+			if err := d.Send(build); err != nil {
+				t.Fatal(err)
+			}
+			request := server.only(t)
+			form, err := url.ParseQuery(string(request.Body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if form.Get("Action") != "Publish" || form.Get("TopicArn") != d.cfg.TopicARN {
+				t.Errorf("form = %v, want a Publish to the topic", form)
+			}
+			if form.Get("Subject") != "Jenkins app - #0: failure" {
+				t.Errorf("subject = %q", form.Get("Subject"))
+			}
+			if form.Get("MessageAttributes.entry.1.Value.StringValue") != "failure" || form.Get("MessageAttributes.entry.2.Value.StringValue") != "app" {
+				t.Errorf("form = %v, want the event and project attributes", form)
+			}
+			var event SNSBuildEvent
+			if err := json.Unmarshal([]byte(form.Get("Message")), &event); err != nil {
+				t.Fatal(err)
+			}
+			if event.ProjectName != "app" || event.Event != "failure" || event.DurationSeconds != 90 || event.Variables["Test"] == "" {
+				t.Errorf("message = %+v, want the build", event)
+			}
+
+			auth := request.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/"+tt.want+"/sns/aws4_request") {
+				t.Errorf("Authorization = %q, want it signed for %s", auth, tt.want)
+			}
+			if request.Header.Get("X-Amz-Content-Sha256") != sha256Hex(request.Body) {
+				t.Error("X-Amz-Content-Sha256 isn't the hash of the body sent")
+			}
+		})
+	}
+}
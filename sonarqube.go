@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SonarQubeConfig configures the SonarQube webhook source. When Secret is
+// set, requests must carry a matching HMAC-SHA256 in X-Sonar-Webhook-HMAC-SHA256.
+type SonarQubeConfig struct {
+	Secret string `yaml:"secret"`
+}
+
+// SonarQube webhook payload structures
+type SonarQubeWebhook struct {
+	TaskID      string                `json:"taskId"`
+	Status      string                `json:"status"`
+	Revision    string                `json:"revision"`
+	Project     *SonarQubeProject     `json:"project,omitempty"`
+	Branch      *SonarQubeBranch      `json:"branch,omitempty"`
+	QualityGate *SonarQubeQualityGate `json:"qualityGate,omitempty"`
+}
+
+type SonarQubeProject struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type SonarQubeBranch struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type SonarQubeQualityGate struct {
+	Name       string               `json:"name"`
+	Status     string               `json:"status"`
+	Conditions []SonarQubeCondition `json:"conditions"`
+}
+
+type SonarQubeCondition struct {
+	Metric         string `json:"metric"`
+	Operator       string `json:"operator"`
+	Value          string `json:"value"`
+	Status         string `json:"status"`
+	ErrorThreshold string `json:"errorThreshold"`
+}
+
+type sonarqubeSource struct {
+	cfg SonarQubeConfig
+}
+
+func (s sonarqubeSource) Name() string {
+	return "sonarqube"
+}
+
+func (s sonarqubeSource) Detect(header http.Header, body []byte) bool {
+	return header.Get("X-SonarQube-Project") != ""
+}
+
+func (s sonarqubeSource) Verify(req *http.Request, body []byte) error {
+	if !s.cfg.verifySignature(req.Header.Get("X-Sonar-Webhook-HMAC-SHA256"), body) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// signedAt reports requests as signed when a secret is configured. The
+// signature doesn't cover a send time.
+func (s sonarqubeSource) signedAt(header http.Header) (time.Time, bool) {
+	return time.Time{}, s.cfg.Secret != ""
+}
+
+func (s sonarqubeSource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	var payload SonarQubeWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return singleBuild(payload.toBuildEvent()), nil
+}
+
+// verifySignature checks the hex HMAC-SHA256 of the body SonarQube sends
+func (c SonarQubeConfig) verifySignature(header string, body []byte) bool {
+	if c.Secret == "" {
+		return true
+	}
+
+	decoded, err := hex.DecodeString(header)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(c.Secret))
+	mac.Write(body)
+	return hmac.Equal(decoded, mac.Sum(nil))
+}
+
+// sonarQubeOperators renders condition operators as comparison symbols
+var sonarQubeOperators = map[string]string{
+	"GREATER_THAN": ">",
+	"LESS_THAN":    "<",
+}
+
+// toBuildEvent converts a quality gate result into a BuildEvent, with one
+// build variable per evaluated gate condition
+func (p SonarQubeWebhook) toBuildEvent() (BuildEvent, bool) {
+	if p.Project == nil {
+		return BuildEvent{}, false
+	}
+
+	build := BuildEvent{
+		Source:      "sonarqube",
+		ProjectName: p.Project.Name,
+		BuildName:   "analysis",
+		RunID:       p.TaskID,
+		BuildURL:    p.Project.URL,
+		Payload:     p,
+	}
+	if p.Branch != nil {
+		build.BuildName = p.Branch.Name
+		if p.Branch.URL != "" {
+			build.BuildURL = p.Branch.URL
+		}
+	}
+
+	gate := p.QualityGate
+	switch {
+	case p.Status != "SUCCESS":
+		// The analysis itself failed, so there is no gate to report
+		build.Event = "failure"
+	case gate == nil:
+		return BuildEvent{}, false
+	case gate.Status == "OK":
+		build.Event = "success"
+	case gate.Status == "WARN":
+		build.Event = "unstable"
+	case gate.Status == "ERROR":
+		build.Event = "failure"
+	default:
+		return BuildEvent{}, false
+	}
+
+	if len(p.Revision) >= 8 {
+		build.Vars = append(build.Vars, BuildVar{Key: "Commit", Value: p.Revision[:8]})
+	}
+	if gate == nil {
+		build.Vars = append(build.Vars, BuildVar{Key: "Analysis", Value: p.Status})
+		return build, true
+	}
+
+	build.Vars = append(build.Vars, BuildVar{Key: "Quality Gate", Value: gate.Name})
+	for _, cond := range gate.Conditions {
+		if cond.Status == "NO_VALUE" {
+			continue
+		}
+		value := "✅ " + cond.Value
+		if cond.Status != "OK" {
+			// Conditions list the threshold that fails, e.g. "coverage < 80"
+			value = fmt.Sprintf("❌ %s (%s %s)", cond.Value, sonarQubeOperators[cond.Operator], cond.ErrorThreshold)
+		}
+		build.Vars = append(build.Vars, BuildVar{Key: cond.Metric, Value: value})
+	}
+
+	return build, true
+}
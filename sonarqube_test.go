@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestSonarQubeParse(t *testing.T) {
+	header := http.Header{"X-Sonarqube-Project": {"app"}}
+	project := `"project": {"key": "app", "name": "App", "url": "https://sonar.example.com/dashboard?id=app"}`
+	tests := []struct {
+		name string
+		body string
+		want []buildSummary
+	}{
+		{
+			"gate failed on a branch",
+			`{"taskId": "T1", "status": "SUCCESS", ` + project + `, "branch": {"name": "main", "url": "https://sonar.example.com/dashboard?id=app&branch=main"},
+			  "qualityGate": {"name": "Sonar way", "status": "ERROR", "conditions": [
+			    {"metric": "coverage", "operator": "LESS_THAN", "value": "62.5", "status": "ERROR", "errorThreshold": "80"},
+			    {"metric": "bugs", "operator": "GREATER_THAN", "value": "0", "status": "OK", "errorThreshold": "0"},
+			    {"metric": "duplicated_lines", "status": "NO_VALUE"}]}}`,
+			[]buildSummary{{"App", "main", "https://sonar.example.com/dashboard?id=app&branch=main", "failure"}},
+		},
+		{
+			"analysis failed",
+			`{"taskId": "T2", "status": "FAILED", ` + project + `}`,
+			[]buildSummary{{"App", "analysis", "https://sonar.example.com/dashboard?id=app", "failure"}},
+		},
+		{
+			"gate warned",
+			`{"taskId": "T3", "status": "SUCCESS", ` + project + `, "qualityGate": {"name": "Sonar way", "status": "WARN"}}`,
+			[]buildSummary{{"App", "analysis", "https://sonar.example.com/dashboard?id=app", "unstable"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name := detectSource(t, header, tt.body); name != "sonarqube" {
+				t.Errorf("detected as %q, want sonarqube", name)
+			}
+			builds := parseBuilds(t, sonarqubeSource{}, header, tt.body)
+			if got := summarize(builds); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("builds = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSonarQubeConditions(t *testing.T) {
+	body := `{"status": "SUCCESS", "project": {"name": "App"}, "qualityGate": {"name": "Sonar way", "status": "ERROR", "conditions": [
+	  {"metric": "coverage", "operator": "LESS_THAN", "value": "62.5", "status": "ERROR", "errorThreshold": "80"},
+	  {"metric": "bugs", "operator": "GREATER_THAN", "value": "0", "status": "OK", "errorThreshold": "0"},
+	  {"metric": "duplicated_lines", "status": "NO_VALUE"}]}}`
+	builds := parseBuilds(t, sonarqubeSource{}, http.Header{}, body)
+	want := []BuildVar{
+		{Key: "Quality Gate", Value: "Sonar way"},
+		{Key: "coverage", Value: "❌ 62.5 (< 80)"},
+		{Key: "bugs", Value: "✅ 0"},
+	}
+	if !reflect.DeepEqual(builds[0].Vars, want) {
+		t.Errorf("vars = %+v, want %+v", builds[0].Vars, want)
+	}
+}
+
+func TestSonarQubeVerify(t *testing.T) {
+	body := []byte(`{"status": "SUCCESS"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	src := sonarqubeSource{cfg: SonarQubeConfig{Secret: "secret"}}
+
+	for signature, ok := range map[string]bool{hex.EncodeToString(mac.Sum(nil)): true, hex.EncodeToString(make([]byte, 32)): false, "": false} {
+		req, _ := http.NewRequest(http.MethodPost, "/webhook/sonarqube", nil)
+		req.Header.Set("X-Sonar-Webhook-HMAC-SHA256", signature)
+		if err := src.Verify(req, body); (err == nil) != ok {
+			t.Errorf("Verify() with %q = %v, want ok %v", signature, err, ok)
+		}
+	}
+}
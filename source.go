@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SourceAdapter turns the webhooks one system sends into build events. Each
+// source is served on /webhook/<name>, and /webhook accepts any of them by
+// asking every source whether it recognises the request.
+type SourceAdapter interface {
+	// Name identifies the source in BuildEvent.Source and its route
+	Name() string
+	// Detect reports whether the request looks like one this source sends
+	Detect(header http.Header, body []byte) bool
+	// Verify authenticates the request, returning nil when the source has
+	// no secret configured
+	Verify(req *http.Request, body []byte) error
+	// Parse converts the request into build events. Returning no events and
+	// no error means the request is valid but not worth a notification.
+	Parse(header http.Header, body []byte) ([]BuildEvent, error)
+}
+
+var (
+	errInvalidToken     = errors.New("invalid token")
+	errInvalidSignature = errors.New("invalid signature")
+)
+
+// buildSources creates the adapter for every webhook source, in the order
+// /webhook tries them
+func buildSources(config *Config, client *http.Client) ([]SourceAdapter, error) {
+	travis, err := newTravisVerifier(config.Travis, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return []SourceAdapter{
+		newJenkinsSource(config, client),
+		gitlabSource{cfg: config.GitLab},
+		circleciSource{cfg: config.CircleCI},
+		droneSource{cfg: config.Drone},
+		teamcitySource{},
+		bitbucketSource{cfg: config.Bitbucket},
+		azureDevOpsSource{cfg: config.AzureDevOps},
+		argocdSource{cfg: config.ArgoCD},
+		tektonSource{cfg: config.Tekton},
+		sonarqubeSource{cfg: config.SonarQube},
+		harborSource{cfg: config.Harbor},
+		alertmanagerSource{cfg: config.Alertmanager},
+		buildkiteSource{cfg: config.Buildkite},
+		travisSource{verifier: travis},
+		woodpeckerSource{cfg: config.Woodpecker},
+		giteaSource{cfg: config.Gitea},
+		spinnakerSource{cfg: config.Spinnaker},
+		artifactorySource{cfg: config.Artifactory},
+		nexusSource{cfg: config.Nexus},
+	}, nil
+}
+
+// sourceHandler serves the /webhook/<name> route of one source, using the
+// source as currently configured
+func (w *WebhookHandler) sourceHandler(name string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		src := w.state.Load().source(name)
+		if src == nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Unknown webhook source"})
+		}
+
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return readError(c, err)
+		}
+		auditRequest(c).setPayload(body)
+		return w.handleSource(c, src, body)
+	}
+}
+
+// HandleWebhook accepts a webhook from any source, handing it to the first
+// source that detects it
+func (w *WebhookHandler) HandleWebhook(c echo.Context) error {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return readError(c, err)
+	}
+	auditRequest(c).setPayload(body)
+
+	for _, src := range w.state.Load().sources {
+		if src.Detect(c.Request().Header, body) {
+			return w.handleSource(c, src, body)
+		}
+	}
+
+	log.Printf("Rejected webhook from an unrecognised source")
+	auditRequest(c).Outcome = "unknown_source"
+	return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown webhook source"})
+}
+
+// handleSource verifies and parses the request with src and delivers the
+// resulting events
+func (w *WebhookHandler) handleSource(c echo.Context, src SourceAdapter, body []byte) error {
+	audit := auditRequest(c)
+	audit.Source = src.Name()
+	if client, ok := w.state.Load().allowlist.allows(c.Request(), src.Name()); !ok {
+		log.Printf("Rejected %s webhook from %s: address not allowed", sourceName(src.Name()), client)
+		audit.Auth = "address_not_allowed"
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Forbidden"})
+	}
+	if !w.state.Load().auth.verify(c.Request(), src.Name()) {
+		log.Printf("Rejected %s webhook: %v", sourceName(src.Name()), errInvalidToken)
+		audit.Auth = "invalid_token"
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+	if err := src.Verify(c.Request(), body); err != nil {
+		log.Printf("Rejected %s webhook: %v", sourceName(src.Name()), err)
+		audit.Auth = "invalid_signature"
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+	}
+	nonce, err := w.checkReplay(w.state.Load().replay, src, c.Request().Header, body)
+	if err != nil {
+		log.Printf("Rejected %s webhook: %v", sourceName(src.Name()), err)
+		audit.Auth = "replayed"
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Replayed or expired delivery"})
+	}
+
+	audit.Auth = "passed"
+
+	builds, err := src.Parse(c.Request().Header, body)
+	if err != nil {
+		log.Printf("Error binding payload: %v", err)
+		audit.Outcome = "invalid_payload"
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid payload"})
+	}
+	if len(builds) == 0 {
+		audit.Outcome = "ignored"
+		return c.JSON(http.StatusOK, map[string]string{"status": "ignored"})
+	}
+
+	for _, build := range builds {
+		log.Printf("Received %s webhook: %s - %s - %s",
+			build.SourceName(), build.ProjectName, build.BuildName, build.Event)
+	}
+
+	err = w.deliver(c, builds...)
+	if nonce != "" && c.Response().Status >= http.StatusInternalServerError {
+		// Nothing was delivered, so let the sender retry
+		w.nonces.forget(nonce)
+	}
+	return err
+}
+
+// source returns the source with the given name, or nil. Every source is
+// always built, so the routes registered at startup stay valid across reloads.
+func (s *handlerState) source(name string) SourceAdapter {
+	for _, src := range s.sources {
+		if src.Name() == name {
+			return src
+		}
+	}
+	return nil
+}
+
+// singleBuild adapts the (BuildEvent, bool) result of most toBuildEvent
+// methods to the slice Parse returns
+func singleBuild(build BuildEvent, ok bool) []BuildEvent {
+	if !ok {
+		return nil
+	}
+	return []BuildEvent{build}
+}
+
+// jsonHasKeys reports whether body is a JSON object with every key, which
+// is how sources without a distinctive header are detected
+func jsonHasKeys(body []byte, keys ...string) bool {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(body, &object); err != nil {
+		return false
+	}
+	for _, key := range keys {
+		if _, ok := object[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
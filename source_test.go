@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// detectSource returns the name of the source /webhook hands the request
+// to, or "" when none recognises it
+func detectSource(t *testing.T, header http.Header, body string) string {
+	t.Helper()
+	sources, err := buildSources(&Config{}, http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range sources {
+		if src.Detect(header, []byte(body)) {
+			return src.Name()
+		}
+	}
+	return ""
+}
+
+// parseBuilds verifies and parses the request with src, failing the test
+// on errors
+func parseBuilds(t *testing.T, src SourceAdapter, header http.Header, body string) []BuildEvent {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, "/webhook/"+src.Name(), nil)
+	req.Header = header
+	if err := src.Verify(req, []byte(body)); err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+	builds, err := src.Parse(header, []byte(body))
+	if err != nil {
+		t.Fatalf("Parse() = %v", err)
+	}
+	return builds
+}
+
+// buildSummary is the part of a build event most source tests check
+type buildSummary struct {
+	ProjectName, BuildName, BuildURL, Event string
+}
+
+func summarize(builds []BuildEvent) []buildSummary {
+	var summaries []buildSummary
+	for _, build := range builds {
+		summaries = append(summaries, buildSummary{build.ProjectName, build.BuildName, build.BuildURL, build.Event})
+	}
+	return summaries
+}
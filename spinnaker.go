@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SpinnakerConfig configures the Spinnaker source. When Token is set,
+// requests must send it as "Authorization: Bearer <token>". DeckURL, when
+// set, links notifications to the execution in the Spinnaker UI.
+type SpinnakerConfig struct {
+	Token   string `yaml:"token"`
+	DeckURL string `yaml:"deck_url"`
+}
+
+// SpinnakerEvent is an event posted by Echo's REST event listener. With
+// wrap enabled the event is nested in payload, otherwise it is the body.
+type SpinnakerEvent struct {
+	Details *struct {
+		Type        string `json:"type"`
+		Application string `json:"application"`
+	} `json:"details,omitempty"`
+	Content *struct {
+		Execution *SpinnakerExecution `json:"execution,omitempty"`
+	} `json:"content,omitempty"`
+}
+
+type SpinnakerExecution struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Application string `json:"application"`
+	Status      string `json:"status"`
+	StartTime   int64  `json:"startTime"`
+	EndTime     int64  `json:"endTime"`
+	Trigger     struct {
+		Type string `json:"type"`
+		User string `json:"user"`
+	} `json:"trigger"`
+	Stages []struct {
+		Name   string `json:"name"`
+		Status string `json:"status"`
+	} `json:"stages"`
+}
+
+type spinnakerSource struct {
+	cfg SpinnakerConfig
+}
+
+func (s spinnakerSource) Name() string {
+	return "spinnaker"
+}
+
+func (s spinnakerSource) Detect(header http.Header, body []byte) bool {
+	payload, err := parseSpinnakerPayload(body)
+	return err == nil && payload.Details != nil && strings.HasPrefix(payload.Details.Type, "orca:")
+}
+
+func (s spinnakerSource) Verify(req *http.Request, body []byte) error {
+	if !s.cfg.verifyToken(req.Header.Get("Authorization")) {
+		return errInvalidToken
+	}
+	return nil
+}
+
+// Parse ignores the stage and task events Echo forwards along with
+// pipeline events
+func (s spinnakerSource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	payload, err := parseSpinnakerPayload(body)
+	if err != nil {
+		return nil, err
+	}
+	return singleBuild(payload.toBuildEvent(s.cfg.DeckURL)), nil
+}
+
+// parseSpinnakerPayload reads an event sent with or without Echo's wrap option
+func parseSpinnakerPayload(body []byte) (SpinnakerEvent, error) {
+	var wrapped struct {
+		Payload *SpinnakerEvent `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &wrapped); err != nil {
+		return SpinnakerEvent{}, err
+	}
+	if wrapped.Payload != nil {
+		return *wrapped.Payload, nil
+	}
+
+	var payload SpinnakerEvent
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return SpinnakerEvent{}, err
+	}
+	return payload, nil
+}
+
+// verifyToken checks the bearer token in the Authorization header
+func (c SpinnakerConfig) verifyToken(header string) bool {
+	return verifyBearerToken(header, c.Token)
+}
+
+// toBuildEvent converts orca pipeline starting, complete and failed events
+// into a BuildEvent named after the application and pipeline
+func (p SpinnakerEvent) toBuildEvent(deckURL string) (BuildEvent, bool) {
+	if p.Details == nil || p.Content == nil || p.Content.Execution == nil {
+		return BuildEvent{}, false
+	}
+	exec := p.Content.Execution
+
+	application := exec.Application
+	if application == "" {
+		application = p.Details.Application
+	}
+
+	build := BuildEvent{
+		Source:      "spinnaker",
+		ProjectName: application,
+		BuildName:   exec.Name,
+		RunID:       exec.ID,
+		Payload:     p,
+	}
+	if deckURL != "" {
+		build.BuildURL = strings.TrimSuffix(deckURL, "/") + "/#/applications/" +
+			url.PathEscape(application) + "/executions/details/" + url.PathEscape(exec.ID)
+	}
+
+	switch p.Details.Type {
+	case "orca:pipeline:starting":
+		build.Event = "started"
+	case "orca:pipeline:complete":
+		build.Event = "success"
+	case "orca:pipeline:failed":
+		build.Event = "failure"
+		if exec.Status == "CANCELED" {
+			build.Event = "aborted"
+		}
+	default:
+		return BuildEvent{}, false
+	}
+	if build.Event != "started" && exec.StartTime > 0 && exec.EndTime > exec.StartTime {
+		build.Duration = time.Duration(exec.EndTime-exec.StartTime) * time.Millisecond
+	}
+
+	if exec.Trigger.Type != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Trigger", Value: exec.Trigger.Type})
+	}
+	if exec.Trigger.User != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Triggered by", Value: exec.Trigger.User})
+	}
+	var failed []string
+	for _, stage := range exec.Stages {
+		if stage.Status == "TERMINAL" {
+			failed = append(failed, stage.Name)
+		}
+	}
+	if len(failed) > 0 {
+		build.Vars = append(build.Vars, BuildVar{Key: "Failed stages", Value: strings.Join(failed, ", ")})
+	}
+
+	return build, true
+}
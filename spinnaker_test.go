@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSpinnakerParse(t *testing.T) {
+	event := func(eventType, status string) string {
+		return `{"details": {"type": "` + eventType + `", "application": "shop"},
+		  "content": {"execution": {"id": "01HX", "name": "Deploy to prod", "application": "shop", "status": "` + status + `",
+		  "startTime": 1700000000000, "endTime": 1700000120000, "trigger": {"type": "manual", "user": "ana@example.com"},
+		  "stages": [{"name": "Bake", "status": "SUCCEEDED"}, {"name": "Deploy", "status": "TERMINAL"}]}}}`
+	}
+	executionURL := "https://spinnaker.example.com/#/applications/shop/executions/details/01HX"
+	tests := []struct {
+		name string
+		body string
+		want []buildSummary
+	}{
+		{"starting", event("orca:pipeline:starting", "RUNNING"), []buildSummary{{"shop", "Deploy to prod", executionURL, "started"}}},
+		{"complete", event("orca:pipeline:complete", "SUCCEEDED"), []buildSummary{{"shop", "Deploy to prod", executionURL, "success"}}},
+		{"failed", event("orca:pipeline:failed", "TERMINAL"), []buildSummary{{"shop", "Deploy to prod", executionURL, "failure"}}},
+		{"canceled", event("orca:pipeline:failed", "CANCELED"), []buildSummary{{"shop", "Deploy to prod", executionURL, "aborted"}}},
+		{"wrapped", `{"payload": ` + event("orca:pipeline:complete", "SUCCEEDED") + `}`, []buildSummary{{"shop", "Deploy to prod", executionURL, "success"}}},
+		{"stage event", event("orca:stage:complete", "SUCCEEDED"), nil},
+	}
+	src := spinnakerSource{cfg: SpinnakerConfig{DeckURL: "https://spinnaker.example.com/"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name := detectSource(t, http.Header{}, tt.body); name != "spinnaker" {
+				t.Errorf("detected as %q, want spinnaker", name)
+			}
+			builds := parseBuilds(t, src, http.Header{}, tt.body)
+			if got := summarize(builds); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("builds = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	build := parseBuilds(t, src, http.Header{}, event("orca:pipeline:failed", "TERMINAL"))[0]
+	if build.Duration != 2*time.Minute || build.RunID != "01HX" {
+		t.Errorf("duration %v and RunID %q, want 2m and the execution ID", build.Duration, build.RunID)
+	}
+	want := []BuildVar{
+		{Key: "Trigger", Value: "manual"},
+		{Key: "Triggered by", Value: "ana@example.com"},
+		{Key: "Failed stages", Value: "Deploy"},
+	}
+	if !reflect.DeepEqual(build.Vars, want) {
+		t.Errorf("vars = %+v, want %+v", build.Vars, want)
+	}
+}
+
+func TestSpinnakerVerify(t *testing.T) {
+	src := spinnakerSource{cfg: SpinnakerConfig{Token: "secret"}}
+	for auth, ok := range map[string]bool{"Bearer secret": true, "Bearer other": false, "": false} {
+		req, _ := http.NewRequest(http.MethodPost, "/webhook/spinnaker", nil)
+		req.Header.Set("Authorization", auth)
+		if err := src.Verify(req, nil); (err == nil) != ok {
+			t.Errorf("Verify() with %q = %v, want ok %v", auth, err, ok)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Stage is a stage of a pipeline build
+type Stage struct {
+	Name string
+	// Status is the stage's status in the pipeline REST API, such as
+	// SUCCESS, FAILED or NOT_EXECUTED
+	Status   string
+	Duration time.Duration
+}
+
+// stageEmojis mark the stages by status
+var stageEmojis = map[string]string{
+	"SUCCESS":      "✅",
+	"FAILED":       "❌",
+	"UNSTABLE":     "⚠️",
+	"ABORTED":      "⛔",
+	"NOT_EXECUTED": "⏭️",
+}
+
+// fetchStages reads the stages of the pipeline build at buildURL from the
+// pipeline REST API, returning nil for builds of other job types
+func (s jenkinsSource) fetchStages(buildURL string) ([]Stage, error) {
+	// wfapi/describe is the entry of the build in the job's wfapi/runs
+	resp, err := s.apiGet(buildURL, "wfapi/describe")
+	if err != nil || resp == nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var run struct {
+		Stages []struct {
+			Name           string `json:"name"`
+			Status         string `json:"status"`
+			DurationMillis int64  `json:"durationMillis"`
+		} `json:"stages"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&run); err != nil {
+		return nil, fmt.Errorf("error decoding pipeline stages: %w", err)
+	}
+
+	var stages []Stage
+	for _, stage := range run.Stages {
+		stages = append(stages, Stage{
+			Name:     stage.Name,
+			Status:   stage.Status,
+			Duration: time.Duration(stage.DurationMillis) * time.Millisecond,
+		})
+	}
+	return stages, nil
+}
+
+// addStages adds the stages of a completed pipeline build. Errors are
+// logged, as the build is notified either way.
+func (s jenkinsSource) addStages(build *BuildEvent, buildURL string) {
+	if build.Event == "started" {
+		return
+	}
+	stages, err := s.fetchStages(buildURL)
+	if err != nil {
+		log.Printf("Error fetching pipeline stages for %s %s: %v", build.ProjectName, build.BuildName, err)
+		return
+	}
+	build.Stages = stages
+	for _, stage := range stages {
+		if stage.Status == "FAILED" {
+			build.FailedStage = stage.Name
+			break
+		}
+	}
+}
+
+// formatStages shows a line per stage with its status and duration, the
+// failed ones in bold, and counts the stages that don't fit in limit
+// characters
+func formatStages(stages []Stage, limit int) string {
+	// Room for the line counting the rest
+	const moreRoom = 20
+	var lines []string
+	length := 0
+	for _, stage := range stages {
+		emoji, ok := stageEmojis[stage.Status]
+		if !ok {
+			emoji = "⏳"
+		}
+		name := strings.ReplaceAll(stage.Name, "*", "\\*")
+		if stage.Status == "FAILED" {
+			name = "**" + name + "**"
+		}
+		line := emoji + " " + name
+		if stage.Status != "NOT_EXECUTED" {
+			line += " · " + formatDuration(stage.Duration)
+		}
+		if length+utf8.RuneCountInString(line)+1 > limit-moreRoom {
+			break
+		}
+		lines = append(lines, line)
+		length += utf8.RuneCountInString(line) + 1
+	}
+	if more := len(stages) - len(lines); more > 0 {
+		lines = append(lines, fmt.Sprintf("…and %d more", more))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// TeamCity webhook payload structures, as sent by the tcWebHooks plugin's
+// JSON format. The build is either wrapped in a "build" object or sent flat.
+type TeamCityWebhook struct {
+	Build *TeamCityBuild `json:"build,omitempty"`
+}
+
+type TeamCityBuild struct {
+	NotifyType        string `json:"notifyType"`
+	BuildResult       string `json:"buildResult"`
+	BuildStatus       string `json:"buildStatus"`
+	BuildName         string `json:"buildName"`
+	BuildFullName     string `json:"buildFullName"`
+	BuildNumber       string `json:"buildNumber"`
+	ProjectName       string `json:"projectName"`
+	BuildStatusURL    string `json:"buildStatusUrl"`
+	BranchDisplayName string `json:"branchDisplayName"`
+	TriggeredBy       string `json:"triggeredBy"`
+	AgentName         string `json:"agentName"`
+}
+
+type teamcitySource struct{}
+
+func (s teamcitySource) Name() string {
+	return "teamcity"
+}
+
+func (s teamcitySource) Detect(header http.Header, body []byte) bool {
+	build, err := parseTeamCityPayload(body)
+	return err == nil && build.NotifyType != ""
+}
+
+// Verify accepts every request; tcWebHooks has no webhook secret
+func (s teamcitySource) Verify(req *http.Request, body []byte) error {
+	return nil
+}
+
+// Parse ignores responsibility changes, pre-finish and similar
+// notifications, which aren't build results
+func (s teamcitySource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	build, err := parseTeamCityPayload(body)
+	if err != nil {
+		return nil, err
+	}
+	return singleBuild(build.toBuildEvent()), nil
+}
+
+// parseTeamCityPayload reads the build from either the wrapped or the flat
+// JSON template
+func parseTeamCityPayload(body []byte) (TeamCityBuild, error) {
+	var payload TeamCityWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return TeamCityBuild{}, err
+	}
+	if payload.Build != nil {
+		return *payload.Build, nil
+	}
+
+	var build TeamCityBuild
+	if err := json.Unmarshal(body, &build); err != nil {
+		return TeamCityBuild{}, err
+	}
+	return build, nil
+}
+
+// toBuildEvent converts a TeamCity notification into a BuildEvent,
+// returning false for notify types that aren't build starts or results
+func (b TeamCityBuild) toBuildEvent() (BuildEvent, bool) {
+	build := BuildEvent{
+		Source:      "teamcity",
+		ProjectName: b.ProjectName,
+		BuildName:   b.BuildName + " #" + b.BuildNumber,
+		BuildURL:    b.BuildStatusURL,
+		Payload:     b,
+	}
+
+	switch b.NotifyType {
+	case "buildStarted":
+		build.Event = "started"
+	case "buildSuccessful", "buildFixed":
+		build.Event = "success"
+	case "buildFailed", "buildBroken":
+		build.Event = "failure"
+	case "buildInterrupted":
+		build.Event = "aborted"
+	case "buildFinished":
+		if strings.EqualFold(b.BuildResult, "success") {
+			build.Event = "success"
+		} else {
+			build.Event = "failure"
+		}
+	default:
+		return BuildEvent{}, false
+	}
+
+	if b.BranchDisplayName != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Branch", Value: b.BranchDisplayName})
+	}
+	if b.TriggeredBy != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Triggered by", Value: b.TriggeredBy})
+	}
+	if b.AgentName != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Agent", Value: b.AgentName})
+	}
+	// buildStatus carries TeamCity's own summary, e.g. "Tests failed: 3 (1 new)"
+	if build.Event == "failure" && b.BuildStatus != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Status", Value: b.BuildStatus})
+	}
+
+	return build, true
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestTeamCityParse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []buildSummary
+	}{
+		{
+			"wrapped build",
+			`{"build": {"notifyType": "buildStarted", "buildName": "Build", "buildNumber": "12", "projectName": "App", "buildStatusUrl": "https://tc.example.com/viewLog.html?buildId=1"}}`,
+			[]buildSummary{{"App", "Build #12", "https://tc.example.com/viewLog.html?buildId=1", "started"}},
+		},
+		{
+			"flat build",
+			`{"notifyType": "buildFinished", "buildResult": "failure", "buildName": "Build", "buildNumber": "12", "projectName": "App"}`,
+			[]buildSummary{{"App", "Build #12", "", "failure"}},
+		},
+		{
+			"finished successfully",
+			`{"notifyType": "buildFinished", "buildResult": "SUCCESS", "buildName": "Build", "buildNumber": "12", "projectName": "App"}`,
+			[]buildSummary{{"App", "Build #12", "", "success"}},
+		},
+		{
+			"responsibility change",
+			`{"notifyType": "responsibilityChanged", "buildName": "Build", "projectName": "App"}`,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name := detectSource(t, http.Header{}, tt.body); name != "teamcity" {
+				t.Errorf("detected as %q, want teamcity", name)
+			}
+			builds := parseBuilds(t, teamcitySource{}, http.Header{}, tt.body)
+			if got := summarize(builds); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("builds = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTeamCityFailureStatus(t *testing.T) {
+	body := `{"notifyType": "buildFailed", "buildStatus": "Tests failed: 3 (1 new)", "buildName": "Build", "buildNumber": "12", "projectName": "App"}`
+	builds := parseBuilds(t, teamcitySource{}, http.Header{}, body)
+	if status, _ := builds[0].variable("Status"); status != "Tests failed: 3 (1 new)" {
+		t.Errorf("status = %q, want TeamCity's summary", status)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TektonConfig configures the Tekton CloudEvents source. DashboardURL, when
+// set, is used to link notifications to the run in the Tekton Dashboard.
+type TektonConfig struct {
+	DashboardURL string `yaml:"dashboard_url"`
+}
+
+// tektonEventPrefix prefixes the type of every CloudEvent Tekton emits,
+// e.g. dev.tekton.event.pipelinerun.successful.v1
+const tektonEventPrefix = "dev.tekton.event."
+
+// TektonEventData is the CloudEvent data, holding whichever run changed
+type TektonEventData struct {
+	PipelineRun *TektonRun `json:"pipelineRun,omitempty"`
+	TaskRun     *TektonRun `json:"taskRun,omitempty"`
+}
+
+type TektonRun struct {
+	Metadata struct {
+		Name      string            `json:"name"`
+		Namespace string            `json:"namespace"`
+		Labels    map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Status struct {
+		StartTime      *time.Time        `json:"startTime,omitempty"`
+		CompletionTime *time.Time        `json:"completionTime,omitempty"`
+		Conditions     []TektonCondition `json:"conditions,omitempty"`
+	} `json:"status"`
+}
+
+type TektonCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+type tektonSource struct {
+	cfg TektonConfig
+}
+
+func (s tektonSource) Name() string {
+	return "tekton"
+}
+
+func (s tektonSource) Detect(header http.Header, body []byte) bool {
+	if !isCloudEvent(header) {
+		return false
+	}
+	event, err := parseCloudEvent(header, body)
+	return err == nil && strings.HasPrefix(event.Type, tektonEventPrefix)
+}
+
+// Verify accepts every request; Tekton doesn't sign its CloudEvents
+func (s tektonSource) Verify(req *http.Request, body []byte) error {
+	return nil
+}
+
+// Parse ignores running and unknown events, which repeat for every step
+func (s tektonSource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	event, err := parseCloudEvent(header, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload TektonEventData
+	if err := json.Unmarshal(event.Data, &payload); err != nil {
+		return nil, err
+	}
+	return singleBuild(payload.toBuildEvent(event.Type, s.cfg)), nil
+}
+
+// toBuildEvent converts a PipelineRun or TaskRun CloudEvent into a
+// BuildEvent, returning false for running and unknown events
+func (p TektonEventData) toBuildEvent(eventType string, cfg TektonConfig) (BuildEvent, bool) {
+	// The type is dev.tekton.event.<kind>.<state>.v1
+	parts := strings.Split(strings.TrimPrefix(eventType, tektonEventPrefix), ".")
+	if !strings.HasPrefix(eventType, tektonEventPrefix) || len(parts) != 3 {
+		return BuildEvent{}, false
+	}
+	kind, state := parts[0], parts[1]
+
+	var run *TektonRun
+	var ownerLabel, dashboardPath string
+	switch kind {
+	case "pipelinerun":
+		run, ownerLabel, dashboardPath = p.PipelineRun, "tekton.dev/pipeline", "pipelineruns"
+	case "taskrun":
+		run, ownerLabel, dashboardPath = p.TaskRun, "tekton.dev/task", "taskruns"
+	}
+	if run == nil {
+		return BuildEvent{}, false
+	}
+	meta := run.Metadata
+
+	build := BuildEvent{
+		Source:      "tekton",
+		ProjectName: meta.Labels[ownerLabel],
+		BuildName:   meta.Name,
+		Payload:     p,
+	}
+	if build.ProjectName == "" {
+		build.ProjectName = meta.Name
+	}
+	if cfg.DashboardURL != "" {
+		build.BuildURL = strings.TrimSuffix(cfg.DashboardURL, "/") +
+			"/#/namespaces/" + meta.Namespace + "/" + dashboardPath + "/" + meta.Name
+	}
+	if start, end := run.Status.StartTime, run.Status.CompletionTime; start != nil && end != nil && end.After(*start) {
+		build.Duration = end.Sub(*start)
+	}
+
+	// The Succeeded condition explains why a run failed, including cancellation
+	var succeeded TektonCondition
+	for _, cond := range run.Status.Conditions {
+		if cond.Type == "Succeeded" {
+			succeeded = cond
+		}
+	}
+
+	switch state {
+	case "started":
+		build.Event = "started"
+	case "successful":
+		build.Event = "success"
+	case "failed":
+		build.Event = "failure"
+		if strings.Contains(succeeded.Reason, "Cancelled") {
+			build.Event = "aborted"
+		}
+	default:
+		return BuildEvent{}, false
+	}
+
+	if meta.Namespace != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Namespace", Value: meta.Namespace})
+	}
+	if build.Event != "started" && build.Event != "success" {
+		if succeeded.Reason != "" {
+			build.Vars = append(build.Vars, BuildVar{Key: "Reason", Value: succeeded.Reason})
+		}
+		if succeeded.Message != "" {
+			build.Vars = append(build.Vars, BuildVar{Key: "Message", Value: succeeded.Message})
+		}
+	}
+
+	return build, true
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTektonParse(t *testing.T) {
+	run := func(reason string) string {
+		return `{"metadata": {"name": "app-run-x1", "namespace": "ci", "labels": {"tekton.dev/pipeline": "app"}},
+		  "status": {"startTime": "2026-10-14T12:00:00Z", "completionTime": "2026-10-14T12:03:00Z",
+		  "conditions": [{"type": "Succeeded", "status": "False", "reason": "` + reason + `"}]}}`
+	}
+	dashboard := "https://tekton.example.com/#/namespaces/ci/pipelineruns/app-run-x1"
+	tests := []struct {
+		name   string
+		header http.Header
+		body   string
+		want   []buildSummary
+	}{
+		{
+			"binary failed pipeline run",
+			http.Header{"Ce-Type": {"dev.tekton.event.pipelinerun.failed.v1"}},
+			`{"pipelineRun": ` + run("Failed") + `}`,
+			[]buildSummary{{"app", "app-run-x1", dashboard, "failure"}},
+		},
+		{
+			"structured cancelled pipeline run",
+			http.Header{"Content-Type": {"application/cloudevents+json"}},
+			`{"specversion": "1.0", "type": "dev.tekton.event.pipelinerun.failed.v1", "data": {"pipelineRun": ` + run("Cancelled") + `}}`,
+			[]buildSummary{{"app", "app-run-x1", dashboard, "aborted"}},
+		},
+		{
+			"running",
+			http.Header{"Ce-Type": {"dev.tekton.event.pipelinerun.running.v1"}},
+			`{"pipelineRun": ` + run("Running") + `}`,
+			nil,
+		},
+	}
+	src := tektonSource{cfg: TektonConfig{DashboardURL: "https://tekton.example.com/"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name := detectSource(t, tt.header, tt.body); name != "tekton" {
+				t.Errorf("detected as %q, want tekton", name)
+			}
+			builds := parseBuilds(t, src, tt.header, tt.body)
+			if got := summarize(builds); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("builds = %+v, want %+v", got, tt.want)
+			}
+			if len(builds) > 0 && builds[0].Duration != 3*time.Minute {
+				t.Errorf("duration = %v, want 3m", builds[0].Duration)
+			}
+		})
+	}
+}
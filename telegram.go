@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// TelegramConfig configures the Telegram destination
+type TelegramConfig struct {
+	BotToken string `yaml:"bot_token"`
+	ChatID   string `yaml:"chat_id"`
+}
+
+type telegramDestination struct {
+	destinationID
+	httpSender
+	cfg TelegramConfig
+}
+
+func (d *telegramDestination) Name() string {
+	return "telegram"
+}
+
+func (d *telegramDestination) pingAddress() string {
+	return "https://api.telegram.org"
+}
+
+func (d *telegramDestination) Send(build BuildEvent) error {
+	return d.sendToTelegram(d.convertToTelegramMessage(build))
+}
+
+// Telegram Bot API sendMessage payload
+type TelegramMessage struct {
+	ChatID                string `json:"chat_id"`
+	Text                  string `json:"text"`
+	ParseMode             string `json:"parse_mode,omitempty"`
+	DisableWebPagePreview bool   `json:"disable_web_page_preview,omitempty"`
+}
+
+// telegramEscaper escapes the characters MarkdownV2 reserves in plain text
+var telegramEscaper = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+// telegramURLEscaper escapes the characters MarkdownV2 reserves inside link targets
+var telegramURLEscaper = strings.NewReplacer(`\`, `\\`, ")", `\)`)
+
+func (d *telegramDestination) convertToTelegramMessage(build BuildEvent) TelegramMessage {
+	esc := telegramEscaper.Replace
+
+	lines := []string{
+		fmt.Sprintf("*%s*", esc(fmt.Sprintf("%s - %s", build.ProjectName, build.BuildName))),
+		fmt.Sprintf("*Status:* %s", esc(build.StatusText())),
+	}
+
+	if build.Duration > 0 {
+		lines = append(lines, fmt.Sprintf("*Duration:* %s", esc(formatDuration(build.Duration))))
+	}
+
+	for _, v := range build.Vars {
+		lines = append(lines, fmt.Sprintf("*%s:* %s", esc(v.Key), esc(v.Value)))
+	}
+
+	if build.BuildURL != "" {
+		lines = append(lines, fmt.Sprintf("[View build](%s)", telegramURLEscaper.Replace(build.BuildURL)))
+	}
+
+	return TelegramMessage{
+		ChatID:                d.cfg.ChatID,
+		Text:                  strings.Join(lines, "\n"),
+		ParseMode:             "MarkdownV2",
+		DisableWebPagePreview: true,
+	}
+}
+
+func (d *telegramDestination) sendToTelegram(message TelegramMessage) error {
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", d.cfg.BotToken)
+	if err := d.postJSON(url, message, nil); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully sent message to Telegram")
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTelegramSend(t *testing.T) {
+	server := newRecordingServer(t, http.StatusOK, `{"ok":true}`)
+	d := &telegramDestination{httpSender: server.sender(), cfg: TelegramConfig{BotToken: "123:abc", ChatID: "-100"}}
+	build := testBuild("my_app.v2", "failure")
+	build.BuildURL = "https://ci.example.com/job/(app)/1"
+
+	if err := d.Send(build); err != nil {
+		t.Fatal(err)
+	}
+	request := server.only(t)
+	if request.Path != "/bot123:abc/sendMessage" {
+		t.Errorf("path = %s, want the bot's sendMessage", request.Path)
+	}
+	var message TelegramMessage
+	request.decode(t, &message)
+	if message.ChatID != "-100" || message.ParseMode != "MarkdownV2" {
+		t.Errorf("message = %+v, want a MarkdownV2 message to the chat", message)
+	}
+	tests := []struct {
+		name, want string
+	}{
+		{"escaped title", `*my\_app\.v2 \- \#0*`},
+		{"duration", `*Duration:* 1m 30s`},
+		{"escaped link target", `[View build](https://ci.example.com/job/(app\)/1)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(message.Text, tt.want) {
+				t.Errorf("text %q doesn't contain %q", message.Text, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// maxFailedTests is how many failing tests are named in a notification
+const maxFailedTests = 5
+
+// TestSummary counts the test results of a build
+type TestSummary struct {
+	Passed, Failed, Skipped int
+	// Failures names the first failing tests, up to maxFailedTests
+	Failures []string
+}
+
+func (t TestSummary) String() string {
+	return fmt.Sprintf("%d passed, %d failed, %d skipped", t.Passed, t.Failed, t.Skipped)
+}
+
+// jenkinsTestReport is the testReport of a build in the Jenkins API: the
+// JUnit result of a build, or, for matrix and Maven builds, the results of
+// its child builds
+type jenkinsTestReport struct {
+	jenkinsTestResult
+	TotalCount   int `json:"totalCount"`
+	ChildReports []struct {
+		Result jenkinsTestResult `json:"result"`
+	} `json:"childReports"`
+}
+
+type jenkinsTestResult struct {
+	PassCount int `json:"passCount"`
+	FailCount int `json:"failCount"`
+	SkipCount int `json:"skipCount"`
+	Suites    []struct {
+		Cases []struct {
+			ClassName string `json:"className"`
+			Name      string `json:"name"`
+			Status    string `json:"status"`
+		} `json:"cases"`
+	} `json:"suites"`
+}
+
+// testReportTree limits the testReport response to what the summary needs
+const testReportTree = "passCount,failCount,skipCount,totalCount," +
+	"suites[cases[className,name,status]]," +
+	"childReports[result[passCount,failCount,skipCount,suites[cases[className,name,status]]]]"
+
+// fetchTestReport reads the test results of the build at buildURL from the
+// Jenkins API, returning nil when the build has none
+func (s jenkinsSource) fetchTestReport(buildURL string) (*TestSummary, error) {
+	resp, err := s.apiGet(buildURL, "testReport/api/json?tree="+testReportTree)
+	if err != nil || resp == nil {
+		// A nil response means the build didn't publish test results
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var report jenkinsTestReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("error decoding test report: %w", err)
+	}
+
+	results := []jenkinsTestResult{report.jenkinsTestResult}
+	if len(report.ChildReports) > 0 {
+		results = nil
+		for _, child := range report.ChildReports {
+			results = append(results, child.Result)
+		}
+	}
+
+	summary := &TestSummary{}
+	for _, result := range results {
+		summary.Passed += result.PassCount
+		summary.Failed += result.FailCount
+		summary.Skipped += result.SkipCount
+		for _, suite := range result.Suites {
+			for _, c := range suite.Cases {
+				if (c.Status == "FAILED" || c.Status == "REGRESSION") && len(summary.Failures) < maxFailedTests {
+					summary.Failures = append(summary.Failures, c.ClassName+"."+c.Name)
+				}
+			}
+		}
+	}
+	// Aggregated reports only count the total
+	if summary.Passed == 0 && report.TotalCount > 0 {
+		summary.Passed = report.TotalCount - summary.Failed - summary.Skipped
+	}
+	return summary, nil
+}
+
+// addTestReport adds the test results of a completed build. Errors are
+// logged, as the build is notified either way.
+func (s jenkinsSource) addTestReport(build *BuildEvent, buildURL string) {
+	if build.Event == "started" {
+		return
+	}
+	tests, err := s.fetchTestReport(buildURL)
+	if err != nil {
+		log.Printf("Error fetching test report for %s %s: %v", build.ProjectName, build.BuildName, err)
+		return
+	}
+	build.Tests = tests
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSConfig makes the server terminate TLS itself, for deployments without
+// a proxy in front of it, with the certificate in CertFile and KeyFile or
+// one obtained from Let's Encrypt (or another ACME CA) for ACMEHosts. With
+// RedirectPort set, plain HTTP requests on that port are redirected to
+// HTTPS. With ClientCAFile set, webhooks are only accepted from clients
+// presenting a certificate signed by one of its CAs.
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	RedirectPort string `yaml:"redirect_port"`
+	ClientCAFile string `yaml:"client_ca_file"`
+
+	ACMEHosts        []string `yaml:"acme_hosts"`
+	ACMEEmail        string   `yaml:"acme_email"`
+	ACMECacheDir     string   `yaml:"acme_cache_dir"`
+	ACMEDirectoryURL string   `yaml:"acme_directory_url"`
+}
+
+// defaultACMECacheDir is where obtained certificates are kept, so restarts
+// don't request new ones and run into the CA's rate limits
+const defaultACMECacheDir = "acme-certs"
+
+func (c TLSConfig) enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.acme()
+}
+
+func (c TLSConfig) acme() bool {
+	return len(c.ACMEHosts) > 0
+}
+
+// validate checks the TLS settings and that the key pair can be loaded
+func (c TLSConfig) validate(port string) error {
+	if !c.enabled() {
+		if c.RedirectPort != "" {
+			return errors.New("TLS_REDIRECT_PORT requires TLS_CERT_FILE and TLS_KEY_FILE, or TLS_ACME_HOSTS")
+		}
+		if c.ClientCAFile != "" {
+			return errors.New("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE, or TLS_ACME_HOSTS")
+		}
+		return nil
+	}
+	switch {
+	case c.acme() && (c.CertFile != "" || c.KeyFile != ""):
+		return errors.New("TLS_ACME_HOSTS can't be used with TLS_CERT_FILE and TLS_KEY_FILE")
+	case c.acme():
+		for _, host := range c.ACMEHosts {
+			if strings.ContainsAny(host, ":/") {
+				return fmt.Errorf("invalid TLS_ACME_HOSTS host name: %s", host)
+			}
+		}
+	case c.CertFile == "" || c.KeyFile == "":
+		return errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	default:
+		if _, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile); err != nil {
+			return fmt.Errorf("error loading TLS certificate: %w", err)
+		}
+	}
+	if c.RedirectPort != "" {
+		if _, err := strconv.Atoi(c.RedirectPort); err != nil {
+			return fmt.Errorf("invalid TLS_REDIRECT_PORT value: %s", c.RedirectPort)
+		}
+		if c.RedirectPort == port {
+			return errors.New("TLS_REDIRECT_PORT must differ from PORT")
+		}
+	}
+	if c.ClientCAFile != "" {
+		if _, err := loadCertPool(c.ClientCAFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acmeManager returns the certificate manager of ACME mode
+func (c TLSConfig) acmeManager() *autocert.Manager {
+	cacheDir := c.ACMECacheDir
+	if cacheDir == "" {
+		cacheDir = defaultACMECacheDir
+	}
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(c.ACMEHosts...),
+		Cache:      autocert.DirCache(cacheDir),
+		Email:      c.ACMEEmail,
+	}
+	if c.ACMEDirectoryURL != "" {
+		manager.Client = &acme.Client{DirectoryURL: c.ACMEDirectoryURL}
+	}
+	return manager
+}
+
+// serverTLSConfig builds the TLS settings the server listens with. In ACME
+// mode manager provides the certificates, otherwise they are read from the
+// certificate files.
+func (c TLSConfig) serverTLSConfig(manager *autocert.Manager) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if manager != nil {
+		// Answer TLS-ALPN-01 challenges as well as serving certificates,
+		// so the CA can verify the host on the HTTPS port alone
+		config.GetCertificate = manager.GetCertificate
+		config.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+	} else {
+		certs, err := newCertificateLoader(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.GetCertificate = certs.getCertificate
+	}
+
+	if c.ClientCAFile != "" {
+		pool, err := loadCertPool(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		// Certificates are verified when given and required by the webhook
+		// routes, so health checks from load balancers and probes without
+		// a certificate still get through
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// loadCertPool reads the PEM encoded CA certificates in path
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in client CA %s", path)
+	}
+	return pool, nil
+}
+
+// requireClientCert rejects requests that didn't present a client
+// certificate signed by the client CA. The handshake has already verified
+// any certificate that was presented.
+func requireClientCert(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if state := c.Request().TLS; state == nil || len(state.VerifiedChains) == 0 {
+			log.Printf("Rejected request from %s: no client certificate", c.Request().RemoteAddr)
+			auditRequest(c).Auth = "client_certificate_required"
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Client certificate required"})
+		}
+		return next(c)
+	}
+}
+
+// certificateLoader serves the certificate in CertFile and KeyFile, loading
+// it again when the files change so renewed certificates are picked up
+// without a restart
+type certificateLoader struct {
+	certFile, keyFile string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modified time.Time
+	checked  time.Time
+}
+
+func newCertificateLoader(certFile, keyFile string) (*certificateLoader, error) {
+	l := &certificateLoader{certFile: certFile, keyFile: keyFile}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *certificateLoader) load() error {
+	info, err := os.Stat(l.certFile)
+	if err != nil {
+		return fmt.Errorf("error loading TLS certificate: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading TLS certificate: %w", err)
+	}
+	l.cert, l.modified = &cert, info.ModTime()
+	return nil
+}
+
+// getCertificate checks the certificate file for changes at most every few
+// seconds. A certificate that fails to load is logged and the current one
+// is kept, as it may be caught halfway through being replaced.
+func (l *certificateLoader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if time.Since(l.checked) > 10*time.Second {
+		l.checked = time.Now()
+		if info, err := os.Stat(l.certFile); err == nil && !info.ModTime().Equal(l.modified) {
+			if err := l.load(); err != nil {
+				log.Printf("Error reloading TLS certificate, keeping the current one: %v", err)
+			} else {
+				log.Printf("Reloaded TLS certificate")
+			}
+		}
+	}
+	return l.cert, nil
+}
+
+// redirectToHTTPS serves plain HTTP on port, redirecting every request to
+// the same URL on the HTTPS port. In ACME mode it also answers the CA's
+// HTTP-01 challenges.
+func redirectToHTTPS(port, httpsPort string, manager *autocert.Manager) {
+	redirect := echo.New()
+	redirect.HideBanner = true
+	redirect.HidePort = true
+	redirect.Any("/*", func(c echo.Context) error {
+		host, _, err := net.SplitHostPort(c.Request().Host)
+		if err != nil {
+			host = c.Request().Host
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		return c.Redirect(http.StatusMovedPermanently, "https://"+host+c.Request().RequestURI)
+	})
+
+	var handler http.Handler = redirect
+	if manager != nil {
+		handler = manager.HTTPHandler(redirect)
+	}
+
+	log.Printf("Redirecting HTTP on port %s to HTTPS", port)
+	if err := http.ListenAndServe(":"+port, handler); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Error serving HTTP redirects: %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// durationHistory is how many recent build durations a job's average uses
+const durationHistory = 10
+
+// unreleasedLimit is how many commits of unsuccessful builds are kept per
+// job for the release notes of its next successful build
+const unreleasedLimit = 100
+
+// startedTTL is how long a build is remembered as started, so builds whose
+// completion is never seen don't pile up
+const startedTTL = 24 * time.Hour
+
+// buildTracker remembers when builds started so completion events, which
+// carry no timing information, can report how long the build took. It also
+// keeps the durations of each job's recent builds, to estimate how long the
+// next one takes, and the commits built since its last successful build.
+type buildTracker struct {
+	mu         sync.Mutex
+	started    map[string]time.Time
+	swept      time.Time
+	durations  map[string][]time.Duration
+	unreleased map[string][]Commit
+}
+
+func newBuildTracker() *buildTracker {
+	return &buildTracker{
+		started:    make(map[string]time.Time),
+		durations:  make(map[string][]time.Duration),
+		unreleased: make(map[string][]Commit),
+	}
+}
+
+// track records started events and returns the elapsed time for any other
+// event of a build that was seen starting, or zero when it is unknown or
+// started more than startedTTL ago
+func (t *buildTracker) track(build BuildEvent) time.Duration {
+	key := build.Source + "/" + build.ProjectName + "#" + build.BuildName
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if build.Event == "started" {
+		now := time.Now()
+		if now.Sub(t.swept) > time.Minute {
+			t.swept = now
+			for k, start := range t.started {
+				if now.Sub(start) > startedTTL {
+					delete(t.started, k)
+				}
+			}
+		}
+		t.started[key] = now
+		return 0
+	}
+
+	start, ok := t.started[key]
+	delete(t.started, key)
+	if elapsed := time.Since(start); ok && elapsed <= startedTTL {
+		return elapsed
+	}
+	return 0
+}
+
+// estimate sets how long a started build is expected to take, unless the
+// source knows, and compares a finished build's duration with the average
+// of the job's earlier builds. Successful and unstable builds are added to
+// that average; failed and aborted ones often end early.
+func (t *buildTracker) estimate(build *BuildEvent) {
+	key := build.Source + "/" + build.ProjectName
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	average := averageDuration(t.durations[key])
+	if build.Event == "started" {
+		if build.EstimatedDuration == 0 {
+			build.EstimatedDuration = average
+		}
+		return
+	}
+	if build.Duration <= 0 {
+		return
+	}
+	build.AverageDuration = average
+	if build.Event == "success" || build.Event == "unstable" {
+		durations := append(t.durations[key], build.Duration)
+		if len(durations) > durationHistory {
+			durations = durations[len(durations)-durationHistory:]
+		}
+		t.durations[key] = durations
+	}
+}
+
+// collectChanges gathers the commits of a job's builds until one succeeds,
+// which gets them all, its own included, as its ReleaseCommits
+func (t *buildTracker) collectChanges(build *BuildEvent) {
+	if build.Event == "started" {
+		return
+	}
+	key := build.Source + "/" + build.ProjectName
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	commits := t.unreleased[key]
+	for _, commit := range build.Commits {
+		if !containsCommit(commits, commit) {
+			commits = append(commits, commit)
+		}
+	}
+	if build.Event == "success" {
+		build.ReleaseCommits = commits
+		delete(t.unreleased, key)
+		return
+	}
+	if len(commits) > unreleasedLimit {
+		commits = commits[len(commits)-unreleasedLimit:]
+	}
+	t.unreleased[key] = commits
+}
+
+// containsCommit reports whether a commit with the same ID, or the same
+// message when there are no IDs, is in commits
+func containsCommit(commits []Commit, commit Commit) bool {
+	for _, c := range commits {
+		if (commit.ID != "" && c.ID == commit.ID) || (commit.ID == "" && c.ID == "" && c.Message == commit.Message) {
+			return true
+		}
+	}
+	return false
+}
+
+func averageDuration(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	return total / time.Duration(len(durations))
+}
+
+// formatETA shows how long a started build is expected to take and when it
+// should finish, e.g. "5m 30s, around 15:42"
+func formatETA(build BuildEvent) string {
+	finish := build.Time.Add(build.EstimatedDuration)
+	return formatDuration(build.EstimatedDuration) + ", around " + finish.Format("15:04")
+}
+
+// compareDuration compares a build's duration with the average, e.g.
+// "+34% slower than average"
+func compareDuration(duration, average time.Duration) string {
+	if average <= 0 {
+		return ""
+	}
+	percent := int(math.Round(float64(duration-average) / float64(average) * 100))
+	switch {
+	case percent >= 5:
+		return fmt.Sprintf("+%d%% slower than average", percent)
+	case percent <= -5:
+		return fmt.Sprintf("%d%% faster than average", percent)
+	default:
+		return "about average"
+	}
+}
+
+// formatDuration renders a duration the way Jenkins does, e.g. "1h 2m 3s"
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := d / time.Hour
+	m := (d % time.Hour) / time.Minute
+	s := (d % time.Minute) / time.Second
+
+	switch {
+	case h > 0:
+		return fmt.Sprintf("%dh %dm %ds", h, m, s)
+	case m > 0:
+		return fmt.Sprintf("%dm %ds", m, s)
+	default:
+		return fmt.Sprintf("%ds", s)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrackForgetsStaleBuilds(t *testing.T) {
+	tracker := newBuildTracker()
+	tracker.started["jenkins/stale#1"] = time.Now().Add(-startedTTL - time.Minute)
+	tracker.started["jenkins/recent#1"] = time.Now().Add(-time.Hour)
+
+	tracker.track(BuildEvent{Source: "jenkins", ProjectName: "new", BuildName: "1", Event: "started"})
+	if _, ok := tracker.started["jenkins/stale#1"]; ok {
+		t.Error("stale build is still tracked after a started event")
+	}
+	if _, ok := tracker.started["jenkins/recent#1"]; !ok {
+		t.Error("recent build was forgotten")
+	}
+
+	tests := []struct {
+		name    string
+		started time.Duration
+		want    bool
+	}{
+		{"recent", time.Hour, true},
+		{"older than the TTL", startedTTL + time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker.started["jenkins/job#2"] = time.Now().Add(-tt.started)
+			elapsed := tracker.track(BuildEvent{Source: "jenkins", ProjectName: "job", BuildName: "2", Event: "success"})
+			if got := elapsed > 0; got != tt.want {
+				t.Errorf("track() = %s, want elapsed time %v", elapsed, tt.want)
+			}
+			if _, ok := tracker.started["jenkins/job#2"]; ok {
+				t.Error("finished build is still tracked")
+			}
+		})
+	}
+}
+
+func TestTrackKeepsSourcesApart(t *testing.T) {
+	tracker := newBuildTracker()
+	tracker.started["jenkins/job#1"] = time.Now().Add(-time.Hour)
+
+	tracker.track(BuildEvent{Source: "gitlab", ProjectName: "job", BuildName: "1", Event: "started"})
+	elapsed := tracker.track(BuildEvent{Source: "jenkins", ProjectName: "job", BuildName: "1", Event: "success"})
+	if elapsed < time.Hour {
+		t.Errorf("track() = %s, want the Jenkins build's hour, not the GitLab start", elapsed)
+	}
+	if _, ok := tracker.started["gitlab/job#1"]; !ok {
+		t.Error("GitLab build was forgotten when the Jenkins one finished")
+	}
+}
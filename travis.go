@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultTravisAPIURL = "https://api.travis-ci.com"
+
+// TravisConfig configures the Travis CI webhook source. Notifications are
+// always verified against Travis's public key: PublicKey when set, otherwise
+// the key published at APIURL/config.
+type TravisConfig struct {
+	PublicKey string `yaml:"public_key"`
+	APIURL    string `yaml:"api_url"`
+}
+
+// Travis CI webhook payload structures. The JSON arrives form-encoded in the
+// payload field.
+type TravisWebhook struct {
+	Number        string            `json:"number"`
+	Type          string            `json:"type"`
+	State         string            `json:"state"`
+	StatusMessage string            `json:"status_message"`
+	Duration      int64             `json:"duration"`
+	BuildURL      string            `json:"build_url"`
+	Commit        string            `json:"commit"`
+	Branch        string            `json:"branch"`
+	Message       string            `json:"message"`
+	AuthorName    string            `json:"author_name"`
+	Repository    *TravisRepository `json:"repository,omitempty"`
+}
+
+type TravisRepository struct {
+	Name      string `json:"name"`
+	OwnerName string `json:"owner_name"`
+}
+
+// travisVerifier checks Travis notification signatures, fetching and caching
+// the public key from the Travis API when none is configured
+type travisVerifier struct {
+	client *http.Client
+	apiURL string
+
+	mu  sync.Mutex
+	key *rsa.PublicKey
+}
+
+func newTravisVerifier(cfg TravisConfig, client *http.Client) (*travisVerifier, error) {
+	v := &travisVerifier{
+		client: client,
+		apiURL: strings.TrimSuffix(cfg.APIURL, "/"),
+	}
+	if cfg.PublicKey != "" {
+		key, err := parseTravisPublicKey(cfg.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRAVIS_PUBLIC_KEY: %w", err)
+		}
+		v.key = key
+	}
+	return v, nil
+}
+
+// parseTravisPublicKey decodes a PEM encoded RSA public key
+func parseTravisPublicKey(value string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(value))
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not an RSA public key")
+	}
+	return key, nil
+}
+
+// publicKey returns the configured key or fetches it from the Travis API
+func (v *travisVerifier) publicKey() (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.key != nil {
+		return v.key, nil
+	}
+
+	resp, err := v.client.Get(v.apiURL + "/config")
+	if err != nil {
+		return nil, fmt.Errorf("error fetching Travis config: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("Travis config returned status: %d", resp.StatusCode)
+	}
+
+	var config struct {
+		Config struct {
+			Notifications struct {
+				Webhook struct {
+					PublicKey string `json:"public_key"`
+				} `json:"webhook"`
+			} `json:"notifications"`
+		} `json:"config"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+		return nil, fmt.Errorf("error decoding Travis config: %w", err)
+	}
+
+	key, err := parseTravisPublicKey(config.Config.Notifications.Webhook.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Travis public key: %w", err)
+	}
+	v.key = key
+	return key, nil
+}
+
+// verify checks the base64 RSA-SHA1 signature Travis sends in the Signature
+// header over the raw payload field
+func (v *travisVerifier) verify(payload, signature string) error {
+	key, err := v.publicKey()
+	if err != nil {
+		return err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("error decoding signature: %w", err)
+	}
+
+	digest := sha1.Sum([]byte(payload))
+	return rsa.VerifyPKCS1v15(key, crypto.SHA1, digest[:], sig)
+}
+
+type travisSource struct {
+	verifier *travisVerifier
+}
+
+func (s travisSource) Name() string {
+	return "travis"
+}
+
+func (s travisSource) Detect(header http.Header, body []byte) bool {
+	return header.Get("Travis-Repo-Slug") != ""
+}
+
+func (s travisSource) Verify(req *http.Request, body []byte) error {
+	raw, err := travisPayload(body)
+	if err != nil {
+		return err
+	}
+	return s.verifier.verify(raw, req.Header.Get("Signature"))
+}
+
+// signedAt reports every request as signed, as Travis CI always signs
+// them. The signature doesn't cover a send time.
+func (s travisSource) signedAt(header http.Header) (time.Time, bool) {
+	return time.Time{}, true
+}
+
+func (s travisSource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	raw, err := travisPayload(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload TravisWebhook
+	if err := json.Unmarshal([]byte(raw), &payload); err != nil {
+		return nil, err
+	}
+	return singleBuild(payload.toBuildEvent()), nil
+}
+
+// travisPayload extracts the JSON Travis sends form-encoded in the payload field
+func travisPayload(body []byte) (string, error) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return "", err
+	}
+	raw := form.Get("payload")
+	if raw == "" {
+		return "", errors.New("missing payload field")
+	}
+	return raw, nil
+}
+
+// toBuildEvent converts a Travis build notification into a BuildEvent,
+// returning false for created and other intermediate states
+func (p TravisWebhook) toBuildEvent() (BuildEvent, bool) {
+	if p.Repository == nil {
+		return BuildEvent{}, false
+	}
+
+	build := BuildEvent{
+		Source:      "travis",
+		ProjectName: p.Repository.OwnerName + "/" + p.Repository.Name,
+		BuildName:   "#" + p.Number,
+		BuildURL:    p.BuildURL,
+		Duration:    time.Duration(p.Duration) * time.Second,
+		Payload:     p,
+	}
+
+	switch p.State {
+	case "started":
+		build.Event = "started"
+		build.Duration = 0
+	case "passed":
+		build.Event = "success"
+	case "failed", "errored":
+		build.Event = "failure"
+	case "canceled":
+		build.Event = "aborted"
+	default:
+		return BuildEvent{}, false
+	}
+
+	if p.Branch != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Branch", Value: p.Branch})
+	}
+	if len(p.Commit) >= 8 {
+		build.Vars = append(build.Vars, BuildVar{Key: "Commit", Value: p.Commit[:8]})
+	}
+	if p.AuthorName != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Author", Value: p.AuthorName})
+	}
+	if message, _, _ := strings.Cut(strings.TrimSpace(p.Message), "\n"); message != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Message", Value: message})
+	}
+	// Travis distinguishes e.g. "Fixed" and "Still Failing" from plain results
+	if p.StatusMessage != "" && build.Event != "started" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Result", Value: p.StatusMessage})
+	}
+
+	return build, true
+}
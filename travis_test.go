@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+)
+
+func TestTravisVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(key *rsa.PrivateKey, payload string) string {
+		digest := sha1.Sum([]byte(payload))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(sig)
+	}
+	payload := `{"id":1,"state":"failed"}`
+	verifier := &travisVerifier{key: &key.PublicKey}
+
+	tests := []struct {
+		name      string
+		payload   string
+		signature string
+		ok        bool
+	}{
+		{"valid", payload, sign(key, payload), true},
+		{"tampered payload", `{"id":1,"state":"passed"}`, sign(key, payload), false},
+		{"signed with another key", payload, sign(other, payload), false},
+		{"not base64", payload, "not base64!", false},
+		{"missing", payload, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifier.verify(tt.payload, tt.signature)
+			if ok := err == nil; ok != tt.ok {
+				t.Errorf("verify() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseTravisPublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"PEM", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), true},
+		{"not PEM", "not a key", false},
+		{"not a public key", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("garbage")})), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseTravisPublicKey(tt.value)
+			if ok := err == nil; ok != tt.ok {
+				t.Fatalf("parseTravisPublicKey() error = %v, want ok %v", err, tt.ok)
+			}
+			if tt.ok && !parsed.Equal(&key.PublicKey) {
+				t.Errorf("parseTravisPublicKey() returned another key")
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TwilioConfig configures the Twilio SMS destination
+type TwilioConfig struct {
+	AccountSID string   `yaml:"account_sid"`
+	AuthToken  string   `yaml:"auth_token"`
+	FromNumber string   `yaml:"from_number"`
+	ToNumbers  []string `yaml:"to_numbers"`
+}
+
+type twilioDestination struct {
+	destinationID
+	httpSender
+	cfg TwilioConfig
+}
+
+func (d *twilioDestination) Name() string {
+	return "twilio"
+}
+
+func (d *twilioDestination) pingAddress() string {
+	return "https://api.twilio.com"
+}
+
+func (d *twilioDestination) Send(build BuildEvent) error {
+	// SMS is reserved for failures so critical pipelines page without noise
+	if !isFailureEvent(build.Event) {
+		return nil
+	}
+	return d.sendSMS(d.convertToSMSText(build))
+}
+
+// convertToSMSText renders a short single-segment friendly summary
+func (d *twilioDestination) convertToSMSText(build BuildEvent) string {
+	text := fmt.Sprintf("%s: %s %s %s", build.SourceName(), build.ProjectName, build.BuildName, strings.ToUpper(build.Event))
+	if build.BuildURL != "" {
+		text += " " + build.BuildURL
+	}
+	return text
+}
+
+func (d *twilioDestination) sendSMS(text string) error {
+	endpoint := fmt.Sprintf("https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json",
+		url.PathEscape(d.cfg.AccountSID))
+
+	// Twilio takes one recipient per message, so keep going past failures
+	var errs []error
+	for _, to := range d.cfg.ToNumbers {
+		form := url.Values{
+			"From": {d.cfg.FromNumber},
+			"To":   {to},
+			"Body": {text},
+		}
+
+		req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return fmt.Errorf("error creating request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(d.cfg.AccountSID, d.cfg.AuthToken)
+
+		if err := d.sendRequest(req); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", to, err))
+			continue
+		}
+
+		log.Printf("Successfully sent SMS to %s", to)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestTwilioSend(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    string
+		requests int
+	}{
+		{"failure", "failure", 2},
+		{"success", "success", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRecordingServer(t, http.StatusCreated, `{"sid":"SM1"}`)
+			d := &twilioDestination{httpSender: server.sender(), cfg: TwilioConfig{
+				AccountSID: "AC1", AuthToken: "token", FromNumber: "+15550000",
+				ToNumbers: []string{"+15551111", "+15552222"},
+			}}
+			build := testBuild("app", tt.event)
+			build.BuildURL = "https://ci.example.com/job/app/1/"
+
+			if err := d.Send(build); err != nil {
+				t.Fatal(err)
+			}
+			requests := server.requests()
+			if len(requests) != tt.requests {
+				t.Fatalf("got %d requests, want %d", len(requests), tt.requests)
+			}
+			for i, request := range requests {
+				if request.Path != "/2010-04-01/Accounts/AC1/Messages.json" {
+					t.Errorf("path = %s, want the account's messages", request.Path)
+				}
+				if user, password, ok := (&http.Request{Header: request.Header}).BasicAuth(); !ok || user != "AC1" || password != "token" {
+					t.Errorf("basic auth = %q:%q, want the account's", user, password)
+				}
+				form, _ := url.ParseQuery(string(request.Body))
+				if form.Get("To") != d.cfg.ToNumbers[i] || form.Get("From") != "+15550000" {
+					t.Errorf("form = %v, want a message from the number to %s", form, d.cfg.ToNumbers[i])
+				}
+				if want := "Jenkins: app #0 FAILURE https://ci.example.com/job/app/1/"; form.Get("Body") != want {
+					t.Errorf("body = %q, want %q", form.Get("Body"), want)
+				}
+			}
+		})
+	}
+}
+
+func TestTwilioSendKeepsGoing(t *testing.T) {
+	server := newRecordingServer(t, http.StatusBadRequest, `{"code":21211}`)
+	d := &twilioDestination{httpSender: server.sender(), cfg: TwilioConfig{
+		AccountSID: "AC1", AuthToken: "token", ToNumbers: []string{"+1", "+2"},
+	}}
+
+	if err := d.Send(testBuild("app", "failure")); !hasStatus(err, http.StatusBadRequest) {
+		t.Errorf("error = %v, want the 400 returned", err)
+	}
+	if requests := server.requests(); len(requests) != 2 {
+		t.Errorf("got %d requests, want every number tried", len(requests))
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// pingable is implemented by destinations that can say where they deliver,
+// as an http(s) URL or a tcp:// or tls:// address, so validate --ping can
+// check it is reachable without sending anything
+type pingable interface {
+	pingAddress() string
+}
+
+// validate loads the configuration the way serve does, renders every
+// template against a test build and, with --ping, connects to each
+// destination. It fails if any of these does, so it can gate deploys in CI.
+func validate(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	configPath := configFlag(flags)
+	ping := flags.Bool("ping", false, "connect to every destination without sending a notification")
+	timeout := flags.Duration("timeout", 5*time.Second, "how long each --ping connection may take")
+	flags.Parse(args)
+
+	// Loading compiles the notification templates and job patterns; building
+	// the handler compiles the destination templates and Discord routes
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	handler, err := NewWebhookHandler(config)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	state := handler.state.Load()
+
+	if err := state.checkTemplates(); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, d := range state.destinations {
+		if !*ping {
+			fmt.Printf("%s: configured\n", d.ID())
+			continue
+		}
+
+		p, ok := d.(pingable)
+		if !ok {
+			fmt.Printf("%s: configured, cannot be pinged\n", d.ID())
+			continue
+		}
+		if err := pingAddress(p.pingAddress(), *timeout); err != nil {
+			fmt.Printf("%s: %v\n", d.ID(), err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: reachable\n", d.ID())
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d destinations are unreachable", failed, len(state.destinations))
+	}
+
+	fmt.Println("Configuration is valid")
+	return nil
+}
+
+// checkTemplates renders the notification templates and the generic webhook
+// body for a test build of every event, catching the errors that only show
+// when a template runs, such as unknown fields
+func (s *handlerState) checkTemplates() error {
+	for _, event := range []string{"started", "success", "failure", "unstable", "aborted"} {
+		build := testBuild("test-project", event)
+
+		if err := s.notifications.checkTemplates(newTemplateData(build)); err != nil {
+			return fmt.Errorf("invalid notifications template: %w", err)
+		}
+		for i, job := range s.jobs {
+			if err := job.checkTemplates(newTemplateData(build)); err != nil {
+				return fmt.Errorf("invalid template in job override %d: %w", i, err)
+			}
+		}
+		for _, d := range s.destinations {
+			if generic, ok := d.(*genericDestination); ok {
+				if _, err := generic.renderGenericBody(build); err != nil {
+					return fmt.Errorf("invalid generic webhook template: %w", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// pingAddress opens a connection to address and, for https and tls://,
+// completes the TLS handshake so certificate problems show up too
+func pingAddress(address string, timeout time.Duration) error {
+	u, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", address, err)
+	}
+	if u.Host == "" {
+		return errors.New("no address to ping")
+	}
+
+	host := u.Host
+	useTLS := false
+	switch u.Scheme {
+	case "https":
+		useTLS = true
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+	case "http":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	case "tls":
+		useTLS = true
+	case "tcp":
+	default:
+		return fmt.Errorf("cannot ping %s:// addresses", u.Scheme)
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	if useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %w", host, err)
+	}
+	return conn.Close()
+}
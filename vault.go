@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// vaultPrefix marks a setting whose value is read from Vault, as in
+// vault:secret/path#key
+const vaultPrefix = "vault:"
+
+// VaultConfig configures the HashiCorp Vault server that vault: settings
+// are read from
+type VaultConfig struct {
+	Address   string `yaml:"address"`
+	Token     string `yaml:"token"`
+	Namespace string `yaml:"namespace"`
+}
+
+func (c VaultConfig) enabled() bool {
+	return c.Address != "" && c.Token != ""
+}
+
+// vaultClient reads secrets over the Vault HTTP API
+type vaultClient struct {
+	client *http.Client
+	cfg    VaultConfig
+
+	// kvVersions caches the KV engine version of each mount by path prefix
+	kvVersions map[string]vaultMount
+}
+
+type vaultMount struct {
+	path    string
+	version string
+}
+
+func newVaultClient(cfg VaultConfig) *vaultClient {
+	return &vaultClient{
+		client:     &http.Client{Timeout: 30 * time.Second},
+		cfg:        cfg,
+		kvVersions: map[string]vaultMount{},
+	}
+}
+
+// resolveVaultSecrets replaces every vault: setting in cfg with the secret
+// it references. Secrets are read again on every load, so a reload picks up
+// changed values.
+func resolveVaultSecrets(cfg *Config) error {
+	var refs []settingRef
+	collectRefs(reflect.ValueOf(cfg).Elem(), vaultPrefix, &refs)
+	if len(refs) == 0 {
+		return nil
+	}
+	if !cfg.Vault.enabled() {
+		return fmt.Errorf("%s settings require VAULT_ADDR and VAULT_TOKEN", vaultPrefix)
+	}
+
+	vault := newVaultClient(cfg.Vault)
+	for _, ref := range refs {
+		secret, err := vault.readRef(ref.value)
+		if err != nil {
+			return err
+		}
+		ref.set(secret)
+	}
+	return nil
+}
+
+// settingRef is a setting whose value stands for a secret held elsewhere,
+// such as in Vault, and how to replace it
+type settingRef struct {
+	value string
+	set   func(string)
+}
+
+// collectRefs finds the settings under v whose value starts with prefix,
+// including list entries and map values such as generic webhook headers
+func collectRefs(v reflect.Value, prefix string, refs *[]settingRef) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() && strings.HasPrefix(v.String(), prefix) {
+			*refs = append(*refs, settingRef{value: v.String(), set: v.SetString})
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				collectRefs(v.Field(i), prefix, refs)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			collectRefs(v.Index(i), prefix, refs)
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			key, value := iter.Key(), iter.Value().String()
+			if strings.HasPrefix(value, prefix) {
+				*refs = append(*refs, settingRef{value: value, set: func(secret string) {
+					v.SetMapIndex(key, reflect.ValueOf(secret).Convert(v.Type().Elem()))
+				}})
+			}
+		}
+	}
+}
+
+// readRef reads the value of a vault:path#key reference
+func (v *vaultClient) readRef(ref string) (string, error) {
+	path, key, ok := strings.Cut(strings.TrimPrefix(ref, vaultPrefix), "#")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("invalid Vault reference %q: expected vault:path#key", ref)
+	}
+
+	data, err := v.read(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s from Vault: %w", path, err)
+	}
+	value, ok := data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("Vault secret %s has no string key %q", path, key)
+	}
+	return value, nil
+}
+
+// read returns the data of the secret at path, reading KV version 2 mounts
+// through their data/ endpoint the way the Vault CLI does
+func (v *vaultClient) read(path string) (map[string]interface{}, error) {
+	path = strings.Trim(path, "/")
+	mount := v.mount(path)
+	apiPath := path
+	if mount.version == "2" {
+		apiPath = mount.path + "data/" + strings.TrimPrefix(path, mount.path)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := v.do("GET", apiPath, nil, &secret); err != nil {
+		return nil, err
+	}
+	if mount.version == "2" {
+		data, _ := secret.Data["data"].(map[string]interface{})
+		return data, nil
+	}
+	return secret.Data, nil
+}
+
+// mount looks up the mount holding path and its KV version. Tokens without
+// access to the lookup are assumed to read a KV version 1 or non-KV engine.
+func (v *vaultClient) mount(path string) vaultMount {
+	for prefix, mount := range v.kvVersions {
+		if strings.HasPrefix(path, prefix) {
+			return mount
+		}
+	}
+
+	var info struct {
+		Data struct {
+			Path    string `json:"path"`
+			Options struct {
+				Version string `json:"version"`
+			} `json:"options"`
+		} `json:"data"`
+	}
+	if err := v.do("GET", "sys/internal/ui/mounts/"+path, nil, &info); err != nil {
+		return vaultMount{}
+	}
+
+	mount := vaultMount{path: info.Data.Path, version: info.Data.Options.Version}
+	if mount.path != "" {
+		v.kvVersions[mount.path] = mount
+	}
+	return mount
+}
+
+// renewToken keeps a renewable Vault token alive, renewing it when half of
+// its TTL is left. Tokens that can't be renewed are left alone.
+func (v *vaultClient) renewToken() {
+	var lookup struct {
+		Data struct {
+			TTL       int64 `json:"ttl"`
+			Renewable bool  `json:"renewable"`
+		} `json:"data"`
+	}
+	if err := v.do("GET", "auth/token/lookup-self", nil, &lookup); err != nil {
+		log.Printf("Error looking up Vault token: %v", err)
+		return
+	}
+	if !lookup.Data.Renewable || lookup.Data.TTL <= 0 {
+		return
+	}
+
+	ttl := time.Duration(lookup.Data.TTL) * time.Second
+	for {
+		time.Sleep(ttl / 2)
+
+		var renewal struct {
+			Auth struct {
+				LeaseDuration int64 `json:"lease_duration"`
+			} `json:"auth"`
+		}
+		if err := v.do("POST", "auth/token/renew-self", map[string]string{}, &renewal); err != nil {
+			log.Printf("Error renewing Vault token: %v", err)
+			// Retry well before the token expires
+			ttl = time.Minute
+			continue
+		}
+		ttl = time.Duration(renewal.Auth.LeaseDuration) * time.Second
+		if ttl <= 0 {
+			return
+		}
+		log.Printf("Renewed Vault token for %s", ttl)
+	}
+}
+
+// do calls the Vault API at path and decodes the JSON response into out
+func (v *vaultClient) do(method, path string, body, out interface{}) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return fmt.Errorf("error marshaling request: %w", err)
+		}
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(v.cfg.Address, "/")+"/v1/"+path, &payload)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.cfg.Token)
+	if v.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.cfg.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Vault returned status: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
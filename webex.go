@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// WebexConfig configures the Webex destination
+type WebexConfig struct {
+	BotToken string `yaml:"bot_token"`
+	RoomID   string `yaml:"room_id"`
+}
+
+type webexDestination struct {
+	destinationID
+	httpSender
+	cfg WebexConfig
+}
+
+func (d *webexDestination) Name() string {
+	return "webex"
+}
+
+func (d *webexDestination) pingAddress() string {
+	return webexMessagesURL
+}
+
+func (d *webexDestination) Send(build BuildEvent) error {
+	return d.sendToWebex(d.convertToWebexMessage(build))
+}
+
+const webexMessagesURL = "https://webexapis.com/v1/messages"
+
+// Webex create-message payload
+type WebexMessage struct {
+	RoomID   string `json:"roomId"`
+	Markdown string `json:"markdown"`
+	Text     string `json:"text,omitempty"`
+}
+
+func (d *webexDestination) convertToWebexMessage(build BuildEvent) WebexMessage {
+	title := fmt.Sprintf("%s - %s", build.ProjectName, build.BuildName)
+	if build.BuildURL != "" {
+		title = fmt.Sprintf("[%s](%s)", title, build.BuildURL)
+	}
+
+	lines := []string{
+		fmt.Sprintf("**%s**", title),
+		"**Status**: " + build.StatusText(),
+	}
+	if build.Duration > 0 {
+		lines = append(lines, "**Duration**: "+formatDuration(build.Duration))
+	}
+	// Webex renders the same markdown as Discord
+	if buildVarsFormatted := formatBuildVars(build.Vars); buildVarsFormatted != "" {
+		lines = append(lines, buildVarsFormatted)
+	}
+
+	return WebexMessage{
+		RoomID: d.cfg.RoomID,
+		// Webex joins single newlines, so separate lines with a forced break
+		Markdown: strings.Join(lines, "  \n"),
+		Text:     fmt.Sprintf("%s - %s: %s", build.ProjectName, build.BuildName, build.StatusText()),
+	}
+}
+
+func (d *webexDestination) sendToWebex(message WebexMessage) error {
+	headers := map[string]string{"Authorization": "Bearer " + d.cfg.BotToken}
+	if err := d.postJSON(webexMessagesURL, message, headers); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully sent message to Webex")
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWebexSend(t *testing.T) {
+	server := newRecordingServer(t, http.StatusOK, `{"id":"1"}`)
+	d := &webexDestination{httpSender: server.sender(), cfg: WebexConfig{BotToken: "token", RoomID: "room"}}
+	build := testBuild("app", "failure")
+	build.BuildURL = "https://ci.example.com/job/app/1/"
+
+	if err := d.Send(build); err != nil {
+		t.Fatal(err)
+	}
+	request := server.only(t)
+	if request.Path != "/v1/messages" || request.Header.Get("Authorization") != "Bearer token" {
+		t.Errorf("request to %s with %q, want the bot's message to /v1/messages", request.Path, request.Header.Get("Authorization"))
+	}
+	var message WebexMessage
+	request.decode(t, &message)
+	if message.RoomID != "room" || message.Text != "app - #0: "+build.StatusText() {
+		t.Errorf("message = %+v, want the build's summary in the room", message)
+	}
+	lines := strings.Split(message.Markdown, "  \n")
+	if len(lines) < 3 || lines[0] != "**[app - #0](https://ci.example.com/job/app/1/)**" || lines[2] != "**Duration**: 1m 30s" {
+		t.Errorf("markdown lines = %q, want the linked title, status and duration on lines of their own", lines)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WoodpeckerConfig configures the Woodpecker CI source. When Token is set,
+// requests must send it as "Authorization: Bearer <token>".
+type WoodpeckerConfig struct {
+	Token string `yaml:"token"`
+}
+
+// WoodpeckerWebhook is the pipeline metadata sent by the Woodpecker webhook
+// plugin, which posts it as JSON when no body template is configured
+type WoodpeckerWebhook struct {
+	Repo *struct {
+		Name     string `json:"name"`
+		Owner    string `json:"owner"`
+		ForgeURL string `json:"forge_url"`
+	} `json:"repo,omitempty"`
+	Curr *WoodpeckerPipeline `json:"curr,omitempty"`
+}
+
+type WoodpeckerPipeline struct {
+	Number   int64  `json:"number"`
+	Status   string `json:"status"`
+	Event    string `json:"event"`
+	ForgeURL string `json:"forge_url"`
+	Started  int64  `json:"started"`
+	Finished int64  `json:"finished"`
+	Commit   struct {
+		SHA     string `json:"sha"`
+		Branch  string `json:"branch"`
+		Message string `json:"message"`
+		Author  struct {
+			Name string `json:"name"`
+		} `json:"author"`
+	} `json:"commit"`
+}
+
+type woodpeckerSource struct {
+	cfg WoodpeckerConfig
+}
+
+func (s woodpeckerSource) Name() string {
+	return "woodpecker"
+}
+
+func (s woodpeckerSource) Detect(header http.Header, body []byte) bool {
+	return jsonHasKeys(body, "repo", "curr")
+}
+
+func (s woodpeckerSource) Verify(req *http.Request, body []byte) error {
+	if !s.cfg.verifyToken(req.Header.Get("Authorization")) {
+		return errInvalidToken
+	}
+	return nil
+}
+
+func (s woodpeckerSource) Parse(header http.Header, body []byte) ([]BuildEvent, error) {
+	var payload WoodpeckerWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return singleBuild(payload.toBuildEvent()), nil
+}
+
+// verifyToken checks the bearer token in the Authorization header
+func (c WoodpeckerConfig) verifyToken(header string) bool {
+	return verifyBearerToken(header, c.Token)
+}
+
+// toBuildEvent converts Woodpecker pipeline metadata into a BuildEvent. The
+// metadata has no pipeline link, so the build links to the commit on the forge.
+func (p WoodpeckerWebhook) toBuildEvent() (BuildEvent, bool) {
+	if p.Repo == nil || p.Curr == nil {
+		return BuildEvent{}, false
+	}
+	curr := p.Curr
+
+	build := BuildEvent{
+		Source:      "woodpecker",
+		ProjectName: p.Repo.Owner + "/" + p.Repo.Name,
+		BuildName:   "#" + strconv.FormatInt(curr.Number, 10),
+		BuildURL:    curr.ForgeURL,
+		Payload:     p,
+	}
+
+	switch curr.Status {
+	case "pending", "running":
+		build.Event = "started"
+	case "success":
+		build.Event = "success"
+	case "failure", "error":
+		build.Event = "failure"
+	case "killed", "declined":
+		build.Event = "aborted"
+	default:
+		return BuildEvent{}, false
+	}
+	if build.Event != "started" && curr.Started > 0 && curr.Finished > curr.Started {
+		build.Duration = time.Duration(curr.Finished-curr.Started) * time.Second
+	}
+
+	commit := curr.Commit
+	if commit.Branch != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Branch", Value: commit.Branch})
+	}
+	if len(commit.SHA) >= 8 {
+		build.Vars = append(build.Vars, BuildVar{Key: "Commit", Value: commit.SHA[:8]})
+	}
+	if commit.Author.Name != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Author", Value: commit.Author.Name})
+	}
+	if curr.Event != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Trigger", Value: curr.Event})
+	}
+	if message, _, _ := strings.Cut(strings.TrimSpace(commit.Message), "\n"); message != "" {
+		build.Vars = append(build.Vars, BuildVar{Key: "Message", Value: message})
+	}
+
+	return build, true
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWoodpeckerParse(t *testing.T) {
+	payload := func(status string) string {
+		return `{"repo": {"name": "app", "owner": "team", "forge_url": "https://git.example.com/team/app"},
+		  "curr": {"number": 31, "status": "` + status + `", "event": "push", "forge_url": "https://git.example.com/team/app/commit/0123456789abcdef",
+		  "started": 1700000000, "finished": 1700000095,
+		  "commit": {"sha": "0123456789abcdef", "branch": "main", "message": "Fix the login\n\nLonger description", "author": {"name": "Ana"}}}}`
+	}
+	commitURL := "https://git.example.com/team/app/commit/0123456789abcdef"
+	tests := []struct {
+		name         string
+		body         string
+		want         []buildSummary
+		wantDuration time.Duration
+	}{
+		{"running", payload("running"), []buildSummary{{"team/app", "#31", commitURL, "started"}}, 0},
+		{"succeeded", payload("success"), []buildSummary{{"team/app", "#31", commitURL, "success"}}, 95 * time.Second},
+		{"errored", payload("error"), []buildSummary{{"team/app", "#31", commitURL, "failure"}}, 95 * time.Second},
+		{"killed", payload("killed"), []buildSummary{{"team/app", "#31", commitURL, "aborted"}}, 95 * time.Second},
+		{"skipped", payload("skipped"), nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name := detectSource(t, http.Header{}, tt.body); name != "woodpecker" {
+				t.Errorf("detected as %q, want woodpecker", name)
+			}
+			builds := parseBuilds(t, woodpeckerSource{}, http.Header{}, tt.body)
+			if got := summarize(builds); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("builds = %+v, want %+v", got, tt.want)
+			}
+			if len(builds) > 0 && builds[0].Duration != tt.wantDuration {
+				t.Errorf("duration = %v, want %v", builds[0].Duration, tt.wantDuration)
+			}
+		})
+	}
+
+	builds := parseBuilds(t, woodpeckerSource{}, http.Header{}, payload("failure"))
+	want := []BuildVar{
+		{Key: "Branch", Value: "main"},
+		{Key: "Commit", Value: "01234567"},
+		{Key: "Author", Value: "Ana"},
+		{Key: "Trigger", Value: "push"},
+		{Key: "Message", Value: "Fix the login"},
+	}
+	if !reflect.DeepEqual(builds[0].Vars, want) {
+		t.Errorf("vars = %+v, want %+v", builds[0].Vars, want)
+	}
+}
+
+func TestWoodpeckerVerify(t *testing.T) {
+	src := woodpeckerSource{cfg: WoodpeckerConfig{Token: "secret"}}
+	for auth, ok := range map[string]bool{"Bearer secret": true, "Bearer other": false, "": false} {
+		req, _ := http.NewRequest(http.MethodPost, "/webhook/woodpecker", nil)
+		req.Header.Set("Authorization", auth)
+		if err := src.Verify(req, nil); (err == nil) != ok {
+			t.Errorf("Verify() with %q = %v, want ok %v", auth, err, ok)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultDeliveryWorkers = 4
+	// defaultDeliveryQueueSize is how many events may wait for the
+	// delivery workers, across all of them
+	defaultDeliveryQueueSize = 1000
+)
+
+// DeliveryConfig decouples receiving webhooks from delivering them. A
+// webhook is answered with 202 as soon as it is verified and parsed, and
+// Workers workers fetch the build details and notify the destinations.
+// QueueSize bounds the events waiting for them. Workers of -1 delivers the
+// events before answering instead.
+type DeliveryConfig struct {
+	Workers   int `yaml:"workers"`
+	QueueSize int `yaml:"queue_size"`
+}
+
+func (c *DeliveryConfig) compile() error {
+	if c.Workers < -1 {
+		return fmt.Errorf("invalid DELIVERY_WORKERS value: %d", c.Workers)
+	}
+	if c.Workers == 0 {
+		c.Workers = defaultDeliveryWorkers
+	}
+	if c.QueueSize < 0 {
+		return fmt.Errorf("invalid DELIVERY_QUEUE_SIZE value: %d", c.QueueSize)
+	}
+	if c.QueueSize == 0 {
+		c.QueueSize = defaultDeliveryQueueSize
+	}
+	return nil
+}
+
+// deliveryJob is an event waiting for a worker, with the state of the
+// request it came with
+type deliveryJob struct {
+	state *handlerState
+	build BuildEvent
+}
+
+// deliveryWorkers is the pool of delivery workers. Each has its own queue
+// and the events of a job always go to the same one, so they are delivered
+// in the order they came in, which tracking started builds and editing
+// their messages rely on.
+type deliveryWorkers struct {
+	queues []chan deliveryJob
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newDeliveryWorkers(cfg DeliveryConfig, process func(*handlerState, BuildEvent) ([]deliveryResult, string)) *deliveryWorkers {
+	size := cfg.QueueSize / cfg.Workers
+	if size < 1 {
+		size = 1
+	}
+	p := &deliveryWorkers{queues: make([]chan deliveryJob, cfg.Workers)}
+	for i := range p.queues {
+		queue := make(chan deliveryJob, size)
+		p.queues[i] = queue
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range queue {
+				results, _ := process(job.state, job.build)
+				for _, r := range results {
+					if r.Status == "error" || r.Status == "retrying" {
+						log.Printf("Error sending %s %s to %s: %s", job.build.ProjectName, job.build.BuildName, r.Destination, r.Error)
+					}
+				}
+			}
+		}()
+	}
+	return p
+}
+
+// count is the number of workers, if there are any
+func (p *deliveryWorkers) count() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.queues)
+}
+
+// add hands the event to the worker of its job, reporting false when that
+// worker's queue is full
+func (p *deliveryWorkers) add(state *handlerState, build BuildEvent) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(build.Source + "/" + build.ProjectName))
+	select {
+	case p.queues[h.Sum32()%uint32(len(p.queues))] <- deliveryJob{state: state, build: build}:
+		return true
+	default:
+		return false
+	}
+}
+
+// drain stops taking events and waits for the workers to deliver the ones
+// waiting for them, or for ctx to be done
+func (p *deliveryWorkers) drain(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.closed = true
+	waiting := 0
+	for _, queue := range p.queues {
+		waiting += len(queue)
+		close(queue)
+	}
+	p.mu.Unlock()
+	if waiting > 0 {
+		log.Printf("Delivering %d waiting events", waiting)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		left := 0
+		for _, queue := range p.queues {
+			left += len(queue)
+		}
+		log.Printf("Shutdown timed out, %d waiting events weren't delivered", left)
+	}
+}
+
+// submit hands the events to the delivery workers and answers with 202, or
+// with 503 when none of them could be queued, so the sender tries again
+func (w *WebhookHandler) submit(c echo.Context, state *handlerState, builds []BuildEvent) error {
+	dropped := 0
+	for _, build := range builds {
+		if !w.workers.add(state, build) {
+			log.Printf("Dropped %s notification for %s: delivery queue is full", build.SourceName(), build.ProjectName)
+			dropped++
+		}
+	}
+
+	audit := auditRequest(c)
+	if dropped == len(builds) {
+		audit.Outcome = "overloaded"
+		c.Response().Header().Set("Retry-After", "60")
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Delivery queue is full"})
+	}
+	audit.Outcome = "accepted"
+	return c.JSON(http.StatusAccepted, map[string]string{"status": "accepted"})
+}
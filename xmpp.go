@@ -0,0 +1,335 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// XMPPConfig configures the XMPP destination
+type XMPPConfig struct {
+	JID      string   `yaml:"jid"`
+	Password string   `yaml:"password"`
+	Server   string   `yaml:"server"` // host:port, defaults to the JID domain on 5222
+	Room     string   `yaml:"room"`
+	Nick     string   `yaml:"nick"`
+	To       []string `yaml:"to"`
+}
+
+type xmppDestination struct {
+	destinationID
+	cfg XMPPConfig
+}
+
+func (d *xmppDestination) Name() string {
+	return "xmpp"
+}
+
+func (d *xmppDestination) pingAddress() string {
+	if d.cfg.Server != "" {
+		return "tcp://" + d.cfg.Server
+	}
+	_, domain, _ := splitJID(d.cfg.JID)
+	return "tcp://" + net.JoinHostPort(domain, "5222")
+}
+
+func (d *xmppDestination) Send(build BuildEvent) error {
+	return d.sendToXMPP(d.convertToXMPPMessage(build))
+}
+
+// XMPP namespaces used during the handshake
+const (
+	xmppNSStream  = "http://etherx.jabber.org/streams"
+	xmppNSTLS     = "urn:ietf:params:xml:ns:xmpp-tls"
+	xmppNSSASL    = "urn:ietf:params:xml:ns:xmpp-sasl"
+	xmppNSBind    = "urn:ietf:params:xml:ns:xmpp-bind"
+	xmppNSSession = "urn:ietf:params:xml:ns:xmpp-session"
+	xmppNSMUC     = "http://jabber.org/protocol/muc"
+)
+
+type xmppFeatures struct {
+	StartTLS   *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-tls starttls"`
+	Mechanisms []string  `xml:"urn:ietf:params:xml:ns:xmpp-sasl mechanisms>mechanism"`
+	Bind       *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+	Session    *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-session session"`
+}
+
+// xmppStanza captures just enough of any top-level element to react to it
+type xmppStanza struct {
+	XMLName xml.Name
+	Type    string `xml:"type,attr"`
+	ID      string `xml:"id,attr"`
+	From    string `xml:"from,attr"`
+	Inner   string `xml:",innerxml"`
+}
+
+// xmppConn is a short-lived client stream used to deliver one message
+type xmppConn struct {
+	conn    net.Conn
+	decoder *xml.Decoder
+	domain  string
+}
+
+func (d *xmppDestination) convertToXMPPMessage(build BuildEvent) string {
+	lines := []string{
+		fmt.Sprintf("%s - %s: %s", build.ProjectName, build.BuildName, build.StatusText()),
+	}
+	if build.Duration > 0 {
+		lines = append(lines, "Duration: "+formatDuration(build.Duration))
+	}
+	for _, v := range build.Vars {
+		lines = append(lines, fmt.Sprintf("%s: %s", v.Key, v.Value))
+	}
+	if build.BuildURL != "" {
+		lines = append(lines, build.BuildURL)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *xmppConn) send(format string, args ...interface{}) error {
+	_, err := fmt.Fprintf(c.conn, format, args...)
+	return err
+}
+
+// openStream (re)starts the XML stream and returns the advertised features
+func (c *xmppConn) openStream() (*xmppFeatures, error) {
+	c.decoder = xml.NewDecoder(c.conn)
+	if err := c.send("<?xml version='1.0'?><stream:stream to='%s' xmlns='jabber:client' xmlns:stream='%s' version='1.0'>",
+		xmlEscape(c.domain), xmppNSStream); err != nil {
+		return nil, err
+	}
+
+	// Skip to the server's stream header
+	for {
+		tok, err := c.decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("error reading stream header: %w", err)
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Space == xmppNSStream && se.Name.Local == "stream" {
+			break
+		}
+	}
+
+	se, err := c.nextElement()
+	if err != nil {
+		return nil, err
+	}
+	if se.Name.Space != xmppNSStream || se.Name.Local != "features" {
+		return nil, fmt.Errorf("expected stream features, got <%s>", se.Name.Local)
+	}
+
+	var features xmppFeatures
+	if err := c.decoder.DecodeElement(&features, &se); err != nil {
+		return nil, fmt.Errorf("error reading stream features: %w", err)
+	}
+	return &features, nil
+}
+
+// nextElement returns the start of the next top-level element
+func (c *xmppConn) nextElement() (xml.StartElement, error) {
+	for {
+		tok, err := c.decoder.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return t, nil
+		case xml.EndElement:
+			if t.Name.Local == "stream" {
+				return xml.StartElement{}, io.EOF
+			}
+		}
+	}
+}
+
+// nextStanza decodes the next top-level element
+func (c *xmppConn) nextStanza() (*xmppStanza, error) {
+	se, err := c.nextElement()
+	if err != nil {
+		return nil, err
+	}
+	var stanza xmppStanza
+	if err := c.decoder.DecodeElement(&stanza, &se); err != nil {
+		return nil, err
+	}
+	if stanza.XMLName.Space == xmppNSStream && stanza.XMLName.Local == "error" {
+		return nil, fmt.Errorf("stream error: %s", stanza.Inner)
+	}
+	return &stanza, nil
+}
+
+// waitFor returns the first stanza accepted by match
+func (c *xmppConn) waitFor(match func(*xmppStanza) bool) (*xmppStanza, error) {
+	for {
+		stanza, err := c.nextStanza()
+		if err != nil {
+			return nil, err
+		}
+		if match(stanza) {
+			return stanza, nil
+		}
+	}
+}
+
+func (d *xmppDestination) sendToXMPP(body string) error {
+	user, domain, resource := splitJID(d.cfg.JID)
+	if resource == "" {
+		resource = "jenkins-webhook"
+	}
+
+	server := d.cfg.Server
+	if server == "" {
+		server = net.JoinHostPort(domain, "5222")
+	}
+
+	conn, err := net.DialTimeout("tcp", server, 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %w", server, err)
+	}
+	defer func() { conn.Close() }()
+
+	// Bound the whole exchange so a silent server cannot hang the request
+	deadline := time.Now().Add(60 * time.Second)
+	conn.SetDeadline(deadline)
+	c := &xmppConn{conn: conn, domain: domain}
+
+	features, err := c.openStream()
+	if err != nil {
+		return err
+	}
+
+	// Never send credentials over an unencrypted stream
+	if features.StartTLS == nil {
+		return fmt.Errorf("server %s does not offer STARTTLS", server)
+	}
+	if err := c.send("<starttls xmlns='%s'/>", xmppNSTLS); err != nil {
+		return err
+	}
+	if stanza, err := c.nextStanza(); err != nil {
+		return fmt.Errorf("error starting TLS: %w", err)
+	} else if stanza.XMLName.Local != "proceed" {
+		return fmt.Errorf("server refused STARTTLS")
+	}
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: domain})
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("error starting TLS: %w", err)
+	}
+	tlsConn.SetDeadline(deadline)
+	conn = tlsConn
+	c.conn = tlsConn
+
+	if features, err = c.openStream(); err != nil {
+		return err
+	}
+	if !containsString(features.Mechanisms, "PLAIN") {
+		return fmt.Errorf("server does not support SASL PLAIN (offers %s)", strings.Join(features.Mechanisms, ", "))
+	}
+	token := base64.StdEncoding.EncodeToString([]byte("\x00" + user + "\x00" + d.cfg.Password))
+	if err := c.send("<auth xmlns='%s' mechanism='PLAIN'>%s</auth>", xmppNSSASL, token); err != nil {
+		return err
+	}
+	if stanza, err := c.nextStanza(); err != nil {
+		return fmt.Errorf("error authenticating: %w", err)
+	} else if stanza.XMLName.Local != "success" {
+		return fmt.Errorf("authentication failed: %s", stanza.Inner)
+	}
+
+	if features, err = c.openStream(); err != nil {
+		return err
+	}
+	if err := c.send("<iq type='set' id='bind1'><bind xmlns='%s'><resource>%s</resource></bind></iq>",
+		xmppNSBind, xmlEscape(resource)); err != nil {
+		return err
+	}
+	if err := c.expectResult("bind1"); err != nil {
+		return fmt.Errorf("error binding resource: %w", err)
+	}
+	if features.Session != nil {
+		if err := c.send("<iq type='set' id='sess1'><session xmlns='%s'/></iq>", xmppNSSession); err != nil {
+			return err
+		}
+		if err := c.expectResult("sess1"); err != nil {
+			return fmt.Errorf("error starting session: %w", err)
+		}
+	}
+
+	if room := d.cfg.Room; room != "" {
+		occupant := room + "/" + d.cfg.Nick
+		if err := c.send("<presence to='%s'><x xmlns='%s'><history maxstanzas='0'/></x></presence>",
+			xmlEscape(occupant), xmppNSMUC); err != nil {
+			return err
+		}
+		// The room echoes our own presence once we have joined
+		stanza, err := c.waitFor(func(s *xmppStanza) bool {
+			return s.XMLName.Local == "presence" && s.From == occupant
+		})
+		if err != nil {
+			return fmt.Errorf("error joining %s: %w", room, err)
+		}
+		if stanza.Type == "error" {
+			return fmt.Errorf("error joining %s: %s", room, stanza.Inner)
+		}
+		if err := c.send("<message to='%s' type='groupchat'><body>%s</body></message>", xmlEscape(room), xmlEscape(body)); err != nil {
+			return err
+		}
+	}
+
+	for _, to := range d.cfg.To {
+		if err := c.send("<message to='%s' type='chat'><body>%s</body></message>", xmlEscape(to), xmlEscape(body)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.send("</stream:stream>"); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully sent message over XMPP")
+	return nil
+}
+
+// expectResult waits for the reply to the iq with the given id
+func (c *xmppConn) expectResult(id string) error {
+	stanza, err := c.waitFor(func(s *xmppStanza) bool {
+		return s.XMLName.Local == "iq" && s.ID == id
+	})
+	if err != nil {
+		return err
+	}
+	if stanza.Type != "result" {
+		return fmt.Errorf("server replied %s: %s", stanza.Type, stanza.Inner)
+	}
+	return nil
+}
+
+// splitJID splits user@domain/resource into its parts
+func splitJID(jid string) (user, domain, resource string) {
+	bare, resource, _ := strings.Cut(jid, "/")
+	user, domain, found := strings.Cut(bare, "@")
+	if !found {
+		return "", user, resource
+	}
+	return user, domain, resource
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func containsString(items []string, want string) bool {
+	for _, item := range items {
+		if item == want {
+			return true
+		}
+	}
+	return false
+}
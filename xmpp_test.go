@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestXMPPRequiresStartTLS(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Only PLAIN over the unencrypted stream
+		io.WriteString(conn, "<?xml version='1.0'?><stream:stream from='example.com' id='1' xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>"+
+			"<stream:features><mechanisms xmlns='urn:ietf:params:xml:ns:xmpp-sasl'><mechanism>PLAIN</mechanism></mechanisms></stream:features>")
+		data, _ := io.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	d := &xmppDestination{cfg: XMPPConfig{JID: "ci@example.com", Password: "secret", Server: listener.Addr().String(), To: []string{"dev@example.com"}}}
+	err = d.Send(testBuild("app", "failure"))
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("error = %v, want STARTTLS required", err)
+	}
+	if data := <-received; strings.Contains(data, "<auth") || strings.Contains(data, "<message") {
+		t.Errorf("client sent %q over the unencrypted stream", data)
+	}
+}
+
+func TestSplitJID(t *testing.T) {
+	tests := []struct {
+		jid, user, domain, resource string
+	}{
+		{"ci@example.com/bridge", "ci", "example.com", "bridge"},
+		{"ci@example.com", "ci", "example.com", ""},
+		{"example.com", "", "example.com", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.jid, func(t *testing.T) {
+			user, domain, resource := splitJID(tt.jid)
+			if user != tt.user || domain != tt.domain || resource != tt.resource {
+				t.Errorf("splitJID(%q) = %q, %q, %q, want %q, %q, %q", tt.jid, user, domain, resource, tt.user, tt.domain, tt.resource)
+			}
+		})
+	}
+}
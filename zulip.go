@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ZulipConfig configures the Zulip destination
+type ZulipConfig struct {
+	Site     string `yaml:"site"`
+	BotEmail string `yaml:"bot_email"`
+	APIKey   string `yaml:"api_key"`
+	Stream   string `yaml:"stream"`
+	Topic    string `yaml:"topic"`
+}
+
+type zulipDestination struct {
+	destinationID
+	httpSender
+	cfg ZulipConfig
+}
+
+func (d *zulipDestination) Name() string {
+	return "zulip"
+}
+
+func (d *zulipDestination) pingAddress() string {
+	return d.cfg.Site
+}
+
+func (d *zulipDestination) Send(build BuildEvent) error {
+	return d.sendToZulip(d.convertToZulipMessage(build))
+}
+
+// ZulipMessage is a stream message for the Zulip send-message API
+type ZulipMessage struct {
+	Stream  string
+	Topic   string
+	Content string
+}
+
+// zulipMaxTopicLength is the longest topic name Zulip accepts
+const zulipMaxTopicLength = 60
+
+func (d *zulipDestination) convertToZulipMessage(build BuildEvent) ZulipMessage {
+	// Each job gets its own conversation thread unless a fixed topic is set
+	topic := d.cfg.Topic
+	if topic == "" {
+		topic = build.ProjectName
+	}
+	if len(topic) > zulipMaxTopicLength {
+		topic = topic[:zulipMaxTopicLength-3] + "..."
+	}
+
+	title := build.BuildName
+	if build.BuildURL != "" {
+		title = fmt.Sprintf("[%s](%s)", build.BuildName, build.BuildURL)
+	}
+
+	lines := []string{fmt.Sprintf("**%s** %s", title, build.StatusText())}
+	if build.Duration > 0 {
+		lines = append(lines, "**Duration**: "+formatDuration(build.Duration))
+	}
+	// Zulip renders the same markdown as Discord
+	if buildVarsFormatted := formatBuildVars(build.Vars); buildVarsFormatted != "" {
+		lines = append(lines, buildVarsFormatted)
+	}
+
+	return ZulipMessage{
+		Stream:  d.cfg.Stream,
+		Topic:   topic,
+		Content: strings.Join(lines, "\n"),
+	}
+}
+
+func (d *zulipDestination) sendToZulip(message ZulipMessage) error {
+	form := url.Values{
+		"type":    {"stream"},
+		"to":      {message.Stream},
+		"topic":   {message.Topic},
+		"content": {message.Content},
+	}
+
+	endpoint := strings.TrimRight(d.cfg.Site, "/") + "/api/v1/messages"
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(d.cfg.BotEmail, d.cfg.APIKey)
+
+	if err := d.sendRequest(req); err != nil {
+		return err
+	}
+
+	log.Printf("Successfully sent message to Zulip stream %s > %s", message.Stream, message.Topic)
+	return nil
+}
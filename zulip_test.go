@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestZulipSend(t *testing.T) {
+	long := strings.Repeat("a", 70)
+	tests := []struct {
+		name, project, topic, want string
+	}{
+		{"topic per job", "app", "", "app"},
+		{"fixed topic", "app", "builds", "builds"},
+		{"long job name", long, "", long[:zulipMaxTopicLength-3] + "..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRecordingServer(t, http.StatusOK, `{"result":"success"}`)
+			d := &zulipDestination{httpSender: server.sender(), cfg: ZulipConfig{
+				Site: "https://zulip.example.com/", BotEmail: "ci-bot@example.com", APIKey: "key",
+				Stream: "ci", Topic: tt.topic,
+			}}
+			build := testBuild(tt.project, "success")
+			build.BuildURL = "https://ci.example.com/job/app/1/"
+
+			if err := d.Send(build); err != nil {
+				t.Fatal(err)
+			}
+			request := server.only(t)
+			if request.Path != "/api/v1/messages" {
+				t.Errorf("path = %s, want /api/v1/messages", request.Path)
+			}
+			if user, key, _ := (&http.Request{Header: request.Header}).BasicAuth(); user != "ci-bot@example.com" || key != "key" {
+				t.Errorf("basic auth = %q:%q, want the bot's", user, key)
+			}
+			form, _ := url.ParseQuery(string(request.Body))
+			if form.Get("type") != "stream" || form.Get("to") != "ci" || form.Get("topic") != tt.want {
+				t.Errorf("form = %v, want a message to ci > %s", form, tt.want)
+			}
+			if content := form.Get("content"); !strings.HasPrefix(content, "**[#0](https://ci.example.com/job/app/1/)** ") {
+				t.Errorf("content = %q, want it to open with the linked build", content)
+			}
+		})
+	}
+}